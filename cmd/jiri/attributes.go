@@ -0,0 +1,140 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var attributesFlags struct {
+	enable  string
+	disable string
+}
+
+var cmdAttributes = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runAttributes),
+	Name:   "attributes",
+	Short:  "List or select the attributes of optional projects and packages",
+	Long: `
+Projects and packages in manifests can be tagged with a comma-separated list
+of attributes, e.g. attributes="tools,optional".  Tagged projects and packages
+are optional: "jiri update" only fetches them if one of their attributes was
+selected with "jiri init -fetch-optional" or with this command.
+
+Without flags, lists every attribute used by the manifest, followed by the
+projects and packages that it pulls in.  Selected attributes are marked with
+'*'.  With <attribute> arguments, only these attributes are listed.
+`,
+	ArgsName: "[<attribute>...]",
+	ArgsLong: "<attribute>... is the list of attributes to show.",
+}
+
+func init() {
+	cmdAttributes.Flags.StringVar(&attributesFlags.enable, "enable", "", "Comma-separated list of attributes to add to the selected ones.")
+	cmdAttributes.Flags.StringVar(&attributesFlags.disable, "disable", "", "Comma-separated list of attributes to remove from the selected ones.")
+}
+
+func splitAttributes(attrs string) []string {
+	var ret []string
+	for _, attr := range strings.Split(strings.TrimPrefix(attrs, "+"), ",") {
+		if attr = strings.TrimSpace(attr); attr != "" {
+			ret = append(ret, attr)
+		}
+	}
+	return ret
+}
+
+func runAttributes(jirix *jiri.X, args []string) error {
+	if attributesFlags.enable != "" || attributesFlags.disable != "" {
+		if len(args) != 0 {
+			return jirix.UsageErrorf("-enable and -disable do not take arguments")
+		}
+		return selectAttributes(jirix)
+	}
+
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	projects, _, pkgs, err := project.LoadManifestFile(jirix, jirix.JiriManifestFile(), localProjects, false /*localManifest*/)
+	if err != nil {
+		return err
+	}
+	members := make(map[string][]string)
+	for _, p := range projects {
+		for attr := range p.ComputedAttributes {
+			members[attr] = append(members[attr], p.Name)
+		}
+	}
+	for _, pkg := range pkgs {
+		for attr := range pkg.ComputedAttributes {
+			members[attr] = append(members[attr], pkg.Name+" (package)")
+		}
+	}
+
+	var attrs []string
+	if len(args) != 0 {
+		for _, attr := range args {
+			if _, ok := members[attr]; !ok {
+				return fmt.Errorf("attribute %q is not used by any project or package", attr)
+			}
+		}
+		attrs = args
+	} else {
+		for attr := range members {
+			attrs = append(attrs, attr)
+		}
+		sort.Strings(attrs)
+	}
+	selected := make(map[string]bool)
+	for _, attr := range splitAttributes(jirix.FetchingAttrs) {
+		selected[attr] = true
+	}
+	for _, attr := range attrs {
+		marker := " "
+		if selected[attr] {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, attr)
+		names := members[attr]
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("    %s\n", name)
+		}
+	}
+	return nil
+}
+
+func selectAttributes(jirix *jiri.X) error {
+	disabled := make(map[string]bool)
+	for _, attr := range splitAttributes(attributesFlags.disable) {
+		disabled[attr] = true
+	}
+	var attrs []string
+	seen := make(map[string]bool)
+	for _, attr := range append(splitAttributes(jirix.FetchingAttrs), splitAttributes(attributesFlags.enable)...) {
+		if !disabled[attr] && !seen[attr] {
+			seen[attr] = true
+			attrs = append(attrs, attr)
+		}
+	}
+	fetchingAttrs := strings.Join(attrs, ",")
+	if err := updateConfig(jirix, func(config *jiri.Config) { config.FetchingAttrs = fetchingAttrs }); err != nil {
+		return err
+	}
+	jirix.FetchingAttrs = fetchingAttrs
+	if fetchingAttrs == "" {
+		jirix.Logger.Infof("No attributes are selected, optional projects and packages will not be fetched.\n")
+	} else {
+		jirix.Logger.Infof("Selected attributes: %s\nRun 'jiri update' to sync the workspace.\n", fetchingAttrs)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
+)
+
+func setDefaultAttributesFlags() {
+	attributesFlags.enable = ""
+	attributesFlags.disable = ""
+}
+
+func TestAttributes(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+	setDefaultAttributesFlags()
+
+	for name, attrs := range map[string]string{"p1": "", "p2": "tools", "p3": "tools,optional"} {
+		if err := fake.CreateRemoteProject(name); err != nil {
+			t.Fatal(err)
+		}
+		p := project.Project{
+			Name:       name,
+			Path:       filepath.Join(fake.X.Root, name),
+			Remote:     fake.Projects[name],
+			Attributes: attrs,
+		}
+		if err := fake.AddProject(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	attributesFlags.enable = "tools,optional"
+	if err := runAttributes(fake.X, nil); err != nil {
+		t.Fatal(err)
+	}
+	attributesFlags.enable = ""
+	attributesFlags.disable = "optional"
+	if err := runAttributes(fake.X, nil); err != nil {
+		t.Fatal(err)
+	}
+	config, err := jiri.ConfigFromFile(filepath.Join(fake.X.RootMetaDir(), jiri.ConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := config.FetchingAttrs, "tools"; got != want {
+		t.Errorf("got fetching attributes %q, want %q", got, want)
+	}
+	setDefaultAttributesFlags()
+
+	stdout, _, err := runfunc(func() {
+		if err := runAttributes(fake.X, nil); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "  optional\n    p3\n* tools\n    p2\n    p3"
+	if got := strings.TrimRight(stdout, "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/project"
+)
+
+// bisectSkipCode is the exit code of a test command which cannot test a
+// state, as for "git bisect run".
+const bisectSkipCode = 125
+
+var bisectFlags struct {
+	good        string
+	bad         string
+	importName  string
+	snapshots   string
+	runHooks    bool
+	fetchPkgs   bool
+	lockTimeout time.Duration
+}
+
+func init() {
+	cmdBisect.Flags.StringVar(&bisectFlags.good, "good", "", "Manifest revision known to be good.")
+	cmdBisect.Flags.StringVar(&bisectFlags.bad, "bad", "HEAD", "Manifest revision known to be bad.")
+	cmdBisect.Flags.StringVar(&bisectFlags.importName, "import", "", "Name of the import of .jiri_manifest to bisect. Required if there are several.")
+	cmdBisect.Flags.StringVar(&bisectFlags.snapshots, "snapshots", "", "Comma-separated snapshot files to bisect instead of manifest revisions, from good to bad.")
+	cmdBisect.Flags.BoolVar(&bisectFlags.runHooks, "run-hooks", true, "Run hooks after checking out each state.")
+	cmdBisect.Flags.BoolVar(&bisectFlags.fetchPkgs, "fetch-packages", true, "Use cipd to fetch packages for each state.")
+	cmdBisect.Flags.DurationVar(&bisectFlags.lockTimeout, "lock-timeout", project.DefaultManifestLockTimeout, "Time to wait for other jiri processes to finish modifying .jiri_manifest.")
+}
+
+var cmdBisect = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runBisect),
+	Name:   "bisect",
+	Short:  "Find the first bad manifest revision with a test command",
+	Long: `
+Binary-searches the revisions of a manifest repository imported by
+.jiri_manifest, between -good and -bad, for the first one for which the
+test command fails. For each revision tested, the import is pinned to the
+revision and all the projects are updated to the state it describes, then
+the test command is run from the current directory. The revision is good if
+the command exits with 0, bad otherwise, and skipped if it exits with 125.
+The revision is also passed to the command in $JIRI_BISECT_REVISION.
+
+With -snapshots, the given snapshot files are bisected instead, the first
+one being good and the last one bad.
+
+.jiri_manifest is locked against changes by other jiri commands, such as
+"jiri override", until it is restored when bisect is done or interrupted.
+Until then, its original content is also kept in .jiri_root/bisect_manifest,
+from which it can be restored by hand if jiri bisect is killed. The projects
+are left at the first bad state, run "jiri update" to go back.
+`,
+	ArgsName: "<command>",
+	ArgsLong: "<command> is the test command and its arguments, use -- to separate its flags from the flags of jiri bisect.",
+}
+
+// bisectState is a state of the projects which can be tested.
+type bisectState struct {
+	// name is the manifest revision or the snapshot file.
+	name     string
+	checkout func() error
+}
+
+func runBisect(jirix *jiri.X, args []string) error {
+	if len(args) == 0 {
+		return jirix.UsageErrorf("no test command given")
+	}
+	var states []bisectState
+	var err error
+	if bisectFlags.snapshots != "" {
+		states, err = bisectSnapshots(jirix, strings.Split(bisectFlags.snapshots, ","))
+	} else {
+		if bisectFlags.good == "" {
+			return jirix.UsageErrorf("-good is required")
+		}
+		var restore func() error
+		states, restore, err = bisectManifestRevisions(jirix, bisectFlags.good, bisectFlags.bad, bisectFlags.importName)
+		if restore != nil {
+			defer restoreOnSignal(jirix, restore)()
+			defer func() {
+				if err := restore(); err != nil {
+					jirix.Logger.Errorf("Could not restore %s: %v\n\n", jirix.JiriManifestFile(), err)
+				}
+			}()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	first, err := bisect(jirix, states, func(s bisectState) (bool, bool, error) {
+		return runBisectTest(jirix, s, args)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("First bad state: %s\n", states[first].name)
+	return nil
+}
+
+// bisect returns the index of the first bad state, states[0] being good and
+// the last one bad. test checks out and tests a state.
+func bisect(jirix *jiri.X, states []bisectState, test func(bisectState) (good, skip bool, err error)) (int, error) {
+	if len(states) < 2 {
+		return 0, fmt.Errorf("nothing to bisect, need a good and a bad state")
+	}
+	// candidates are the indices of the states which can still be tested.
+	candidates := make([]int, len(states))
+	for i := range candidates {
+		candidates[i] = i
+	}
+	lo, hi := 0, len(candidates)-1
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		s := states[candidates[mid]]
+		jirix.Logger.Infof("Bisecting: %d state(s) left to test, testing %s\n", hi-lo-1, s.name)
+		good, skip, err := test(s)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case skip:
+			candidates = append(candidates[:mid], candidates[mid+1:]...)
+			hi--
+		case good:
+			lo = mid
+		default:
+			hi = mid
+		}
+	}
+	first := candidates[hi]
+	if skipped := first - candidates[lo] - 1; skipped > 0 {
+		jirix.Logger.Warningf("%d skipped state(s) precede %s, the first bad state may be one of them\n\n", skipped, states[first].name)
+	}
+	// Leave the projects at the first bad state.
+	if err := states[first].checkout(); err != nil {
+		return 0, err
+	}
+	return first, nil
+}
+
+// runBisectTest checks out s and runs the test command on it.
+func runBisectTest(jirix *jiri.X, s bisectState, args []string) (bool, bool, error) {
+	if err := s.checkout(); err != nil {
+		return false, false, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), "JIRI_BISECT_REVISION="+s.name)
+	err := cmd.Run()
+	if err == nil {
+		jirix.Logger.Infof("%s is good\n", s.name)
+		return true, false, nil
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false, false, fmt.Errorf("cannot run %q: %v", strings.Join(args, " "), err)
+	}
+	if exitErr.ExitCode() == bisectSkipCode {
+		jirix.Logger.Infof("%s is skipped\n", s.name)
+		return false, true, nil
+	}
+	jirix.Logger.Infof("%s is bad\n", s.name)
+	return false, false, nil
+}
+
+// restoreOnSignal calls restore and exits if jiri is interrupted or
+// terminated, so that .jiri_manifest is not left pinned. The returned function
+// stops watching for signals.
+func restoreOnSignal(jirix *jiri.X, restore func() error) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigs:
+			jirix.Logger.Warningf("Restoring %s after %v\n\n", jirix.JiriManifestFile(), sig)
+			if err := restore(); err != nil {
+				jirix.Logger.Errorf("Could not restore %s: %v\n\n", jirix.JiriManifestFile(), err)
+			}
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+func bisectSnapshots(jirix *jiri.X, snapshots []string) ([]bisectState, error) {
+	var states []bisectState
+	for _, snapshot := range snapshots {
+		snapshot := snapshot
+		states = append(states, bisectState{
+			name: snapshot,
+			checkout: func() error {
+				return project.CheckoutSnapshot(jirix, snapshot, false /*gc*/, bisectFlags.runHooks, bisectFlags.fetchPkgs, project.DefaultHookTimeout, project.DefaultPackageTimeout)
+			},
+		})
+	}
+	return states, nil
+}
+
+// bisectRecoveryFile returns the file keeping the original .jiri_manifest
+// while it is pinned by jiri bisect.
+func bisectRecoveryFile(jirix *jiri.X) string {
+	return filepath.Join(jirix.RootMetaDir(), "bisect_manifest")
+}
+
+// bisectManifestRevisions returns the states described by the revisions of
+// the manifest repository of the import named importName, from good to bad,
+// and a function restoring .jiri_manifest, which may be called several times.
+// .jiri_manifest stays locked until it is restored, so that the changes of
+// other jiri processes are not lost.
+func bisectManifestRevisions(jirix *jiri.X, good, bad, importName string) (states []bisectState, restore func() error, e error) {
+	manifestFile := jirix.JiriManifestFile()
+	unlock, err := project.LockManifestFile(jirix, manifestFile, bisectFlags.lockTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if e != nil {
+			unlock()
+		}
+	}()
+	recoveryFile := bisectRecoveryFile(jirix)
+	if _, err := os.Stat(recoveryFile); err == nil {
+		return nil, nil, fmt.Errorf("a previous jiri bisect was interrupted, restore %s from %s and remove it first", manifestFile, recoveryFile)
+	}
+	data, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := project.ManifestFromBytes(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	index, scm, err := fetchManifestImport(jirix, m, importName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bad == "HEAD" {
+		bad = "origin/" + m.Imports[index].RemoteBranch
+	}
+	var revs []string
+	for _, ref := range []string{good, bad} {
+		rev, err := scm.CurrentRevisionForRef(ref)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unknown manifest revision %q: %v", ref, err)
+		}
+		revs = append(revs, rev)
+	}
+	between, err := scm.ExtraCommits(revs[1], revs[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := project.WriteManifestBytes(jirix, recoveryFile, data); err != nil {
+		return nil, nil, err
+	}
+
+	// mu serializes the writes of .jiri_manifest, which restore may do from
+	// a signal handler while a state is checked out.
+	var mu sync.Mutex
+	restored := false
+	pin := func(rev string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if restored {
+			return fmt.Errorf("%s was restored", manifestFile)
+		}
+		pinned := *m
+		pinned.Imports = append([]project.Import(nil), m.Imports...)
+		pinned.Imports[index].Revision = rev
+		pinnedData, err := pinned.ToBytes()
+		if err != nil {
+			return err
+		}
+		// Unlike Manifest.ToFile, this keeps the user's .jiri_manifest.bak.
+		return project.WriteManifestBytes(jirix, manifestFile, pinnedData)
+	}
+	// ExtraCommits lists the newest commits first.
+	ordered := []string{revs[0]}
+	for i := len(between) - 1; i >= 0; i-- {
+		ordered = append(ordered, between[i])
+	}
+	for _, rev := range ordered {
+		rev := rev
+		states = append(states, bisectState{
+			name: rev,
+			checkout: func() error {
+				if err := pin(rev); err != nil {
+					return err
+				}
+				return project.UpdateUniverse(jirix, false /*gc*/, false /*localManifest*/, false /*rebaseTracked*/, false /*rebaseUntracked*/, false /*rebaseAll*/, bisectFlags.runHooks, bisectFlags.fetchPkgs, project.DefaultHookTimeout, project.DefaultPackageTimeout)
+			},
+		})
+	}
+	restore = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if restored {
+			return nil
+		}
+		if err := project.WriteManifestBytes(jirix, manifestFile, data); err != nil {
+			return err
+		}
+		restored = true
+		unlock()
+		return os.Remove(recoveryFile)
+	}
+	return states, restore, nil
+}
+
+// fetchManifestImport returns the index of the import of m, the content of
+// .jiri_manifest, selected by importName, which may be empty if m has a single
+// import, and the repository of its manifest project fetched from origin, or
+// as last fetched in -no-write mode.
+func fetchManifestImport(jirix *jiri.X, m *project.Manifest, importName string) (int, *gitutil.Git, error) {
+	index := -1
+	for i, imp := range m.Imports {
+		if importName == "" || imp.Name == importName {
+			if index != -1 {
+				return -1, nil, fmt.Errorf("several imports in %s, select one with -import", jirix.JiriManifestFile())
+			}
+			index = i
+		}
+	}
+	if index == -1 {
+		return -1, nil, fmt.Errorf("no import to select in %s", jirix.JiriManifestFile())
+	}
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return -1, nil, err
+	}
+	manifestProject, ok := localProjects[m.Imports[index].ProjectKey()]
+	if !ok {
+		return -1, nil, fmt.Errorf("manifest project of import %q not found, run 'jiri update'", m.Imports[index].Name)
+	}
+	scm := gitutil.New(jirix, gitutil.RootDirOpt(manifestProject.Path))
+	if jirix.NoWrite {
+		jirix.Logger.Warningf("Not fetching manifest project %q in -no-write mode, using the revisions fetched before\n\n", manifestProject.Name)
+	} else if err := scm.Fetch("origin"); err != nil {
+		return -1, nil, err
+	}
+	return index, scm, nil
+}
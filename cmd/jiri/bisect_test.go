@@ -0,0 +1,151 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
+)
+
+// TestBisectSearch checks the search of bisect, with skipped states.
+func TestBisectSearch(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	tests := []struct {
+		firstBad int
+		skip     map[int]bool
+	}{
+		{1, nil},
+		{5, nil},
+		{9, nil},
+		{5, map[int]bool{4: true, 6: true}},
+		// The skipped state 4 may be the first bad one.
+		{5, map[int]bool{4: true}},
+	}
+	for _, test := range tests {
+		var states []bisectState
+		checkedOut := -1
+		for i := 0; i < 10; i++ {
+			i := i
+			states = append(states, bisectState{
+				name: fmt.Sprintf("state-%d", i),
+				checkout: func() error {
+					checkedOut = i
+					return nil
+				},
+			})
+		}
+		first, err := bisect(fake.X, states, func(s bisectState) (bool, bool, error) {
+			if err := s.checkout(); err != nil {
+				return false, false, err
+			}
+			if test.skip[checkedOut] {
+				return false, true, nil
+			}
+			return checkedOut < test.firstBad, false, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != test.firstBad {
+			t.Errorf("skipping %v: got first bad state %d, want %d", test.skip, first, test.firstBad)
+		}
+		if checkedOut != first {
+			t.Errorf("skipping %v: state %d left checked out, want %d", test.skip, checkedOut, first)
+		}
+	}
+}
+
+// TestBisectManifestRevisions checks that jiri bisect finds the manifest
+// revision which added a project, restores .jiri_manifest without overwriting
+// its backup, and refuses to start after an interrupted bisect.
+func TestBisectManifestRevisions(t *testing.T) {
+	_, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	jiriManifest, err := ioutil.ReadFile(fake.X.JiriManifestFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestScm := gitutil.New(fake.X, gitutil.RootDirOpt(fake.Projects[jiritest.ManifestProjectName]))
+	good, err := manifestScm.CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revs []string
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("bisect-%d", i)
+		if err := fake.CreateRemoteProject(name); err != nil {
+			t.Fatal(err)
+		}
+		writeReadme(t, fake.X, fake.Projects[name], "initial readme")
+		if err := fake.AddProject(project.Project{Name: name, Path: name, Remote: fake.Projects[name]}); err != nil {
+			t.Fatal(err)
+		}
+		rev, err := manifestScm.CurrentRevision()
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+	}
+
+	backupFile := project.ManifestBackupFile(fake.X.JiriManifestFile())
+	backup := []byte("<manifest/>\n")
+	if err := ioutil.WriteFile(backupFile, backup, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bisectFlags.good, bisectFlags.bad, bisectFlags.runHooks, bisectFlags.fetchPkgs = good, "HEAD", true, true
+	defer func() { bisectFlags.good = "" }()
+	stdout, _, err := runfunc(func() {
+		if err := runBisect(fake.X, []string{"test", "!", "-d", filepath.Join(fake.X.Root, "bisect-1")}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("First bad state: %s\n", revs[1]); stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+	if _, err := os.Stat(filepath.Join(fake.X.Root, "bisect-1")); err != nil {
+		t.Errorf("expected the first bad state to be checked out: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(fake.X.Root, "bisect-2")); err == nil {
+		t.Errorf("expected project bisect-2 not to be checked out")
+	}
+	if data, err := ioutil.ReadFile(fake.X.JiriManifestFile()); err != nil || string(data) != string(jiriManifest) {
+		t.Errorf("expected %s to be restored, got %q, %v", fake.X.JiriManifestFile(), data, err)
+	}
+	if data, err := ioutil.ReadFile(backupFile); err != nil || string(data) != string(backup) {
+		t.Errorf("expected %s to be kept, got %q, %v", backupFile, data, err)
+	}
+	if _, err := os.Stat(bisectRecoveryFile(fake.X)); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got: %v", bisectRecoveryFile(fake.X), err)
+	}
+	unlock, err := project.LockManifestFile(fake.X, fake.X.JiriManifestFile(), 0)
+	if err != nil {
+		t.Fatalf("expected %s to be unlocked: %v", fake.X.JiriManifestFile(), err)
+	}
+	unlock()
+
+	if err := ioutil.WriteFile(bisectRecoveryFile(fake.X), jiriManifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := runBisect(fake.X, []string{"true"}); err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Errorf("expected bisect to refuse to start after an interrupted bisect, got: %v", err)
+	}
+}
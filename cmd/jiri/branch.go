@@ -22,12 +22,15 @@ import (
 )
 
 var branchFlags struct {
+	checkoutFlag              bool
+	createFlag                bool
 	deleteFlag                bool
 	deleteMergedClsFlag       bool
 	deleteMergedFlag          bool
 	forceDeleteFlag           bool
 	listFlag                  bool
 	overrideProjectConfigFlag bool
+	projectsFlag              string
 }
 
 type MultiError []error
@@ -49,16 +52,24 @@ func (m MultiError) String() string {
 var cmdBranch = &cmdline.Command{
 	Runner: jiri.RunnerFunc(runBranch),
 	Name:   "branch",
-	Short:  "Show or delete branches",
+	Short:  "Show, create, switch or delete branches",
 	Long: `
 Show all the projects having branch <branch> .If -d or -D is passed, <branch>
-is deleted. if <branch> is not passed, show all projects which have branches other than "master"`,
+is deleted. if <branch> is not passed, show all projects which have branches other than "master"
+
+If -create is passed, <branch> is created in the projects listed in -projects,
+tracking their remote branch, and checked out. jiri remembers these projects,
+so that "jiri branch -checkout", "jiri branch -d/-D" and "jiri upload
+-multipart" act on exactly them.`,
 	ArgsName: "<branch>",
 	ArgsLong: "<branch> is the name branch",
 }
 
 func init() {
 	flags := &cmdBranch.Flags
+	flags.BoolVar(&branchFlags.createFlag, "create", false, "Create <branch> in the projects listed in -projects and check it out.")
+	flags.BoolVar(&branchFlags.checkoutFlag, "checkout", false, "Check out <branch> in the projects it was created in, or in all projects having it if it was not created with -create.")
+	flags.StringVar(&branchFlags.projectsFlag, "projects", "", "Comma-separated list of project names or keys to create the branch in. Used with -create.")
 	flags.BoolVar(&branchFlags.deleteFlag, "d", false, "Delete branch from project. Similar to running 'git branch -d <branch-name>'")
 	flags.BoolVar(&branchFlags.forceDeleteFlag, "D", false, "Force delete branch from project. Similar to running 'git branch -D <branch-name>'")
 	flags.BoolVar(&branchFlags.listFlag, "list", false, "Show only projects with current branch <branch>")
@@ -140,6 +151,18 @@ func runBranch(jirix *jiri.X, args []string) error {
 	} else if len(args) == 1 {
 		branch = args[0]
 	}
+	if branchFlags.createFlag {
+		if branch == "" {
+			return jirix.UsageErrorf("Please provide branch to create")
+		}
+		return createBranches(jirix, branch)
+	}
+	if branchFlags.checkoutFlag {
+		if branch == "" {
+			return jirix.UsageErrorf("Please provide branch to check out")
+		}
+		return checkoutBranches(jirix, branch)
+	}
 	if branchFlags.deleteFlag || branchFlags.forceDeleteFlag {
 		if branch == "" {
 			return jirix.UsageErrorf("Please provide branch to delete")
@@ -478,6 +501,9 @@ func deleteBranches(jirix *jiri.X, branchToDelete string) error {
 	if err != nil {
 		return err
 	}
+	if err := filterBranchProjects(jirix, branchToDelete, localProjects); err != nil {
+		return err
+	}
 	states, err := project.GetProjectStates(jirix, localProjects, false)
 	if err != nil {
 		return err
@@ -486,6 +512,7 @@ func deleteBranches(jirix *jiri.X, branchToDelete string) error {
 	jirix.TimerPush("Process")
 	errors := false
 	projectFound := false
+	var deleted project.ProjectKeys
 	var keys project.ProjectKeys
 	for key, _ := range states {
 		keys = append(keys, key)
@@ -517,12 +544,16 @@ func deleteBranches(jirix *jiri.X, branchToDelete string) error {
 						return err
 					}
 					fmt.Printf("%s (was %s)\n", jirix.Color.Green("Deleted Branch %s", branchToDelete), jirix.Color.Yellow(shortHash))
+					deleted = append(deleted, key)
 				}
 				break
 			}
 		}
 	}
 	jirix.TimerPop()
+	if err := project.RemoveBranchProjects(jirix, branchToDelete, deleted); err != nil {
+		return err
+	}
 
 	if !projectFound {
 		fmt.Printf("Cannot find any project with branch %q\n", branchToDelete)
@@ -533,3 +564,120 @@ func deleteBranches(jirix *jiri.X, branchToDelete string) error {
 	}
 	return nil
 }
+
+// filterBranchProjects removes from projects those that branch was not
+// created in, if branch was created by "jiri branch -create".
+func filterBranchProjects(jirix *jiri.X, branch string, projects project.Projects) error {
+	keys, err := project.BranchProjects(jirix, branch)
+	if err != nil || keys == nil {
+		return err
+	}
+	tracked := make(map[project.ProjectKey]bool)
+	for _, key := range keys {
+		tracked[key] = true
+	}
+	for key := range projects {
+		if !tracked[key] {
+			delete(projects, key)
+		}
+	}
+	return nil
+}
+
+func createBranches(jirix *jiri.X, branch string) error {
+	if branchFlags.projectsFlag == "" {
+		return jirix.UsageErrorf("Please provide projects to create the branch in with -projects")
+	}
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	remoteProjects, _, _, err := project.LoadManifestFile(jirix, jirix.JiriManifestFile(), localProjects, false /*localManifest*/)
+	if err != nil {
+		return err
+	}
+	var projects []project.Project
+	for _, name := range strings.Split(branchFlags.projectsFlag, ",") {
+		p, err := localProjects.FindUnique(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		projects = append(projects, p)
+	}
+
+	var created project.ProjectKeys
+	var errs MultiError
+	for _, p := range projects {
+		scm := gitutil.New(jirix, gitutil.RootDirOpt(p.Path))
+		if exists, err := scm.BranchExists(branch); err != nil {
+			errs = append(errs, fmt.Errorf("project %s(%s): %s", p.Name, p.Path, err))
+			continue
+		} else if exists {
+			errs = append(errs, fmt.Errorf("project %s(%s): branch %q already exists", p.Name, p.Path, branch))
+			continue
+		}
+		rb := "master"
+		if remote, ok := remoteProjects[p.Key()]; ok && remote.RemoteBranch != "" {
+			rb = remote.RemoteBranch
+		}
+		if err := scm.CreateBranchWithUpstream(branch, "origin/"+rb); err != nil {
+			errs = append(errs, fmt.Errorf("project %s(%s): %s", p.Name, p.Path, err))
+			continue
+		}
+		created = append(created, p.Key())
+		if err := scm.CheckoutBranch(branch); err != nil {
+			errs = append(errs, fmt.Errorf("project %s(%s): %s", p.Name, p.Path, err))
+			continue
+		}
+		fmt.Printf("Project %s(%s): %s\n", p.Name, p.Path, jirix.Color.Green("Created branch %s", branch))
+	}
+	if err := project.AddBranchProjects(jirix, branch, created); err != nil {
+		return err
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkoutBranches(jirix *jiri.X, branch string) error {
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	keys, err := project.BranchProjects(jirix, branch)
+	if err != nil {
+		return err
+	}
+	tracked := keys != nil
+	if err := filterBranchProjects(jirix, branch, localProjects); err != nil {
+		return err
+	}
+	var errs MultiError
+	found := false
+	for _, p := range localProjects {
+		scm := gitutil.New(jirix, gitutil.RootDirOpt(p.Path))
+		if exists, err := scm.BranchExists(branch); err != nil {
+			errs = append(errs, fmt.Errorf("project %s(%s): %s", p.Name, p.Path, err))
+			continue
+		} else if !exists {
+			if tracked {
+				errs = append(errs, fmt.Errorf("project %s(%s): branch %q does not exist", p.Name, p.Path, branch))
+			}
+			continue
+		}
+		found = true
+		if err := scm.CheckoutBranch(branch); err != nil {
+			errs = append(errs, fmt.Errorf("project %s(%s): %s", p.Name, p.Path, err))
+			continue
+		}
+		fmt.Printf("Project %s(%s): %s\n", p.Name, p.Path, jirix.Color.Green("Switched to branch %s", branch))
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	if !found {
+		fmt.Printf("Cannot find any project with branch %q\n", branch)
+	}
+	return nil
+}
@@ -23,12 +23,15 @@ import (
 )
 
 func setDefaultBranchFlags() {
+	branchFlags.checkoutFlag = false
+	branchFlags.createFlag = false
 	branchFlags.deleteFlag = false
 	branchFlags.deleteMergedClsFlag = false
 	branchFlags.deleteMergedFlag = false
 	branchFlags.forceDeleteFlag = false
 	branchFlags.listFlag = false
 	branchFlags.overrideProjectConfigFlag = false
+	branchFlags.projectsFlag = ""
 }
 
 func createBranchCommits(t *testing.T, fake *jiritest.FakeJiriRoot, localProjects []project.Project) {
@@ -157,6 +160,93 @@ func TestBranch(t *testing.T) {
 	}
 }
 
+func TestCreateCheckoutDeleteBranch(t *testing.T) {
+	setDefaultBranchFlags()
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	numProjects := 3
+	localProjects := createBranchProjects(t, fake, numProjects)
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	gitLocals := make([]*gitutil.Git, numProjects)
+	for i, localProject := range localProjects {
+		gitLocals[i] = gitutil.New(fake.X, gitutil.RootDirOpt(localProject.Path))
+	}
+
+	testBranch := "testBranch"
+	branchFlags.createFlag = true
+	branchFlags.projectsFlag = localProjects[0].Name + "," + localProjects[1].Name
+	if got := executeBranch(t, fake, testBranch); strings.Contains(got, "ERROR") {
+		t.Fatalf("create failed: %s", got)
+	}
+	branchFlags.createFlag = false
+	for i := 0; i < 2; i++ {
+		if b, err := gitLocals[i].CurrentBranchName(); err != nil {
+			t.Fatal(err)
+		} else if b != testBranch {
+			t.Errorf("project %s: got branch %q, want %q", localProjects[i].Name, b, testBranch)
+		}
+	}
+	if gitLocals[2].IsOnBranch() {
+		t.Errorf("project %s should not be on a branch", localProjects[2].Name)
+	}
+	keys, err := project.BranchProjects(fake.X, testBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got tracked projects %v, want 2", keys)
+	}
+
+	// A branch of the same name in another project is not switched to or
+	// deleted.
+	if err := gitLocals[2].CreateBranch(testBranch); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := gitLocals[i].CheckoutBranch("master"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	branchFlags.checkoutFlag = true
+	executeBranch(t, fake, testBranch)
+	branchFlags.checkoutFlag = false
+	for i := 0; i < 2; i++ {
+		if b, err := gitLocals[i].CurrentBranchName(); err != nil {
+			t.Fatal(err)
+		} else if b != testBranch {
+			t.Errorf("project %s: got branch %q, want %q", localProjects[i].Name, b, testBranch)
+		}
+	}
+	if gitLocals[2].IsOnBranch() {
+		t.Errorf("project %s should not be on a branch", localProjects[2].Name)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := gitLocals[i].CheckoutBranch("master"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	branchFlags.forceDeleteFlag = true
+	executeBranch(t, fake, testBranch)
+	for i, gitLocal := range gitLocals {
+		exists, err := gitLocal.BranchExists(testBranch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i == 2; exists != want {
+			t.Errorf("project %s: branch exists: got %t, want %t", localProjects[i].Name, exists, want)
+		}
+	}
+	if keys, err := project.BranchProjects(fake.X, testBranch); err != nil {
+		t.Fatal(err)
+	} else if keys != nil {
+		t.Errorf("branch should not be tracked anymore, got %v", keys)
+	}
+}
+
 func TestDeleteBranchWithProjectConfig(t *testing.T) {
 	testDeleteBranchWithProjectConfig(t, false)
 	testDeleteBranchWithProjectConfig(t, true)
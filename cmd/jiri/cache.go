@@ -0,0 +1,60 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var cmdCache = &cmdline.Command{
+	Name:  "cache",
+	Short: "Manage the git cache of a jiri root",
+	Long: `
+Jiri keeps bare mirrors of the projects of a workspace in the cache directory
+set with "jiri init -cache".  New projects are cloned with --reference to these
+mirrors, which saves network and disk when many workspaces share one cache, as
+on CI machines.  With "jiri init -dissociate=true", the borrowed objects are
+copied into new projects so that they keep working if the cache is removed.
+`,
+	Children: []*cmdline.Command{cmdCacheUpdate},
+}
+
+var cmdCacheUpdate = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runCacheUpdate),
+	Name:   "update",
+	Short:  "Create or refresh the cache mirrors of all projects",
+	Long: `
+Creates or refreshes the cache mirror of every project of the manifest,
+honoring the optional attributes selected with "jiri init -fetch-optional",
+without updating the projects of the workspace.
+`,
+}
+
+func runCacheUpdate(jirix *jiri.X, args []string) error {
+	if len(args) != 0 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	if jirix.Cache == "" {
+		return fmt.Errorf("no cache is configured, set one with 'jiri init -cache=<path>'")
+	}
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	// Remote imports are fetched as needed, so that the cache can be
+	// populated before any project is checked out.
+	projects, _, pkgs, err := project.LoadUpdatedManifest(jirix, localProjects, false /*localManifest*/)
+	if err != nil {
+		return err
+	}
+	if err := project.FilterOptionalProjectsPackages(jirix, jirix.FetchingAttrs, projects, pkgs); err != nil {
+		return err
+	}
+	return project.UpdateCache(jirix, projects)
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
+)
+
+func TestCacheUpdate(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	if err := runCacheUpdate(fake.X, nil); err == nil {
+		t.Errorf("expected an error when no cache is configured")
+	}
+
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	fake.X.Cache = cacheDir
+
+	if err := fake.CreateRemoteProject("p1"); err != nil {
+		t.Fatal(err)
+	}
+	p := project.Project{
+		Name:   "p1",
+		Path:   filepath.Join(fake.X.Root, "p1"),
+		Remote: fake.Projects["p1"],
+	}
+	if err := fake.AddProject(p); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fake.X, fake.Projects["p1"], "file1", "first commit")
+	if err := runCacheUpdate(fake.X, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDirPath, err := p.CacheDirPath(fake.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheRev, err := gitutil.New(fake.X, gitutil.RootDirOpt(cacheDirPath)).CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteRev, err := gitutil.New(fake.X, gitutil.RootDirOpt(fake.Projects["p1"])).CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cacheRev != remoteRev {
+		t.Errorf("cache revision %v, want %v", cacheRev, remoteRev)
+	}
+	if _, err := os.Stat(p.Path); err == nil {
+		t.Errorf("expected project %q to not be checked out", p.Name)
+	}
+}
@@ -55,11 +55,18 @@ Command jiri is a multi-purpose tool for multi-repo development.
 `,
 		LookPath: true,
 		Children: []*cmdline.Command{
+			cmdAttributes,
+			cmdBisect,
 			cmdBranch,
 			cmdBootstrap,
+			cmdCache,
+			cmdCompletion,
 			cmdDiff,
+			cmdDiffManifest,
+			cmdDoctor,
 			cmdEdit,
 			cmdFetchPkgs,
+			cmdGC,
 			cmdGenGitModule,
 			cmdGrep,
 			cmdImport,
@@ -69,17 +76,27 @@ Command jiri is a multi-purpose tool for multi-repo development.
 			cmdProject,
 			cmdProjectConfig,
 			cmdManifest,
+			cmdManifestExport,
+			cmdManifestImport,
+			cmdManifestLint,
+			cmdMetrics,
 			cmdOverride,
+			cmdRelocate,
 			cmdResolve,
+			cmdRollback,
 			cmdRunHooks,
 			cmdRunP,
 			cmdSelfUpdate,
+			cmdServe,
 			cmdSnapshot,
 			cmdSourceManifest,
 			cmdStatus,
+			cmdSync,
 			cmdUpdate,
 			cmdUpload,
 			cmdVersion,
+			cmdView,
+			cmdWorkspace,
 		},
 		Topics: []cmdline.Topic{
 			topicFileSystem,
@@ -240,5 +257,29 @@ They are configured via the following attributes:
 
 * action (required) - Action to be performed inside the project.
 It is mostly identified by a script
+
+* after (optional) - Comma-separated names of hooks that must succeed before
+this hook runs. Hooks without this attribute run in parallel.
+
+* timeout (optional) - Timeout of the hook in minutes, overriding the
+-hook-timeout flag of 'jiri update' and 'jiri run-hooks'.
+
+The [root]/.jiri_manifest file can also declare <views>, named subsets of the
+projects to sync:
+
+<manifest>
+  ...
+  <views>
+    <view name="tools">
+      <project name="my-project" sparse="src,docs"/>
+      ...
+    </view>
+  </views>
+</manifest>
+
+Once a view is selected with "jiri view <name>" or "jiri init -view=<name>",
+"jiri update" only syncs the projects of the view, plus the projects containing
+manifests.  The optional "sparse" attribute is a comma-separated list of
+directories of the project to check out, using git sparse-checkout.
 `,
 }
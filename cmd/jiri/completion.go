@@ -0,0 +1,197 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/jiri/cmdline"
+)
+
+var cmdCompletion = &cmdline.Command{
+	Runner: cmdline.RunnerFunc(runCompletion),
+	Name:   "completion",
+	Short:  "Print a shell completion script",
+	Long: `
+Prints a script completing jiri commands, subcommands and flags for the given
+shell, one of bash, zsh or fish. The script is generated from the commands
+compiled into this jiri binary, regenerate it after updating jiri.
+
+To enable completion, add to ~/.bashrc:
+  source <(jiri completion bash)
+to ~/.zshrc:
+  source <(jiri completion zsh)
+or to ~/.config/fish/config.fish:
+  jiri completion fish | source
+`,
+	ArgsName: "<shell>",
+	ArgsLong: "<shell> is bash, zsh or fish.",
+}
+
+func runCompletion(env *cmdline.Env, args []string) error {
+	if len(args) != 1 {
+		return env.UsageErrorf("unexpected number of arguments")
+	}
+	cmds := completionCommands(cmdRoot)
+	switch args[0] {
+	case "bash":
+		return writeBashCompletion(env.Stdout, cmds, false)
+	case "zsh":
+		return writeBashCompletion(env.Stdout, cmds, true)
+	case "fish":
+		return writeFishCompletion(env.Stdout, cmds)
+	}
+	return env.UsageErrorf("unsupported shell %q", args[0])
+}
+
+// completionFlag is a flag accepted by a command.
+type completionFlag struct {
+	name  string
+	usage string
+}
+
+// completionCommand describes what can follow a command on the command line.
+type completionCommand struct {
+	// path is the command line of the command, e.g. "jiri project-config".
+	path     string
+	children []*cmdline.Command
+	flags    []completionFlag
+}
+
+// completionCommands returns the commands of the tree rooted at root, root
+// first, with the flags each of them accepts, i.e. the global flags, its own
+// flags and the flags propagated from its ancestors.
+func completionCommands(root *cmdline.Command) []completionCommand {
+	var global []completionFlag
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "test.") {
+			global = append(global, completionFlag{f.Name, f.Usage})
+		}
+	})
+	var cmds []completionCommand
+	var walk func(cmd *cmdline.Command, path string, inherited []completionFlag)
+	walk = func(cmd *cmdline.Command, path string, inherited []completionFlag) {
+		if cmd.DontInheritFlags {
+			inherited = nil
+		}
+		flags := append([]completionFlag(nil), inherited...)
+		cmd.Flags.VisitAll(func(f *flag.Flag) {
+			flags = append(flags, completionFlag{f.Name, f.Usage})
+		})
+		children := append([]*cmdline.Command(nil), cmd.Children...)
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Name < children[j].Name
+		})
+		all := append(append([]completionFlag(nil), global...), flags...)
+		sort.Slice(all, func(i, j int) bool {
+			return all[i].name < all[j].name
+		})
+		cmds = append(cmds, completionCommand{path, children, all})
+		if cmd.DontPropagateFlags {
+			flags = nil
+		}
+		for _, child := range children {
+			walk(child, path+" "+child.Name, flags)
+		}
+	}
+	walk(root, root.Name, nil)
+	return cmds
+}
+
+func writeBashCompletion(w io.Writer, cmds []completionCommand, zsh bool) error {
+	var paths []string
+	for _, cmd := range cmds[1:] {
+		paths = append(paths, fmt.Sprintf("%q", cmd.path))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Completion for jiri, generated by \"jiri completion\".\n")
+	if zsh {
+		fmt.Fprintf(&b, "autoload -U +X bashcompinit && bashcompinit\n")
+	}
+	fmt.Fprintf(&b, `_jiri() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" cmdpath="jiri" cmds="" flags="" word i
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    word="${COMP_WORDS[i]}"
+    case "$cmdpath $word" in
+      %s) cmdpath="$cmdpath $word" ;;
+    esac
+  done
+  case "$cmdpath" in
+`, strings.Join(paths, "|"))
+	for _, cmd := range cmds {
+		var names, flags []string
+		for _, child := range cmd.children {
+			names = append(names, child.Name)
+		}
+		if len(names) > 0 {
+			names = append(names, "help")
+		}
+		for _, f := range cmd.flags {
+			flags = append(flags, "-"+f.name)
+		}
+		fmt.Fprintf(&b, "    %q) cmds=%q flags=%q ;;\n", cmd.path, strings.Join(names, " "), strings.Join(flags, " "))
+	}
+	fmt.Fprintf(&b, `  esac
+  if [[ "$cur" == -* ]]; then
+    COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+  elif [[ -n "$cmds" ]]; then
+    COMPREPLY=($(compgen -W "$cmds" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -f -- "$cur"))
+  fi
+}
+complete -F _jiri jiri
+`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFishCompletion(w io.Writer, cmds []completionCommand) error {
+	var paths []string
+	for _, cmd := range cmds[1:] {
+		paths = append(paths, fishQuote(cmd.path))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Completion for jiri, generated by \"jiri completion\".\n")
+	fmt.Fprintf(&b, "set -g __jiri_commands %s\n", strings.Join(paths, " "))
+	fmt.Fprintf(&b, `function __jiri_path
+    set -l path jiri
+    for word in (commandline -opc)[2..-1]
+        if contains -- "$path $word" $__jiri_commands
+            set path "$path $word"
+        end
+    end
+    echo $path
+end
+`)
+	for _, cmd := range cmds {
+		cond := fishQuote(fmt.Sprintf("test (__jiri_path) = %s", fishQuote(cmd.path)))
+		for _, child := range cmd.children {
+			fmt.Fprintf(&b, "complete -c jiri -n %s -f -a %s -d %s\n", cond, fishQuote(child.Name), fishQuote(child.Short))
+		}
+		for _, f := range cmd.flags {
+			fmt.Fprintf(&b, "complete -c jiri -n %s -o %s -d %s\n", cond, fishQuote(f.name), fishQuote(firstLine(f.usage)))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishQuote quotes s for fish, which only interprets \' and \\ in single
+// quoted strings.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri/cmdline"
+)
+
+func TestCompletion(t *testing.T) {
+	for _, test := range []struct {
+		shell string
+		want  []string
+	}{
+		{"bash", []string{
+			`"jiri project-config"|`,
+			`    "jiri update") cmds="" flags="-attempts `,
+			` -on-conflict `,
+			`complete -F _jiri jiri`,
+		}},
+		{"zsh", []string{
+			`bashcompinit`,
+			// zsh ties path to $PATH, the script must not assign to it.
+			` cmdpath="jiri" `,
+			`complete -F _jiri jiri`,
+		}},
+		{"fish", []string{
+			`complete -c jiri -n 'test (__jiri_path) = \'jiri\'' -f -a 'update' -d 'Update all jiri projects'`,
+			`complete -c jiri -n 'test (__jiri_path) = \'jiri update\'' -o 'on-conflict' -d `,
+			`complete -c jiri -n 'test (__jiri_path) = \'jiri update\'' -o 'offline' -d `,
+		}},
+	} {
+		var stdout bytes.Buffer
+		env := &cmdline.Env{Stdout: &stdout}
+		if err := runCompletion(env, []string{test.shell}); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("%s completion does not contain %q:\n%s", test.shell, want, stdout.String())
+			}
+		}
+	}
+
+	env := &cmdline.Env{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+	if err := runCompletion(env, []string{"csh"}); err == nil {
+		t.Errorf("expected an error for an unsupported shell")
+	}
+}
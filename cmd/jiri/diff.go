@@ -7,14 +7,18 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/cmdline"
 	"github.com/btwiuse/jiri/gerrit"
+	"github.com/btwiuse/jiri/gitutil"
 	"github.com/btwiuse/jiri/log"
 	"github.com/btwiuse/jiri/project"
 )
@@ -22,6 +26,7 @@ import (
 var diffFlags struct {
 	cls          bool
 	indentOutput bool
+	text         bool
 
 	// Need this to avoid infinite loop
 	maxCls uint
@@ -31,12 +36,14 @@ var cmdDiff = &cmdline.Command{
 	Runner:   jiri.RunnerFunc(runDiff),
 	Name:     "diff",
 	Short:    "Prints diff between two snapshots",
-	ArgsName: "<snapshot-1> <snapshot-2>",
-	ArgsLong: "<snapshot-1/2> are files or urls containing snapshot",
+	ArgsName: "<snapshot-1> [<snapshot-2>]",
+	ArgsLong: "<snapshot-1/2> are files or urls containing snapshot. If <snapshot-2> is omitted, <snapshot-1> is compared against the current state of the workspace",
 	Long: `
-Prints diff between two snapshots in json format. Max CLs returned for a
-project is controlled by flag max-xls and is default by 5. The format of
-returned json:
+Prints diff between two snapshots in json format, or as a human-readable
+summary if -text is set. Max CLs returned for a project is controlled by flag
+max-xls and is default by 5. For updated projects that are checked out in the
+workspace, the one-line log of the commits between the two revisions is
+returned as well, up to the same limit. The format of returned json:
 {
 	new_projects: [
 		{
@@ -70,6 +77,7 @@ returned json:
 					subject:sub
 				},{...},...
 			]
+			log: ["hash subject", ...],
 			has_more_cls: true,
 			error: error in retrieving CL
 		},{...}...
@@ -83,6 +91,7 @@ func init() {
 	flags.BoolVar(&diffFlags.cls, "cls", true, "Return CLs for changed projects")
 	flags.BoolVar(&diffFlags.indentOutput, "indent", true, "Indent json output")
 	flags.UintVar(&diffFlags.maxCls, "max-cls", 5, "Max number of CLs returned per changed project")
+	flags.BoolVar(&diffFlags.text, "text", false, "Print a human-readable summary instead of json")
 }
 
 type DiffCl struct {
@@ -100,8 +109,16 @@ type DiffProject struct {
 	Revision    string   `json:"revision"`
 	OldRevision string   `json:"old_revision,omitempty"`
 	Cls         []DiffCl `json:"cls,omitempty"`
+	Log         []string `json:"log,omitempty"`
 	Error       string   `json:"error,omitempty"`
 	HasMoreCls  bool     `json:"has_more_cls,omitempty"`
+
+	// Set by "jiri diff-manifest" only: the number of commits between the
+	// old and the new revision, the number of commits of the old revision
+	// which the new one drops, and the authors of the new commits.
+	Commits        int      `json:"commits,omitempty"`
+	DroppedCommits int      `json:"dropped_commits,omitempty"`
+	Authors        []string `json:"authors,omitempty"`
 }
 
 type DiffProjectsByName []DiffProject
@@ -130,13 +147,29 @@ func (d *Diff) Sort() *Diff {
 }
 
 func runDiff(jirix *jiri.X, args []string) error {
-	if len(args) != 2 {
-		return jirix.UsageErrorf("Please provide two snapshots to diff")
+	if len(args) != 1 && len(args) != 2 {
+		return jirix.UsageErrorf("Please provide one or two snapshots to diff")
+	}
+	if len(args) == 1 {
+		f, err := ioutil.TempFile("", "jiri-diff-snapshot-")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+		if err := project.CreateSnapshot(jirix, f.Name(), nil, nil, false); err != nil {
+			return err
+		}
+		args = append(args, f.Name())
 	}
 	d, err := getDiff(jirix, args[0], args[1])
 	if err != nil {
 		return err
 	}
+	if diffFlags.text {
+		printDiff(os.Stdout, d)
+		return nil
+	}
 	e := json.NewEncoder(os.Stdout)
 	if diffFlags.indentOutput {
 		e.SetIndent("", " ")
@@ -165,6 +198,10 @@ func getDiff(jirix *jiri.X, snapshot1, snapshot2 string) (*Diff, error) {
 	}
 	project.MatchLocalWithRemote(projects1, projects2)
 	jirix.Logger = oldLogger
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get deleted projects
 	for key, p1 := range projects1 {
@@ -211,6 +248,14 @@ func getDiff(jirix *jiri.X, snapshot1, snapshot2 string) (*Diff, error) {
 		}
 		if p1.Revision != p2.Revision {
 			diffP.OldRevision = p1.Revision
+			if local, ok := localProjects[key]; ok {
+				// Failing to get the log is not an error, the old or new
+				// revision may simply not be fetched locally.
+				scm := gitutil.New(jirix, gitutil.RootDirOpt(local.Path))
+				if log, err := scm.ShortLog(p1.Revision, p2.Revision, diffFlags.maxCls); err == nil {
+					diffP.Log = log
+				}
+			}
 			if !diffFlags.cls {
 				// do nothing, prevents nested if/else
 			} else if p2.GerritHost == "" {
@@ -282,3 +327,54 @@ func getDiff(jirix *jiri.X, snapshot1, snapshot2 string) (*Diff, error) {
 	}
 	return diff.Sort(), nil
 }
+
+func printDiff(w io.Writer, d *Diff) {
+	if len(d.NewProjects) == 0 && len(d.DeletedProjects) == 0 && len(d.UpdatedProjects) == 0 {
+		fmt.Fprintln(w, "No differences.")
+		return
+	}
+	if len(d.NewProjects) != 0 {
+		fmt.Fprintln(w, "Added projects:")
+		for _, p := range d.NewProjects {
+			fmt.Fprintf(w, "  %s (%s) at %s\n", p.Name, p.Path, p.Revision)
+		}
+	}
+	if len(d.DeletedProjects) != 0 {
+		fmt.Fprintln(w, "Removed projects:")
+		for _, p := range d.DeletedProjects {
+			fmt.Fprintf(w, "  %s (%s) at %s\n", p.Name, p.Path, p.Revision)
+		}
+	}
+	if len(d.UpdatedProjects) != 0 {
+		fmt.Fprintln(w, "Updated projects:")
+		for _, p := range d.UpdatedProjects {
+			fmt.Fprintf(w, "  %s\n", p.Name)
+			if p.OldPath != "" {
+				fmt.Fprintf(w, "    moved: %s -> %s\n", p.OldPath, p.Path)
+			}
+			if p.OldRevision != "" {
+				fmt.Fprintf(w, "    revision: %s -> %s\n", p.OldRevision, p.Revision)
+			}
+			if p.Commits != 0 {
+				fmt.Fprintf(w, "    %d commits by %s\n", p.Commits, strings.Join(p.Authors, ", "))
+			}
+			if p.DroppedCommits != 0 {
+				fmt.Fprintf(w, "    %d commits dropped\n", p.DroppedCommits)
+			}
+			for _, cl := range p.Cls {
+				fmt.Fprintf(w, "    %s %s\n", cl.URL, cl.Subject)
+			}
+			if len(p.Cls) == 0 {
+				for _, line := range p.Log {
+					fmt.Fprintf(w, "    %s\n", line)
+				}
+			}
+			if p.HasMoreCls {
+				fmt.Fprintln(w, "    ...")
+			}
+			if p.Error != "" {
+				fmt.Fprintf(w, "    error: %s\n", p.Error)
+			}
+		}
+	}
+}
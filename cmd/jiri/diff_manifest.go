@@ -0,0 +1,208 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/project"
+)
+
+var diffManifestFlags struct {
+	importName   string
+	indentOutput bool
+	text         bool
+	maxLog       uint
+}
+
+var cmdDiffManifest = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runDiffManifest),
+	Name:   "diff-manifest",
+	Short:  "Prints what jiri update would do for a manifest revision",
+	Long: `
+Prints the changes "jiri update" would make to the projects if the import of
+.jiri_manifest was pinned to the given revision or branch of its manifest
+repository, without changing .jiri_manifest or any project: the projects
+which would be added, removed or moved, and for the projects which would be
+updated, their old and new revisions with the number of commits and the
+authors in between. Only the manifest repository is fetched, the revisions
+of the other projects are resolved as last fetched. With the global
+-no-write flag, nothing is written to the jiri root and the manifest
+repository is not fetched either.
+
+The diff is printed in the json format of "jiri diff", with the additional
+commits, dropped_commits and authors fields for updated projects, or as a
+human-readable summary if -text is set.
+`,
+	ArgsName: "<revision>",
+	ArgsLong: "<revision> is a revision or a branch of the manifest repository, HEAD being the head of its remote branch.",
+}
+
+func init() {
+	flags := &cmdDiffManifest.Flags
+	flags.StringVar(&diffManifestFlags.importName, "import", "", "Name of the import of .jiri_manifest to diff. Required if there are several.")
+	flags.BoolVar(&diffManifestFlags.indentOutput, "indent", true, "Indent json output")
+	flags.BoolVar(&diffManifestFlags.text, "text", false, "Print a human-readable summary instead of json")
+	flags.UintVar(&diffManifestFlags.maxLog, "max-log", 5, "Max number of commits logged per updated project")
+}
+
+func runDiffManifest(jirix *jiri.X, args []string) error {
+	if len(args) != 1 {
+		return jirix.UsageErrorf("Please provide the manifest revision to diff")
+	}
+	d, err := getManifestDiff(jirix, args[0], diffManifestFlags.importName)
+	if err != nil {
+		return err
+	}
+	if diffManifestFlags.text {
+		printDiff(jirix.Stdout(), d)
+		return nil
+	}
+	e := json.NewEncoder(jirix.Stdout())
+	if diffManifestFlags.indentOutput {
+		e.SetIndent("", " ")
+	}
+	return e.Encode(d)
+}
+
+// manifestRevision returns the revision of the manifest repository scm
+// designated by ref, which may be a branch of origin.
+func manifestRevision(scm *gitutil.Git, imp project.Import, ref string) (string, error) {
+	if ref == "HEAD" {
+		ref = "origin/" + imp.RemoteBranch
+	}
+	rev, err := scm.CurrentRevisionForRef(ref)
+	if err != nil {
+		var originErr error
+		if rev, originErr = scm.CurrentRevisionForRef("origin/" + ref); originErr != nil {
+			return "", fmt.Errorf("unknown manifest revision %q: %v", ref, err)
+		}
+	}
+	return rev, nil
+}
+
+// getManifestDiff returns the diff between the local projects and the
+// projects of .jiri_manifest with the import selected by importName pinned to
+// the manifest revision ref.
+func getManifestDiff(jirix *jiri.X, ref, importName string) (*Diff, error) {
+	data, err := ioutil.ReadFile(jirix.JiriManifestFile())
+	if err != nil {
+		return nil, err
+	}
+	m, err := project.ManifestFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	index, scm, err := fetchManifestImport(jirix, m, importName)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := manifestRevision(scm, m.Imports[index], ref)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pinned manifest is loaded in place of .jiri_manifest, without
+	// being written, and its local imports stay relative to .jiri_manifest.
+	pinned := *m
+	pinned.Imports = append([]project.Import(nil), m.Imports...)
+	pinned.Imports[index].Revision = rev
+	pinnedData, err := pinned.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	localProjects, err := project.LocalProjects(jirix, project.FullScan)
+	if err != nil {
+		return nil, err
+	}
+	remoteProjects, _, pkgs, err := project.LoadManifestBytesAtHead(jirix, jirix.JiriManifestFile(), pinnedData, localProjects)
+	if err != nil {
+		return nil, err
+	}
+	if err := project.FilterOptionalProjectsPackages(jirix, jirix.FetchingAttrs, remoteProjects, pkgs); err != nil {
+		return nil, err
+	}
+	project.MatchLocalWithRemote(localProjects, remoteProjects)
+
+	diff := &Diff{
+		NewProjects:     make([]DiffProject, 0),
+		DeletedProjects: make([]DiffProject, 0),
+		UpdatedProjects: make([]DiffProject, 0),
+	}
+	for key, local := range localProjects {
+		if _, ok := remoteProjects[key]; !ok {
+			diff.DeletedProjects = append(diff.DeletedProjects, DiffProject{
+				Name:     local.Name,
+				Remote:   local.Remote,
+				Path:     local.Path,
+				Revision: local.Revision,
+			})
+		}
+	}
+	for key, remote := range remoteProjects {
+		revision, err := project.GetHeadRevision(jirix, remote)
+		if err != nil {
+			return nil, err
+		}
+		diffP := DiffProject{
+			Name:     remote.Name,
+			Remote:   remote.Remote,
+			Path:     remote.Path,
+			Revision: revision,
+		}
+		local, ok := localProjects[key]
+		if !ok {
+			diff.NewProjects = append(diff.NewProjects, diffP)
+			continue
+		}
+		if local.LocalConfig.Ignore || local.LocalConfig.NoUpdate {
+			continue
+		}
+		scm := gitutil.New(jirix, gitutil.RootDirOpt(local.Path))
+		if rev, err := scm.CurrentRevisionForRef(revision); err == nil {
+			diffP.Revision = rev
+		} else {
+			diffP.Error = fmt.Sprintf("revision %s is not fetched", revision)
+		}
+		if local.Path != remote.Path {
+			diffP.OldPath = local.Path
+		}
+		if diffP.Error == "" && local.Revision != diffP.Revision {
+			diffP.OldRevision = local.Revision
+			if err := diffRevisions(scm, &diffP, diffManifestFlags.maxLog); err != nil {
+				diffP.Error = err.Error()
+			}
+		}
+		if diffP.OldPath != "" || diffP.OldRevision != "" || diffP.Error != "" {
+			diff.UpdatedProjects = append(diff.UpdatedProjects, diffP)
+		}
+	}
+	return diff.Sort(), nil
+}
+
+// diffRevisions fills the log, the commit counts and the authors of the
+// commits between the old and new revisions of p, from the repository scm.
+func diffRevisions(scm *gitutil.Git, p *DiffProject, maxLog uint) error {
+	var err error
+	if p.Commits, err = scm.CountCommits(p.Revision, p.OldRevision); err != nil {
+		return err
+	}
+	if p.DroppedCommits, err = scm.CountCommits(p.OldRevision, p.Revision); err != nil {
+		return err
+	}
+	if p.Authors, err = scm.Authors(p.OldRevision, p.Revision); err != nil {
+		return err
+	}
+	if p.Log, err = scm.ShortLog(p.OldRevision, p.Revision, maxLog); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
+)
+
+// TestDiffManifest checks that jiri diff-manifest reports the projects added,
+// removed, moved and updated by a manifest revision, without checking it out.
+func TestDiffManifest(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	jiriManifest, err := ioutil.ReadFile(fake.X.JiriManifestFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Project 0 gets a new commit, fetched but not checked out.
+	writeReadme(t, fake.X, fake.Projects[localProjects[0].Name], "new readme")
+	if err := gitutil.New(fake.X, gitutil.RootDirOpt(localProjects[0].Path)).Fetch("origin"); err != nil {
+		t.Fatal(err)
+	}
+	// The manifest adds a project, moves project 1 and removes project 2.
+	if err := fake.CreateRemoteProject("new"); err != nil {
+		t.Fatal(err)
+	}
+	writeReadme(t, fake.X, fake.Projects["new"], "initial readme")
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var projects []project.Project
+	for _, p := range m.Projects {
+		switch p.Name {
+		case localProjects[1].Name:
+			p.Path = "moved-1"
+		case localProjects[2].Name:
+			continue
+		}
+		projects = append(projects, p)
+	}
+	m.Projects = append(projects, project.Project{Name: "new", Path: "new", Remote: fake.Projects["new"]})
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+
+	// The diff does not write to the jiri root, once the manifest project
+	// is fetched.
+	if err := gitutil.New(fake.X, gitutil.RootDirOpt(filepath.Join(fake.X.Root, jiritest.ManifestProjectPath))).Fetch("origin"); err != nil {
+		t.Fatal(err)
+	}
+	fake.X.NoWrite = true
+	d, err := getManifestDiff(fake.X, "HEAD", "")
+	fake.X.NoWrite = false
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.NewProjects) != 1 || d.NewProjects[0].Name != "new" {
+		t.Errorf("got new projects %+v, want project new", d.NewProjects)
+	}
+	if len(d.DeletedProjects) != 1 || d.DeletedProjects[0].Name != localProjects[2].Name {
+		t.Errorf("got deleted projects %+v, want project %s", d.DeletedProjects, localProjects[2].Name)
+	}
+	updated := make(map[string]DiffProject)
+	for _, p := range d.UpdatedProjects {
+		updated[p.Name] = p
+	}
+	if _, ok := updated[jiritest.ManifestProjectName]; !ok {
+		t.Errorf("expected the manifest project to be updated, got %+v", d.UpdatedProjects)
+	}
+	if p := updated[localProjects[0].Name]; p.Commits != 1 || p.DroppedCommits != 0 || !reflect.DeepEqual(p.Authors, []string{"John Doe"}) || len(p.Log) != 1 {
+		t.Errorf("got %+v, want 1 commit by John Doe", p)
+	}
+	if p := updated[localProjects[1].Name]; p.OldPath != localProjects[1].Path || p.Path != filepath.Join(fake.X.Root, "moved-1") || p.OldRevision != "" {
+		t.Errorf("got %+v, want project moved from %s to moved-1", p, localProjects[1].Path)
+	}
+
+	// Nothing was checked out.
+	if data, err := ioutil.ReadFile(fake.X.JiriManifestFile()); err != nil || string(data) != string(jiriManifest) {
+		t.Errorf("expected %s to be unchanged, got %q, %v", fake.X.JiriManifestFile(), data, err)
+	}
+	if _, err := os.Stat(filepath.Join(fake.X.Root, "new")); err == nil {
+		t.Errorf("expected project new not to be checked out")
+	}
+	if _, err := os.Stat(localProjects[1].Path); err != nil {
+		t.Errorf("expected project %s not to be moved: %v", localProjects[1].Name, err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/btwiuse/jiri/jiritest"
@@ -175,3 +176,55 @@ func TestDiffSnapshotsUrl(t *testing.T) {
 		t.Fatalf("Error, got: %s\n\nwant:%s", got, want)
 	}
 }
+
+func TestDiffWorkspaceText(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+	if err := fake.CreateRemoteProject("p1"); err != nil {
+		t.Fatal(err)
+	}
+	p := project.Project{
+		Name:   "p1",
+		Path:   filepath.Join(fake.X.Root, "p1"),
+		Remote: fake.Projects["p1"],
+	}
+	if err := fake.AddProject(p); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fake.X, fake.Projects["p1"], "file1", "first commit")
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(fake.X.Root, "snapshot")
+	if err := project.CreateSnapshot(fake.X, snapshot, nil, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fake.X, fake.Projects["p1"], "file2", "second commit")
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	diffFlags.text = true
+	diffFlags.cls = false
+	diffFlags.maxCls = 5
+	defer func() {
+		diffFlags.text = false
+		diffFlags.cls = true
+	}()
+	stdout, _, err := runfunc(func() {
+		if err := runDiff(fake.X, []string{snapshot}); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Updated projects:\n  p1\n    revision: ", " second commit\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("got output:\n%s\nwant substr %q", stdout, want)
+		}
+	}
+	if strings.Contains(stdout, "first commit") {
+		t.Errorf("got output:\n%s\nwant no %q", stdout, "first commit")
+	}
+}
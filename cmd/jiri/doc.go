@@ -12,172 +12,506 @@ Usage:
    jiri [flags] <command>
 
 The jiri commands are:
-   cl          Manage changelists for multiple projects
-   import      Adds imports to .jiri_manifest file
-   project     Manage the jiri projects
-   snapshot    Manage project snapshots
-   update      Update all jiri projects
-   which       Show path to the jiri tool
-   runp        Run a command in parallel across jiri projects
-   help        Display help for commands or topics
+   attributes          List or select the attributes of optional projects and
+                       packages
+   bisect              Find the first bad manifest revision with a test command
+   branch              Show, create, switch or delete branches
+   bootstrap           Bootstrap essential packages
+   cache               Manage the git cache of a jiri root
+   completion          Print a shell completion script
+   diff                Prints diff between two snapshots
+   diff-manifest       Prints what jiri update would do for a manifest revision
+   doctor              Check the health of the jiri root
+   edit                Edit manifest file
+   fetch-packages      Fetch cipd packages using JIRI_HEAD version manifest
+   gc                  Delete projects that are no longer in the manifest
+   generate-gitmodules Create a .gitmodule and a .gitattributes files for git
+                       submodule repository
+   grep                Search across projects.
+   import              Adds imports to .jiri_manifest file
+   init                Create a new jiri root
+   package             Display the jiri packages
+   patch               Patch in the existing change
+   project             Manage the jiri projects
+   project-config      Prints/sets project's local config
+   manifest            Reads <import>, <project> or <package> information from a
+                       manifest file
+   manifest-export     Export the projects of a manifest to another meta-tool
+   manifest-import     Convert the manifest of another meta-tool to a jiri
+                       manifest
+   manifest-lint       Check a manifest file for problems
+   metrics             Report where the time of jiri update goes
+   override            Add overrides to .jiri_manifest file
+   relocate            Move the jiri root to a new directory
+   resolve             Generate jiri lockfile
+   rollback            Restore the projects to their state before the last
+                       update
+   run-hooks           Run hooks using local manifest
+   runp                Run a command in parallel across jiri projects
+   selfupdate          Update jiri tool
+   serve               Serve the state of the jiri root over a local JSON API
+   snapshot            Create a new project snapshot
+   source-manifest     Create a new source-manifest from current checkout
+   status              Prints status of all the projects
+   sync                Update the projects without local work, optionally
+                       continuously
+   update              Update all jiri projects
+   upload              Upload a changelist for review
+   version             Print the jiri version
+   view                List or select workspace views
+   workspace           Manage the jiri roots of the user
+   help                Display help for commands or topics
 
 The jiri additional help topics are:
-   filesystem  Description of jiri file system layout
-   manifest    Description of manifest files
-
-The jiri flags are:
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+   filesystem     Description of jiri file system layout
+   manifest-files Description of manifest files
 
 The global flags are:
+ -color=auto
+   Use color to format output. Values can be always, never and auto
+ -j=2
+   Number of jobs (commands) to run simultaneously
+ -log-format=text
+   Format of log output. Values can be text and json. json disables color and
+   progress.
  -metadata=<just specify -metadata to activate>
    Displays metadata for the program and exits.
+ -no-write=false
+   Do not modify the jiri root, its projects, manifests and cache. Commands that
+   would modify them fail.
+ -offline=false
+   Make jiri update, and the loading of manifests, work without network access,
+   failing with a list of what is missing locally. Other commands, e.g. upload,
+   still access the network.
+ -progress-window=5
+   Number of progress messages to show simultaneously. Should be between 1 and
+   10
+ -q=false
+   Same as -quiet
+ -quiet=false
+   Only print user actionable messages.
+ -root=
+   Jiri root directory
+ -show-progress=true
+   Show progress.
+ -show-root=<just specify -show-root to activate>
+   Displays jiri root and exits.
  -time=false
    Dump timing information to stderr before exiting the program.
+ -time-log-threshold=10s
+   Log time taken by operations if more than the passed value (eg 5s). This only
+   works with -v and -vv.
+ -v=false
+   Print debug level output.
+ -vv=false
+   Print trace level output.
+
+Jiri attributes - List or select the attributes of optional projects and packages
 
-Jiri cl - Manage changelists for multiple projects
+Projects and packages in manifests can be tagged with a comma-separated list of
+attributes, e.g. attributes="tools,optional".  Tagged projects and packages are
+optional: "jiri update" only fetches them if one of their attributes was
+selected with "jiri init -fetch-optional" or with this command.
 
-Manage changelists for multiple projects.
+Without flags, lists every attribute used by the manifest, followed by the
+projects and packages that it pulls in.  Selected attributes are marked with
+'*'.  With <attribute> arguments, only these attributes are listed.
 
 Usage:
-   jiri cl [flags] <command>
+   jiri attributes [flags] [<attribute>...]
 
-The jiri cl commands are:
-   cleanup     Clean up changelists that have been merged
-   upload      Upload a changelist for review
-   new         Create a new local branch for a changelist
-   sync        Bring a changelist up to date
+<attribute>... is the list of attributes to show.
 
-The jiri cl flags are:
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+The jiri attributes flags are:
+ -disable=
+   Comma-separated list of attributes to remove from the selected ones.
+ -enable=
+   Comma-separated list of attributes to add to the selected ones.
+
+Jiri bisect - Find the first bad manifest revision with a test command
+
+Binary-searches the revisions of a manifest repository imported by
+.jiri_manifest, between -good and -bad, for the first one for which the test
+command fails. For each revision tested, the import is pinned to the revision
+and all the projects are updated to the state it describes, then the test
+command is run from the current directory. The revision is good if the command
+exits with 0, bad otherwise, and skipped if it exits with 125. The revision is
+also passed to the command in $JIRI_BISECT_REVISION.
+
+With -snapshots, the given snapshot files are bisected instead, the first one
+being good and the last one bad.
 
-Jiri cl cleanup - Clean up changelists that have been merged
+.jiri_manifest is locked against changes by other jiri commands, such as "jiri
+override", until it is restored when bisect is done or interrupted. Until then,
+its original content is also kept in .jiri_root/bisect_manifest, from which it
+can be restored by hand if jiri bisect is killed. The projects are left at the
+first bad state, run "jiri update" to go back.
 
-Command "cleanup" checks that the given branches have been merged into the
-corresponding remote branch. If a branch differs from the corresponding remote
-branch, the command reports the difference and stops. Otherwise, it deletes the
-given branches.
+Usage:
+   jiri bisect [flags] <command>
+
+<command> is the test command and its arguments, use -- to separate its flags
+from the flags of jiri bisect.
+
+The jiri bisect flags are:
+ -bad=HEAD
+   Manifest revision known to be bad.
+ -fetch-packages=true
+   Use cipd to fetch packages for each state.
+ -good=
+   Manifest revision known to be good.
+ -import=
+   Name of the import of .jiri_manifest to bisect. Required if there are
+   several.
+ -lock-timeout=30s
+   Time to wait for other jiri processes to finish modifying .jiri_manifest.
+ -run-hooks=true
+   Run hooks after checking out each state.
+ -snapshots=
+   Comma-separated snapshot files to bisect instead of manifest revisions, from
+   good to bad.
+
+Jiri branch - Show, create, switch or delete branches
+
+Show all the projects having branch <branch> .If -d or -D is passed, <branch> is
+deleted. if <branch> is not passed, show all projects which have branches other
+than "master"
+
+If -create is passed, <branch> is created in the projects listed in -projects,
+tracking their remote branch, and checked out. jiri remembers these projects, so
+that "jiri branch -checkout", "jiri branch -d/-D" and "jiri upload -multipart"
+act on exactly them.
 
 Usage:
-   jiri cl cleanup [flags] <branches>
+   jiri branch [flags] <branch>
+
+<branch> is the name branch
+
+The jiri branch flags are:
+ -D=false
+   Force delete branch from project. Similar to running 'git branch -D
+   <branch-name>'
+ -checkout=false
+   Check out <branch> in the projects it was created in, or in all projects
+   having it if it was not created with -create.
+ -create=false
+   Create <branch> in the projects listed in -projects and check it out.
+ -d=false
+   Delete branch from project. Similar to running 'git branch -d <branch-name>'
+ -delete-merged=false
+   Delete merged branches. Merged branches are the tracked branches merged with
+   their tracking remote or un-tracked branches merged with the branch specified
+   in manifest(default master). If <branch> is provided, it will only delete
+   branch <branch> if merged.
+ -delete-merged-cl=false
+   Implies -delete-merged. It also parses commit messages for ChangeID and
+   checks with gerrit if those changes have been merged and deletes those
+   branches. It will ignore a branch if it differs with remote by more than 10
+   commits.
+ -list=false
+   Show only projects with current branch <branch>
+ -override-pc=false
+   Overrrides project config's ignore and noupdate flag and deletes the branch.
+ -projects=
+   Comma-separated list of project names or keys to create the branch in. Used
+   with -create.
 
-<branches> is a list of branches to cleanup.
+Jiri bootstrap - Bootstrap essential packages
 
-The jiri cl cleanup flags are:
- -f=false
-   Ignore unmerged changes.
- -remote-branch=master
-   Name of the remote branch the CL pertains to, without the leading "origin/".
+Bootstrap essential packages such as cipd.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Usage:
+   jiri bootstrap [flags] <package ...>
 
-Jiri cl upload - Upload a changelist for review
+<package ...> is a list of packages that can be bootstrapped by jiri. If the
+list is empty, jiri will list supported packages.
 
-Command "upload" squashes all commits of a local branch into a single "changelist"
-and uploads this changelist to Gerrit as a single commit. First time the command
-is invoked, it generates a Change-Id for the changelist, which is appended to
-the commit message. Consecutive invocations of the command use the same
-Change-Id by default, informing Gerrit that the incomming commit is an update of
-an existing changelist.
+Jiri cache - Manage the git cache of a jiri root
+
+Jiri keeps bare mirrors of the projects of a workspace in the cache directory
+set with "jiri init -cache".  New projects are cloned with --reference to these
+mirrors, which saves network and disk when many workspaces share one cache, as
+on CI machines.  With "jiri init -dissociate=true", the borrowed objects are
+copied into new projects so that they keep working if the cache is removed.
 
 Usage:
-   jiri cl upload [flags]
+   jiri cache [flags] <command>
 
-The jiri cl upload flags are:
- -autosubmit=false
-   Automatically submit the changelist when feasible.
- -cc=
-   Comma-seperated list of emails or LDAPs to cc.
- -check-uncommitted=true
-   Check that no uncommitted changes exist.
- -clean-multipart-metadata=false
-   Cleanup the metadata associated with multipart CLs pertaining the MultiPart:
-   x/y message without uploading any CLs.
- -commit-message-body-file=
-   file containing the body of the CL description, that is, text without a
-   ChangeID, MultiPart etc.
- -current-project-only=false
-   Run upload in the current project only.
- -d=false
-   Send a draft changelist.
- -edit=true
-   Open an editor to edit the CL description.
- -host=
-   Gerrit host to use.  Defaults to gerrit host specified in manifest.
- -m=
-   CL description.
- -presubmit=all
-   The type of presubmit tests to run. Valid values: none,all.
- -r=
-   Comma-seperated list of emails or LDAPs to request review.
- -remote-branch=master
-   Name of the remote branch the CL pertains to, without the leading "origin/".
- -set-topic=true
-   Set Gerrit CL topic.
- -topic=
-   CL topic, defaults to <username>-<branchname>.
- -verify=true
-   Run pre-push git hooks.
+The jiri cache commands are:
+   update      Create or refresh the cache mirrors of all projects
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Jiri cache update - Create or refresh the cache mirrors of all projects
+
+Creates or refreshes the cache mirror of every project of the manifest, honoring
+the optional attributes selected with "jiri init -fetch-optional", without
+updating the projects of the workspace.
+
+Usage:
+   jiri cache update [flags]
+
+Jiri completion - Print a shell completion script
 
-Jiri cl new - Create a new local branch for a changelist
+Prints a script completing jiri commands, subcommands and flags for the given
+shell, one of bash, zsh or fish. The script is generated from the commands
+compiled into this jiri binary, regenerate it after updating jiri.
 
-Command "new" creates a new local branch for a changelist. In particular, it
-forks a new branch with the given name from the current branch and records the
-relationship between the current branch and the new branch in the .jiri metadata
-directory. The information recorded in the .jiri metadata directory tracks
-dependencies between CLs and is used by the "jiri cl sync" and "jiri cl upload"
-commands.
+To enable completion, add to ~/.bashrc:
+  source <(jiri completion bash)
+to ~/.zshrc:
+  source <(jiri completion zsh)
+or to ~/.config/fish/config.fish:
+  jiri completion fish | source
 
 Usage:
-   jiri cl new [flags] <name>
+   jiri completion [flags] <shell>
+
+<shell> is bash, zsh or fish.
+
+Jiri diff - Prints diff between two snapshots
+
+Prints diff between two snapshots in json format, or as a human-readable summary
+if -text is set. Max CLs returned for a project is controlled by flag max-xls
+and is default by 5. For updated projects that are checked out in the workspace,
+the one-line log of the commits between the two revisions is returned as well,
+up to the same limit. The format of returned json: {
+	new_projects: [
+		{
+			name: name,
+			path: path,
+			remote: remote,
+			revision: rev
+		},{...}...
+	],
+	deleted_projects:[
+		{
+			name: name,
+			path: path,
+			remote: remote,
+			revision: rev
+		},{...}...
+	],
+	updated_projects:[
+		{
+			name: name,
+			path: path,
+			remote: remote,
+			revision: rev
+			old_revision: old-rev, // if updated
+			old_path: old-path //if moved
+			cls:[
+				{
+					number: num,
+					url: url,
+					commit: commit,
+					subject:sub
+				},{...},...
+			]
+			log: ["hash subject", ...],
+			has_more_cls: true,
+			error: error in retrieving CL
+		},{...}...
+	]
+}
 
-<name> is the changelist name.
+Usage:
+   jiri diff [flags] <snapshot-1> [<snapshot-2>]
+
+<snapshot-1/2> are files or urls containing snapshot. If <snapshot-2> is
+omitted, <snapshot-1> is compared against the current state of the workspace
+
+The jiri diff flags are:
+ -cls=true
+   Return CLs for changed projects
+ -indent=true
+   Indent json output
+ -max-cls=5
+   Max number of CLs returned per changed project
+ -text=false
+   Print a human-readable summary instead of json
+
+Jiri diff-manifest - Prints what jiri update would do for a manifest revision
+
+Prints the changes "jiri update" would make to the projects if the import of
+.jiri_manifest was pinned to the given revision or branch of its manifest
+repository, without changing .jiri_manifest or any project: the projects which
+would be added, removed or moved, and for the projects which would be updated,
+their old and new revisions with the number of commits and the authors in
+between. Only the manifest repository is fetched, the revisions of the other
+projects are resolved as last fetched. With the global -no-write flag, nothing
+is written to the jiri root and the manifest repository is not fetched either.
+
+The diff is printed in the json format of "jiri diff", with the additional
+commits, dropped_commits and authors fields for updated projects, or as a
+human-readable summary if -text is set.
 
-The jiri cl new flags are:
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Usage:
+   jiri diff-manifest [flags] <revision>
+
+<revision> is a revision or a branch of the manifest repository, HEAD being the
+head of its remote branch.
+
+The jiri diff-manifest flags are:
+ -import=
+   Name of the import of .jiri_manifest to diff. Required if there are several.
+ -indent=true
+   Indent json output
+ -max-log=5
+   Max number of commits logged per updated project
+ -text=false
+   Print a human-readable summary instead of json
+
+Jiri doctor - Check the health of the jiri root
+
+Runs a series of checks on the jiri root and its environment and prints, for
+each of them, whether it passed, produced a warning or failed, along with a
+suggested fix:
+
+  root        .jiri_root and .jiri_manifest exist
+  git         git is installed and recent enough
+  identity    git user.name and user.email are set
+  credentials the credential helpers and token variables in the config exist
+  manifest    the manifest loads
+  remotes     the remote manifest repositories are reachable (skipped with
+              the global -offline flag)
+  projects    the projects of the manifest are checked out
+  symlinks    no symlink at the top of the root or of a project is dangling
+  disk        there is enough free disk space
+
+The command fails if any check fails, or with -strict if any check produces a
+warning, so that it can gate CI jobs.
 
-Jiri cl sync - Bring a changelist up to date
+Usage:
+   jiri doctor [flags]
 
-Command "sync" brings the CL identified by the current branch up to date with
-the branch tracking the remote branch this CL pertains to. To do that, the
-command uses the information recorded in the .jiri metadata directory to
-identify the sequence of dependent CLs leading to the current branch. The
-command then iterates over this sequence bringing each of the CLs up to date
-with its ancestor. The end result of this process is that all CLs in the
-sequence are up to date with the branch that tracks the remote branch this CL
-pertains to.
+The jiri doctor flags are:
+ -strict=false
+   Fail on warnings too.
 
-NOTE: It is possible that the command cannot automatically merge changes in an
-ancestor into its dependent. When that occurs, the command is aborted and prints
-instructions that need to be followed before the command can be retried.
+Jiri edit - Edit manifest file
+
+Edit manifest file by rolling the revision of provided projects, imports or
+packages
 
 Usage:
-   jiri cl sync [flags]
+   jiri edit [flags] <manifest>
+
+<manifest> is path of the manifest
+
+The jiri edit flags are:
+ -edit-mode=both
+   Edit mode. It can be 'manifest' for updating project revisions in manifest
+   only, 'lockfile' for updating project revisions in lockfile only or 'both'
+   for updating project revisions in both files.
+ -import=
+   List of imports to update. It is of form <import-name>=<revision> where
+   revision is optional. It can be specified multiple times.
+ -json-output=
+   File to print changes to, in json format.
+ -package=
+   List of packages to update. It is of form <package-name>=<version>. It can be
+   specified multiple times.
+ -project=
+   List of projects to update. It is of form <project-name>=<revision> where
+   revision is optional. It can be specified multiple times.
 
-The jiri cl sync flags are:
- -remote-branch=master
-   Name of the remote branch the CL pertains to, without the leading "origin/".
+Jiri fetch-packages
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Fetch cipd packages using local manifest JIRI_HEAD version if -local-manifest
+flag is false, otherwise it fetches cipd packages using current manifest
+checkout version.
+
+Usage:
+   jiri fetch-packages [flags]
+
+The jiri fetch-packages flags are:
+ -attempts=1
+   Number of attempts before failing.
+ -fetch-packages-timeout=20
+   Timeout in minutes for fetching prebuilt packages using cipd.
+ -local-manifest=false
+   Use local checked out manifest.
+
+Jiri gc - Delete projects that are no longer in the manifest
+
+Lists the projects under the jiri root that are not part of the manifest any
+more, e.g. because they were removed from it, are optional and not selected, or
+are not in the selected view. With -f, these projects are deleted.
+
+Projects with branches or local changes are kept unless -force-dirty is passed.
+Projects containing other projects are always kept.
+
+Unlike "jiri update -gc", this does not fetch or update anything.
+
+Usage:
+   jiri gc [flags]
+
+The jiri gc flags are:
+ -f=false
+   Delete the projects instead of listing them.
+ -force-dirty=false
+   With -f, also delete projects with branches or local changes.
+
+Jiri generate-gitmodules - Create a .gitmodule and a .gitattributes files for git submodule repository
+
+The "jiri generate-gitmodules command captures the current project state and
+create a .gitmodules file and an optional .gitattributes file for building a git
+submodule based super repository.
+
+Usage:
+   jiri generate-gitmodules [flags] <.gitmodule path> [<.gitattributes path>]
+
+<.gitmodule path> is the path to the output .gitmodule file. <.gitattributes
+path> is the path to the output .gitattribute file, which is optional.
+
+The jiri generate-gitmodules flags are:
+ -generate-script=
+   File to save generated git commands for seting up a superproject.
+ -redir-root=false
+   When set to true, jiri will add the root repository as a submodule into
+   {name}-mirror directory and create necessary setup commands in generated
+   script.
+
+Jiri grep
+
+Run git grep across all projects.
+
+Usage:
+   jiri grep [flags] <query> [--] [<pathspec>...]
+
+The jiri grep flags are:
+ -E=false
+   Use POSIX extended regular expressions for patterns
+ -F=false
+   Use fixed strings for patterns, don't interpret pattern as a regex
+ -H=true
+   Does nothing. Just makes this git grep compatible
+ -L=false
+   Instead of showing every matched line, show only the names of files that do
+   not contain matches
+ -cwd-rel=false
+   Output paths relative to the current working directory (if available)
+ -e=
+   The next parameter is the pattern. This option has to be used for patterns
+   starting with -
+ -extended-regexp=false
+   same as -E
+ -files-with-matches=false
+   same as -l
+ -files-without-match=false
+   same as -L
+ -fixed-strings=false
+   same as -F
+ -i=false
+   Ignore case differences between the patterns and the files
+ -l=false
+   Instead of showing every matched line, show only the names of files that
+   contain matches
+ -n=false
+   Prefix the line number to matching lines
+ -name-only=false
+   same as -l
+ -w=false
+   Match the pattern only at word boundary
 
 Jiri import
 
@@ -202,33 +536,127 @@ Usage:
 <remote> specifies the remote manifest repository.
 
 The jiri import flags are:
+ -delete=false
+   Delete existing import. Import is matched using <manifest>, <remote> and
+   name. <remote> is optional.
+ -json-output=
+   Json output file from -list flag.
+ -list=false
+   List all the imports from .jiri_manifest. This flag doesn't accept any
+   arguments. -json-out flag can be used to specify json output file.
+ -lock-timeout=30s
+   Time to wait for other jiri processes to finish modifying .jiri_manifest.
  -name=manifest
    The name of the remote manifest project.
  -out=
-   The output file.  Uses [root]/.jiri_manifest if unspecified.  Uses stdout
-   if set to "-".
+   The output file.  Uses <root>/.jiri_manifest if unspecified.  Uses stdout if
+   set to "-".
  -overwrite=false
    Write a new .jiri_manifest file with the given specification.  If it already
    exists, the existing content will be ignored and the file will be
    overwritten.
- -protocol=git
-   The version control protocol used by the remote manifest project.
  -remote-branch=master
    The branch of the remote manifest project to track, without the leading
    "origin/".
+ -revision=
+   Revision to check out for the remote.
  -root=
    Root to store the manifest project locally.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Jiri init - Create a new jiri root
+
+The "init" command creates new jiri "root" - basically a [root]/.jiri_root
+directory and template files.
+
+Running "init" in existing jiri [root] is safe.
+
+Authentication to HTTPS remotes can be configured per host in
+[root]/.jiri_root/config, either with a git credential helper or with the name
+of an environment variable holding an access token:
+
+	<config>
+	  <credentials>
+	    <credential host="github.com" tokenEnv="GITHUB_TOKEN" username="x-access-token"/>
+	    <credential host="git.example.com" helper="store"/>
+	  </credentials>
+	</config>
+
+Git never prompts for credentials while jiri fetches or clones projects;
+authentication failures are reported with advice on how to fix them instead.
+
+Usage:
+   jiri init [flags] [directory]
+
+If you provide a directory, the command is run inside it. If this directory does
+not exists, it will be created.
+
+The jiri init flags are:
+ -analytics-opt=
+   Opt in/out of analytics collection. Takes true/false
+ -cache=
+   Jiri cache directory.
+ -cipd-max-threads=0
+   Number of threads to use for unpacking CIPD packages. If zero, uses all CPUs.
+ -cipd-paranoid-mode=
+   Whether to use paranoid mode in cipd.
+ -dissociate=
+   Copy the objects borrowed from the cache into new projects, so that they do
+   not depend on the cache. Takes true/false.
+ -enable-lockfile=
+   Enable lockfile enforcement
+ -fetch-optional=[ATTRIBUTES_NOT_SET]
+   Set up attributes of optional projects and packages that should be fetched by
+   jiri.
+ -keep-git-hooks=
+   Whether to keep current git hooks in '.git/hooks' when doing 'jiri update'.
+   Takes true/false.
+ -lockfile-name=
+   Set up filename of lockfile
+ -metrics=
+   Record the time spent in each phase of 'jiri update' in .jiri_root/metrics,
+   see 'jiri help metrics'. Nothing leaves the machine. Takes true/false.
+ -partial=false
+   Whether to use a partial checkout.
+ -prebuilt-json=
+   Set up filename for prebuilt json file
+ -rewrite-sso-to-https=
+   Rewrites sso fetches, clones, etc to https. Takes true/false.
+ -shared=false
+   [DEPRECATED] All caches are shared.
+ -show-analytics-data=false
+   Show analytics data that jiri collect when you opt-in and exits.
+ -sso-cookie-path=
+   Path to master SSO cookie file.
+ -update-history-depth=-1
+   Number of snapshots taken before and after 'jiri update' to keep in
+   .jiri_root/update_history for 'jiri rollback'. 0 restores the default of 10.
+ -view=[VIEW_NOT_SET]
+   Name of the view declared in .jiri_manifest that 'jiri update' should sync.
+
+Jiri package - Display the jiri packages
+
+Display structured info on the existing
+	packages and branches. Packages are specified using either names or	regular
+	expressions that are matched against package names. If no command line
+	arguments are provided all projects will be used.
+
+Usage:
+   jiri package [flags] <package ...>
+
+<package ...> is a list of packages to give info about.
+
+The jiri package flags are:
+ -json-output=
+   Path to write operation results to.
+ -regexp=false
+   Use argument as regular expression.
 
 Jiri patch - Patch in the existing change
 
 Command "patch" applies the existing changelist to the current project. The
 change can be identified either using change ID, in which case the latest
-patchset will be used, or the the full reference.
+patchset will be used, or the the full reference. By default patch will be
+checked-out on a new branch.
 
 A new branch will be created to apply the patch to. The default name of this
 branch is "change/<changeset>/<patchset>", but this can be overriden using the
@@ -236,185 +664,437 @@ branch is "change/<changeset>/<patchset>", but this can be overriden using the
 flag will delete the branch if already exists. Use the -force flag to force
 deleting the branch even if it contains unmerged changes).
 
+if -topic flag is true jiri will fetch whole topic and will try to apply to
+individual projects. Patch will assume topic is of form {USER}-{BRANCH} and will
+try to create branch name out of it. If this fails default branch name will be
+same as topic. Currently patch does not support the scenario when change "B" is
+created on top of "A" and both have same topic.
+
 Usage:
-   jiri patch <change>
+   jiri patch [flags] <change or topic>
 
-<change> is a change ID or a full reference.
+<change or topic> is a change ID, full reference or topic when -topic is true.
 
-The jiri project info flags are:
+The jiri patch flags are:
  -branch=
    Name of the branch the patch will be applied to
+ -cherry-pick=false
+   Cherry-pick patches instead of checking out.
  -delete=false
    Delete the existing branch if already exists
  -force=false
    Use force when deleting the existing branch
  -host=
-   Gerrit host to use.  Defaults to gerrit host specified in manifest.
-
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+   Gerrit host to use. Defaults to gerrit host specified in manifest.
+ -no-branch=false
+   Don't create the branch for the patch.
+ -project=
+   Project to apply patch to. This cannot be passed with topic flag.
+ -rebase=false
+   Rebase the change after downloading
+ -rebase-revision=
+   Rebase the change to a specific revision after downloading
+ -topic=false
+   Patch whole topic.
 
 Jiri project - Manage the jiri projects
 
-Manage the jiri projects.
+Cleans all projects if -clean flag is provided else inspect
+	the local filesystem and provide structured info on the existing
+	projects and branches. Projects are specified using either names or
+	regular expressions that are matched against project names. If no
+	command line arguments are provided the project that the contains the
+	current directory is used, or if run from outside of a given project,
+	all projects will be used. The information to be displayed can be
+	specified using a Go template, supplied via
+the -template flag.
+
+With -deprecated, only the projects marked as deprecated by the manifest are
+listed, with the message and the replacement given by the manifest.
+
+With -add or -remove, a <project> element is added to or removed from the
+[root]/.jiri_manifest file instead. The file is edited in place, so that
+comments and the order of its elements are kept.
+
+Example:
+  $ jiri project -add -path=src/foo foo https://foo.com/foo.git
 
 Usage:
-   jiri project [flags] <command>
+   jiri project [flags] <project ...>
 
-The jiri project commands are:
-   clean        Restore jiri projects to their pristine state
-   info         Provided structured input for existing jiri projects and
-                branches
-   list         List existing jiri projects and branches
-   shell-prompt Print a succinct status of projects suitable for shell prompts
+<project ...> is a list of projects to clean up or give info about. With -add,
+the arguments are <name> <remote>, with -remove <name> [<remote>].
 
 The jiri project flags are:
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+ -add=false
+   Add project <name> with remote <remote> to .jiri_manifest.
+ -clean=false
+   Restore jiri projects to their pristine state.
+ -clean-all=false
+   Restore jiri projects to their pristine state and delete all branches.
+ -deprecated=false
+   Only list the deprecated projects, of all projects if no project is given.
+ -gerrithost=
+   Gerrit host of the project added with -add.
+ -json-output=
+   Path to write operation results to.
+ -list-remote-projects=false
+   List remote projects instead of local projects.
+ -lock-timeout=30s
+   Time to wait for other jiri processes to finish modifying .jiri_manifest.
+ -override=false
+   Add or remove a project override instead of a project. Used with -add and
+   -remove.
+ -path=
+   Path of the project added with -add.
+ -regexp=false
+   Use argument as regular expression.
+ -remote-branch=
+   Remote branch of the project added with -add.
+ -remove=false
+   Remove project <name> from .jiri_manifest. If <remote> is given, only the
+   project with that remote is removed.
+ -revision=
+   Revision of the project added with -add.
+ -template=
+   The template for the fields to display.
 
-Jiri project clean - Restore jiri projects to their pristine state
+Jiri project-config
 
-Restore jiri projects back to their master branches and get rid of all the local
-branches and changes.
+Prints/Manages local project config. This command should be run from inside a
+project. It will print config if no flags are provided otherwise set it.
 
 Usage:
-   jiri project clean [flags] <project ...>
+   jiri project-config [flags]
+   jiri project-config [flags] <command>
+
+The jiri project-config commands are:
+   verify      Reports projects whose git config differs from the manifest
+
+The jiri project-config flags are:
+ -ignore=
+   This can be true or false. If set to true project would be completely ignored
+   while updating
+ -no-rebase=
+   This can be true or false. If set to true local branch won't be rebased or
+   merged.
+ -no-update=
+   This can be true or false. If set to true project won't be updated
+ -on-conflict=
+   What "jiri update" does when local work is in the way: fail, skip, stash,
+   backup, rebase or prompt. See "jiri help update".
+
+Jiri project-config verify - Reports projects whose git config differs from the manifest
+
+Reports the projects whose git config variables, declared by the gitconfig
+elements of the manifest, or git hooks installed by jiri, such as the gerrit
+commit-msg hook, differ from what "jiri update" sets, and fails if there are
+any. All the projects are checked if none is given.
 
-<project ...> is a list of projects to clean up.
+Usage:
+   jiri project-config verify [flags] [<project>...]
 
-The jiri project clean flags are:
- -branches=false
-   Delete all non-master branches.
+<project> is the name of a project to check.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+The jiri project-config verify flags are:
+ -ignore=
+   This can be true or false. If set to true project would be completely ignored
+   while updating
+ -no-rebase=
+   This can be true or false. If set to true local branch won't be rebased or
+   merged.
+ -no-update=
+   This can be true or false. If set to true project won't be updated
+ -on-conflict=
+   What "jiri update" does when local work is in the way: fail, skip, stash,
+   backup, rebase or prompt. See "jiri help update".
 
-Jiri project info - Provided structured input for existing jiri projects and branches
+Jiri manifest
 
-Inspect the local filesystem and provide structured info on the existing
-projects and branches. Projects are specified using either names or regular
-expressions that are matched against project names. If no command line
-arguments are provided the project that the contains the current directory is
-used, or if run from outside of a given project, all projects will be used. The
-information to be displayed can be specified using a Go template, supplied via
-the -template flag.
+Reads <import>, <project> or <package> information from a manifest file.
+	A template matching the schema defined in pkg/text/template is used to fill
+	in the requested information.  Some examples:
+
+	    Read project's 'remote' attribute:
+	        manifest -element=$PROJECT_NAME -template="{{.Remote}}"
+
+	    Read import's 'path' attribute:
+	        manifest -element=$IMPORT_NAME -template="{{.Path}}"
+
+	    Read packages's 'version' attribute:
+	        manifest -element=$PACKAGE_NAME -template="{{.Version}}"
+
+	With -explain, all imports of the manifest are resolved and the chain of
+	manifests through which the named project was included is printed, along
+	with whether an override applied to it.  The manifest defaults to
+	.jiri_manifest in that case:
+	        manifest -explain=$PROJECT_NAME
+
+	Run "jiri manifest-lint" to check a manifest, "jiri manifest-export" to
+	export its projects to another meta-tool and "jiri manifest-import" to
+	convert the manifest of another meta-tool.
 
 Usage:
-   jiri project info [flags] <project-names>...
+   jiri manifest [flags] <manifest>
 
-<project-names>... a list of project names
+<manifest> is the manifest file.
 
-The jiri project info flags are:
- -json-output=
-   Path to write operation results to.
- -regexp=false
-   Use argument as regular expression.
+The jiri manifest flags are:
+ -element=
+   Name of the <project>, <import> or <package>.
+ -explain=
+   Name of the <project> to explain the resolution of.
  -template=
    The template for the fields to display.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Jiri manifest-export - Export the projects of a manifest to another meta-tool
 
-Jiri project list - List existing jiri projects and branches
+Resolves the manifest and writes its projects in the format of another
+meta-tool, to move a workspace to it or mirror it there. Packages and hooks are
+not exported, nor are the projects at the jiri root.
 
-Inspect the local filesystem and list the existing projects and branches.
+Projects with attributes, which jiri does not fetch by default, are excluded by
+default in the other tool as well when it supports it.
 
 Usage:
-   jiri project list [flags]
+   jiri manifest-export [flags] [<manifest>]
 
-The jiri project list flags are:
- -branches=false
-   Show project branches.
- -nopristine=false
-   If true, omit pristine projects, i.e. projects with a clean master branch and
-   no other branches.
+<manifest> is the manifest file, .jiri_manifest by default.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+The jiri manifest-export flags are:
+ -format=repo
+   Format to export to: repo (an Android repo manifest), gclient (the deps of a
+   DEPS file), gitmodules or west (a Zephyr west manifest).
+ -o=
+   File to write the export to, instead of stdout.
+ -pin=false
+   Pin the projects to their local revisions, instead of the revisions, or
+   branches, of the manifest.
 
-Jiri project shell-prompt - Print a succinct status of projects suitable for shell prompts
+Jiri manifest-import - Convert the manifest of another meta-tool to a jiri manifest
 
-Reports current branches of jiri projects (repositories) as well as an
-indication of each project's status:
-  *  indicates that a repository contains uncommitted changes
-  %  indicates that a repository contains untracked files
+Converts an Android repo manifest, with the manifests it includes, to a jiri
+manifest. Projects keep the revision of their remote or of the <default>
+element, those in the notdefault group get attributes, and the review host of
+their remote becomes their gerrit host.
 
 Usage:
-   jiri project shell-prompt [flags]
+   jiri manifest-import [flags] <manifest>
 
-The jiri project shell-prompt flags are:
- -check-dirty=true
-   If false, don't check for uncommitted changes or untracked files. Setting
-   this option to false is dangerous: dirty master branches will not appear in
-   the output.
- -show-name=false
-   Show the name of the current repo.
+<manifest> is the manifest file to convert.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+The jiri manifest-import flags are:
+ -from=repo
+   Format of the manifest, only repo is supported.
+ -manifest-url=
+   Url of the repo manifest repository, which relative fetch urls of remotes are
+   resolved against.
+ -o=
+   File to write the jiri manifest to, instead of stdout.
 
-Jiri snapshot - Create a new project snapshot
+Jiri manifest-lint - Check a manifest file for problems
 
-The "jiri snapshot <snapshot>" command captures the current project state
-in a manifest.
+Checks the manifest and prints its problems: unknown elements and attributes,
+projects sharing a name or a path or nested inside each other, and with
+-resolve, projects of different imports shadowing each other, unused overrides
+and replacements of deprecated projects which are not in the manifest.
+
+The command fails if any finding is an error.
 
 Usage:
-   jiri snapshot [flags] <snapshot>
+   jiri manifest-lint [flags] [<manifest>]
 
-<snapshot> is the snapshot manifest file.
+<manifest> is the manifest file, .jiri_manifest by default.
 
-The jiri snapshot create flags are:
- -time-format=2006-01-02T15:04:05Z07:00
-   Time format for snapshot file name.
+The jiri manifest-lint flags are:
+ -json=false
+   Print the findings as a json list, for presubmit bots.
+ -network=false
+   Check that the remotes of the imports, and with -resolve of the projects, are
+   reachable.
+ -resolve=false
+   Load the imports of the manifest and check the whole tree.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Jiri metrics - Report where the time of jiri update goes
 
-Jiri update - Update all jiri projects
+When enabled with "jiri init -metrics=true", every "jiri update" records the
+time spent in each of its phases (loading manifests, fetching, updating
+projects, running hooks, fetching packages...) and on each project, in
+.jiri_root/metrics. The last 100 runs are kept. Nothing is sent anywhere.
 
-Updates all projects. The sequence in which the individual updates happen
-guarantees that we end up with a consistent workspace. The set of projects
-to update is described in the manifest.
+Usage:
+   jiri metrics [flags] <command>
+
+The jiri metrics commands are:
+   report      Summarize the last updates
+
+Jiri metrics report - Summarize the last updates
+
+Lists the last updates with their durations, the average time spent in each
+phase and the projects which took the longest to fetch and to update.
+
+Usage:
+   jiri metrics report [flags]
+
+The jiri metrics report flags are:
+ -n=10
+   Number of updates to report on.
+ -top=10
+   Number of projects to list for each phase.
+
+Jiri override
+
+Add overrides to the .jiri_manifest file. This allows overriding project
+definitions, including from transitively imported manifests.
+
+Overrides are applied by "jiri update" after the manifest is resolved. They can
+pin a project to a revision (-revision), make it track another branch
+(-remote-branch) or fetch it from another remote (-new-remote), e.g. to test
+unmerged changes of a dependency.
+
+Example:
+  $ jiri override project https://foo.com/bar.git
+  $ jiri override -new-remote=https://foo.com/fork.git -remote-branch=fix project https://foo.com/bar.git
 
 Run "jiri help manifest" for details on manifests.
 
 Usage:
-   jiri update [flags] <snapshot>
+   jiri override [flags] <name> <remote>
 
-<snapshot> is the snapshot manifest file.
+<name> is the project name.
 
-The jiri update flags are:
- -attempts=1
-   Number of attempts before failing.
+<remote> is the project remote.
+
+The jiri override flags are:
+ -delete=false
+   Delete existing override. Override is matched using <name> and <remote>,
+   <remote> is optional.
+ -gerrithost=
+   The project Gerrit host.
+ -import-manifest=
+   The manifest of the import override.
+ -json-output=
+   JSON output file from -list flag.
+ -list=false
+   List all the overrides from .jiri_manifest. This flag doesn't accept any
+   arguments. -json-out flag can be used to specify json output file.
+ -lock-timeout=30s
+   Time to wait for other jiri processes to finish modifying .jiri_manifest.
+ -new-remote=
+   Remote to fetch the project from instead of <remote>, e.g. a fork.
+ -path=
+   Path used to store the project locally.
+ -remote-branch=
+   Remote branch to track, without the leading "origin/". Ignored if -revision
+   is set.
+ -revision=
+   Revision to check out for the remote (defaults to HEAD).
+
+Jiri relocate - Move the jiri root to a new directory
+
+Moves the jiri root to <newroot>, which must not exist, and rewrites the
+absolute references to its old location. jiri only stores paths relative to the
+jiri root, but older versions of jiri left absolute paths in project metadata,
+snapshots and .jiri_manifest, and git alternates and gitdir files can point
+inside the root.
+
+If the jiri root was already moved by hand, run "jiri relocate -from <oldroot>
+<newroot>" from <newroot>. "jiri relocate ." makes the legacy absolute paths of
+the current root relative.
+
+Usage:
+   jiri relocate [flags] <newroot>
+
+<newroot> is the new location of the jiri root.
+
+The jiri relocate flags are:
+ -from=
+   Path the jiri root was at before it was moved by hand to <newroot>, which
+   must then be the current jiri root.
+
+Jiri resolve - Generate jiri lockfile
+
+Generate jiri lockfile in json format for <manifest ...>. If no manifest
+provided, jiri will use .jiri_manifest by default.
+
+Usage:
+   jiri resolve [flags] <manifest ...>
+
+<manifest ...> is a list of manifest files for lockfile generation
+
+The jiri resolve flags are:
+ -allow-floating-refs=false
+   Allow packages to be pinned to floating refs such as "latest"
+ -allow-hosts=
+   List of hostnames that can be used in the url of a repository, seperated by
+   comma. It will not be enforced if it is left empty.
+ -enable-package-lock=true
+   Enable resolving packages in lockfile
+ -enable-project-lock=false
+   Enable resolving projects in lockfile
+ -local-manifest=false
+   Use local manifest
+ -output=jiri.lock
+   Path to the generated lockfile
+
+Jiri rollback - Restore the projects to their state before the last update
+
+Checks out the projects at the revisions they had before the last "jiri update",
+e.g. to undo a bad manifest roll.
+
+"jiri update" records the revisions of the projects in .jiri_root/update_history
+before and after updating. -list lists these snapshots, and -to rolls back to a
+given one. Snapshots taken before updates only list projects, so rolling back to
+them does not change packages.
+
+Usage:
+   jiri rollback [flags]
+
+The jiri rollback flags are:
+ -fetch-packages=false
+   Fetch the packages of the snapshot, if it has any.
  -gc=false
-   Garbage collect obsolete repositories.
- -manifest=
-   Name of the project manifest.
+   Delete the projects which are not in the snapshot.
+ -list=false
+   List the snapshots of the update history instead of rolling back.
+ -run-hooks=false
+   Run the hooks of the snapshot, if it has any.
+ -to=
+   ID of the snapshot to roll back to, as listed by -list. Defaults to the
+   snapshot taken before the last update.
 
- -color=true
-   Use color to format output.
- -v=false
-   Print verbose output.
+Jiri run-hooks - Run hooks using local manifest
+
+Run hooks using local manifest JIRI_HEAD version if -local-manifest flag is
+false, else it runs hooks using current manifest checkout version.
+
+Usage:
+   jiri run-hooks [flags]
+
+The jiri run-hooks flags are:
+ -attempts=1
+   Number of attempts before failing.
+ -fetch-packages=true
+   Use fetching packages using jiri.
+ -hook-timeout=5
+   Timeout in minutes for running the hooks operation.
+ -local-manifest=false
+   Use local checked out manifest.
 
 Jiri runp - Run a command in parallel across jiri projects
 
 Run a command in parallel across one or more jiri projects. Commands are run
-using the shell specified by the users $SHELL environment variable, or "sh"
-if that's not set. Thus commands are run as $SHELL -c "args..."
+using the shell specified by the users $SHELL environment variable, or "sh" if
+that's not set. Thus commands are run as $SHELL -c "args..."
+
+The environment of each command has JIRI_PROJECT_NAME, JIRI_PROJECT_PATH and
+JIRI_PROJECT_KEY set to the name, absolute path and key of the project it is run
+in.
+
+If the command fails in any project, runp reports the projects it failed in and,
+once all commands have completed, exits with a non-zero status, even without
+-exit-on-error. Scripts which should carry on regardless must ignore the status,
+e.g. with "|| true".
 
 Usage:
    jiri runp [flags] <command line>
@@ -425,53 +1105,441 @@ is run must be quoted to avoid expansion before being passed to runp by the
 shell.
 
 The jiri runp flags are:
+ -attributes=
+   A comma-separated list of manifest attributes. If set, only projects with at
+   least one of these attributes are matched.
+ -branch=
+   A regular expression specifying branch names to use in matching projects. A
+   project will match if the specified branch exists, even if it is not checked
+   out.
  -collate-stdout=true
    Collate all stdout output from each parallel invocation and display it as if
    had been generated sequentially. This flag cannot be used with
    -show-name-prefix, -show-key-prefix or -interactive.
- -env=
-   specify an environment variable in the form: <var>=[<val>],...
  -exit-on-error=false
    If set, all commands will killed as soon as one reports an error, otherwise,
    each will run to completion.
- -has-branch=
-   A regular expression specifying branch names to use in matching projects. A
-   project will match if the specified branch exists, even if it is not checked
-   out.
- -has-gerrit-message=false
-   If specified, match branches that have, or have no, gerrit message
- -has-uncommitted=false
-   If specified, match projects that have, or have no, uncommitted changes
- -has-untracked=false
-   If specified, match projects that have, or have no, untracked files
- -interactive=true
+ -interactive=false
    If set, the command to be run is interactive and should not have its
    stdout/stderr manipulated. This flag cannot be used with -show-name-prefix,
    -show-key-prefix or -collate-stdout.
- -merge-policies=+CCFLAGS,+CGO_CFLAGS,+CGO_CXXFLAGS,+CGO_LDFLAGS,+CXXFLAGS,GOARCH,GOOS,GOPATH:,^GOROOT*,+LDFLAGS,:PATH,VDLPATH:
-   specify policies for merging environment variables
+ -names=
+   A comma-separated list of glob patterns, as used by path.Match, specifying
+   the names of projects to run commands in.
+ -no-uncommitted=false
+   Match projects that have no uncommitted changes
+ -no-untracked=false
+   Match projects that have no untracked files
  -projects=
    A Regular expression specifying project keys to run commands in. By default,
    runp will use projects that have the same branch checked as the current
    project unless it is run from outside of a project in which case it will
    default to using all projects.
+ -remote=
+   A Regular expression specifying projects to run commands in by matching
+   against their remote URLs.
  -show-key-prefix=false
    If set, each line of output from each project will begin with the key of the
    project followed by a colon. This is intended for use with long running
    commands where the output needs to be streamed. Stdout and stderr are spliced
-   apart. This flag cannot be used with -interactive, -show-name-prefix or
-   -collate-stdout
+   apart. This flag cannot be used with -interactive, -show-name-prefix,
+   -show-path-prefix or -collate-stdout
  -show-name-prefix=false
    If set, each line of output from each project will begin with the name of the
    project followed by a colon. This is intended for use with long running
    commands where the output needs to be streamed. Stdout and stderr are spliced
-   apart. This flag cannot be used with -interactive, -show-key-prefix or
-   -collate-stdout.
+   apart. This flag cannot be used with -interactive, -show-path-prefix,
+   -show-key-prefix or -collate-stdout.
+ -show-path-prefix=false
+   If set, each line of output from each project will begin with the path of the
+   project followed by a colon. This is intended for use with long running
+   commands where the output needs to be streamed. Stdout and stderr are spliced
+   apart. This flag cannot be used with -interactive, -show-name-prefix,
+   -show-key-prefix or -collate-stdout.
+ -uncommitted=false
+   Match projects that have uncommitted changes
+ -untracked=false
+   Match projects that have untracked files
  -v=false
    Print verbose logging information
 
- -color=true
-   Use color to format output.
+Jiri selfupdate - Update jiri tool
+
+Updates jiri tool and replaces current one with the latest
+
+Usage:
+   jiri selfupdate [flags]
+
+Jiri serve - Serve the state of the jiri root over a local JSON API
+
+Serves a JSON API describing the jiri root, for IDE plugins and dashboards,
+until interrupted. The API is served on a unix socket, .jiri_root/jiri.sock by
+default, or with -port on a port of localhost. It is never served on other
+interfaces. On a port, requests whose Host is not localhost, or which carry the
+Origin of another site, are rejected so that web pages cannot use the API.
+
+  GET  /v1/projects        the local projects with their current branch,
+                           revision and whether they have uncommitted or
+                           untracked changes
+  GET  /v1/projects/<name> the local projects named <name>
+  GET  /v1/manifest        the projects and packages of the manifest
+  POST /v1/update          starts "jiri update -autoupdate=false", returns
+                           409 if an update is running
+  GET  /v1/update          the state and output of the last update started
+                           through the API
+
+For example:
+  curl --unix-socket .jiri_root/jiri.sock http://jiri/v1/projects
+
+Usage:
+   jiri serve [flags]
+
+The jiri serve flags are:
+ -port=0
+   Port to listen on, on localhost only, instead of a unix socket.
+ -socket=
+   Unix socket to listen on. Defaults to .jiri_root/jiri.sock.
+
+Jiri snapshot - Create a new project snapshot
+
+The "jiri snapshot <snapshot>" command captures the current project state in a
+manifest.
+
+With -sign, an armored detached GPG signature of the snapshot is written to
+<snapshot>.asc.  "jiri update <snapshot>" verifies this signature when the file
+.jiri_root/snapshot_signers exists, and only accepts snapshots signed by one of
+the key fingerprints listed in it, one per line.
+
+Usage:
+   jiri snapshot [flags] <snapshot>
+
+<snapshot> is the snapshot manifest file.
+
+The jiri snapshot flags are:
+ -sign=false
+   Sign the snapshot with gpg.
+ -sign-key=
+   The gpg key to sign the snapshot with. Implies -sign. Defaults to the default
+   key of gpg.
+
+Jiri source-manifest - Create a new source-manifest from current checkout
+
+This command captures the current project state in a source-manifest format. See
+https://github.com/luci/recipes-py/blob/master/recipe_engine/source_manifest.proto
+for its format.
+
+Usage:
+   jiri source-manifest [flags] <source-manifest>
+
+<source-manifest> is the source-manifest file.
+
+Jiri status - Prints status of all the projects
+
+Prints status for the the projects. It runs git status -s across all the
+projects and prints it if there are some changes. It also shows status if the
+project is on a rev other then the one according to manifest(Named as JIRI_HEAD
+in git)
+
+With -changes, it also shows the files copied or linked by the copyfile and
+linkfile elements of the projects which were modified or removed since "jiri
+update" installed them.
+
+Usage:
+   jiri status [flags]
+
+The jiri status flags are:
+ -branch=
+   Display all projects only on this branch along with their status.
+ -changes=true
+   Display projects with tracked or un-tracked changes.
+ -check-head=true
+   Display projects that are not on HEAD/pinned revisions.
+ -commits=true
+   Display commits not merged with remote. This only works when project is on a
+   local branch.
+ -d=false
+   Same as -deleted.
+ -deleted=false
+   List all deleted projects. Other flags would be ignored.
+ -json-output=
+   File to write the status of displayed projects to, in json format.
+
+Jiri sync - Update the projects without local work, optionally continuously
+
+Updates the projects like "jiri update", but never touches a project with
+uncommitted changes or a branch which cannot be fast-forwarded: the
+"-on-conflict=skip" policy is used for all projects, whatever their local config
+says.
+
+With -watch, jiri sync keeps running: the branches of the manifest repositories
+imported by .jiri_manifest are polled every -interval, and the projects are
+synced whenever one of them moves. With -listen, a sync is also triggered by a
+POST to /sync on the given address, so that a webhook of the code review or
+hosting service can notify manifest changes right away.
+
+Usage:
+   jiri sync [flags]
+
+The jiri sync flags are:
+ -fetch-packages=true
+   Use cipd to fetch packages.
+ -interval=5m0s
+   With -watch, how often to poll the manifest repositories.
+ -listen=
+   With -watch, address to receive webhook notifications on, e.g.
+   localhost:8081. A POST to /sync triggers a sync.
+ -notify=false
+   Send a desktop notification, or ring the terminal bell, after each sync.
+ -run-hooks=true
+   Run hooks after syncing sources.
+ -watch=false
+   Keep running, and sync whenever the manifest changes.
+
+Jiri update - Update all jiri projects
+
+Updates all projects. The sequence in which the individual updates happen
+guarantees that we end up with a consistent workspace. The set of projects to
+update is described in the manifest.
+
+Run "jiri help manifest" for details on manifests.
+
+With -incremental, the remote branches of all projects are listed with one "git
+ls-remote" per remote and compared with the revisions recorded in
+.jiri_root/update_state.json by the previous update. Projects whose branch has
+not moved are not fetched.
+
+Projects are fetched in the order of their size as of their last fetch, as
+recorded in .jiri_root/update_state.json, smallest first, so that most of them
+are up to date if the update stops midway.
+
+With -max-bandwidth, new fetches and clones of projects are held back while the
+data downloaded so far exceeds the given rate on average. The limit is
+best-effort, as git cannot throttle a transfer in progress: the first -j fetches
+start at once, a fetch or clone runs at full speed once started, and the data
+downloaded is estimated by the growth of the repositories, which misses data
+that git compacts while fetching.
+
+With -min-free-disk, no new fetch, checkout or clone is started once the free
+disk space falls below the given amount: the update stops with an error before
+checking out anything if fetches are stopped, so that the projects are left as
+they were.
+
+With the global -offline flag, nothing is fetched: projects are updated to the
+refs fetched before, and update fails, listing the projects concerned, if it
+would need to clone a project, change its remote or check out a revision that is
+not available locally. Packages are not fetched.
+
+Projects with uncommitted changes, or whose current branch cannot be
+fast-forwarded, are handled according to -on-conflict, or to the policy set with
+"jiri project-config -on-conflict":
+  fail   - leave the project as it is and report it as failed (default)
+  skip   - leave the project as it is
+  stash  - stash uncommitted changes and reapply them after updating
+  backup - commit uncommitted changes, or save the branch, on a new
+           jiri-backup/<branch>-<time> branch before updating
+  rebase - stash and reapply uncommitted changes, rebase the branch
+  prompt - ask which of the above to use for each project
+
+When a snapshot is given and .jiri_root/snapshot_signers exists, the snapshot
+must be signed, see "jiri help snapshot".
+
+The revisions of the projects are recorded in .jiri_root/update_history before
+and after each update, so that "jiri rollback" can undo it. The last 10
+snapshots of each kind are kept, see "jiri init -update-history-depth".
+
+Usage:
+   jiri update [flags] <file or url>
+
+<file or url> points to snapshot to checkout.
+
+The jiri update flags are:
+ -attempts=3
+   Number of attempts before failing.
+ -autoupdate=true
+   Automatically update to the new version.
+ -fetch-packages=true
+   Use cipd to fetch packages.
+ -fetch-packages-timeout=20
+   Timeout in minutes for fetching prebuilt packages using cipd.
+ -force-autoupdate=false
+   Always update to the current version.
+ -gc=false
+   Garbage collect obsolete repositories.
+ -hook-timeout=5
+   Timeout in minutes for running the hooks operation.
+ -incremental=false
+   Skip fetching projects whose remote branch has not changed since the last
+   update.
+ -local-manifest=false
+   Use local manifest
+ -max-bandwidth=0
+   Best-effort limit, in KiB per second, on the average download rate of fetches
+   and clones. Fetches in progress are not slowed down. No limit if 0.
+ -min-free-disk=0
+   Stop the update before fetching or checking out more when less than this many
+   MiB are free on the disk of the jiri root. No limit if 0.
+ -on-conflict=
+   What to do with projects whose local work is in the way of the update: fail,
+   skip, stash, backup, rebase or prompt. Defaults to the project's local
+   config, then to fail.
+ -override-optional=false
+   Override existing optional attributes in the snapshot file with current jiri
+   settings
+ -rebase-all=false
+   Rebase all tracked branches. Also rebase all untracked branches if
+   -rebase-untracked is passed
+ -rebase-current=false
+   Deprecated. Implies -rebase-tracked. Would be removed in future.
+ -rebase-tracked=false
+   Rebase current tracked branches instead of fast-forwarding them.
+ -rebase-untracked=false
+   Rebase untracked branches onto HEAD.
+ -run-hooks=true
+   Run hooks after updating sources.
+
+Jiri upload - Upload a changelist for review
+
+Command "upload" uploads commits of a local branch to Gerrit.
+
+Usage:
+   jiri upload [flags] <ref>
+
+<ref> is the valid git ref to upload. It is optional and HEAD is used by
+default. This cannot be used with -multipart flag.
+
+The jiri upload flags are:
+ -branch=
+   Used when multipart flag is true and this command is executed from root
+   folder
+ -cc=
+   Comma-separated list of emails or LDAPs to cc.
+ -git-options=
+   Passthrough git options
+ -hashtags=
+   Comma-separated list of hashtags to add to the CLs.
+ -l=
+   Comma-separated list of review labels.
+ -multipart=false
+   Send multipart CL.  Use -set-topic or -topic flag if you want to set a topic.
+ -presubmit=all
+   The type of presubmit tests to run. Valid values: none,all.
+ -r=
+   Comma-separated list of emails or LDAPs to request review.
+ -rebase=false
+   Run rebase before pushing.
+ -remoteBranch=
+   Remote branch to upload change to. If this is not specified and branch is
+   untracked, change would be uploaded to branch in project manifest
+ -set-topic=false
+   Set topic. This flag would be ignored if -topic passed.
+ -topic=
+   CL topic. Default is <username>-<branchname>. If this flag is set, upload
+   will ignore -set-topic and will set a topic.
+ -verify=true
+   Run pre-push git hooks.
+
+Jiri version - Print the jiri version
+
+Print the Git commit revision jiri was built from and the build date.
+
+Usage:
+   jiri version [flags]
+
+Jiri view - List or select workspace views
+
+Views are named subsets of projects declared in .jiri_manifest, see "jiri help
+manifest-files".  Without arguments, lists the declared views and marks the
+selected one with '*'.  With a view name, selects that view; the selection takes
+effect on the next "jiri update".
+
+Usage:
+   jiri view [flags] [<view>]
+
+<view> is the name of the view to select.
+
+The jiri view flags are:
+ -clear=false
+   Clear the selected view, so that all projects are synced.
+
+Jiri workspace - Manage the jiri roots of the user
+
+Jiri keeps a registry of the jiri roots, or workspaces, of the user in
+jiri/workspaces under their configuration directory, e.g. ~/.config. "jiri init"
+registers the roots it creates.
+
+Jiri commands run in the jiri root given by -root or, if it is not set, by
+$JIRI_WORKSPACE, which holds the name of a workspace or the path of a jiri root.
+Otherwise they run in the jiri root containing the current directory, or,
+outside of any jiri root, in the workspace made active by "jiri workspace
+switch".
+
+Usage:
+   jiri workspace [flags] <command>
+
+The jiri workspace commands are:
+   list        List the workspaces
+   add         Register a jiri root as a workspace
+   remove      Unregister a workspace
+   switch      Make a workspace active
+   run         Run a command in workspaces
+
+Jiri workspace list - List the workspaces
+
+Lists the registered workspaces with their jiri roots. The active workspace is
+marked with a "*", and the workspaces whose root is gone are marked as missing.
+
+Usage:
+   jiri workspace list [flags]
+
+Jiri workspace add - Register a jiri root as a workspace
+
+Registers a jiri root, by default the current one, as the workspace <name>. An
+existing workspace with the same name is replaced.
+
+Usage:
+   jiri workspace add [flags] <name> [<root>]
+
+<name> is the name of the workspace and <root> is its jiri root.
+
+Jiri workspace remove - Unregister a workspace
+
+Unregisters a workspace, without touching its jiri root.
+
+Usage:
+   jiri workspace remove [flags] <name>
+
+<name> is the name of the workspace.
+
+Jiri workspace switch - Make a workspace active
+
+Makes a workspace active: jiri commands run outside of any jiri root run in it.
+Its root is printed, so that "cd $(jiri workspace switch <name>)" also moves the
+shell to it. With -none, no workspace is active anymore.
+
+Usage:
+   jiri workspace switch [flags] <name>
+
+<name> is the name of the workspace.
+
+The jiri workspace switch flags are:
+ -none=false
+   Make no workspace active.
+
+Jiri workspace run - Run a command in workspaces
+
+Runs a command from the root of a workspace, or of all the workspaces with -all,
+with $JIRI_WORKSPACE set to the workspace, e.g. "jiri workspace run -all jiri
+update".
+
+Usage:
+   jiri workspace run [flags] [<name>] <command>
+
+<name> is the name of the workspace, it is omitted with -all. <command> is the
+command to run and its arguments.
+
+The jiri workspace run flags are:
+ -all=false
+   Run the command in all the workspaces.
 
 Jiri help - Display help for commands or topics
 
@@ -505,16 +1573,16 @@ All data managed by the jiri tool is located in the file system under a root
 directory, colloquially called the jiri root directory.  The file system layout
 looks like this:
 
- [root]                              # root directory (name picked by user)
- [root]/.jiri_root                   # root metadata directory
- [root]/.jiri_root/bin               # contains tool binaries (jiri, etc.)
- [root]/.jiri_root/update_history    # contains history of update snapshots
- [root]/.manifest                    # contains jiri manifests
- [root]/[project1]                   # project directory (name picked by user)
- [root]/[project1]/.jiri             # project metadata directory
- [root]/[project1]/.jiri/metadata.v2 # project metadata file
- [root]/[project1]/.jiri/<<cls>>     # project per-cl metadata directories
- [root]/[project1]/<<files>>         # project files
+ [root]                                   # root directory (name picked by user)
+ [root]/.jiri_root                        # root metadata directory
+ [root]/.jiri_root/bin                    # contains jiri tool binary
+ [root]/.jiri_root/update_history         # contains history of update snapshots
+ [root]/.manifest                         # contains jiri manifests
+ [root]/[project1]                        # project directory (name picked by user)
+ [root]/[project1]/.git/jiri              # project metadata directory
+ [root]/[project1]/.git/jiri/metadata.v2  # project metadata file
+ [root]/[project1]/.git/jiri/config       # project local config file
+ [root]/[project1]/<<files>>              # project files
  [root]/[project2]...
 
 The [root] and [projectN] directory names are picked by the user.  The <<cls>>
@@ -525,23 +1593,23 @@ collide with these special names.
 
 To find the [root] directory, the jiri binary looks for the .jiri_root
 directory, starting in the current working directory and walking up the
-directory chain. The search is terminated successfully when the .jiri_root
-directory is found; it fails after it reaches the root of the file system.
-Thus jiri must be invoked from the [root] directory or one of its
-subdirectories.  To invoke jiri from a different directory, you can set the
--root flag to point to your [root] directory.
+directory chain.  The search is terminated successfully when the .jiri_root
+directory is found; it fails after it reaches the root of the file system. Thus
+jiri must be invoked from the [root] directory or one of its subdirectories.  To
+invoke jiri from a different directory, you can set the -root flag to point to
+your [root] directory.
 
 Keep in mind that when "jiri update" is run, the jiri tool itself is
 automatically updated along with all projects.  Note that if you have multiple
-[root] directories on your file system, you must remember to run the jiri
-binary corresponding to your [root] directory.  Things may fail if you mix
-things up, since the jiri binary is updated with each call to "jiri update",
-and you may encounter version mismatches between the jiri binary and the
-various metadata files or other logic.
+[root] directories on your file system, you must remember to run the jiri binary
+corresponding to your [root] directory.  Things may fail if you mix things up,
+since the jiri binary is updated with each call to "jiri update", and you may
+encounter version mismatches between the jiri binary and the various metadata
+files or other logic.
 
 The jiri binary is located at [root]/.jiri_root/bin/jiri
 
-Jiri manifest - Description of manifest files
+Jiri manifest-files - Description of manifest files
 
 Jiri manifest files describe the set of projects that get synced when running
 "jiri update".
@@ -636,14 +1704,38 @@ specified, then running "jiri cl upload" will upload a CL to this Gerrit host.
 git hooks that will be installed in the projects .git/hooks directory during
 each update.
 
-The <hook> tag describes the hooks that must be executed after every 'jiri update'
-They are configured via the following attributes:
+The <hook> tag describes the hooks that must be executed after every 'jiri
+update' They are configured via the following attributes:
 
 * name (required) - The name of the of the hook to identify it
 
 * project (required) - The name of the project where the hook is present
 
-* action (required) - Action to be performed inside the project.
-It is mostly identified by a script
+* action (required) - Action to be performed inside the project. It is mostly
+identified by a script
+
+* after (optional) - Comma-separated names of hooks that must succeed before
+this hook runs. Hooks without this attribute run in parallel.
+
+* timeout (optional) - Timeout of the hook in minutes, overriding the
+-hook-timeout flag of 'jiri update' and 'jiri run-hooks'.
+
+The [root]/.jiri_manifest file can also declare <views>, named subsets of the
+projects to sync:
+
+<manifest>
+  ...
+  <views>
+    <view name="tools">
+      <project name="my-project" sparse="src,docs"/>
+      ...
+    </view>
+  </views>
+</manifest>
+
+Once a view is selected with "jiri view <name>" or "jiri init -view=<name>",
+"jiri update" only syncs the projects of the view, plus the projects containing
+manifests.  The optional "sparse" attribute is a comma-separated list of
+directories of the project to check out, using git sparse-checkout.
 */
 package main
@@ -0,0 +1,335 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/osutil"
+	"github.com/btwiuse/jiri/project"
+)
+
+var cmdDoctor = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runDoctor),
+	Name:   "doctor",
+	Short:  "Check the health of the jiri root",
+	Long: `
+Runs a series of checks on the jiri root and its environment and prints, for
+each of them, whether it passed, produced a warning or failed, along with a
+suggested fix:
+
+  root        .jiri_root and .jiri_manifest exist
+  git         git is installed and recent enough
+  identity    git user.name and user.email are set
+  credentials the credential helpers and token variables in the config exist
+  manifest    the manifest loads
+  remotes     the remote manifest repositories are reachable (skipped with
+              the global -offline flag)
+  projects    the projects of the manifest are checked out
+  symlinks    no symlink at the top of the root or of a project is dangling
+  disk        there is enough free disk space
+
+The command fails if any check fails, or with -strict if any check produces
+a warning, so that it can gate CI jobs.
+`,
+}
+
+var doctorFlags struct {
+	strict bool
+}
+
+func init() {
+	cmdDoctor.Flags.BoolVar(&doctorFlags.strict, "strict", false, "Fail on warnings too.")
+}
+
+type doctorStatus int
+
+const (
+	doctorPass doctorStatus = iota
+	doctorWarn
+	doctorFail
+)
+
+func (s doctorStatus) String() string {
+	switch s {
+	case doctorPass:
+		return "PASS"
+	case doctorWarn:
+		return "WARN"
+	}
+	return "FAIL"
+}
+
+// doctorResult is the outcome of a check. fix suggests how to address a
+// warning or failure.
+type doctorResult struct {
+	status  doctorStatus
+	message string
+	fix     string
+}
+
+type doctorCheck struct {
+	name string
+	run  func(jirix *jiri.X) doctorResult
+}
+
+var doctorChecks = []doctorCheck{
+	{"root", checkDoctorRoot},
+	{"git", checkDoctorGit},
+	{"identity", checkDoctorIdentity},
+	{"credentials", checkDoctorCredentials},
+	{"manifest", checkDoctorManifest},
+	{"remotes", checkDoctorRemotes},
+	{"projects", checkDoctorProjects},
+	{"symlinks", checkDoctorSymlinks},
+	{"disk", checkDoctorDisk},
+}
+
+// Free disk space thresholds, in bytes.
+const (
+	doctorDiskWarn = 10 << 30
+	doctorDiskFail = 1 << 30
+)
+
+func runDoctor(jirix *jiri.X, args []string) error {
+	if len(args) != 0 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	counts := make(map[doctorStatus]int)
+	for _, check := range doctorChecks {
+		r := check.run(jirix)
+		counts[r.status]++
+		status := r.status.String()
+		switch r.status {
+		case doctorPass:
+			status = jirix.Color.Green(status)
+		case doctorWarn:
+			status = jirix.Color.Yellow(status)
+		default:
+			status = jirix.Color.Red(status)
+		}
+		fmt.Printf("[%s] %-11s %s\n", status, check.name, strings.Replace(r.message, "\n", "\n                   ", -1))
+		if r.status != doctorPass && r.fix != "" {
+			fmt.Printf("                   fix: %s\n", r.fix)
+		}
+	}
+	if counts[doctorFail] != 0 || (doctorFlags.strict && counts[doctorWarn] != 0) {
+		return fmt.Errorf("%d check(s) failed, %d warning(s)", counts[doctorFail], counts[doctorWarn])
+	}
+	return nil
+}
+
+func checkDoctorRoot(jirix *jiri.X) doctorResult {
+	if _, err := os.Stat(jirix.RootMetaDir()); err != nil {
+		return doctorResult{doctorFail, err.Error(), "run 'jiri init' in " + jirix.Root}
+	}
+	if _, err := os.Stat(jirix.JiriManifestFile()); err != nil {
+		return doctorResult{doctorFail, err.Error(), "run 'jiri import' to add a manifest"}
+	}
+	return doctorResult{doctorPass, jirix.Root, ""}
+}
+
+func checkDoctorGit(jirix *jiri.X) doctorResult {
+	major, minor, err := gitutil.New(jirix).Version()
+	if err != nil {
+		return doctorResult{doctorFail, fmt.Sprintf("cannot run git: %v", err), "install git"}
+	}
+	version := fmt.Sprintf("git %d.%d", major, minor)
+	if major < 2 {
+		return doctorResult{doctorFail, version, "install git 2.25 or newer"}
+	}
+	if major == 2 && minor < 25 {
+		return doctorResult{doctorWarn, version + ", views need 'git sparse-checkout' from git 2.25", "install git 2.25 or newer"}
+	}
+	return doctorResult{doctorPass, version, ""}
+}
+
+func checkDoctorIdentity(jirix *jiri.X) doctorResult {
+	scm := gitutil.New(jirix, gitutil.RootDirOpt(jirix.Root))
+	var missing, fixes []string
+	for _, key := range []string{"user.name", "user.email"} {
+		if v, err := scm.ConfigGetKey(key); err != nil || v == "" {
+			missing = append(missing, key)
+			fixes = append(fixes, fmt.Sprintf("git config --global %s <%s>", key, strings.TrimPrefix(key, "user.")))
+		}
+	}
+	if len(missing) != 0 {
+		return doctorResult{doctorWarn, strings.Join(missing, " and ") + " not set, commits and uploads will fail", strings.Join(fixes, " && ")}
+	}
+	return doctorResult{doctorPass, "user.name and user.email are set", ""}
+}
+
+func checkDoctorCredentials(jirix *jiri.X) doctorResult {
+	if len(jirix.Credentials) == 0 {
+		return doctorResult{doctorPass, "no credentials configured", ""}
+	}
+	var problems []string
+	for _, c := range jirix.Credentials {
+		if c.TokenEnv != "" && os.Getenv(c.TokenEnv) == "" {
+			problems = append(problems, fmt.Sprintf("%s: $%s is not set", c.Host, c.TokenEnv))
+		}
+		if c.Helper != "" && !credentialHelperExists(c.Helper) {
+			problems = append(problems, fmt.Sprintf("%s: git-credential-%s not found", c.Host, c.Helper))
+		}
+	}
+	if len(problems) != 0 {
+		return doctorResult{doctorWarn, strings.Join(problems, "\n"), "fix the credentials in " + filepath.Join(jirix.RootMetaDir(), jiri.ConfigFile)}
+	}
+	return doctorResult{doctorPass, fmt.Sprintf("%d credential(s) configured", len(jirix.Credentials)), ""}
+}
+
+// credentialHelperExists reports whether git can run the credential helper,
+// see gitcredentials(7).
+func credentialHelperExists(helper string) bool {
+	if strings.HasPrefix(helper, "!") {
+		// A shell snippet, it cannot be checked.
+		return true
+	}
+	fields := strings.Fields(helper)
+	if len(fields) == 0 {
+		return false
+	}
+	name := fields[0]
+	if filepath.IsAbs(name) {
+		_, err := os.Stat(name)
+		return err == nil
+	}
+	name = "git-credential-" + name
+	if _, err := exec.LookPath(name); err == nil {
+		return true
+	}
+	out, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(strings.TrimSpace(string(out)), name))
+	return err == nil
+}
+
+func checkDoctorManifest(jirix *jiri.X) doctorResult {
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return doctorResult{doctorFail, err.Error(), "run 'jiri update'"}
+	}
+	projects, _, pkgs, err := project.LoadManifestFile(jirix, jirix.JiriManifestFile(), localProjects, false /*localManifest*/)
+	if err != nil {
+		return doctorResult{doctorFail, err.Error(), "fix the manifest, or run 'jiri update' to fetch its imports"}
+	}
+	return doctorResult{doctorPass, fmt.Sprintf("%d project(s), %d package(s)", len(projects), len(pkgs)), ""}
+}
+
+func checkDoctorRemotes(jirix *jiri.X) doctorResult {
+	if jirix.Offline {
+		return doctorResult{doctorPass, "skipped in offline mode", ""}
+	}
+	m, err := project.ManifestFromFile(jirix, jirix.JiriManifestFile())
+	if err != nil {
+		return doctorResult{doctorFail, err.Error(), ""}
+	}
+	var unreachable []string
+	for _, i := range m.Imports {
+		heads, err := gitutil.New(jirix).LsRemoteHeads(i.Remote, i.RemoteBranch)
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s: %v", i.Remote, err))
+		} else if _, ok := heads[i.RemoteBranch]; !ok && (i.Revision == "" || i.Revision == "HEAD") {
+			// An import pinned to a revision does not need its branch.
+			unreachable = append(unreachable, fmt.Sprintf("%s: no branch %q", i.Remote, i.RemoteBranch))
+		}
+	}
+	if len(unreachable) != 0 {
+		return doctorResult{doctorFail, strings.Join(unreachable, "\n"), "check the network, the credentials and the imports in " + jirix.JiriManifestFile()}
+	}
+	return doctorResult{doctorPass, fmt.Sprintf("%d manifest remote(s) reachable", len(m.Imports)), ""}
+}
+
+func checkDoctorProjects(jirix *jiri.X) doctorResult {
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return doctorResult{doctorFail, err.Error(), "run 'jiri update'"}
+	}
+	projects, _, pkgs, err := project.LoadManifestFile(jirix, jirix.JiriManifestFile(), localProjects, false /*localManifest*/)
+	if err != nil {
+		return doctorResult{doctorFail, "cannot load the manifest", "see the manifest check"}
+	}
+	if err := project.FilterOptionalProjectsPackages(jirix, jirix.FetchingAttrs, projects, pkgs); err != nil {
+		return doctorResult{doctorFail, err.Error(), ""}
+	}
+	status := doctorPass
+	var problems []string
+	for _, p := range projects {
+		if _, err := os.Stat(p.Path); os.IsNotExist(err) {
+			if status == doctorPass {
+				status = doctorWarn
+			}
+			problems = append(problems, fmt.Sprintf("%s(%s): not checked out", p.Name, p.Path))
+		} else if _, err := os.Stat(filepath.Join(p.Path, ".git")); err != nil {
+			status = doctorFail
+			problems = append(problems, fmt.Sprintf("%s(%s): not a git repository", p.Name, p.Path))
+		}
+	}
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return doctorResult{status, strings.Join(problems, "\n"), "move the broken projects away and run 'jiri update'"}
+	}
+	return doctorResult{doctorPass, fmt.Sprintf("%d project(s) checked out", len(projects)), ""}
+}
+
+func checkDoctorSymlinks(jirix *jiri.X) doctorResult {
+	dirs := []string{jirix.Root, jirix.BinDir()}
+	if localProjects, err := project.LocalProjects(jirix, project.FastScan); err == nil {
+		for _, p := range localProjects {
+			dirs = append(dirs, p.Path)
+		}
+	}
+	var dangling []string
+	for _, dir := range dirs {
+		f, err := os.Open(dir)
+		if err != nil {
+			continue
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if fi, err := os.Lstat(path); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				dangling = append(dangling, path)
+			}
+		}
+	}
+	if len(dangling) != 0 {
+		sort.Strings(dangling)
+		return doctorResult{doctorWarn, strings.Join(dangling, "\n"), "remove the links, or run 'jiri update' or 'jiri run-hooks' to recreate them"}
+	}
+	return doctorResult{doctorPass, "no dangling symlink", ""}
+}
+
+func checkDoctorDisk(jirix *jiri.X) doctorResult {
+	free, err := osutil.FreeDiskSpace(jirix.Root)
+	if err != nil {
+		return doctorResult{doctorWarn, fmt.Sprintf("cannot get free disk space: %v", err), ""}
+	}
+	message := fmt.Sprintf("%.1f GiB free", float64(free)/(1<<30))
+	switch {
+	case free < doctorDiskFail:
+		return doctorResult{doctorFail, message, "free up disk space"}
+	case free < doctorDiskWarn:
+		return doctorResult{doctorWarn, message, "free up disk space"}
+	}
+	return doctorResult{doctorPass, message, ""}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
+)
+
+func executeDoctor(t *testing.T, fake *jiritest.FakeJiriRoot) (string, error) {
+	var runErr error
+	stdout, _, err := runfunc(func() {
+		runErr = runDoctor(fake.X, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stdout, runErr
+}
+
+func TestDoctor(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := executeDoctor(t, fake)
+	for _, want := range []string{
+		"[PASS] root        " + fake.X.Root + "\n",
+		"[PASS] manifest    ",
+		"[PASS] remotes     1 manifest remote(s) reachable\n",
+		"[PASS] projects    ",
+		"[PASS] symlinks    no dangling symlink\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("doctor output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	// Break a project and leave a dangling symlink.
+	if err := os.RemoveAll(filepath.Join(localProjects[1].Path, ".git")); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(fake.X.Root, "dangling")
+	if err := os.Symlink(filepath.Join(fake.X.Root, "missing"), link); err != nil {
+		t.Fatal(err)
+	}
+	out, err := executeDoctor(t, fake)
+	if err == nil {
+		t.Errorf("expected doctor to fail")
+	}
+	for _, want := range []string{
+		"[FAIL] projects    ",
+		"[WARN] symlinks    " + link + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("doctor output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+// TestDoctorRemotes checks that the remotes check fails when the remote branch
+// of an import does not exist.
+func TestDoctorRemotes(t *testing.T) {
+	_, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	m, err := project.ManifestFromFile(fake.X, fake.X.JiriManifestFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Imports[0].RemoteBranch = "missing"
+	if err := m.ToFile(fake.X, fake.X.JiriManifestFile()); err != nil {
+		t.Fatal(err)
+	}
+	r := checkDoctorRemotes(fake.X)
+	if want := fmt.Sprintf("%s: no branch %q", m.Imports[0].Remote, "missing"); r.status != doctorFail || r.message != want {
+		t.Errorf("got %+v, want a failure with %q", r, want)
+	}
+}
+
+func TestCredentialHelperExists(t *testing.T) {
+	for _, test := range []struct {
+		helper string
+		want   bool
+	}{
+		{"!f() { echo password=x; }; f", true},
+		{"/nonexistent/helper --flag", false},
+		{"nonexistent-jiri-helper", false},
+		{" \t", false},
+	} {
+		if got := credentialHelperExists(test.helper); got != test.want {
+			t.Errorf("credentialHelperExists(%q): got %v, want %v", test.helper, got, test.want)
+		}
+	}
+}
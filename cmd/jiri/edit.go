@@ -157,6 +157,9 @@ func runEdit(jirix *jiri.X, args []string) error {
 }
 
 func writeManifest(jirix *jiri.X, manifestPath, manifestContent string, projects map[string]string) error {
+	if err := jirix.CheckWrite(manifestPath, "edit manifest"); err != nil {
+		return err
+	}
 	// Create a temp dir to save backedup lockfiles
 	tempDir, err := ioutil.TempDir("", "jiri_lockfile")
 	if err != nil {
@@ -230,6 +233,9 @@ func updateLocks(jirix *jiri.X, tempDir, lockfile string, backup, projects map[s
 	}
 
 	if found {
+		if err := jirix.CheckWrite(lockfile, "edit lockfile"); err != nil {
+			return err
+		}
 		// backup original lockfile
 		info, err := os.Stat(lockfile)
 		if err != nil {
@@ -0,0 +1,86 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var gcFlags struct {
+	force      bool
+	forceDirty bool
+}
+
+func init() {
+	cmdGC.Flags.BoolVar(&gcFlags.force, "f", false, "Delete the projects instead of listing them.")
+	cmdGC.Flags.BoolVar(&gcFlags.forceDirty, "force-dirty", false, "With -f, also delete projects with branches or local changes.")
+}
+
+var cmdGC = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runGC),
+	Name:   "gc",
+	Short:  "Delete projects that are no longer in the manifest",
+	Long: `
+Lists the projects under the jiri root that are not part of the manifest any
+more, e.g. because they were removed from it, are optional and not selected,
+or are not in the selected view. With -f, these projects are deleted.
+
+Projects with branches or local changes are kept unless -force-dirty is
+passed. Projects containing other projects are always kept.
+
+Unlike "jiri update -gc", this does not fetch or update anything.
+`,
+}
+
+func runGC(jirix *jiri.X, args []string) error {
+	if len(args) != 0 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	if gcFlags.forceDirty && !gcFlags.force {
+		return jirix.UsageErrorf("-force-dirty can only be used with -f")
+	}
+	orphans, err := project.OrphanedProjects(jirix)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Println("No projects to delete")
+		return nil
+	}
+	if gcFlags.force {
+		orphans, err = project.DeleteOrphanedProjects(jirix, orphans, gcFlags.forceDirty)
+	}
+	cwd, err2 := os.Getwd()
+	if err2 != nil {
+		return err2
+	}
+	var paths []string
+	names := make(map[string]string)
+	for _, p := range orphans {
+		relativePath, err := filepath.Rel(cwd, p.Path)
+		if err != nil {
+			relativePath = p.Path
+		}
+		paths = append(paths, relativePath)
+		names[relativePath] = p.Name
+	}
+	sort.Strings(paths)
+	if gcFlags.force {
+		fmt.Printf("Deleted %d project(s):\n", len(paths))
+	} else {
+		fmt.Printf("%d project(s) would be deleted, run with -f to delete them:\n", len(paths))
+	}
+	for _, path := range paths {
+		fmt.Printf("%s(%s)\n", names[path], path)
+	}
+	return err
+}
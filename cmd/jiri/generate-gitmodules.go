@@ -270,6 +270,14 @@ func writeGitModules(jirix *jiri.X, projects project.Projects, gitmodulesPath, g
 		}
 	}
 	jirix.Logger.Debugf("generated gitmodule content \n%v\n", gitmoduleBuf.String())
+	for _, path := range []string{gitmodulesPath, genGitModuleFlags.genScript, gitattributesPath} {
+		if path == "" {
+			continue
+		}
+		if err := jirix.CheckWrite(path, "generate gitmodules"); err != nil {
+			return err
+		}
+	}
 	if err := ioutil.WriteFile(gitmodulesPath, gitmoduleBuf.Bytes(), 0644); err != nil {
 		return err
 	}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/cmdline"
@@ -34,6 +36,8 @@ var grepFlags struct {
 	l bool
 	L bool
 	w bool
+	E bool
+	F bool
 }
 
 func init() {
@@ -44,6 +48,10 @@ func init() {
 	flags.BoolVar(&grepFlags.i, "i", false, "Ignore case differences between the patterns and the files")
 	flags.BoolVar(&grepFlags.l, "l", false, "Instead of showing every matched line, show only the names of files that contain matches")
 	flags.BoolVar(&grepFlags.w, "w", false, "Match the pattern only at word boundary")
+	flags.BoolVar(&grepFlags.E, "E", false, "Use POSIX extended regular expressions for patterns")
+	flags.BoolVar(&grepFlags.E, "extended-regexp", false, "same as -E")
+	flags.BoolVar(&grepFlags.F, "F", false, "Use fixed strings for patterns, don't interpret pattern as a regex")
+	flags.BoolVar(&grepFlags.F, "fixed-strings", false, "same as -F")
 	flags.BoolVar(&grepFlags.l, "name-only", false, "same as -l")
 	flags.BoolVar(&grepFlags.l, "files-with-matches", false, "same as -l")
 	flags.BoolVar(&grepFlags.L, "L", false, "Instead of showing every matched line, show only the names of files that do not contain matches")
@@ -71,6 +79,12 @@ func buildFlags() []string {
 	if grepFlags.w {
 		args = append(args, "-w")
 	}
+	if grepFlags.E {
+		args = append(args, "-E")
+	}
+	if grepFlags.F {
+		args = append(args, "-F")
+	}
 	return args
 }
 
@@ -98,6 +112,9 @@ func doGrep(jirix *jiri.X, args []string) ([]string, error) {
 		}
 	}
 
+	if grepFlags.E && grepFlags.F {
+		return nil, jirix.UsageErrorf("-E and -F can not be used together")
+	}
 	if grepFlags.e != "" && lenArgs > 0 {
 		return nil, jirix.UsageErrorf("No additional argument allowed with flag -e")
 	} else if grepFlags.e == "" && lenArgs != 1 {
@@ -109,9 +126,7 @@ func doGrep(jirix *jiri.X, args []string) ([]string, error) {
 		return nil, err
 	}
 
-	// TODO(ianloic): run in parallel rather than serially.
 	// TODO(ianloic): only run grep on projects under the cwd.
-	var results []string
 	flags := buildFlags()
 	if jirix.Color.Enabled() {
 		flags = append(flags, "--color=always")
@@ -128,20 +143,49 @@ func doGrep(jirix *jiri.X, args []string) ([]string, error) {
 		}
 	}
 
-	for _, project := range projects {
-		relpath, err := filepath.Rel(cwd, project.Path)
-		if err != nil {
+	// Sort projects by path so that output does not depend on which grep
+	// finishes first.
+	var sorted project.ProjectsByPath
+	for _, p := range projects {
+		sorted = append(sorted, p)
+	}
+	sort.Sort(sorted)
+	relpaths := make([]string, len(sorted))
+	for i, p := range sorted {
+		if relpaths[i], err = filepath.Rel(cwd, p.Path); err != nil {
 			return nil, err
 		}
-		git := gitutil.New(jirix, gitutil.RootDirOpt(project.Path))
-		lines, err := git.Grep(query, pathSpecs, flags...)
-		if err != nil {
-			continue
-		}
-		for _, line := range lines {
-			// TODO(ianloic): higlight the project path part like `repo grep`.
-			results = append(results, relpath+"/"+line)
-		}
+	}
+
+	projectResults := make([][]string, len(sorted))
+	workQueue := make(chan int, len(sorted))
+	for i := range sorted {
+		workQueue <- i
+	}
+	close(workQueue)
+	var wg sync.WaitGroup
+	for i := uint(0); i < jirix.Jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range workQueue {
+				git := gitutil.New(jirix, gitutil.RootDirOpt(sorted[i].Path))
+				lines, err := git.Grep(query, pathSpecs, flags...)
+				if err != nil {
+					continue
+				}
+				for _, line := range lines {
+					// TODO(ianloic): higlight the project path part like `repo grep`.
+					projectResults[i] = append(projectResults[i], relpaths[i]+"/"+line)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var results []string
+	for _, lines := range projectResults {
+		results = append(results, lines...)
 	}
 
 	// TODO(ianloic): fail if all of the sub-greps fail
@@ -24,6 +24,8 @@ func setDefaultGrepFlags() {
 	grepFlags.l = false
 	grepFlags.L = false
 	grepFlags.w = false
+	grepFlags.E = false
+	grepFlags.F = false
 }
 
 func makeProjects(t *testing.T, fake *jiritest.FakeJiriRoot) []*project.Project {
@@ -195,3 +197,30 @@ func TestLFlagGrep(t *testing.T) {
 		"sub/sub2/r.t2/file.txt",
 	})
 }
+
+func TestFFlagGrep(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	setup(t, fake)
+	setDefaultGrepFlags()
+	expectGrep(t, fake, []string{"summer.s"}, []string{
+		"r.a/file.txt:Shall I compare thee to a summer's day?",
+		"r.c/file.txt:And summer's lease hath all too short a date:",
+	})
+
+	grepFlags.F = true
+	expectGrep(t, fake, []string{"summer.s"}, []string{})
+}
+
+func TestExtendedRegexpFlagGrep(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	setup(t, fake)
+	setDefaultGrepFlags()
+	grepFlags.E = true
+	expectGrep(t, fake, []string{"(hot|lovely) the"}, []string{
+		"sub/r.t1/file.txt:Sometime too hot the eye of heaven shines,",
+	})
+}
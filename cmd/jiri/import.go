@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/cmdline"
@@ -20,12 +22,13 @@ var (
 	// Flags for configuring project attributes for remote imports.
 	flagImportName, flagImportRemoteBranch, flagImportRoot string
 	// Flags for controlling the behavior of the command.
-	flagImportOverwrite  bool
-	flagImportOut        string
-	flagImportDelete     bool
-	flagImportRevision   string
-	flagImportList       bool
-	flagImportJsonOutput string
+	flagImportOverwrite   bool
+	flagImportOut         string
+	flagImportDelete      bool
+	flagImportRevision    string
+	flagImportList        bool
+	flagImportJsonOutput  string
+	flagImportLockTimeout time.Duration
 )
 
 func init() {
@@ -39,6 +42,7 @@ func init() {
 	cmdImport.Flags.BoolVar(&flagImportDelete, "delete", false, `Delete existing import. Import is matched using <manifest>, <remote> and name. <remote> is optional.`)
 	cmdImport.Flags.BoolVar(&flagImportList, "list", false, `List all the imports from .jiri_manifest. This flag doesn't accept any arguments. -json-out flag can be used to specify json output file.`)
 	cmdImport.Flags.StringVar(&flagImportJsonOutput, "json-output", "", `Json output file from -list flag.`)
+	cmdImport.Flags.DurationVar(&flagImportLockTimeout, "lock-timeout", project.DefaultManifestLockTimeout, `Time to wait for other jiri processes to finish modifying .jiri_manifest.`)
 }
 
 var cmdImport = &cmdline.Command{
@@ -124,6 +128,24 @@ func runImport(jirix *jiri.X, args []string) error {
 		return jirix.UsageErrorf("wrong number of arguments")
 	}
 
+	outFile := flagImportOut
+	if outFile == "" {
+		outFile = jirix.JiriManifestFile()
+	} else if outFile != "-" {
+		abs, err := filepath.Abs(outFile)
+		if err != nil {
+			return err
+		}
+		outFile = abs
+	}
+	if !flagImportList && outFile == jirix.JiriManifestFile() {
+		unlock, err := project.LockManifestFile(jirix, jirix.JiriManifestFile(), flagImportLockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
 	// Initialize manifest.
 	var manifest *project.Manifest
 	manifestExists, err := isFile(jirix.JiriManifestFile())
@@ -162,6 +184,7 @@ func runImport(jirix *jiri.X, args []string) error {
 		}
 	}
 
+	var added project.Import
 	if flagImportDelete {
 		var tempImports []project.Import
 		deletedImports := make(map[string]project.Import)
@@ -205,21 +228,18 @@ func runImport(jirix *jiri.X, args []string) error {
 		}
 		// There's not much error checking when writing the .jiri_manifest file;
 		// errors will be reported when "jiri update" is run.
-		manifest.Imports = append(manifest.Imports, project.Import{
+		added = project.Import{
 			Manifest:     args[0],
 			Name:         flagImportName,
 			Remote:       args[1],
 			RemoteBranch: flagImportRemoteBranch,
 			Revision:     flagImportRevision,
 			Root:         flagImportRoot,
-		})
+		}
+		manifest.Imports = append(manifest.Imports, added)
 	}
 
 	// Write output to stdout or file.
-	outFile := flagImportOut
-	if outFile == "" {
-		outFile = jirix.JiriManifestFile()
-	}
 	if outFile == "-" {
 		bytes, err := manifest.ToBytes()
 		if err != nil {
@@ -228,5 +248,17 @@ func runImport(jirix *jiri.X, args []string) error {
 		_, err = os.Stdout.Write(bytes)
 		return err
 	}
-	return manifest.ToFile(jirix, outFile)
+	if flagImportOverwrite || outFile != jirix.JiriManifestFile() {
+		return manifest.ToFile(jirix, outFile)
+	}
+	// Edit .jiri_manifest in place to keep its comments and formatting.
+	if flagImportDelete {
+		remote := ""
+		if len(args) == 2 {
+			remote = args[1]
+		}
+		_, err := project.RemoveManifestImport(jirix, outFile, args[0], flagImportName, remote, false)
+		return err
+	}
+	return project.AddManifestImport(jirix, outFile, added, false)
 }
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/btwiuse/jiri/jiritest/xtest"
+	"github.com/btwiuse/jiri/project"
 )
 
 type importTestCase struct {
@@ -325,6 +326,51 @@ func TestImport(t *testing.T) {
     <import manifest="foo" name="manifest" remote="https://github.com/orig.git"/>
   </imports>
 </manifest>
+`,
+		},
+		// Comments and formatting of .jiri_manifest are kept.
+		{
+			Args: []string{"foo", "https://github.com/new.git"},
+			Exist: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="bar" name="manifest"
+            remote="https://github.com/orig.git"/>
+  </imports>
+</manifest>
+`,
+			Want: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="bar" name="manifest"
+            remote="https://github.com/orig.git"/>
+    <import manifest="foo" name="manifest" remote="https://github.com/new.git"/>
+  </imports>
+</manifest>
+`,
+		},
+		{
+			SetFlags: func() {
+				flagImportDelete = true
+			},
+			Args:    []string{"foo"},
+			runOnce: true,
+			Exist: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="bar" name="manifest" remote="https://github.com/orig.git"/>
+    <!-- To be deleted. -->
+    <import manifest="foo" name="manifest" remote="https://github.com/orig.git"/>
+  </imports>
+</manifest>
+`,
+			Want: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="bar" name="manifest" remote="https://github.com/orig.git"/>
+    <!-- To be deleted. -->
+  </imports>
+</manifest>
 `,
 		},
 	}
@@ -439,3 +485,32 @@ func testImport(t *testing.T, test importTestCase) error {
 	}
 	return nil
 }
+
+// TestImportLockRelativeOut checks that jiri import locks .jiri_manifest when
+// -out names it with a relative path.
+func TestImportLockRelativeOut(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(jirix.Root); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := project.LockManifestFile(jirix, jirix.JiriManifestFile(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	setDefaultImportFlags()
+	defer setDefaultImportFlags()
+	flagImportOut = ".jiri_manifest"
+	flagImportLockTimeout = 0
+	defer func() { flagImportLockTimeout = project.DefaultManifestLockTimeout }()
+	if err := runImport(jirix, []string{"foo", "https://github.com/new.git"}); err == nil || !strings.Contains(err.Error(), "waiting for lock") {
+		t.Errorf("expected import to wait for the lock on %s, got: %v", jirix.JiriManifestFile(), err)
+	}
+}
@@ -26,6 +26,20 @@ The "init" command creates new jiri "root" - basically a [root]/.jiri_root
 directory and template files.
 
 Running "init" in existing jiri [root] is safe.
+
+Authentication to HTTPS remotes can be configured per host in
+[root]/.jiri_root/config, either with a git credential helper or with the
+name of an environment variable holding an access token:
+
+	<config>
+	  <credentials>
+	    <credential host="github.com" tokenEnv="GITHUB_TOKEN" username="x-access-token"/>
+	    <credential host="git.example.com" helper="store"/>
+	  </credentials>
+	</config>
+
+Git never prompts for credentials while jiri fetches or clones projects;
+authentication failures are reported with advice on how to fix them instead.
 `,
 	ArgsName: "[directory]",
 	ArgsLong: `
@@ -42,10 +56,14 @@ var (
 	rewriteSsoToHttpsFlag string
 	ssoCookieFlag         string
 	keepGitHooks          string
+	metricsFlag           string
+	updateHistoryDepth    int
+	dissociateFlag        string
 	enableLockfileFlag    string
 	lockfileNameFlag      string
 	prebuiltJSON          string
 	optionalAttrs         string
+	viewFlag              string
 	partialFlag           bool
 	cipdParanoidFlag      string
 	cipdMaxThreads        int
@@ -53,6 +71,7 @@ var (
 
 const (
 	optionalAttrsNotSet = "[ATTRIBUTES_NOT_SET]"
+	viewNotSet          = "[VIEW_NOT_SET]"
 )
 
 func init() {
@@ -63,13 +82,18 @@ func init() {
 	cmdInit.Flags.StringVar(&rewriteSsoToHttpsFlag, "rewrite-sso-to-https", "", "Rewrites sso fetches, clones, etc to https. Takes true/false.")
 	cmdInit.Flags.StringVar(&ssoCookieFlag, "sso-cookie-path", "", "Path to master SSO cookie file.")
 	cmdInit.Flags.StringVar(&keepGitHooks, "keep-git-hooks", "", "Whether to keep current git hooks in '.git/hooks' when doing 'jiri update'. Takes true/false.")
+	cmdInit.Flags.StringVar(&metricsFlag, "metrics", "", "Record the time spent in each phase of 'jiri update' in .jiri_root/metrics, see 'jiri help metrics'. Nothing leaves the machine. Takes true/false.")
+	cmdInit.Flags.IntVar(&updateHistoryDepth, "update-history-depth", -1, "Number of snapshots taken before and after 'jiri update' to keep in .jiri_root/update_history for 'jiri rollback'. 0 restores the default of 10.")
 	cmdInit.Flags.StringVar(&enableLockfileFlag, "enable-lockfile", "", "Enable lockfile enforcement")
 	cmdInit.Flags.StringVar(&lockfileNameFlag, "lockfile-name", "", "Set up filename of lockfile")
 	cmdInit.Flags.StringVar(&prebuiltJSON, "prebuilt-json", "", "Set up filename for prebuilt json file")
 	// Empty string is not used as default value for optionalAttrs as we
 	// use empty string to clear existing saved attributes.
 	cmdInit.Flags.StringVar(&optionalAttrs, "fetch-optional", optionalAttrsNotSet, "Set up attributes of optional projects and packages that should be fetched by jiri.")
+	// As with -fetch-optional, an empty view clears the saved view.
+	cmdInit.Flags.StringVar(&viewFlag, "view", viewNotSet, "Name of the view declared in .jiri_manifest that 'jiri update' should sync.")
 	cmdInit.Flags.BoolVar(&partialFlag, "partial", false, "Whether to use a partial checkout.")
+	cmdInit.Flags.StringVar(&dissociateFlag, "dissociate", "", "Copy the objects borrowed from the cache into new projects, so that they do not depend on the cache. Takes true/false.")
 	cmdInit.Flags.StringVar(&cipdParanoidFlag, "cipd-paranoid-mode", "", "Whether to use paranoid mode in cipd.")
 	// Default (0) causes CIPD to use as many threads as there are CPUs.
 	cmdInit.Flags.IntVar(&cipdMaxThreads, "cipd-max-threads", 0, "Number of threads to use for unpacking CIPD packages. If zero, uses all CPUs.")
@@ -152,6 +176,26 @@ func runInit(env *cmdline.Env, args []string) error {
 		}
 	}
 
+	if metricsFlag != "" {
+		if val, err := strconv.ParseBool(metricsFlag); err != nil {
+			return fmt.Errorf("'metrics' flag should be true or false")
+		} else {
+			config.Metrics = val
+		}
+	}
+
+	if updateHistoryDepth >= 0 {
+		config.UpdateHistoryDepth = updateHistoryDepth
+	}
+
+	if dissociateFlag != "" {
+		if val, err := strconv.ParseBool(dissociateFlag); err != nil {
+			return fmt.Errorf("'dissociate' flag should be true or false")
+		} else {
+			config.Dissociate = val
+		}
+	}
+
 	if rewriteSsoToHttpsFlag != "" {
 		if val, err := strconv.ParseBool(rewriteSsoToHttpsFlag); err != nil {
 			return fmt.Errorf("'rewrite-sso-to-https' flag should be true or false")
@@ -164,6 +208,10 @@ func runInit(env *cmdline.Env, args []string) error {
 		config.FetchingAttrs = optionalAttrs
 	}
 
+	if viewFlag != viewNotSet {
+		config.View = viewFlag
+	}
+
 	if partialFlag {
 		config.Partial = partialFlag
 	}
@@ -224,6 +272,11 @@ func runInit(env *cmdline.Env, args []string) error {
 	if err := config.Write(configPath); err != nil {
 		return err
 	}
+	if root, err := filepath.EvalSymlinks(dir); err == nil {
+		if err := jiri.RegisterWorkspace(root); err != nil {
+			fmt.Fprintf(env.Stderr, "WARNING: could not register %s in the workspaces of 'jiri workspace list': %v\n", root, err)
+		}
+	}
 	// TODO(phosek): also create an empty manifest
 
 	return nil
@@ -9,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -27,6 +28,10 @@ var manifestFlags struct {
 	// fields to display.  The invoker of Jiri is expected to form this template
 	// themselves.
 	Template string
+
+	// Explain is the name of a project whose resolution through the
+	// manifest imports should be printed.
+	Explain string
 }
 
 var cmdManifest = &cmdline.Command{
@@ -45,6 +50,16 @@ var cmdManifest = &cmdline.Command{
 
 	    Read packages's 'version' attribute:
 	        manifest -element=$PACKAGE_NAME -template="{{.Version}}"
+
+	With -explain, all imports of the manifest are resolved and the chain of
+	manifests through which the named project was included is printed, along
+	with whether an override applied to it.  The manifest defaults to
+	.jiri_manifest in that case:
+	        manifest -explain=$PROJECT_NAME
+
+	Run "jiri manifest-lint" to check a manifest, "jiri manifest-export" to
+	export its projects to another meta-tool and "jiri manifest-import" to
+	convert the manifest of another meta-tool.
 	`,
 	ArgsName: "<manifest>",
 	ArgsLong: "<manifest> is the manifest file.",
@@ -58,10 +73,21 @@ func init() {
 func setManifestFlags(f *flag.FlagSet) {
 	f.StringVar(&manifestFlags.ElementName, "element", "", "Name of the <project>, <import> or <package>.")
 	f.StringVar(&manifestFlags.Template, "template", "", "The template for the fields to display.")
+	f.StringVar(&manifestFlags.Explain, "explain", "", "Name of the <project> to explain the resolution of.")
 }
 
 // Run executes the ManifestCommand.
 func runManifest(jirix *jiri.X, args []string) error {
+	if manifestFlags.Explain != "" {
+		if len(args) > 1 {
+			return jirix.UsageErrorf("Wrong number of args")
+		}
+		manifestPath := jirix.JiriManifestFile()
+		if len(args) == 1 {
+			manifestPath = args[0]
+		}
+		return explainProject(jirix, manifestPath, manifestFlags.Explain)
+	}
 	if len(args) != 1 {
 		return jirix.UsageErrorf("Wrong number of args")
 	}
@@ -115,3 +141,40 @@ func readManifest(jirix *jiri.X, manifestPath string, tmpl *template.Template) e
 	// Found nothing.
 	return fmt.Errorf("found no project/import/package named %s", manifestFlags.ElementName)
 }
+
+func explainProject(jirix *jiri.X, manifestPath, name string) error {
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	traces, err := project.TraceManifestFile(jirix, manifestPath, localProjects, false /*localManifest*/)
+	if err != nil {
+		return err
+	}
+	var keys project.ProjectKeys
+	for key, trace := range traces {
+		if trace.Project.Name == name {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("found no project named %s", name)
+	}
+	sort.Sort(keys)
+	for _, key := range keys {
+		trace := traces[key]
+		fmt.Printf("%s: %s\n", jirix.Color.Yellow("Project"), trace.Project.Name)
+		fmt.Printf("%s: %s\n", jirix.Color.Yellow("Path"), trace.Project.Path)
+		fmt.Printf("%s: %s\n", jirix.Color.Yellow("Remote"), trace.Project.Remote)
+		fmt.Printf("%s: %s\n", jirix.Color.Yellow("Revision"), trace.Project.Revision)
+		fmt.Printf("%s:\n", jirix.Color.Yellow("Included through"))
+		for i, manifest := range trace.Chain {
+			fmt.Printf("  %s%s\n", strings.Repeat("  ", i), manifest)
+		}
+		if trace.Overridden {
+			fmt.Printf("%s: by %s\n", jirix.Color.Yellow("Overridden"), manifestPath)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var manifestExportFlags struct {
+	format string
+	output string
+	pin    bool
+}
+
+func init() {
+	cmdManifestExport.Flags.StringVar(&manifestExportFlags.format, "format", "repo", "Format to export to: repo (an Android repo manifest), gclient (the deps of a DEPS file), gitmodules or west (a Zephyr west manifest).")
+	cmdManifestExport.Flags.StringVar(&manifestExportFlags.output, "o", "", "File to write the export to, instead of stdout.")
+	cmdManifestExport.Flags.BoolVar(&manifestExportFlags.pin, "pin", false, "Pin the projects to their local revisions, instead of the revisions, or branches, of the manifest.")
+}
+
+var cmdManifestExport = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runManifestExport),
+	Name:   "manifest-export",
+	Short:  "Export the projects of a manifest to another meta-tool",
+	Long: `
+Resolves the manifest and writes its projects in the format of another
+meta-tool, to move a workspace to it or mirror it there. Packages and hooks
+are not exported, nor are the projects at the jiri root.
+
+Projects with attributes, which jiri does not fetch by default, are excluded
+by default in the other tool as well when it supports it.
+`,
+	ArgsName: "[<manifest>]",
+	ArgsLong: "<manifest> is the manifest file, .jiri_manifest by default.",
+}
+
+// manifestExporters maps the formats of "jiri manifest-export" to the
+// functions writing the projects in them.
+var manifestExporters = map[string]func(jirix *jiri.X, w io.Writer, projects []project.Project) error{
+	"repo":       exportRepo,
+	"gclient":    exportGclient,
+	"gitmodules": exportGitmodules,
+	"west":       exportWest,
+}
+
+func runManifestExport(jirix *jiri.X, args []string) error {
+	if len(args) > 1 {
+		return jirix.UsageErrorf("Wrong number of args")
+	}
+	exporter, ok := manifestExporters[manifestExportFlags.format]
+	if !ok {
+		return jirix.UsageErrorf("unknown format %q, want repo, gclient, gitmodules or west", manifestExportFlags.format)
+	}
+	manifestPath := jirix.JiriManifestFile()
+	if len(args) == 1 {
+		manifestPath = args[0]
+	}
+	projects, err := exportedProjects(jirix, manifestPath, manifestExportFlags.pin)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := exporter(jirix, &buf, projects); err != nil {
+		return err
+	}
+	if manifestExportFlags.output == "" {
+		_, err := jirix.Stdout().Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(manifestExportFlags.output, buf.Bytes(), 0644)
+}
+
+// exportedProjects resolves the manifest and returns its projects sorted by
+// path, with paths relative to the jiri root and the revision, or the branch
+// if the manifest does not pin it, to check out in Revision. With pin, the
+// projects checked out locally are pinned to their current revision.
+func exportedProjects(jirix *jiri.X, manifestPath string, pin bool) ([]project.Project, error) {
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return nil, err
+	}
+	projects, _, _, err := project.LoadManifestFile(jirix, manifestPath, localProjects, false)
+	if err != nil {
+		return nil, err
+	}
+	var exported []project.Project
+	for key, p := range projects {
+		if lp, ok := localProjects[key]; ok && pin {
+			p.Revision = lp.Revision
+		} else if p.Revision == "" || p.Revision == "HEAD" {
+			p.Revision = p.RemoteBranch
+			if p.Revision == "" {
+				p.Revision = "master"
+			}
+		}
+		if p.Path, err = makePathRel(jirix.Root, p.Path); err != nil {
+			return nil, err
+		}
+		if p.Path == "." {
+			jirix.Logger.Warningf("Project %q is the jiri root and cannot be exported\n\n", p.Name)
+			continue
+		}
+		exported = append(exported, p)
+	}
+	sort.Slice(exported, func(i, j int) bool {
+		return exported[i].Path < exported[j].Path
+	})
+	return exported, nil
+}
+
+// projectAttributes returns the attributes of p, which jiri does not fetch by
+// default.
+func projectAttributes(p project.Project) []string {
+	var attrs []string
+	for _, attr := range strings.Split(p.Attributes, ",") {
+		if attr = strings.TrimSpace(attr); attr != "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+// splitRemote splits remote into the url its repository is fetched from and
+// the name of the repository, as repo declares them.
+func splitRemote(remote string) (fetch, name string) {
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		name = strings.TrimPrefix(u.Path, "/")
+		u.Path, u.RawPath = "/", ""
+		return u.String(), name
+	}
+	return filepath.Dir(remote) + "/", filepath.Base(remote)
+}
+
+// exportRepo writes projects as an Android repo manifest. The projects with
+// attributes are in the groups named after them and in the notdefault group,
+// so that repo does not sync them by default either.
+func exportRepo(jirix *jiri.X, w io.Writer, projects []project.Project) error {
+	var m repoManifest
+	remotes := make(map[string]string)
+	for _, p := range projects {
+		fetch, name := splitRemote(p.Remote)
+		remote, ok := remotes[fetch]
+		if !ok {
+			remote = fmt.Sprintf("remote%d", len(remotes))
+			if u, err := url.Parse(fetch); err == nil && u.Host != "" {
+				remote = u.Hostname()
+			}
+			for _, r := range m.Remotes {
+				if r.Name == remote {
+					remote = fmt.Sprintf("%s%d", remote, len(remotes))
+					break
+				}
+			}
+			remotes[fetch] = remote
+			m.Remotes = append(m.Remotes, repoRemote{Name: remote, Fetch: fetch})
+		}
+		var groups string
+		if attrs := projectAttributes(p); len(attrs) != 0 {
+			groups = strings.Join(append(attrs, "notdefault"), ",")
+		}
+		rp := repoProject{
+			Name:     name,
+			Path:     p.Path,
+			Remote:   remote,
+			Revision: p.Revision,
+			Groups:   groups,
+		}
+		for _, f := range p.Copyfiles {
+			rp.Copyfiles = append(rp.Copyfiles, repoFileLink{Src: f.Src, Dest: f.Dest})
+		}
+		for _, f := range p.Linkfiles {
+			rp.Linkfiles = append(rp.Linkfiles, repoFileLink{Src: f.Src, Dest: f.Dest})
+		}
+		m.Projects = append(m.Projects, rp)
+	}
+	data, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// exportGclient writes projects as the deps of a gclient DEPS file. The
+// projects with attributes are conditioned on checkout_<attribute> variables,
+// which are false by default.
+func exportGclient(jirix *jiri.X, w io.Writer, projects []project.Project) error {
+	var vars []string
+	seen := make(map[string]bool)
+	for _, p := range projects {
+		for _, attr := range projectAttributes(p) {
+			if !seen[attr] {
+				seen[attr] = true
+				vars = append(vars, attr)
+			}
+		}
+	}
+	sort.Strings(vars)
+	if len(vars) != 0 {
+		fmt.Fprintln(w, "vars = {")
+		for _, v := range vars {
+			fmt.Fprintf(w, "  %s: False,\n", strconv.Quote("checkout_"+v))
+		}
+		fmt.Fprintln(w, "}")
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "deps = {")
+	for _, p := range projects {
+		dep := strconv.Quote(p.Remote + "@" + p.Revision)
+		if attrs := projectAttributes(p); len(attrs) != 0 {
+			for i, attr := range attrs {
+				attrs[i] = "checkout_" + attr
+			}
+			fmt.Fprintf(w, "  %s: {\n    \"url\": %s,\n    \"condition\": %s,\n  },\n",
+				strconv.Quote(filepath.ToSlash(p.Path)), dep, strconv.Quote(strings.Join(attrs, " or ")))
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %s,\n", strconv.Quote(filepath.ToSlash(p.Path)), dep)
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// exportGitmodules writes projects as a .gitmodules file. As with "jiri
+// generate-gitmodules", the projects nested inside other projects are
+// dropped, as git does not support nested submodules.
+func exportGitmodules(jirix *jiri.X, w io.Writer, projects []project.Project) error {
+	treeRoot := projectTreeRoot{&projectTree{nil, make(map[string]*projectTree)}, make(project.Projects)}
+	for _, p := range projects {
+		if err := treeRoot.add(jirix, p); err != nil {
+			return err
+		}
+	}
+	for _, p := range projects {
+		if _, ok := treeRoot.dropped[p.Key()]; ok {
+			jirix.Logger.Warningf("Project %q is nested inside another project and cannot be exported\n\n", p.Name)
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", moduleDecl(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportWest writes projects as a Zephyr west manifest. The projects with
+// attributes are in the groups named after them, which the group-filter
+// disables by default.
+func exportWest(jirix *jiri.X, w io.Writer, projects []project.Project) error {
+	// JSON strings are valid YAML scalars.
+	quote := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+	var filter []string
+	seen := make(map[string]bool)
+	names := make(map[string]bool)
+	fmt.Fprintln(w, "manifest:")
+	fmt.Fprintln(w, "  projects:")
+	for _, p := range projects {
+		// West identifies projects by their name, which jiri does not.
+		name := p.Name
+		if names[name] {
+			name = filepath.ToSlash(p.Path)
+		}
+		names[name] = true
+		fmt.Fprintf(w, "    - name: %s\n", quote(name))
+		fmt.Fprintf(w, "      url: %s\n", quote(p.Remote))
+		fmt.Fprintf(w, "      revision: %s\n", quote(p.Revision))
+		fmt.Fprintf(w, "      path: %s\n", quote(filepath.ToSlash(p.Path)))
+		if attrs := projectAttributes(p); len(attrs) != 0 {
+			for i, attr := range attrs {
+				if !seen[attr] {
+					seen[attr] = true
+					filter = append(filter, quote("-"+attr))
+				}
+				attrs[i] = quote(attr)
+			}
+			fmt.Fprintf(w, "      groups: [%s]\n", strings.Join(attrs, ", "))
+		}
+	}
+	if len(filter) != 0 {
+		sort.Strings(filter)
+		fmt.Fprintf(w, "  group-filter: [%s]\n", strings.Join(filter, ", "))
+	}
+	return nil
+}
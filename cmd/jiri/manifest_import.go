@@ -0,0 +1,208 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var shaRE = regexp.MustCompile("^[0-9a-f]{40}$")
+
+var manifestImportFlags struct {
+	from        string
+	manifestURL string
+	output      string
+}
+
+func init() {
+	cmdManifestImport.Flags.StringVar(&manifestImportFlags.from, "from", "repo", "Format of the manifest, only repo is supported.")
+	cmdManifestImport.Flags.StringVar(&manifestImportFlags.manifestURL, "manifest-url", "", "Url of the repo manifest repository, which relative fetch urls of remotes are resolved against.")
+	cmdManifestImport.Flags.StringVar(&manifestImportFlags.output, "o", "", "File to write the jiri manifest to, instead of stdout.")
+}
+
+var cmdManifestImport = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runManifestImport),
+	Name:   "manifest-import",
+	Short:  "Convert the manifest of another meta-tool to a jiri manifest",
+	Long: `
+Converts an Android repo manifest, with the manifests it includes, to a jiri
+manifest. Projects keep the revision of their remote or of the <default>
+element, those in the notdefault group get attributes, and the review host of
+their remote becomes their gerrit host.
+`,
+	ArgsName: "<manifest>",
+	ArgsLong: "<manifest> is the manifest file to convert.",
+}
+
+func runManifestImport(jirix *jiri.X, args []string) error {
+	if len(args) != 1 {
+		return jirix.UsageErrorf("Wrong number of args")
+	}
+	if manifestImportFlags.from != "repo" {
+		return jirix.UsageErrorf("unknown format %q, want repo", manifestImportFlags.from)
+	}
+	rm, err := readRepoManifest(args[0])
+	if err != nil {
+		return err
+	}
+	m, err := convertRepoManifest(jirix, rm, manifestImportFlags.manifestURL)
+	if err != nil {
+		return err
+	}
+	data, err := m.ToBytes()
+	if err != nil {
+		return err
+	}
+	if manifestImportFlags.output == "" {
+		_, err := jirix.Stdout().Write(data)
+		return err
+	}
+	return ioutil.WriteFile(manifestImportFlags.output, data, 0644)
+}
+
+// convertRepoManifest returns the jiri manifest equivalent to the repo
+// manifest rm.
+func convertRepoManifest(jirix *jiri.X, rm *repoManifest, manifestURL string) (*project.Manifest, error) {
+	for _, e := range rm.Unsupported {
+		jirix.Logger.Warningf("Element <%s> is not supported and was ignored\n\n", e.XMLName.Local)
+	}
+	remotes := make(map[string]repoRemote)
+	for _, r := range rm.Remotes {
+		if u, err := url.Parse(r.Fetch); err != nil {
+			return nil, fmt.Errorf("invalid fetch url %q of remote %q: %v", r.Fetch, r.Name, err)
+		} else if !u.IsAbs() {
+			if manifestURL == "" {
+				return nil, fmt.Errorf("remote %q has a relative fetch url %q, give the url of the manifest repository with -manifest-url", r.Name, r.Fetch)
+			}
+			base, err := url.Parse(manifestURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid manifest url %q: %v", manifestURL, err)
+			}
+			r.Fetch = base.ResolveReference(u).String()
+		}
+		remotes[r.Name] = r
+	}
+	def := repoDefault{}
+	if rm.Default != nil {
+		def = *rm.Default
+	}
+
+	removed := make(map[string]bool)
+	for _, r := range rm.RemoveProjects {
+		removed[r.Name] = true
+	}
+	m := &project.Manifest{}
+	for _, rp := range rm.Projects {
+		if removed[rp.Name] {
+			continue
+		}
+		for _, e := range rm.ExtendProjects {
+			if e.Name != rp.Name || (e.Path != "" && e.Path != rp.Path) {
+				continue
+			}
+			if e.Groups != "" {
+				rp.Groups = strings.Trim(rp.Groups+","+e.Groups, ",")
+			}
+			if e.Revision != "" {
+				rp.Revision = e.Revision
+			}
+			if e.Remote != "" {
+				rp.Remote = e.Remote
+			}
+			if e.Upstream != "" {
+				rp.Upstream = e.Upstream
+			}
+			rp.Copyfiles = append(rp.Copyfiles, e.Copyfiles...)
+			rp.Linkfiles = append(rp.Linkfiles, e.Linkfiles...)
+		}
+		for _, e := range rp.Unsupported {
+			jirix.Logger.Warningf("Element <%s> of project %q is not supported and was ignored\n\n", e.XMLName.Local, rp.Name)
+		}
+		remoteName := rp.Remote
+		if remoteName == "" {
+			remoteName = def.Remote
+		}
+		remote, ok := remotes[remoteName]
+		if !ok {
+			return nil, fmt.Errorf("project %q has unknown remote %q", rp.Name, remoteName)
+		}
+		p := project.Project{
+			Name:       rp.Name,
+			Path:       rp.Path,
+			Remote:     strings.TrimSuffix(remote.Fetch, "/") + "/" + rp.Name,
+			Attributes: repoAttributes(rp.Groups),
+		}
+		if p.Path == "" {
+			p.Path = rp.Name
+		}
+		if remote.Review != "" {
+			p.GerritHost = remote.Review
+			if !strings.Contains(p.GerritHost, "://") {
+				p.GerritHost = "https://" + p.GerritHost
+			}
+		}
+		revision := rp.Revision
+		if revision == "" {
+			revision = remote.Revision
+		}
+		if revision == "" {
+			revision = def.Revision
+		}
+		p.Revision, p.RemoteBranch = repoRevision(revision, rp.Upstream)
+		for _, f := range rp.Copyfiles {
+			p.Copyfiles = append(p.Copyfiles, project.ProjectFile{Src: f.Src, Dest: f.Dest})
+		}
+		for _, f := range rp.Linkfiles {
+			p.Linkfiles = append(p.Linkfiles, project.ProjectFile{Src: f.Src, Dest: f.Dest})
+		}
+		m.Projects = append(m.Projects, p)
+	}
+	return m, nil
+}
+
+// repoRevision returns the revision and the remote branch of a jiri project
+// checking out the repo revision, given with its upstream branch.
+func repoRevision(revision, upstream string) (string, string) {
+	branch := strings.TrimPrefix(upstream, "refs/heads/")
+	switch {
+	case strings.HasPrefix(revision, "refs/heads/"):
+		return "", strings.TrimPrefix(revision, "refs/heads/")
+	case strings.HasPrefix(revision, "refs/") || shaRE.MatchString(revision):
+		return revision, branch
+	}
+	return "", revision
+}
+
+// repoAttributes returns the attributes of a jiri project in the repo
+// groups. Only the projects in the notdefault group are not fetched by
+// default by repo, so the other projects have no attributes.
+func repoAttributes(groups string) string {
+	var attrs []string
+	notDefault := false
+	for _, g := range strings.Split(groups, ",") {
+		switch g = strings.TrimSpace(g); g {
+		case "":
+		case "notdefault":
+			notDefault = true
+		default:
+			attrs = append(attrs, g)
+		}
+	}
+	if !notDefault {
+		return ""
+	}
+	if len(attrs) == 0 {
+		return "notdefault"
+	}
+	return strings.Join(attrs, ",")
+}
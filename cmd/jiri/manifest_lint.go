@@ -0,0 +1,80 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var manifestLintFlags struct {
+	json bool
+	opts project.LintOptions
+}
+
+func init() {
+	cmdManifestLint.Flags.BoolVar(&manifestLintFlags.json, "json", false, "Print the findings as a json list, for presubmit bots.")
+	cmdManifestLint.Flags.BoolVar(&manifestLintFlags.opts.Resolve, "resolve", false, "Load the imports of the manifest and check the whole tree.")
+	cmdManifestLint.Flags.BoolVar(&manifestLintFlags.opts.Network, "network", false, "Check that the remotes of the imports, and with -resolve of the projects, are reachable.")
+}
+
+var cmdManifestLint = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runManifestLint),
+	Name:   "manifest-lint",
+	Short:  "Check a manifest file for problems",
+	Long: `
+Checks the manifest and prints its problems: unknown elements and attributes,
+projects sharing a name or a path or nested inside each other, and with
+-resolve, projects of different imports shadowing each other, unused overrides
+and replacements of deprecated projects which are not in the manifest.
+
+The command fails if any finding is an error.
+`,
+	ArgsName: "[<manifest>]",
+	ArgsLong: "<manifest> is the manifest file, .jiri_manifest by default.",
+}
+
+func runManifestLint(jirix *jiri.X, args []string) error {
+	if len(args) > 1 {
+		return jirix.UsageErrorf("Wrong number of args")
+	}
+	manifestPath := jirix.JiriManifestFile()
+	if len(args) == 1 {
+		manifestPath = args[0]
+	}
+	findings, err := project.LintManifestFile(jirix, manifestPath, manifestLintFlags.opts)
+	if err != nil {
+		return err
+	}
+	errs := 0
+	for _, f := range findings {
+		if f.Severity == project.LintError {
+			errs++
+		}
+	}
+	if manifestLintFlags.json {
+		if findings == nil {
+			findings = []project.LintFinding{}
+		}
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", " ")
+		if err := e.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	}
+	if errs != 0 {
+		return fmt.Errorf("%d error(s) found in %s", errs, manifestPath)
+	}
+	return nil
+}
@@ -5,12 +5,18 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
 )
 
 func TestManifest(t *testing.T) {
@@ -248,3 +254,188 @@ func TestManifest(t *testing.T) {
 			"false")
 	})
 }
+
+func TestManifestLint(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	manifest := filepath.Join(fake.X.Root, "lint_manifest")
+	if err := ioutil.WriteFile(manifest, []byte(`<manifest>
+  <projects>
+    <project name="a" path="a" remote="https://example.com/a"/>
+    <project name="b" path="a" remote="https://example.com/b" revison="r"/>
+  </projects>
+</manifest>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var runErr error
+	stdout, _, err := runfunc(func() {
+		manifestLintFlags.json = true
+		defer func() { manifestLintFlags.json = false }()
+		runErr = runManifestLint(fake.X, []string{manifest})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runErr == nil {
+		t.Errorf("expected lint to fail")
+	}
+	var findings []project.LintFinding
+	if err := json.Unmarshal([]byte(stdout), &findings); err != nil {
+		t.Fatalf("cannot parse %q: %v", stdout, err)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, fmt.Sprintf("%s:%d:%s", f.File, f.Line, f.Check))
+	}
+	if want := []string{"lint_manifest:4:unknown-attribute", "lint_manifest:4:duplicate-path"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got findings %v, want %v", got, want)
+	}
+}
+
+func TestManifestExport(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	manifest := filepath.Join(fake.X.Root, "export_manifest")
+	if err := ioutil.WriteFile(manifest, []byte(`<manifest>
+  <projects>
+    <project name="root" path="." remote="https://example.com/root"/>
+    <project name="a" path="a" remote="https://example.com/a" revision="abc"/>
+    <project name="n" path="a/n" remote="https://example.com/n"/>
+    <project name="b" path="b/c" remote="https://other.org/x/b" remotebranch="main" attributes="opt"/>
+  </projects>
+</manifest>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]string{
+		"repo": {
+			`<remote name="example.com" fetch="https://example.com/"></remote>`,
+			`<remote name="other.org" fetch="https://other.org/"></remote>`,
+			`<project name="a" path="a" remote="example.com" revision="abc"></project>`,
+			`<project name="n" path="a/n" remote="example.com" revision="master"></project>`,
+			`<project name="x/b" path="b/c" remote="other.org" revision="main" groups="opt,notdefault"></project>`,
+		},
+		"gclient": {
+			`"checkout_opt": False,`,
+			`"a": "https://example.com/a@abc",`,
+			`"url": "https://other.org/x/b@main",`,
+			`"condition": "checkout_opt",`,
+		},
+		"gitmodules": {
+			"[submodule \"a\"]\n\tbranch = abc\n\tpath = a\n\turl = https://example.com/a\n",
+			"[submodule \"b\"]\n\tbranch = main\n\tpath = b/c\n\turl = https://other.org/x/b\n",
+		},
+		"west": {
+			"    - name: \"a\"\n      url: \"https://example.com/a\"\n      revision: \"abc\"\n      path: \"a\"\n",
+			`      groups: ["opt"]`,
+			`  group-filter: ["-opt"]`,
+		},
+	}
+	defer func() { manifestExportFlags.format, manifestExportFlags.output = "repo", "" }()
+	for format, want := range tests {
+		output := filepath.Join(fake.X.Root, "export."+format)
+		manifestExportFlags.format, manifestExportFlags.output = format, output
+		if err := runManifestExport(fake.X, []string{manifest}); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		data, err := ioutil.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(data)
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: export %q does not contain %q", format, got, w)
+			}
+		}
+		if strings.Contains(got, "example.com/root") {
+			t.Errorf("%s: export %q contains the project at the jiri root", format, got)
+		}
+		if format == "gitmodules" && strings.Contains(got, "a/n") {
+			t.Errorf("gitmodules: export %q contains a nested project", got)
+		}
+	}
+	manifestExportFlags.format = "cargo"
+	if err := runManifestExport(fake.X, []string{manifest}); err == nil {
+		t.Errorf("expected an error exporting to an unknown format")
+	}
+}
+
+func TestManifestImport(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	dir := filepath.Join(fake.X.Root, "repo")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "default.xml"), []byte(`<manifest>
+  <remote name="aosp" fetch=".." review="android-review.googlesource.com"/>
+  <remote name="other" fetch="https://other.org/" revision="refs/heads/stable"/>
+  <default remote="aosp" revision="refs/heads/main"/>
+  <project name="platform/build" path="build/make">
+    <copyfile src="core/root.mk" dest="Makefile"/>
+    <linkfile src="target" dest="build/target"/>
+  </project>
+  <project name="tools" remote="other" groups="pdk,notdefault"/>
+  <project name="gone"/>
+  <remove-project name="gone"/>
+  <include name="include.xml"/>
+  <notice>Hi</notice>
+</manifest>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "include.xml"), []byte(`<manifest>
+  <project name="pinned" revision="0123456789abcdef0123456789abcdef01234567" upstream="refs/heads/dev"/>
+</manifest>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(fake.X.Root, "android.xml")
+	manifestImportFlags.manifestURL = "https://android.googlesource.com/platform/manifest"
+	manifestImportFlags.output = output
+	defer func() { manifestImportFlags.manifestURL, manifestImportFlags.output = "", "" }()
+	if err := runManifestImport(fake.X, []string{filepath.Join(dir, "default.xml")}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := project.ManifestFromFile(fake.X, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range m.Projects {
+		got = append(got, strings.Join([]string{p.Name, p.Path, p.Remote, p.Revision, p.RemoteBranch, p.Attributes, p.GerritHost}, " "))
+	}
+	want := []string{
+		"platform/build build/make https://android.googlesource.com/platform/build HEAD main  https://android-review.googlesource.com",
+		"tools tools https://other.org/tools HEAD stable pdk ",
+		"pinned pinned https://android.googlesource.com/pinned 0123456789abcdef0123456789abcdef01234567 dev  https://android-review.googlesource.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got projects %q, want %q", got, want)
+	}
+	build := m.Projects[0]
+	if got, want := build.Copyfiles, []project.ProjectFile{{Src: "core/root.mk", Dest: "Makefile"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got copyfiles %+v, want %+v", got, want)
+	}
+	if got, want := build.Linkfiles, []project.ProjectFile{{Src: "target", Dest: "build/target"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got linkfiles %+v, want %+v", got, want)
+	}
+
+	// An include cycle is an error.
+	if err := ioutil.WriteFile(filepath.Join(dir, "include.xml"), []byte(`<manifest>
+  <include name="default.xml"/>
+</manifest>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = runManifestImport(fake.X, []string{filepath.Join(dir, "default.xml")})
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("expected an include cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/metrics"
+)
+
+var cmdMetrics = &cmdline.Command{
+	Name:  "metrics",
+	Short: "Report where the time of jiri update goes",
+	Long: `
+When enabled with "jiri init -metrics=true", every "jiri update" records the
+time spent in each of its phases (loading manifests, fetching, updating
+projects, running hooks, fetching packages...) and on each project, in
+.jiri_root/metrics. The last 100 runs are kept. Nothing is sent anywhere.
+`,
+	Children: []*cmdline.Command{cmdMetricsReport},
+}
+
+var cmdMetricsReport = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runMetricsReport),
+	Name:   "report",
+	Short:  "Summarize the last updates",
+	Long: `
+Lists the last updates with their durations, the average time spent in each
+phase and the projects which took the longest to fetch and to update.
+`,
+}
+
+var metricsReportFlags struct {
+	runs int
+	top  int
+}
+
+func init() {
+	cmdMetricsReport.Flags.IntVar(&metricsReportFlags.runs, "n", 10, "Number of updates to report on.")
+	cmdMetricsReport.Flags.IntVar(&metricsReportFlags.top, "top", 10, "Number of projects to list for each phase.")
+}
+
+func runMetricsReport(jirix *jiri.X, args []string) error {
+	if len(args) != 0 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	if metricsReportFlags.runs < 1 {
+		return jirix.UsageErrorf("-n should be >= 1")
+	}
+	if jirix.Metrics == nil {
+		jirix.Logger.Warningf("Metrics are not enabled, enable them with 'jiri init -metrics=true'\n\n")
+	}
+	runs, err := metrics.Read(jirix.MetricsDir(), "update", metricsReportFlags.runs)
+	if err != nil {
+		return err
+	}
+	return metrics.Report(os.Stdout, runs, metricsReportFlags.top)
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/cmdline"
@@ -19,12 +20,15 @@ var overrideFlags struct {
 	// Flags configuring project attributes for overrides.
 	importManifest string
 	gerritHost     string
+	newRemote      string
 	path           string
+	remoteBranch   string
 	revision       string
 	// Flags controlling the behavior of the command.
-	delete     bool
-	list       bool
-	JSONOutput string
+	delete      bool
+	list        bool
+	JSONOutput  string
+	lockTimeout time.Duration
 }
 
 func init() {
@@ -32,11 +36,14 @@ func init() {
 
 	cmdOverride.Flags.StringVar(&overrideFlags.path, "path", "", `Path used to store the project locally.`)
 	cmdOverride.Flags.StringVar(&overrideFlags.revision, "revision", "", `Revision to check out for the remote (defaults to HEAD).`)
+	cmdOverride.Flags.StringVar(&overrideFlags.remoteBranch, "remote-branch", "", `Remote branch to track, without the leading "origin/". Ignored if -revision is set.`)
+	cmdOverride.Flags.StringVar(&overrideFlags.newRemote, "new-remote", "", `Remote to fetch the project from instead of <remote>, e.g. a fork.`)
 	cmdOverride.Flags.StringVar(&overrideFlags.gerritHost, "gerrithost", "", `The project Gerrit host.`)
 
 	cmdOverride.Flags.BoolVar(&overrideFlags.delete, "delete", false, `Delete existing override. Override is matched using <name> and <remote>, <remote> is optional.`)
 	cmdOverride.Flags.BoolVar(&overrideFlags.list, "list", false, `List all the overrides from .jiri_manifest. This flag doesn't accept any arguments. -json-out flag can be used to specify json output file.`)
 	cmdOverride.Flags.StringVar(&overrideFlags.JSONOutput, "json-output", "", `JSON output file from -list flag.`)
+	cmdOverride.Flags.DurationVar(&overrideFlags.lockTimeout, "lock-timeout", project.DefaultManifestLockTimeout, `Time to wait for other jiri processes to finish modifying .jiri_manifest.`)
 }
 
 var cmdOverride = &cmdline.Command{
@@ -46,8 +53,14 @@ var cmdOverride = &cmdline.Command{
 	Long: `Add overrides to the .jiri_manifest file. This allows overriding project
 definitions, including from transitively imported manifests.
 
+Overrides are applied by "jiri update" after the manifest is resolved. They
+can pin a project to a revision (-revision), make it track another branch
+(-remote-branch) or fetch it from another remote (-new-remote), e.g. to test
+unmerged changes of a dependency.
+
 Example:
   $ jiri override project https://foo.com/bar.git
+  $ jiri override -new-remote=https://foo.com/fork.git -remote-branch=fix project https://foo.com/bar.git
 
 Run "jiri help manifest" for details on manifests.
 `,
@@ -65,6 +78,8 @@ type overrideInfo struct {
 	Name           string `json:"name"`
 	Path           string `json:"path,omitempty"`
 	Remote         string `json:"remote"`
+	NewRemote      string `json:"new-remote,omitempty"`
+	RemoteBranch   string `json:"remote-branch,omitempty"`
 	Revision       string `json:"revision,omitempty"`
 	GerritHost     string `json:"gerrithost,omitempty"`
 }
@@ -82,6 +97,14 @@ func runOverride(jirix *jiri.X, args []string) error {
 		return jirix.UsageErrorf("wrong number of arguments")
 	}
 
+	if !overrideFlags.list {
+		unlock, err := project.LockManifestFile(jirix, jirix.JiriManifestFile(), overrideFlags.lockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
 	// Initialize manifest.
 	manifestExists, err := isFile(jirix.JiriManifestFile())
 	if err != nil {
@@ -98,12 +121,19 @@ func runOverride(jirix *jiri.X, args []string) error {
 	if overrideFlags.list {
 		overrides := make([]overrideInfo, 0)
 		for _, p := range manifest.ProjectOverrides {
+			// Only show branches that are not the default one, as in
+			// .jiri_manifest.
+			if p.RemoteBranch == "master" {
+				p.RemoteBranch = ""
+			}
 			overrides = append(overrides, overrideInfo{
-				Name:       p.Name,
-				Path:       p.Path,
-				Remote:     p.Remote,
-				Revision:   p.Revision,
-				GerritHost: p.GerritHost,
+				Name:         p.Name,
+				Path:         p.Path,
+				Remote:       p.Remote,
+				NewRemote:    p.NewRemote,
+				RemoteBranch: p.RemoteBranch,
+				Revision:     p.Revision,
+				GerritHost:   p.GerritHost,
 			})
 		}
 
@@ -126,9 +156,15 @@ func runOverride(jirix *jiri.X, args []string) error {
 				}
 				fmt.Printf("  Name:        %s\n", o.Name)
 				fmt.Printf("  Remote:      %s\n", o.Remote)
+				if o.NewRemote != "" {
+					fmt.Printf("  New Remote:  %s\n", o.NewRemote)
+				}
 				if o.Path != "" {
 					fmt.Printf("  Path:        %s\n", o.Path)
 				}
+				if o.RemoteBranch != "" {
+					fmt.Printf("  Branch:      %s\n", o.RemoteBranch)
+				}
 				if o.Remote != "" {
 					fmt.Printf("  Revision:    %s\n", o.Revision)
 				}
@@ -151,79 +187,76 @@ func runOverride(jirix *jiri.X, args []string) error {
 		return nil
 	}
 
+	// Edit .jiri_manifest in place to keep its comments and formatting.
+	// There's no error checking when writing the .jiri_manifest file;
+	// errors will be reported when "jiri update" is run.
 	name := args[0]
 	if overrideFlags.delete {
-		var projectOverrides []project.Project
-		var importOverrides []project.Import
-		var deletedProjectOverrides []project.Project
-		var deletedImportOverrides []project.Import
-		for _, p := range manifest.ImportOverrides {
-			if overrideFlags.importManifest == "" || (len(args) == 2 && p.Remote != args[1]) || p.Name != name {
-				importOverrides = append(importOverrides, p)
-				continue
-			}
-			deletedImportOverrides = append(deletedImportOverrides, p)
+		remote := ""
+		if len(args) == 2 {
+			remote = args[1]
 		}
-
-		for _, p := range manifest.ProjectOverrides {
-			if overrideFlags.importManifest != "" || (len(args) == 2 && p.Remote != args[1]) || p.Name != name {
-				projectOverrides = append(projectOverrides, p)
-				continue
+		var names []string
+		if overrideFlags.importManifest != "" {
+			for _, p := range manifest.ImportOverrides {
+				if p.Name == name && (remote == "" || p.Remote == remote) {
+					names = append(names, p.Name)
+				}
+			}
+		} else {
+			for _, p := range manifest.ProjectOverrides {
+				if p.Name == name && (remote == "" || p.Remote == remote) {
+					names = append(names, p.Name)
+				}
 			}
-			deletedProjectOverrides = append(deletedProjectOverrides, p)
 		}
-
-		if len(deletedProjectOverrides)+len(deletedImportOverrides) > 1 {
+		if len(names) > 1 {
 			return fmt.Errorf("more than one override matches")
 		}
-		var names []string
-		for _, p := range deletedProjectOverrides {
-			names = append(names, p.Name)
+		if overrideFlags.importManifest != "" {
+			_, err = project.RemoveManifestImport(jirix, jirix.JiriManifestFile(), "", name, remote, true /*override*/)
+		} else {
+			_, err = project.RemoveManifestProject(jirix, jirix.JiriManifestFile(), name, remote, true /*override*/)
 		}
-		for _, p := range deletedImportOverrides {
-			names = append(names, p.Name)
+		if err != nil {
+			return err
 		}
 		jirix.Logger.Infof("Deleted overrides: %s\n", strings.Join(names, " "))
+		return nil
+	}
 
-		manifest.ProjectOverrides = projectOverrides
-		manifest.ImportOverrides = importOverrides
-	} else {
-		remote := args[1]
-		overrideKeys := make(map[string]bool)
-		for _, p := range manifest.ProjectOverrides {
-			overrideKeys[string(p.Key())] = true
-		}
-		for _, p := range manifest.ImportOverrides {
-			overrideKeys[string(p.ProjectKey())] = true
-		}
-		if _, ok := overrideKeys[string(project.MakeProjectKey(name, remote))]; !ok {
-			if overrideFlags.importManifest != "" {
-				importOverride := project.Import{
-					Name:     name,
-					Remote:   remote,
-					Manifest: overrideFlags.importManifest,
-					Revision: overrideFlags.revision,
-				}
-				manifest.ImportOverrides = append(manifest.ImportOverrides, importOverride)
-			} else {
-				projectOverride := project.Project{
-					Name:       name,
-					Remote:     remote,
-					Path:       overrideFlags.path,
-					Revision:   overrideFlags.revision,
-					GerritHost: overrideFlags.gerritHost,
-					// We deliberately omit RemoteBranch, HistoryDepth and
-					// GitHooks. Those fields are effectively deprecated and
-					// will likely be removed in the future.
-				}
-				manifest.ProjectOverrides = append(manifest.ProjectOverrides, projectOverride)
-			}
-		} else {
-			jirix.Logger.Infof("Override \"%s:%s\" is already exist, no modification will be made.", name, remote)
+	remote := args[1]
+	overrideKeys := make(map[string]bool)
+	for _, p := range manifest.ProjectOverrides {
+		overrideKeys[string(p.Key())] = true
+	}
+	for _, p := range manifest.ImportOverrides {
+		overrideKeys[string(p.ProjectKey())] = true
+	}
+	if overrideKeys[string(project.MakeProjectKey(name, remote))] {
+		jirix.Logger.Infof("Override \"%s:%s\" is already exist, no modification will be made.", name, remote)
+		return nil
+	}
+	if overrideFlags.importManifest != "" {
+		importOverride := project.Import{
+			Name:     name,
+			Remote:   remote,
+			Manifest: overrideFlags.importManifest,
+			Revision: overrideFlags.revision,
 		}
+		return project.AddManifestImport(jirix, jirix.JiriManifestFile(), importOverride, true /*override*/)
 	}
-
-	// There's no error checking when writing the .jiri_manifest file;
-	// errors will be reported when "jiri update" is run.
-	return manifest.ToFile(jirix, jirix.JiriManifestFile())
+	projectOverride := project.Project{
+		Name:         name,
+		Remote:       remote,
+		NewRemote:    overrideFlags.newRemote,
+		Path:         overrideFlags.path,
+		RemoteBranch: overrideFlags.remoteBranch,
+		Revision:     overrideFlags.revision,
+		GerritHost:   overrideFlags.gerritHost,
+		// We deliberately omit HistoryDepth and GitHooks. Those
+		// fields are effectively deprecated and will likely be
+		// removed in the future.
+	}
+	return project.AddManifestProject(jirix, jirix.JiriManifestFile(), projectOverride, true /*override*/)
 }
@@ -30,9 +30,12 @@ func setDefaultOverrideFlags() {
 	overrideFlags.path = ""
 	overrideFlags.revision = ""
 	overrideFlags.gerritHost = ""
+	overrideFlags.newRemote = ""
+	overrideFlags.remoteBranch = ""
 	overrideFlags.delete = false
 	overrideFlags.list = false
 	overrideFlags.JSONOutput = ""
+	overrideFlags.lockTimeout = project.DefaultManifestLockTimeout
 }
 
 func TestOverride(t *testing.T) {
@@ -89,6 +92,22 @@ func TestOverride(t *testing.T) {
     <project name="foo" remote="https://github.com/new.git" revision="bar"/>
   </overrides>
 </manifest>
+`,
+		},
+		{
+			SetFlags: func() {
+				overrideFlags.newRemote = "https://github.com/fork.git"
+				overrideFlags.remoteBranch = "fix"
+			},
+			Args: []string{"foo", "https://github.com/new.git"},
+			Want: `<manifest>
+  <imports>
+    <import manifest="manifest" name="foo" remote="https://github.com/new.git"/>
+  </imports>
+  <overrides>
+    <project name="foo" remote="https://github.com/new.git" newremote="https://github.com/fork.git" remotebranch="fix"/>
+  </overrides>
+</manifest>
 `,
 		},
 		{
@@ -131,6 +150,26 @@ func TestOverride(t *testing.T) {
 			Stdout: `* override foo
   Name:        foo
   Remote:      https://github.com/new.git
+`,
+		},
+		{
+			SetFlags: func() {
+				overrideFlags.list = true
+			},
+			Exist: `<manifest>
+  <imports>
+    <import manifest="manifest" name="orig" remote="https://github.com/orig.git"/>
+  </imports>
+  <overrides>
+    <project name="foo" remote="https://github.com/new.git" remotebranch="fix"/>
+  </overrides>
+</manifest>
+`,
+			Stdout: `* override foo
+  Name:        foo
+  Remote:      https://github.com/new.git
+  Branch:      fix
+  Revision:    HEAD
 `,
 		},
 		{
@@ -271,6 +310,67 @@ func TestOverride(t *testing.T) {
     <import manifest="manifest" name="orig" remote="https://github.com/orig.git" revision="eabeadae97b1e7f97ba93206066411adfe93a509"/>
   </overrides>
 </manifest>
+`,
+		},
+		// Comments and formatting of .jiri_manifest are kept.
+		{
+			Args: []string{"foo", "https://github.com/foo.git"},
+			Exist: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="manifest" name="orig" remote="https://github.com/orig.git"/>
+  </imports>
+  <overrides>
+    <!-- Pinned until the fix lands. -->
+    <project name="bar" remote="https://github.com/bar.git"
+             revision="eabeadae97b1e7f97ba93206066411adfe93a509"/>
+  </overrides>
+</manifest>
+`,
+			Want: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="manifest" name="orig" remote="https://github.com/orig.git"/>
+  </imports>
+  <overrides>
+    <!-- Pinned until the fix lands. -->
+    <project name="bar" remote="https://github.com/bar.git"
+             revision="eabeadae97b1e7f97ba93206066411adfe93a509"/>
+    <project name="foo" remote="https://github.com/foo.git"/>
+  </overrides>
+</manifest>
+`,
+		},
+		{
+			SetFlags: func() {
+				overrideFlags.delete = true
+			},
+			Args:    []string{"foo"},
+			runOnce: true,
+			Exist: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="manifest" name="orig" remote="https://github.com/orig.git"/>
+  </imports>
+  <overrides>
+    <!-- Pinned until the fix lands. -->
+    <project name="bar" remote="https://github.com/bar.git"
+             revision="eabeadae97b1e7f97ba93206066411adfe93a509"/>
+    <project name="foo" remote="https://github.com/foo.git"/>
+  </overrides>
+</manifest>
+`,
+			Want: `<manifest>
+  <!-- The main manifest. -->
+  <imports>
+    <import manifest="manifest" name="orig" remote="https://github.com/orig.git"/>
+  </imports>
+  <overrides>
+    <!-- Pinned until the fix lands. -->
+    <project name="bar" remote="https://github.com/bar.git"
+             revision="eabeadae97b1e7f97ba93206066411adfe93a509"/>
+  </overrides>
+</manifest>
 `,
 		},
 	}
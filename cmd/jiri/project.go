@@ -14,6 +14,7 @@ import (
 	"regexp"
 	"sort"
 	"text/template"
+	"time"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/cmdline"
@@ -27,6 +28,18 @@ var (
 	jsonOutputFlag    string
 	regexpFlag        bool
 	templateFlag      string
+	deprecatedFlag    bool
+
+	projectEditFlags struct {
+		add          bool
+		remove       bool
+		override     bool
+		path         string
+		remoteBranch string
+		revision     string
+		gerritHost   string
+		lockTimeout  time.Duration
+	}
 )
 
 func init() {
@@ -36,6 +49,15 @@ func init() {
 	cmdProject.Flags.BoolVar(&regexpFlag, "regexp", false, "Use argument as regular expression.")
 	cmdProject.Flags.StringVar(&templateFlag, "template", "", "The template for the fields to display.")
 	cmdProject.Flags.BoolVar(&useRemoteProjects, "list-remote-projects", false, "List remote projects instead of local projects.")
+	cmdProject.Flags.BoolVar(&deprecatedFlag, "deprecated", false, "Only list the deprecated projects, of all projects if no project is given.")
+	cmdProject.Flags.BoolVar(&projectEditFlags.add, "add", false, "Add project <name> with remote <remote> to .jiri_manifest.")
+	cmdProject.Flags.BoolVar(&projectEditFlags.remove, "remove", false, "Remove project <name> from .jiri_manifest. If <remote> is given, only the project with that remote is removed.")
+	cmdProject.Flags.BoolVar(&projectEditFlags.override, "override", false, "Add or remove a project override instead of a project. Used with -add and -remove.")
+	cmdProject.Flags.StringVar(&projectEditFlags.path, "path", "", "Path of the project added with -add.")
+	cmdProject.Flags.StringVar(&projectEditFlags.remoteBranch, "remote-branch", "", "Remote branch of the project added with -add.")
+	cmdProject.Flags.StringVar(&projectEditFlags.revision, "revision", "", "Revision of the project added with -add.")
+	cmdProject.Flags.StringVar(&projectEditFlags.gerritHost, "gerrithost", "", "Gerrit host of the project added with -add.")
+	cmdProject.Flags.DurationVar(&projectEditFlags.lockTimeout, "lock-timeout", project.DefaultManifestLockTimeout, "Time to wait for other jiri processes to finish modifying .jiri_manifest.")
 }
 
 // cmdProject represents the "jiri project" command.
@@ -51,18 +73,74 @@ var cmdProject = &cmdline.Command{
 	current directory is used, or if run from outside of a given project,
 	all projects will be used. The information to be displayed can be
 	specified using a Go template, supplied via
-the -template flag.`,
+the -template flag.
+
+With -deprecated, only the projects marked as deprecated by the manifest are
+listed, with the message and the replacement given by the manifest.
+
+With -add or -remove, a <project> element is added to or removed from the
+[root]/.jiri_manifest file instead. The file is edited in place, so that
+comments and the order of its elements are kept.
+
+Example:
+  $ jiri project -add -path=src/foo foo https://foo.com/foo.git`,
 	ArgsName: "<project ...>",
-	ArgsLong: "<project ...> is a list of projects to clean up or give info about.",
+	ArgsLong: `<project ...> is a list of projects to clean up or give info about.
+With -add, the arguments are <name> <remote>, with -remove <name> [<remote>].`,
 }
 
 func runProject(jirix *jiri.X, args []string) (e error) {
+	if projectEditFlags.add || projectEditFlags.remove {
+		return runProjectEdit(jirix, args)
+	}
 	if cleanupFlag || cleanAllFlag {
 		return runProjectClean(jirix, args)
 	} else {
 		return runProjectInfo(jirix, args)
 	}
 }
+
+func runProjectEdit(jirix *jiri.X, args []string) error {
+	if projectEditFlags.add && projectEditFlags.remove {
+		return jirix.UsageErrorf("cannot use -add and -remove together")
+	}
+	if projectEditFlags.add && len(args) != 2 {
+		return jirix.UsageErrorf("wrong number of arguments for the add flag")
+	} else if projectEditFlags.remove && len(args) != 1 && len(args) != 2 {
+		return jirix.UsageErrorf("wrong number of arguments for the remove flag")
+	}
+	unlock, err := project.LockManifestFile(jirix, jirix.JiriManifestFile(), projectEditFlags.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if projectEditFlags.add {
+		p := project.Project{
+			Name:         args[0],
+			Remote:       args[1],
+			Path:         projectEditFlags.path,
+			RemoteBranch: projectEditFlags.remoteBranch,
+			Revision:     projectEditFlags.revision,
+			GerritHost:   projectEditFlags.gerritHost,
+		}
+		return project.AddManifestProject(jirix, jirix.JiriManifestFile(), p, projectEditFlags.override)
+	}
+	remote := ""
+	if len(args) == 2 {
+		remote = args[1]
+	}
+	n, err := project.RemoveManifestProject(jirix, jirix.JiriManifestFile(), args[0], remote, projectEditFlags.override)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("project %q not found in %s", args[0], jirix.JiriManifestFile())
+	}
+	jirix.Logger.Infof("Removed %d project(s) named %q", n, args[0])
+	return nil
+}
+
 func runProjectClean(jirix *jiri.X, args []string) (e error) {
 	localProjects, err := project.LocalProjects(jirix, project.FullScan)
 	if err != nil {
@@ -113,6 +191,8 @@ type projectInfoOutput struct {
 	CurrentBranch string   `json:"current_branch,omitempty"`
 	Branches      []string `json:"branches,omitempty"`
 	Manifest      string   `json:"manifest,omitempty"`
+	Deprecated    string   `json:"deprecated,omitempty"`
+	Replacement   string   `json:"replacement,omitempty"`
 }
 
 // runProjectInfo provides structured info on local projects.
@@ -158,8 +238,9 @@ func runProjectInfo(jirix *jiri.X, args []string) error {
 		// Due to fuchsia.git is checked out at root.
 		// set currentProject to nil if current working
 		// dir is JIRI_ROOT to allow list all projects.
+		// -deprecated looks for deprecated projects among all of them too.
 		cwd, err := os.Getwd()
-		if cwd == jirix.Root {
+		if cwd == jirix.Root || deprecatedFlag {
 			currentProject = nil
 		}
 		if currentProject == nil {
@@ -206,6 +287,15 @@ func runProjectInfo(jirix *jiri.X, args []string) error {
 			}
 		}
 	}
+	if deprecatedFlag {
+		var deprecated project.ProjectKeys
+		for _, key := range keys {
+			if states[key].Project.Deprecated != "" {
+				deprecated = append(deprecated, key)
+			}
+		}
+		keys = deprecated
+	}
 	sort.Sort(keys)
 
 	info := make([]projectInfoOutput, len(keys))
@@ -224,6 +314,8 @@ func runProjectInfo(jirix *jiri.X, args []string) error {
 			Revision:      state.Project.Revision,
 			CurrentBranch: state.CurrentBranch.Name,
 			Manifest:      state.Project.ManifestPath,
+			Deprecated:    state.Project.Deprecated,
+			Replacement:   state.Project.Replacement,
 		}
 		for _, b := range state.Branches {
 			info[i].Branches = append(info[i].Branches, b.Name)
@@ -245,6 +337,12 @@ func runProjectInfo(jirix *jiri.X, args []string) error {
 			if useRemoteProjects {
 				fmt.Printf("  Manifest: %s\n", i.Manifest)
 			}
+			if i.Deprecated != "" {
+				fmt.Printf("  Deprecated: %s\n", i.Deprecated)
+				if i.Replacement != "" {
+					fmt.Printf("  Replacement: %s\n", i.Replacement)
+				}
+			}
 			if len(i.Branches) != 0 {
 				fmt.Printf("  Branches:\n")
 				width := 0
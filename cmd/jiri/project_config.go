@@ -6,6 +6,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/btwiuse/jiri"
@@ -20,18 +21,34 @@ var cmdProjectConfig = &cmdline.Command{
 	Long: `
 Prints/Manages local project config. This command should be run from inside a
 project. It will print config if no flags are provided otherwise set it.`,
+	Children: []*cmdline.Command{cmdProjectConfigVerify},
+}
+
+var cmdProjectConfigVerify = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runProjectConfigVerify),
+	Name:   "verify",
+	Short:  "Reports projects whose git config differs from the manifest",
+	Long: `
+Reports the projects whose git config variables, declared by the gitconfig
+elements of the manifest, or git hooks installed by jiri, such as the gerrit
+commit-msg hook, differ from what "jiri update" sets, and fails if there are
+any. All the projects are checked if none is given.`,
+	ArgsName: "[<project>...]",
+	ArgsLong: "<project> is the name of a project to check.",
 }
 
 var (
-	configIgnoreFlag   string
-	configNoUpdateFlag string
-	configNoRebaseFlag string
+	configIgnoreFlag     string
+	configNoUpdateFlag   string
+	configNoRebaseFlag   string
+	configOnConflictFlag string
 )
 
 func init() {
 	cmdProjectConfig.Flags.StringVar(&configIgnoreFlag, "ignore", "", `This can be true or false. If set to true project would be completely ignored while updating`)
 	cmdProjectConfig.Flags.StringVar(&configNoUpdateFlag, "no-update", "", `This can be true or false. If set to true project won't be updated`)
 	cmdProjectConfig.Flags.StringVar(&configNoRebaseFlag, "no-rebase", "", `This can be true or false. If set to true local branch won't be rebased or merged.`)
+	cmdProjectConfig.Flags.StringVar(&configOnConflictFlag, "on-conflict", "", `What "jiri update" does when local work is in the way: fail, skip, stash, backup, rebase or prompt. See "jiri help update".`)
 }
 
 func runProjectConfig(jirix *jiri.X, args []string) error {
@@ -39,7 +56,7 @@ func runProjectConfig(jirix *jiri.X, args []string) error {
 	if err != nil {
 		return err
 	}
-	if configIgnoreFlag == "" && configNoUpdateFlag == "" && configNoRebaseFlag == "" {
+	if configIgnoreFlag == "" && configNoUpdateFlag == "" && configNoRebaseFlag == "" && configOnConflictFlag == "" {
 		displayConfig(p.LocalConfig)
 		return nil
 	}
@@ -53,6 +70,12 @@ func runProjectConfig(jirix *jiri.X, args []string) error {
 	if err := setBoolVar(configNoRebaseFlag, &lc.NoRebase, "no-rebase"); err != nil {
 		return err
 	}
+	if configOnConflictFlag != "" {
+		if err := project.ValidateConflictPolicy(configOnConflictFlag); err != nil {
+			return err
+		}
+		lc.OnConflict = configOnConflictFlag
+	}
 	return project.WriteLocalConfig(jirix, p, lc)
 }
 
@@ -73,4 +96,63 @@ func displayConfig(lc project.LocalConfig) {
 	fmt.Printf("ignore: %t\n", lc.Ignore)
 	fmt.Printf("no-update: %t\n", lc.NoUpdate)
 	fmt.Printf("no-rebase: %t\n", lc.NoRebase)
+	onConflict := lc.OnConflict
+	if onConflict == "" {
+		onConflict = project.ConflictFail
+	}
+	fmt.Printf("on-conflict: %s\n", onConflict)
+}
+
+func runProjectConfigVerify(jirix *jiri.X, args []string) error {
+	localProjects, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	remoteProjects, _, _, err := project.LoadManifestFile(jirix, jirix.JiriManifestFile(), localProjects, false /*localManifest*/)
+	if err != nil {
+		return err
+	}
+	project.MatchLocalWithRemote(localProjects, remoteProjects)
+	names := make(map[string]bool)
+	for _, name := range args {
+		names[name] = true
+	}
+	found := make(map[string]bool)
+	var keys project.ProjectKeys
+	for key, p := range localProjects {
+		if len(names) != 0 && !names[p.Name] {
+			continue
+		}
+		found[p.Name] = true
+		if _, ok := remoteProjects[key]; ok && !p.LocalConfig.Ignore && !p.LocalConfig.NoUpdate {
+			keys = append(keys, key)
+		}
+	}
+	for _, name := range args {
+		if !found[name] {
+			return fmt.Errorf("project %q not found", name)
+		}
+	}
+	sort.Sort(keys)
+	drifted := 0
+	for _, key := range keys {
+		remote := remoteProjects[key]
+		remote.Path = localProjects[key].Path
+		drifts, err := project.GitConfigDrift(jirix, remote)
+		if err != nil {
+			return err
+		}
+		if len(drifts) == 0 {
+			continue
+		}
+		drifted++
+		fmt.Fprintf(jirix.Stdout(), "%s (%s):\n", jirix.Color.Yellow(remote.Name), remote.Path)
+		for _, d := range drifts {
+			fmt.Fprintf(jirix.Stdout(), "  %s\n", d)
+		}
+	}
+	if drifted != 0 {
+		return fmt.Errorf("git config or hooks of %d project(s) differ from the manifest, run \"jiri update\" to fix them", drifted)
+	}
+	return nil
 }
@@ -5,18 +5,23 @@
 package main
 
 import (
+	"bytes"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/btwiuse/jiri/gitutil"
 	"github.com/btwiuse/jiri/jiritest"
 	"github.com/btwiuse/jiri/project"
+	"github.com/btwiuse/jiri/tool"
 )
 
 func setDefaultConfigFlags() {
 	configIgnoreFlag = ""
 	configNoUpdateFlag = ""
 	configNoRebaseFlag = ""
+	configOnConflictFlag = ""
 }
 
 func testConfig(t *testing.T, fake *jiritest.FakeJiriRoot, localProjects []project.Project) {
@@ -62,6 +67,14 @@ func testConfig(t *testing.T, fake *jiritest.FakeJiriRoot, localProjects []proje
 	if newConfig.NoRebase != expectedOutput {
 		t.Errorf("local config no-rebase: got %t, want %t", newConfig.NoRebase, expectedOutput)
 	}
+
+	expectedPolicy := oldConfig.OnConflict
+	if configOnConflictFlag != "" {
+		expectedPolicy = configOnConflictFlag
+	}
+	if newConfig.OnConflict != expectedPolicy {
+		t.Errorf("local config on-conflict: got %q, want %q", newConfig.OnConflict, expectedPolicy)
+	}
 }
 
 func TestConfig(t *testing.T) {
@@ -110,4 +123,69 @@ func TestConfig(t *testing.T) {
 	configNoUpdateFlag = "false"
 	configIgnoreFlag = "false"
 	testConfig(t, fake, localProjects)
+
+	setDefaultConfigFlags()
+	configOnConflictFlag = project.ConflictStash
+	testConfig(t, fake, localProjects)
+
+	setDefaultConfigFlags()
+	configOnConflictFlag = "unknown"
+	if err := runProjectConfig(fake.X, []string{}); err == nil {
+		t.Errorf("expected an error for an unknown on-conflict policy")
+	}
+}
+
+// TestConfigVerify checks that "jiri update" sets the git config variables of
+// the manifest, and that "jiri project-config verify" reports them once they
+// are changed.
+func TestConfigVerify(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range m.Projects {
+		if p.Name == localProjects[1].Name {
+			m.Projects[i].GitConfigs = []project.GitConfig{{Name: "push.default", Value: "upstream"}}
+		}
+	}
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	scm := gitutil.New(fake.X, gitutil.RootDirOpt(localProjects[1].Path))
+	if got, err := scm.ConfigGetKey("push.default"); err != nil || got != "upstream" {
+		t.Fatalf("got push.default %q, %v, want upstream", got, err)
+	}
+	if err := runProjectConfigVerify(fake.X, nil); err != nil {
+		t.Errorf("expected no drift, got %v", err)
+	}
+
+	if err := scm.Config("push.default", "simple"); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	fake.X.Context = tool.NewContext(tool.ContextOpts{Stdout: &stdout, Env: fake.X.Context.Env()})
+	if err := runProjectConfigVerify(fake.X, []string{localProjects[1].Name}); err == nil {
+		t.Errorf("expected verify to fail")
+	}
+	if want := `gitconfig push.default: set to "simple" instead of "upstream"`; !strings.Contains(stdout.String(), want) {
+		t.Errorf("expected %q in the output, got %q", want, stdout.String())
+	}
+	if err := runProjectConfigVerify(fake.X, []string{localProjects[0].Name}); err != nil {
+		t.Errorf("expected no drift for project %q, got %v", localProjects[0].Name, err)
+	}
+	if err := runProjectConfigVerify(fake.X, []string{"unknown"}); err == nil {
+		t.Errorf("expected an error for an unknown project")
+	}
+
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := runProjectConfigVerify(fake.X, nil); err != nil {
+		t.Errorf("expected jiri update to fix the drift, got %v", err)
+	}
 }
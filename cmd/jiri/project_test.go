@@ -0,0 +1,97 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
+)
+
+// TestProjectEdit checks that "jiri project -add" and "jiri project -remove"
+// edit the projects and overrides of .jiri_manifest in place.
+func TestProjectEdit(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+	defer func() {
+		projectEditFlags.add, projectEditFlags.remove, projectEditFlags.override = false, false, false
+		projectEditFlags.path = ""
+	}()
+	if err := ioutil.WriteFile(fake.X.JiriManifestFile(), []byte(`<manifest>
+  <!-- Kept by edits. -->
+  <imports>
+    <import manifest="manifest" name="manifest" remote="https://example.com/manifest.git"/>
+  </imports>
+</manifest>
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(add, remove, override bool, path string, args ...string) error {
+		projectEditFlags.add, projectEditFlags.remove, projectEditFlags.override = add, remove, override
+		projectEditFlags.path = path
+		return runProject(fake.X, args)
+	}
+	check := func(wantProjects, wantOverrides []string) {
+		t.Helper()
+		data, err := ioutil.ReadFile(fake.X.JiriManifestFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "<!-- Kept by edits. -->") {
+			t.Errorf("expected the comment of %s to be kept:\n%s", fake.X.JiriManifestFile(), data)
+		}
+		m, err := project.ManifestFromBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var projects, overrides []string
+		for _, p := range m.Projects {
+			projects = append(projects, p.Name+" "+p.Path+" "+p.Remote)
+		}
+		for _, p := range m.ProjectOverrides {
+			overrides = append(overrides, p.Name+" "+p.Remote)
+		}
+		if strings.Join(projects, ",") != strings.Join(wantProjects, ",") || strings.Join(overrides, ",") != strings.Join(wantOverrides, ",") {
+			t.Errorf("got projects %q and overrides %q, want %q and %q", projects, overrides, wantProjects, wantOverrides)
+		}
+	}
+
+	if err := run(true, false, false, "foo", "foo", "https://example.com/foo.git"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(true, false, true, "", "bar", "https://example.com/bar-fork.git"); err != nil {
+		t.Fatal(err)
+	}
+	check([]string{"foo foo https://example.com/foo.git"}, []string{"bar https://example.com/bar-fork.git"})
+
+	if err := run(false, true, false, "", "foo", "https://example.com/other.git"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected removing foo with another remote to fail, got %v", err)
+	}
+	if err := run(false, true, false, "", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	check(nil, []string{"bar https://example.com/bar-fork.git"})
+	if err := run(false, true, true, "", "bar", "https://example.com/bar-fork.git"); err != nil {
+		t.Fatal(err)
+	}
+	check(nil, nil)
+
+	for _, test := range []struct {
+		add, remove bool
+		args        []string
+		want        string
+	}{
+		{true, true, []string{"foo"}, "cannot use -add and -remove together"},
+		{true, false, []string{"foo"}, "wrong number of arguments for the add flag"},
+		{false, true, []string{"foo", "remote", "extra"}, "wrong number of arguments for the remove flag"},
+	} {
+		if err := run(test.add, test.remove, false, "", test.args...); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("add=%t remove=%t %q: got error %v, want %q", test.add, test.remove, test.args, err, test.want)
+		}
+	}
+}
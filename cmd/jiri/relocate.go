@@ -0,0 +1,83 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var relocateFlags struct {
+	from string
+}
+
+func init() {
+	cmdRelocate.Flags.StringVar(&relocateFlags.from, "from", "", "Path the jiri root was at before it was moved by hand to <newroot>, which must then be the current jiri root.")
+}
+
+var cmdRelocate = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runRelocate),
+	Name:   "relocate",
+	Short:  "Move the jiri root to a new directory",
+	Long: `
+Moves the jiri root to <newroot>, which must not exist, and rewrites the
+absolute references to its old location. jiri only stores paths relative to
+the jiri root, but older versions of jiri left absolute paths in project
+metadata, snapshots and .jiri_manifest, and git alternates and gitdir files
+can point inside the root.
+
+If the jiri root was already moved by hand, run "jiri relocate -from <oldroot>
+<newroot>" from <newroot>. "jiri relocate ." makes the legacy absolute paths
+of the current root relative.
+`,
+	ArgsName: "<newroot>",
+	ArgsLong: "<newroot> is the new location of the jiri root.",
+}
+
+func runRelocate(jirix *jiri.X, args []string) error {
+	if len(args) != 1 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	newRoot, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	if err := jirix.CheckWrite(jirix.Root, "relocate"); err != nil {
+		return err
+	}
+	oldRoot := jirix.Root
+	if relocateFlags.from != "" {
+		if newRoot != jirix.Root {
+			return jirix.UsageErrorf("with -from, <newroot> should be the current jiri root %s", jirix.Root)
+		}
+		if oldRoot, err = filepath.Abs(relocateFlags.from); err != nil {
+			return err
+		}
+	} else if newRoot != jirix.Root {
+		if _, err := os.Stat(newRoot); err == nil {
+			return fmt.Errorf("%s already exists", newRoot)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Rename(jirix.Root, newRoot); err != nil {
+			return fmt.Errorf("cannot move the jiri root: %v", err)
+		}
+		jirix.Logger.Infof("Moved jiri root %s to %s\n", jirix.Root, newRoot)
+		jirix.Root = newRoot
+	}
+	rewritten, err := project.Relocate(jirix, oldRoot)
+	for _, file := range rewritten {
+		if rel, err := filepath.Rel(jirix.Root, file); err == nil {
+			file = rel
+		}
+		fmt.Fprintf(jirix.Stdout(), "Rewrote %s\n", file)
+	}
+	return err
+}
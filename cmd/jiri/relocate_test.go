@@ -0,0 +1,52 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/btwiuse/jiri/project"
+)
+
+// TestRelocate checks that jiri relocate moves the jiri root, and that the
+// projects are found at their new location.
+func TestRelocate(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	oldRoot := fake.X.Root
+	newRoot := oldRoot + "-moved"
+	defer os.RemoveAll(newRoot)
+
+	if err := runRelocate(fake.X, []string{newRoot}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.X.Root != newRoot {
+		t.Errorf("got root %q, want %q", fake.X.Root, newRoot)
+	}
+	if _, err := os.Stat(oldRoot); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be moved away: %v", oldRoot, err)
+	}
+	projects, err := project.LocalProjects(fake.X, project.FullScan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range localProjects {
+		rel, err := filepath.Rel(oldRoot, p.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := projects[p.Key()].Path, filepath.Join(newRoot, rel); got != want {
+			t.Errorf("got path %q for project %q, want %q", got, p.Name, want)
+		}
+	}
+	if err := runRelocate(fake.X, []string{newRoot}); err != nil {
+		t.Errorf("relocating to the current root: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// repoManifest is a manifest of the Android repo tool, as documented in
+// https://gerrit.googlesource.com/git-repo/+/master/docs/manifest-format.md.
+// Only the elements jiri can import or export are declared, the others are
+// collected in Unsupported.
+type repoManifest struct {
+	XMLName        xml.Name            `xml:"manifest"`
+	Remotes        []repoRemote        `xml:"remote"`
+	Default        *repoDefault        `xml:"default"`
+	Projects       []repoProject       `xml:"project"`
+	ExtendProjects []repoProject       `xml:"extend-project"`
+	RemoveProjects []repoRemoveProject `xml:"remove-project"`
+	Includes       []repoInclude       `xml:"include"`
+	Unsupported    []repoElement       `xml:",any"`
+}
+
+type repoRemote struct {
+	Name     string `xml:"name,attr"`
+	Fetch    string `xml:"fetch,attr"`
+	Review   string `xml:"review,attr,omitempty"`
+	Revision string `xml:"revision,attr,omitempty"`
+}
+
+type repoDefault struct {
+	Remote   string `xml:"remote,attr,omitempty"`
+	Revision string `xml:"revision,attr,omitempty"`
+}
+
+type repoProject struct {
+	Name        string         `xml:"name,attr"`
+	Path        string         `xml:"path,attr,omitempty"`
+	Remote      string         `xml:"remote,attr,omitempty"`
+	Revision    string         `xml:"revision,attr,omitempty"`
+	Upstream    string         `xml:"upstream,attr,omitempty"`
+	Groups      string         `xml:"groups,attr,omitempty"`
+	Copyfiles   []repoFileLink `xml:"copyfile"`
+	Linkfiles   []repoFileLink `xml:"linkfile"`
+	Unsupported []repoElement  `xml:",any"`
+}
+
+// repoFileLink is a copyfile or linkfile element, which copies or links the
+// file src of a project to dest, relative to the root of the checkout.
+type repoFileLink struct {
+	Src  string `xml:"src,attr"`
+	Dest string `xml:"dest,attr"`
+}
+
+type repoRemoveProject struct {
+	Name string `xml:"name,attr"`
+}
+
+type repoInclude struct {
+	Name string `xml:"name,attr"`
+}
+
+type repoElement struct {
+	XMLName xml.Name
+}
+
+// readRepoManifest reads the repo manifest in file and, recursively, the
+// manifests it includes, which repo looks up next to it. The elements of the
+// included manifests are merged in m in order, before the removals and
+// extensions of projects are applied.
+func readRepoManifest(file string) (*repoManifest, error) {
+	return readRepoManifestIncluded(file, nil)
+}
+
+// readRepoManifestIncluded reads the repo manifest in file, which is included
+// by the manifests in parents, and returns an error if it includes one of
+// them.
+func readRepoManifestIncluded(file string, parents []string) (*repoManifest, error) {
+	file = filepath.Clean(file)
+	for i, parent := range parents {
+		if parent == file {
+			cycle := append(append([]string(nil), parents[i:]...), file)
+			return nil, fmt.Errorf("repo manifest include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	parents = append(parents[:len(parents):len(parents)], file)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := &repoManifest{}
+	if err := xml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid repo manifest %s: %v", file, err)
+	}
+	for _, include := range m.Includes {
+		im, err := readRepoManifestIncluded(filepath.Join(filepath.Dir(file), include.Name), parents)
+		if err != nil {
+			return nil, err
+		}
+		m.Remotes = append(m.Remotes, im.Remotes...)
+		if m.Default == nil {
+			m.Default = im.Default
+		}
+		m.Projects = append(m.Projects, im.Projects...)
+		m.ExtendProjects = append(m.ExtendProjects, im.ExtendProjects...)
+		m.RemoveProjects = append(m.RemoveProjects, im.RemoveProjects...)
+		m.Unsupported = append(m.Unsupported, im.Unsupported...)
+	}
+	m.Includes = nil
+	return m, nil
+}
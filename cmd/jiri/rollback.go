@@ -0,0 +1,77 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var rollbackFlags struct {
+	to        string
+	list      bool
+	gc        bool
+	runHooks  bool
+	fetchPkgs bool
+}
+
+func init() {
+	cmdRollback.Flags.StringVar(&rollbackFlags.to, "to", "", "ID of the snapshot to roll back to, as listed by -list. Defaults to the snapshot taken before the last update.")
+	cmdRollback.Flags.BoolVar(&rollbackFlags.list, "list", false, "List the snapshots of the update history instead of rolling back.")
+	cmdRollback.Flags.BoolVar(&rollbackFlags.gc, "gc", false, "Delete the projects which are not in the snapshot.")
+	cmdRollback.Flags.BoolVar(&rollbackFlags.runHooks, "run-hooks", false, "Run the hooks of the snapshot, if it has any.")
+	cmdRollback.Flags.BoolVar(&rollbackFlags.fetchPkgs, "fetch-packages", false, "Fetch the packages of the snapshot, if it has any.")
+}
+
+var cmdRollback = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runRollback),
+	Name:   "rollback",
+	Short:  "Restore the projects to their state before the last update",
+	Long: `
+Checks out the projects at the revisions they had before the last "jiri
+update", e.g. to undo a bad manifest roll.
+
+"jiri update" records the revisions of the projects in
+.jiri_root/update_history before and after updating. -list lists these
+snapshots, and -to rolls back to a given one. Snapshots taken before updates
+only list projects, so rolling back to them does not change packages.
+`,
+}
+
+func runRollback(jirix *jiri.X, args []string) error {
+	if len(args) != 0 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	if rollbackFlags.list {
+		snapshots, err := project.UpdateHistory(jirix)
+		if err != nil {
+			return err
+		}
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			s := snapshots[i]
+			kind := "after update"
+			if s.PreUpdate {
+				kind = "before update"
+			}
+			fmt.Printf("%s\t%s\n", s.ID, kind)
+		}
+		return nil
+	}
+	s, err := project.RollbackTarget(jirix, rollbackFlags.to)
+	if err != nil {
+		return err
+	}
+	jirix.Logger.Infof("Rolling back to %s\n", s.ID)
+	if err := project.Rollback(jirix, s, rollbackFlags.gc, rollbackFlags.runHooks, rollbackFlags.fetchPkgs, project.DefaultHookTimeout, project.DefaultPackageTimeout); err != nil {
+		return err
+	}
+	if jirix.Failures() != 0 {
+		return fmt.Errorf("Rollback completed with non-fatal errors")
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
 	"regexp"
 	"sort"
 	"strings"
@@ -40,6 +41,8 @@ var runpFlags struct {
 	collateOutput  bool
 	branch         string
 	remote         string
+	names          string
+	attributes     string
 }
 
 var cmdRunP = &cmdline.Command{
@@ -49,6 +52,15 @@ var cmdRunP = &cmdline.Command{
 	Long: `Run a command in parallel across one or more jiri projects. Commands are run
 using the shell specified by the users $SHELL environment variable, or "sh"
 if that's not set. Thus commands are run as $SHELL -c "args..."
+
+The environment of each command has JIRI_PROJECT_NAME, JIRI_PROJECT_PATH and
+JIRI_PROJECT_KEY set to the name, absolute path and key of the project it is
+run in.
+
+If the command fails in any project, runp reports the projects it failed in
+and, once all commands have completed, exits with a non-zero status, even
+without -exit-on-error. Scripts which should carry on regardless must ignore
+the status, e.g. with "|| true".
  `,
 	ArgsName: "<command line>",
 	ArgsLong: `A command line to be run in each project specified by the supplied command
@@ -73,6 +85,8 @@ func init() {
 	cmdRunP.Flags.BoolVar(&runpFlags.exitOnError, "exit-on-error", false, "If set, all commands will killed as soon as one reports an error, otherwise, each will run to completion.")
 	cmdRunP.Flags.StringVar(&runpFlags.branch, "branch", "", "A regular expression specifying branch names to use in matching projects. A project will match if the specified branch exists, even if it is not checked out.")
 	cmdRunP.Flags.StringVar(&runpFlags.remote, "remote", "", "A Regular expression specifying projects to run commands in by matching against their remote URLs.")
+	cmdRunP.Flags.StringVar(&runpFlags.names, "names", "", "A comma-separated list of glob patterns, as used by path.Match, specifying the names of projects to run commands in.")
+	cmdRunP.Flags.StringVar(&runpFlags.attributes, "attributes", "", "A comma-separated list of manifest attributes. If set, only projects with at least one of these attributes are matched.")
 }
 
 type mapInput struct {
@@ -115,6 +129,8 @@ type runner struct {
 	args                 []string
 	serializedWriterLock sync.Mutex
 	collatedOutputLock   sync.Mutex
+	failedLock           sync.Mutex
+	failed               []string
 }
 
 func (r *runner) serializedWriter(w io.Writer) io.Writer {
@@ -165,7 +181,11 @@ func (r *runner) Map(mr *simplemr.MR, key string, val interface{}) error {
 	}
 	var wg sync.WaitGroup
 	cmd := exec.Command(path, "-c", strings.Join(r.args, " "))
-	cmd.Env = envvar.MapToSlice(jirix.Env())
+	env := envvar.CopyMap(jirix.Env())
+	env["JIRI_PROJECT_NAME"] = mi.Project.Name
+	env["JIRI_PROJECT_PATH"] = mi.Project.Path
+	env["JIRI_PROJECT_KEY"] = string(mi.key)
+	cmd.Env = envvar.MapToSlice(env)
 	cmd.Dir = mi.Project.Path
 	cmd.Stdin = mi.jirix.Stdin()
 	var stdoutCloser, stderrCloser io.Closer
@@ -263,6 +283,9 @@ func (r *runner) Reduce(mr *simplemr.MR, key string, values []interface{}) error
 		mo := v.(*mapOutput)
 		if mo.err != nil {
 			fmt.Fprintf(os.Stdout, "FAILED: %v: %s %v\n", mo.key, strings.Join(r.args, " "), mo.err)
+			r.failedLock.Lock()
+			r.failed = append(r.failed, mo.mi.Project.Name)
+			r.failedLock.Unlock()
 			return nil
 		} else {
 			if runpFlags.collateOutput {
@@ -315,6 +338,24 @@ func runRunp(jirix *jiri.X, args []string) error {
 		}
 	}
 
+	var namePatterns []string
+	if runpFlags.names != "" {
+		for _, pattern := range strings.Split(runpFlags.names, ",") {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid project name pattern: %q: %v", pattern, err)
+			}
+			namePatterns = append(namePatterns, pattern)
+		}
+	}
+	var attrs []string
+	if runpFlags.attributes != "" {
+		for _, attr := range strings.Split(runpFlags.attributes, ",") {
+			if attr = strings.TrimSpace(attr); attr != "" {
+				attrs = append(attrs, attr)
+			}
+		}
+	}
+
 	if (runpFlags.showKeyPrefix || runpFlags.showNamePrefix || runpFlags.showPathPrefix) && runpFlags.interactive {
 		fmt.Fprintf(jirix.Stderr(), "WARNING: interactive mode being disabled because show-key-prefix or show-name-prefix or show-path-prefix was set\n")
 		runpFlags.interactive = false
@@ -371,6 +412,12 @@ func runRunp(jirix *jiri.X, args []string) error {
 		if remoteRE != nil && !remoteRE.MatchString(localProject.Remote) {
 			continue
 		}
+		if len(namePatterns) != 0 && !matchesAnyName(localProject.Name, namePatterns) {
+			continue
+		}
+		if len(attrs) != 0 && !hasAnyAttribute(localProject.Attributes, attrs) {
+			continue
+		}
 		if (runpFlags.untracked && !state.HasUntracked) || (runpFlags.noUntracked && state.HasUntracked) {
 			continue
 		}
@@ -421,5 +468,33 @@ func runRunp(jirix *jiri.X, args []string) error {
 	close(in)
 	<-out
 	jirix.TimerPop()
-	return mr.Error()
+	if err := mr.Error(); err != nil {
+		return err
+	}
+	if len(runner.failed) != 0 {
+		sort.Strings(runner.failed)
+		return fmt.Errorf("command failed in %d of %d projects: %s", len(runner.failed), total, strings.Join(runner.failed, ", "))
+	}
+	return nil
+}
+
+func matchesAnyName(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyAttribute(projectAttrs string, attrs []string) bool {
+	for _, pa := range strings.Split(projectAttrs, ",") {
+		pa = strings.TrimSpace(pa)
+		for _, attr := range attrs {
+			if pa == attr {
+				return true
+			}
+		}
+	}
+	return false
 }
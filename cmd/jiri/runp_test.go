@@ -31,6 +31,8 @@ func setDefaultRunpFlags() {
 	runpFlags.collateOutput = true
 	runpFlags.branch = ""
 	runpFlags.remote = ""
+	runpFlags.names = ""
+	runpFlags.attributes = ""
 }
 
 func addProjects(t *testing.T, fake *jiritest.FakeJiriRoot) []*project.Project {
@@ -272,3 +274,28 @@ func TestRunP(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestRunPEnvAndNames(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+	addProjects(t, fake)
+	setDefaultRunpFlags()
+
+	runpFlags.names = "sub/*"
+	got := executeRunp(t, fake, `echo "$JIRI_PROJECT_NAME"`)
+	if want := "sub/r.t1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	runpFlags.names = "r.a,r.b"
+	got = executeRunp(t, fake, `basename "$JIRI_PROJECT_PATH"`)
+	if want := "r.a\nr.b"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	runpFlags.names = "r.*"
+	got = executeRunp(t, fake, `test "$JIRI_PROJECT_NAME" != r.b`)
+	if want := "command failed in 1 of 3 projects: r.b"; !strings.HasSuffix(got, want) {
+		t.Errorf("got %q, want suffix %q", got, want)
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var serveFlags struct {
+	socket string
+	port   int
+}
+
+func init() {
+	cmdServe.Flags.StringVar(&serveFlags.socket, "socket", "", "Unix socket to listen on. Defaults to .jiri_root/jiri.sock.")
+	cmdServe.Flags.IntVar(&serveFlags.port, "port", 0, "Port to listen on, on localhost only, instead of a unix socket.")
+}
+
+var cmdServe = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runServe),
+	Name:   "serve",
+	Short:  "Serve the state of the jiri root over a local JSON API",
+	Long: `
+Serves a JSON API describing the jiri root, for IDE plugins and dashboards,
+until interrupted. The API is served on a unix socket, .jiri_root/jiri.sock by
+default, or with -port on a port of localhost. It is never served on other
+interfaces. On a port, requests whose Host is not localhost, or which carry
+the Origin of another site, are rejected so that web pages cannot use the API.
+
+  GET  /v1/projects        the local projects with their current branch,
+                           revision and whether they have uncommitted or
+                           untracked changes
+  GET  /v1/projects/<name> the local projects named <name>
+  GET  /v1/manifest        the projects and packages of the manifest
+  POST /v1/update          starts "jiri update -autoupdate=false", returns
+                           409 if an update is running
+  GET  /v1/update          the state and output of the last update started
+                           through the API
+
+For example:
+  curl --unix-socket .jiri_root/jiri.sock http://jiri/v1/projects
+`,
+}
+
+func runServe(jirix *jiri.X, args []string) error {
+	if len(args) != 0 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	var l net.Listener
+	var err error
+	s := newServer(jirix)
+	if serveFlags.port != 0 {
+		s.localOnly = true
+		l, err = net.Listen("tcp", fmt.Sprintf("localhost:%d", serveFlags.port))
+	} else {
+		socket := serveFlags.socket
+		if socket == "" {
+			socket = filepath.Join(jirix.RootMetaDir(), "jiri.sock")
+		}
+		// Remove the socket left behind by a server which was killed.
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		l, err = net.Listen("unix", socket)
+	}
+	if err != nil {
+		return err
+	}
+	// Close the server on interrupt, which also removes the unix socket.
+	srv := &http.Server{Handler: s}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		srv.Close()
+	}()
+	jirix.Logger.Infof("Serving on %s\n", l.Addr())
+	err = srv.Serve(l)
+	signal.Stop(sigs)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// server implements the API of "jiri serve".
+type server struct {
+	// mu serializes the queries, as jirix is not thread safe.
+	mu    sync.Mutex
+	jirix *jiri.X
+	mux   *http.ServeMux
+	// localOnly rejects the requests which may come from web pages, for
+	// the API served on a port.
+	localOnly bool
+
+	// updateCmd returns the command run by POST /v1/update.
+	updateCmd func() (*exec.Cmd, error)
+	// updateMu guards update.
+	updateMu sync.Mutex
+	update   serveUpdate
+}
+
+// serveProject is the JSON representation of a local project.
+type serveProject struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Remote    string `json:"remote"`
+	Branch    string `json:"branch,omitempty"`
+	Revision  string `json:"revision"`
+	Dirty     bool   `json:"dirty"`
+	Untracked bool   `json:"untracked"`
+}
+
+// serveManifest is the JSON representation of the manifest.
+type serveManifest struct {
+	Projects []serveManifestProject `json:"projects"`
+	Packages []serveManifestPackage `json:"packages"`
+}
+
+type serveManifestProject struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Remote       string `json:"remote"`
+	RemoteBranch string `json:"remotebranch,omitempty"`
+	Revision     string `json:"revision,omitempty"`
+	Attributes   string `json:"attributes,omitempty"`
+}
+
+type serveManifestPackage struct {
+	Name       string `json:"name"`
+	Path       string `json:"path,omitempty"`
+	Version    string `json:"version"`
+	Attributes string `json:"attributes,omitempty"`
+}
+
+// serveUpdate is the state of the last update started through the API.
+type serveUpdate struct {
+	Running  bool      `json:"running"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Error    string    `json:"error,omitempty"`
+	Output   string    `json:"output,omitempty"`
+}
+
+func newServer(jirix *jiri.X) *server {
+	s := &server{
+		jirix: jirix,
+		mux:   http.NewServeMux(),
+		updateCmd: func() (*exec.Cmd, error) {
+			// os.Args[0] may be relative to another directory.
+			path, err := os.Executable()
+			if err != nil {
+				return nil, err
+			}
+			cmd := exec.Command(path, "update", "-autoupdate=false")
+			cmd.Dir = jirix.Root
+			return cmd, nil
+		},
+	}
+	s.mux.HandleFunc("/v1/projects", s.handleProjects)
+	s.mux.HandleFunc("/v1/projects/", s.handleProjects)
+	s.mux.HandleFunc("/v1/manifest", s.handleManifest)
+	s.mux.HandleFunc("/v1/update", s.handleUpdate)
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.localOnly {
+		if err := checkLocalRequest(r); err != nil {
+			writeJSON(w, http.StatusForbidden, err)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// isLocalHost returns true if host, with an optional port, is the local host.
+func isLocalHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkLocalRequest returns an error if r may have been sent by a web page:
+// if its Host is not the local host, as after a DNS rebinding, or if it has
+// the Origin of another site, as a cross-site request.
+func checkLocalRequest(r *http.Request) error {
+	if !isLocalHost(r.Host) {
+		return fmt.Errorf("host %q not allowed", r.Host)
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			return fmt.Errorf("origin %q not allowed", origin)
+		}
+	}
+	return nil
+}
+
+// writeJSON writes v as the JSON response, or err as a JSON error.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	if err, ok := v.(error); ok {
+		v = struct {
+			Error string `json:"error"`
+		}{err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	e.Encode(v)
+}
+
+func (s *server) handleProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/v1/projects"), "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	localProjects, err := project.LocalProjects(s.jirix, project.FastScan)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	if name != "" {
+		for key, p := range localProjects {
+			if p.Name != name {
+				delete(localProjects, key)
+			}
+		}
+		if len(localProjects) == 0 {
+			writeJSON(w, http.StatusNotFound, fmt.Errorf("no project named %q", name))
+			return
+		}
+	}
+	states, err := project.GetProjectStates(s.jirix, localProjects, true)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	projects := []serveProject{}
+	for _, state := range states {
+		projects = append(projects, serveProject{
+			Name:      state.Project.Name,
+			Path:      state.Project.Path,
+			Remote:    state.Project.Remote,
+			Branch:    state.CurrentBranch.Name,
+			Revision:  state.CurrentBranch.Revision,
+			Dirty:     state.HasUncommitted,
+			Untracked: state.HasUntracked,
+		})
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Path < projects[j].Path
+	})
+	writeJSON(w, http.StatusOK, projects)
+}
+
+func (s *server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	localProjects, err := project.LocalProjects(s.jirix, project.FastScan)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	projects, _, pkgs, err := project.LoadManifestFile(s.jirix, s.jirix.JiriManifestFile(), localProjects, false /*localManifest*/)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	m := serveManifest{
+		Projects: []serveManifestProject{},
+		Packages: []serveManifestPackage{},
+	}
+	for _, p := range projects {
+		m.Projects = append(m.Projects, serveManifestProject{
+			Name:         p.Name,
+			Path:         p.Path,
+			Remote:       p.Remote,
+			RemoteBranch: p.RemoteBranch,
+			Revision:     p.Revision,
+			Attributes:   p.Attributes,
+		})
+	}
+	for _, p := range pkgs {
+		m.Packages = append(m.Packages, serveManifestPackage{
+			Name:       p.Name,
+			Path:       p.Path,
+			Version:    p.Version,
+			Attributes: p.Attributes,
+		})
+	}
+	sort.Slice(m.Projects, func(i, j int) bool {
+		return m.Projects[i].Path < m.Projects[j].Path
+	})
+	sort.Slice(m.Packages, func(i, j int) bool {
+		return m.Packages[i].Name < m.Packages[j].Name
+	})
+	writeJSON(w, http.StatusOK, m)
+}
+
+func (s *server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.update)
+	case http.MethodPost:
+		if s.update.Running {
+			writeJSON(w, http.StatusConflict, fmt.Errorf("an update started at %s is running", s.update.Started.Format(time.RFC3339)))
+			return
+		}
+		cmd, err := s.updateCmd()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.update = serveUpdate{Running: true, Started: time.Now()}
+		go s.runUpdate(cmd)
+		writeJSON(w, http.StatusAccepted, s.update)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed", r.Method))
+	}
+}
+
+func (s *server) runUpdate(cmd *exec.Cmd) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	s.update.Running = false
+	s.update.Finished = time.Now()
+	s.update.Output = out.String()
+	if err != nil {
+		s.update.Error = err.Error()
+	}
+}
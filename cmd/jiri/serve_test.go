@@ -0,0 +1,138 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveRequest(t *testing.T, s *server, method, path string, v interface{}) int {
+	return serveRequestFrom(t, s, method, path, "", "", v)
+}
+
+// serveRequestFrom is serveRequest with the given Host and Origin headers,
+// unless they are empty.
+func serveRequestFrom(t *testing.T, s *server, method, path, host, origin string, v interface{}) int {
+	r := httptest.NewRequest(method, path, nil)
+	if host != "" {
+		r.Host = host
+	}
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: cannot parse %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestServe(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(localProjects[1].Path, "README"), []byte("uncommitted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newServer(fake.X)
+	var projects []serveProject
+	if code := serveRequest(t, s, "GET", "/v1/projects", &projects); code != http.StatusOK {
+		t.Fatalf("GET /v1/projects: got status %d", code)
+	}
+	// The manifest project is a local project too.
+	if got, want := len(projects), len(localProjects)+1; got != want {
+		t.Errorf("got %d projects, want %d", got, want)
+	}
+	for _, p := range projects {
+		if want := p.Name == localProjects[1].Name; p.Dirty != want {
+			t.Errorf("project %q: got dirty %v, want %v", p.Name, p.Dirty, want)
+		}
+	}
+
+	projects = nil
+	if code := serveRequest(t, s, "GET", "/v1/projects/"+localProjects[2].Name, &projects); code != http.StatusOK {
+		t.Fatalf("GET /v1/projects/%s: got status %d", localProjects[2].Name, code)
+	}
+	if len(projects) != 1 || projects[0].Path != localProjects[2].Path {
+		t.Errorf("got projects %+v, want project %q", projects, localProjects[2].Name)
+	}
+	if code := serveRequest(t, s, "GET", "/v1/projects/missing", nil); code != http.StatusNotFound {
+		t.Errorf("GET /v1/projects/missing: got status %d, want %d", code, http.StatusNotFound)
+	}
+	if code := serveRequest(t, s, "DELETE", "/v1/projects", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /v1/projects: got status %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+
+	var m serveManifest
+	if code := serveRequest(t, s, "GET", "/v1/manifest", &m); code != http.StatusOK {
+		t.Fatalf("GET /v1/manifest: got status %d", code)
+	}
+	if got, want := len(m.Projects), len(localProjects)+1; got != want {
+		t.Errorf("got %d manifest projects, want %d", got, want)
+	}
+
+	s.updateCmd = func() (*exec.Cmd, error) {
+		return exec.Command("sh", "-c", "sleep 0.5; echo updated"), nil
+	}
+	var u serveUpdate
+	if code := serveRequest(t, s, "POST", "/v1/update", &u); code != http.StatusAccepted || !u.Running {
+		t.Fatalf("POST /v1/update: got status %d, update %+v", code, u)
+	}
+	if code := serveRequest(t, s, "POST", "/v1/update", nil); code != http.StatusConflict {
+		t.Errorf("second POST /v1/update: got status %d, want %d", code, http.StatusConflict)
+	}
+	for deadline := time.Now().Add(10 * time.Second); u.Running && time.Now().Before(deadline); {
+		time.Sleep(100 * time.Millisecond)
+		serveRequest(t, s, "GET", "/v1/update", &u)
+	}
+	if u.Running || u.Error != "" || strings.TrimSpace(u.Output) != "updated" {
+		t.Errorf("got update %+v, want a successful update", u)
+	}
+}
+
+// TestServeLocalOnly checks that the API served on a port rejects the
+// requests which may come from web pages.
+func TestServeLocalOnly(t *testing.T) {
+	_, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	s := newServer(fake.X)
+	s.localOnly = true
+	s.updateCmd = func() (*exec.Cmd, error) {
+		t.Errorf("unexpected update")
+		return exec.Command("true"), nil
+	}
+	for _, test := range []struct {
+		host, origin string
+		want         int
+	}{
+		{"localhost:8080", "", http.StatusOK},
+		{"127.0.0.1:8080", "http://127.0.0.1:8080", http.StatusOK},
+		{"[::1]:8080", "", http.StatusOK},
+		{"example.com", "", http.StatusForbidden},
+		{"localhost:8080", "http://example.com", http.StatusForbidden},
+		{"localhost:8080", "http://localhost:3000", http.StatusForbidden},
+	} {
+		if code := serveRequestFrom(t, s, "GET", "/v1/update", test.host, test.origin, nil); code != test.want {
+			t.Errorf("GET with host %q and origin %q: got status %d, want %d", test.host, test.origin, code, test.want)
+		}
+	}
+	if code := serveRequestFrom(t, s, "POST", "/v1/update", "localhost:8080", "http://example.com", nil); code != http.StatusForbidden {
+		t.Errorf("cross-site POST /v1/update: got status %d, want %d", code, http.StatusForbidden)
+	}
+}
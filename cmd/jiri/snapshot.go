@@ -10,6 +10,11 @@ import (
 	"github.com/btwiuse/jiri/project"
 )
 
+var snapshotFlags struct {
+	sign    bool
+	signKey string
+}
+
 var cmdSnapshot = &cmdline.Command{
 	Runner: jiri.RunnerFunc(runSnapshot),
 	Name:   "snapshot",
@@ -17,14 +22,30 @@ var cmdSnapshot = &cmdline.Command{
 	Long: `
 The "jiri snapshot <snapshot>" command captures the current project state
 in a manifest.
+
+With -sign, an armored detached GPG signature of the snapshot is written to
+<snapshot>.asc.  "jiri update <snapshot>" verifies this signature when the
+file .jiri_root/snapshot_signers exists, and only accepts snapshots signed by
+one of the key fingerprints listed in it, one per line.
 `,
 	ArgsName: "<snapshot>",
 	ArgsLong: "<snapshot> is the snapshot manifest file.",
 }
 
+func init() {
+	cmdSnapshot.Flags.BoolVar(&snapshotFlags.sign, "sign", false, "Sign the snapshot with gpg.")
+	cmdSnapshot.Flags.StringVar(&snapshotFlags.signKey, "sign-key", "", "The gpg key to sign the snapshot with. Implies -sign. Defaults to the default key of gpg.")
+}
+
 func runSnapshot(jirix *jiri.X, args []string) error {
 	if len(args) != 1 {
 		return jirix.UsageErrorf("unexpected number of arguments")
 	}
-	return project.CreateSnapshot(jirix, args[0], nil, nil, true)
+	if err := project.CreateSnapshot(jirix, args[0], nil, nil, true); err != nil {
+		return err
+	}
+	if snapshotFlags.sign || snapshotFlags.signKey != "" {
+		return project.SignSnapshot(jirix, args[0], snapshotFlags.signKey)
+	}
+	return nil
 }
@@ -5,7 +5,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -18,11 +20,29 @@ import (
 )
 
 var statusFlags struct {
-	changes   bool
-	checkHead bool
-	branch    string
-	commits   bool
-	deleted   bool
+	changes    bool
+	checkHead  bool
+	branch     string
+	commits    bool
+	deleted    bool
+	jsonOutput string
+}
+
+// projectStatus is the JSON representation of a project printed by
+// "jiri status".
+type projectStatus struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Branch     string   `json:"branch,omitempty"`
+	Revision   string   `json:"revision"`
+	JiriHead   string   `json:"jiri_head,omitempty"`
+	Ahead      int      `json:"ahead"`
+	Behind     int      `json:"behind"`
+	Changes    []string `json:"changes,omitempty"`
+	Untracked  []string `json:"untracked,omitempty"`
+	Commits    []string `json:"commits,omitempty"`
+	Submodules []string `json:"submodules,omitempty"`
+	Files      []string `json:"files,omitempty"`
 }
 
 var cmdStatus = &cmdline.Command{
@@ -33,6 +53,10 @@ var cmdStatus = &cmdline.Command{
 Prints status for the the projects. It runs git status -s across all the projects
 and prints it if there are some changes. It also shows status if the project is on
 a rev other then the one according to manifest(Named as JIRI_HEAD in git)
+
+With -changes, it also shows the files copied or linked by the copyfile and
+linkfile elements of the projects which were modified or removed since "jiri
+update" installed them.
 `,
 }
 
@@ -44,6 +68,7 @@ func init() {
 	flags.StringVar(&statusFlags.branch, "branch", "", "Display all projects only on this branch along with their status.")
 	flags.BoolVar(&statusFlags.deleted, "deleted", false, "List all deleted projects. Other flags would be ignored.")
 	flags.BoolVar(&statusFlags.deleted, "d", false, "Same as -deleted.")
+	flags.StringVar(&statusFlags.jsonOutput, "json-output", "", "File to write the status of displayed projects to, in json format.")
 }
 
 func colorFormatGitLog(jirix *jiri.X, log string) string {
@@ -94,6 +119,7 @@ func runStatus(jirix *jiri.X, args []string) error {
 	}
 	sort.Sort(keys)
 	deletedProjects := 0
+	statuses := []projectStatus{}
 	for _, key := range keys {
 		localProject := localProjects[key]
 		remoteProject, foundRemote := remoteProjects[key]
@@ -122,6 +148,22 @@ func runStatus(jirix *jiri.X, args []string) error {
 		}
 		revisionMessage := ""
 		git := gitutil.New(jirix, gitutil.RootDirOpt(state.Project.Path))
+		var submodules []string
+		if statusFlags.changes && remoteProject.HasSubmodules() {
+			if submodules, err = git.SubmoduleStatus(remoteProject.Submodules == "recursive"); err != nil {
+				jirix.Logger.Errorf("%s :%s\n\n", errorMsg, err)
+				jirix.IncrementFailures()
+				continue
+			}
+		}
+		var files []string
+		if statusFlags.changes {
+			if files, err = project.ProjectFilesDrift(jirix, remoteProject); err != nil {
+				jirix.Logger.Errorf("%s :%s\n\n", errorMsg, err)
+				jirix.IncrementFailures()
+				continue
+			}
+		}
 		currentLog, err := git.OneLineLog(state.CurrentBranch.Revision)
 		if err != nil {
 			jirix.Logger.Errorf("%s :%s\n\n", errorMsg, err)
@@ -143,7 +185,14 @@ func runStatus(jirix *jiri.X, args []string) error {
 			}
 		}
 		if statusFlags.branch != "" || changes != "" || revisionMessage != "" ||
-			len(extraCommits) != 0 {
+			len(extraCommits) != 0 || len(submodules) != 0 || len(files) != 0 {
+			ps, err := newProjectStatus(git, localProject, state, headRev, changes, extraCommits, submodules, files)
+			if err != nil {
+				jirix.Logger.Errorf("%s :%s\n\n", errorMsg, err)
+				jirix.IncrementFailures()
+				continue
+			}
+			statuses = append(statuses, ps)
 			fmt.Printf("%s: %s", jirix.Color.Yellow(relativePath), revisionMessage)
 			fmt.Println()
 			branch := state.CurrentBranch.Name
@@ -163,6 +212,18 @@ func runStatus(jirix *jiri.X, args []string) error {
 					fmt.Println(colorFormatGitiStatusLog(jirix, change))
 				}
 			}
+			if len(submodules) != 0 {
+				fmt.Printf("%s: %d submodule(s) not at the recorded commit\n", jirix.Color.Yellow("Submodules"), len(submodules))
+				for _, submodule := range submodules {
+					fmt.Println(colorFormatGitiStatusLog(jirix, submodule))
+				}
+			}
+			if len(files) != 0 {
+				fmt.Printf("%s: %d copied or linked file(s) out of date, run 'jiri update' to restore them\n", jirix.Color.Yellow("Files"), len(files))
+				for _, file := range files {
+					fmt.Println(jirix.Color.Red(file))
+				}
+			}
 			fmt.Println()
 		}
 
@@ -170,12 +231,55 @@ func runStatus(jirix *jiri.X, args []string) error {
 	if deletedProjects != 0 {
 		jirix.Logger.Warningf("Found %d deleted project(s), run with -d flag to list them.\n\n", deletedProjects)
 	}
+	if statusFlags.jsonOutput != "" {
+		out, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to serialize JSON output: %s\n", err)
+		}
+		if err := ioutil.WriteFile(statusFlags.jsonOutput, out, 0600); err != nil {
+			return fmt.Errorf("failed write JSON output to %s: %s\n", statusFlags.jsonOutput, err)
+		}
+	}
 	if jirix.Failures() != 0 {
 		return fmt.Errorf("completed with non-fatal errors")
 	}
 	return nil
 }
 
+// newProjectStatus collects the status details of a project. Ahead and behind
+// are counted against JIRI_HEAD, so they are only set when headRev is known.
+func newProjectStatus(git *gitutil.Git, local project.Project, state *project.ProjectState, headRev, changes string, extraCommits, submodules, files []string) (projectStatus, error) {
+	ps := projectStatus{
+		Name:       local.Name,
+		Path:       local.Path,
+		Branch:     state.CurrentBranch.Name,
+		Revision:   state.CurrentBranch.Revision,
+		JiriHead:   headRev,
+		Commits:    extraCommits,
+		Submodules: submodules,
+		Files:      files,
+	}
+	if changes != "" {
+		for _, change := range strings.Split(changes, "\n") {
+			if strings.HasPrefix(change, "??") {
+				ps.Untracked = append(ps.Untracked, strings.TrimSpace(change[2:]))
+			} else {
+				ps.Changes = append(ps.Changes, change)
+			}
+		}
+	}
+	if headRev != "" && headRev != ps.Revision {
+		var err error
+		if ps.Ahead, err = git.CountCommits(ps.Revision, headRev); err != nil {
+			return ps, err
+		}
+		if ps.Behind, err = git.CountCommits(headRev, ps.Revision); err != nil {
+			return ps, err
+		}
+	}
+	return ps, nil
+}
+
 func getStatus(jirix *jiri.X, local project.Project, remote project.Project, currentBranch project.BranchState) (string, string, []string, error) {
 	var extraCommits []string
 	headRev := ""
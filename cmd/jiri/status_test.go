@@ -5,6 +5,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -26,6 +27,7 @@ func setDefaultStatusFlags() {
 	statusFlags.branch = ""
 	statusFlags.commits = true
 	statusFlags.deleted = false
+	statusFlags.jsonOutput = ""
 }
 
 func createCommits(t *testing.T, fake *jiritest.FakeJiriRoot, localProjects []project.Project) ([]string, []string, []string, []string) {
@@ -251,6 +253,48 @@ func TestStatusDeleted(t *testing.T) {
 	}
 }
 
+func TestStatusJSONOutput(t *testing.T) {
+	setDefaultStatusFlags()
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	numProjects := 2
+	localProjects := createProjects(t, fake, numProjects)
+	_, _, latestCommitRevs, _ := createCommits(t, fake, localProjects)
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	gitLocal := gitutil.New(fake.X, gitutil.RootDirOpt(localProjects[1].Path))
+	if err := gitLocal.CheckoutBranch("HEAD~2"); err != nil {
+		t.Fatal(err)
+	}
+	newfile(t, localProjects[1].Path, "untracked")
+
+	statusFlags.jsonOutput = filepath.Join(fake.X.Root, "status.json")
+	executeStatus(t, fake, "")
+	data, err := ioutil.ReadFile(statusFlags.jsonOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []projectStatus
+	if err := json.Unmarshal(data, &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("expected status of 1 project, got %+v", statuses)
+	}
+	ps := statuses[0]
+	if ps.Name != localProjects[1].Name || ps.JiriHead != latestCommitRevs[1] {
+		t.Errorf("unexpected project or JIRI_HEAD in %+v", ps)
+	}
+	if ps.Ahead != 0 || ps.Behind != 2 {
+		t.Errorf("expected to be 0 ahead and 2 behind, got %+v", ps)
+	}
+	if len(ps.Untracked) != 1 || ps.Untracked[0] != "untracked" || len(ps.Changes) != 0 {
+		t.Errorf("expected one untracked file, got %+v", ps)
+	}
+}
+
 func statusFlagsTest(t *testing.T) {
 	fake, cleanup := jiritest.NewFakeJiriRoot(t)
 	defer cleanup()
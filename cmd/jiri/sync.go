@@ -0,0 +1,212 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/project"
+)
+
+var syncFlags struct {
+	watch     bool
+	interval  time.Duration
+	listen    string
+	notify    bool
+	runHooks  bool
+	fetchPkgs bool
+}
+
+func init() {
+	cmdSync.Flags.BoolVar(&syncFlags.watch, "watch", false, "Keep running, and sync whenever the manifest changes.")
+	cmdSync.Flags.DurationVar(&syncFlags.interval, "interval", 5*time.Minute, "With -watch, how often to poll the manifest repositories.")
+	cmdSync.Flags.StringVar(&syncFlags.listen, "listen", "", "With -watch, address to receive webhook notifications on, e.g. localhost:8081. A POST to /sync triggers a sync.")
+	cmdSync.Flags.BoolVar(&syncFlags.notify, "notify", false, "Send a desktop notification, or ring the terminal bell, after each sync.")
+	cmdSync.Flags.BoolVar(&syncFlags.runHooks, "run-hooks", true, "Run hooks after syncing sources.")
+	cmdSync.Flags.BoolVar(&syncFlags.fetchPkgs, "fetch-packages", true, "Use cipd to fetch packages.")
+}
+
+var cmdSync = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runSync),
+	Name:   "sync",
+	Short:  "Update the projects without local work, optionally continuously",
+	Long: `
+Updates the projects like "jiri update", but never touches a project with
+uncommitted changes or a branch which cannot be fast-forwarded: the
+"-on-conflict=skip" policy is used for all projects, whatever their local
+config says.
+
+With -watch, jiri sync keeps running: the branches of the manifest
+repositories imported by .jiri_manifest are polled every -interval, and the
+projects are synced whenever one of them moves. With -listen, a sync is also
+triggered by a POST to /sync on the given address, so that a webhook of the
+code review or hosting service can notify manifest changes right away.
+`,
+}
+
+func runSync(jirix *jiri.X, args []string) error {
+	if len(args) != 0 {
+		return jirix.UsageErrorf("unexpected number of arguments")
+	}
+	if !syncFlags.watch && syncFlags.listen != "" {
+		return jirix.UsageErrorf("-listen can only be used with -watch")
+	}
+	if syncFlags.interval <= 0 {
+		return jirix.UsageErrorf("-interval should be positive")
+	}
+	jirix.OnConflict = project.ConflictSkip
+	jirix.ForceOnConflict = true
+	if !syncFlags.watch {
+		return syncOnce(jirix)
+	}
+
+	trigger := make(chan struct{}, 1)
+	if syncFlags.listen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, fmt.Sprintf("%s not allowed", r.Method), http.StatusMethodNotAllowed)
+				return
+			}
+			select {
+			case trigger <- struct{}{}:
+			default:
+				// A sync is already pending.
+			}
+			w.WriteHeader(http.StatusAccepted)
+		})
+		go func() {
+			if err := http.ListenAndServe(syncFlags.listen, mux); err != nil {
+				jirix.Logger.Errorf("Cannot receive webhook notifications: %v\n\n", err)
+			}
+		}()
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	ticker := time.NewTicker(syncFlags.interval)
+	defer ticker.Stop()
+
+	heads, err := manifestHeads(jirix)
+	if err != nil {
+		jirix.Logger.Warningf("Cannot poll the manifest repositories: %v\n\n", err)
+	}
+	for {
+		if err := syncOnce(jirix); err != nil {
+			jirix.Logger.Errorf("%v\n\n", err)
+		}
+		jirix.Logger.Infof("Waiting for manifest changes\n")
+	wait:
+		for {
+			select {
+			case <-sigs:
+				return nil
+			case <-trigger:
+				if newHeads, err := manifestHeads(jirix); err == nil {
+					heads = newHeads
+				}
+				break wait
+			case <-ticker.C:
+				newHeads, err := manifestHeads(jirix)
+				if err != nil {
+					jirix.Logger.Warningf("Cannot poll the manifest repositories: %v\n\n", err)
+					continue
+				}
+				if !reflect.DeepEqual(newHeads, heads) {
+					heads = newHeads
+					break wait
+				}
+			}
+		}
+	}
+}
+
+// syncOnce updates the projects and reports how many of them moved.
+func syncOnce(jirix *jiri.X) error {
+	before, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	if err := project.WritePreUpdateSnapshot(jirix); err != nil {
+		jirix.Logger.Warningf("Could not snapshot the projects before syncing, 'jiri rollback' will not be able to undo this sync: %v\n\n", err)
+	}
+	failures := jirix.Failures()
+	err = project.UpdateUniverse(jirix, false /*gc*/, false /*localManifest*/, false /*rebaseTracked*/, false /*rebaseUntracked*/, false /*rebaseAll*/, syncFlags.runHooks, syncFlags.fetchPkgs, project.DefaultHookTimeout, project.DefaultPackageTimeout)
+	if err2 := project.WriteUpdateHistorySnapshot(jirix, "", nil, nil, false); err2 != nil && err == nil {
+		err = fmt.Errorf("while writing history: %s", err2)
+	}
+	if err == nil && jirix.Failures() != failures {
+		err = fmt.Errorf("Sync completed with non-fatal errors")
+	}
+	if err != nil {
+		syncNotify(jirix, fmt.Sprintf("sync failed: %v", err))
+		return err
+	}
+	after, err := project.LocalProjects(jirix, project.FastScan)
+	if err != nil {
+		return err
+	}
+	moved := 0
+	for key, p := range after {
+		if b, ok := before[key]; !ok || b.Revision != p.Revision {
+			moved++
+		}
+	}
+	syncNotify(jirix, fmt.Sprintf("synced, %d project(s) updated", moved))
+	return nil
+}
+
+// manifestHeads returns the revisions of the branches tracked by the imports
+// of .jiri_manifest, keyed by remote and branch.
+func manifestHeads(jirix *jiri.X) (map[string]string, error) {
+	m, err := project.ManifestFromFile(jirix, jirix.JiriManifestFile())
+	if err != nil {
+		return nil, err
+	}
+	heads := make(map[string]string)
+	for _, i := range m.Imports {
+		if i.Revision != "" && i.Revision != "HEAD" {
+			continue
+		}
+		revs, err := gitutil.New(jirix).LsRemoteHeads(i.Remote, i.RemoteBranch)
+		if err != nil {
+			return nil, err
+		}
+		heads[i.Remote+" "+i.RemoteBranch] = revs[i.RemoteBranch]
+	}
+	return heads, nil
+}
+
+// syncNotify logs msg and, with -notify, shows it as a desktop notification
+// when possible, or rings the terminal bell.
+func syncNotify(jirix *jiri.X, msg string) {
+	jirix.Logger.Infof("jiri sync: %s\n", msg)
+	if !syncFlags.notify {
+		return
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title \"jiri\"", msg))
+	default:
+		if _, err := exec.LookPath("notify-send"); err == nil {
+			cmd = exec.Command("notify-send", "jiri", msg)
+		}
+	}
+	if cmd == nil || cmd.Run() != nil {
+		fmt.Fprint(jirix.Stdout(), "\a")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/btwiuse/jiri/jiritest"
+	"github.com/btwiuse/jiri/project"
+)
+
+// TestSync checks that jiri sync updates clean projects and leaves the ones
+// with local changes alone, even if their local config would stash them.
+func TestSync(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	dirty := localProjects[1]
+	dirty.LocalConfig.OnConflict = project.ConflictStash
+	if err := project.WriteLocalConfig(fake.X, dirty, dirty.LocalConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dirty.Path, "README"), []byte("uncommitted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range localProjects[1:] {
+		writeFile(t, fake.X, fake.Projects[p.Name], "extra", "remote commit")
+	}
+
+	syncFlags.runHooks, syncFlags.fetchPkgs = true, true
+	if err := runSync(fake.X, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(localProjects[2].Path, "extra")); err != nil {
+		t.Errorf("expected project %q to be synced: %v", localProjects[2].Name, err)
+	}
+	if _, err := os.Stat(filepath.Join(dirty.Path, "extra")); err == nil {
+		t.Errorf("expected project %q with local changes not to be synced", dirty.Name)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dirty.Path, "README")); err != nil || string(data) != "uncommitted" {
+		t.Errorf("expected the local changes of project %q to be kept, got %q, %v", dirty.Name, data, err)
+	}
+}
+
+// TestManifestHeads checks that the heads polled by jiri sync -watch change
+// when the manifest repository moves.
+func TestManifestHeads(t *testing.T) {
+	_, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+
+	heads, err := manifestHeads(fake.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heads) != 1 {
+		t.Fatalf("got heads %v, want the head of the manifest repository", heads)
+	}
+	if err := fake.AddProject(project.Project{Name: "new", Path: "new", Remote: "https://example.com/new"}); err != nil {
+		t.Fatal(err)
+	}
+	newHeads, err := manifestHeads(fake.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(heads, newHeads) {
+		t.Errorf("heads %v did not change after a manifest commit to %s", heads, fake.Projects[jiritest.ManifestProjectName])
+	}
+}
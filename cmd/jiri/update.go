@@ -11,6 +11,7 @@ import (
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/metrics"
 	"github.com/btwiuse/jiri/project"
 	"github.com/btwiuse/jiri/retry"
 )
@@ -30,6 +31,10 @@ var (
 	runHooksFlag         bool
 	fetchPkgsFlag        bool
 	overrideOptionalFlag bool
+	incrementalFlag      bool
+	onConflictFlag       string
+	maxBandwidthFlag     uint64
+	minFreeDiskFlag      uint64
 )
 
 const (
@@ -51,6 +56,10 @@ func init() {
 	cmdUpdate.Flags.BoolVar(&rebaseTrackedFlag, "rebase-tracked", false, "Rebase current tracked branches instead of fast-forwarding them.")
 	cmdUpdate.Flags.BoolVar(&runHooksFlag, "run-hooks", true, "Run hooks after updating sources.")
 	cmdUpdate.Flags.BoolVar(&fetchPkgsFlag, "fetch-packages", true, "Use cipd to fetch packages.")
+	cmdUpdate.Flags.BoolVar(&incrementalFlag, "incremental", false, "Skip fetching projects whose remote branch has not changed since the last update.")
+	cmdUpdate.Flags.Uint64Var(&maxBandwidthFlag, "max-bandwidth", 0, "Best-effort limit, in KiB per second, on the average download rate of fetches and clones. Fetches in progress are not slowed down. No limit if 0.")
+	cmdUpdate.Flags.Uint64Var(&minFreeDiskFlag, "min-free-disk", 0, "Stop the update before fetching or checking out more when less than this many MiB are free on the disk of the jiri root. No limit if 0.")
+	cmdUpdate.Flags.StringVar(&onConflictFlag, "on-conflict", "", "What to do with projects whose local work is in the way of the update: fail, skip, stash, backup, rebase or prompt. Defaults to the project's local config, then to fail.")
 	cmdUpdate.Flags.BoolVar(&overrideOptionalFlag, "override-optional", false, "Override existing optional attributes in the snapshot file with current jiri settings")
 }
 
@@ -65,12 +74,67 @@ guarantees that we end up with a consistent workspace. The set of projects
 to update is described in the manifest.
 
 Run "jiri help manifest" for details on manifests.
+
+With -incremental, the remote branches of all projects are listed with one
+"git ls-remote" per remote and compared with the revisions recorded in
+.jiri_root/update_state.json by the previous update. Projects whose branch
+has not moved are not fetched.
+
+Projects are fetched in the order of their size as of their last fetch, as
+recorded in .jiri_root/update_state.json, smallest first, so that most of them
+are up to date if the update stops midway.
+
+With -max-bandwidth, new fetches and clones of projects are held back while
+the data downloaded so far exceeds the given rate on average. The limit is
+best-effort, as git cannot throttle a transfer in progress: the first -j
+fetches start at once, a fetch or clone runs at full speed once started, and
+the data downloaded is estimated by the growth of the repositories, which
+misses data that git compacts while fetching.
+
+With -min-free-disk, no new fetch, checkout or clone is started once the free
+disk space falls below the given amount: the update stops with an error before checking out anything if
+fetches are stopped, so that the projects are left as they were.
+
+With the global -offline flag, nothing is fetched: projects are updated to
+the refs fetched before, and update fails, listing the projects concerned,
+if it would need to clone a project, change its remote or check out a
+revision that is not available locally. Packages are not fetched.
+
+Projects with uncommitted changes, or whose current branch cannot be
+fast-forwarded, are handled according to -on-conflict, or to the policy set
+with "jiri project-config -on-conflict":
+  fail   - leave the project as it is and report it as failed (default)
+  skip   - leave the project as it is
+  stash  - stash uncommitted changes and reapply them after updating
+  backup - commit uncommitted changes, or save the branch, on a new
+           jiri-backup/<branch>-<time> branch before updating
+  rebase - stash and reapply uncommitted changes, rebase the branch
+  prompt - ask which of the above to use for each project
+
+When a snapshot is given and .jiri_root/snapshot_signers exists, the snapshot
+must be signed, see "jiri help snapshot".
+
+The revisions of the projects are recorded in .jiri_root/update_history
+before and after each update, so that "jiri rollback" can undo it. The last
+10 snapshots of each kind are kept, see "jiri init -update-history-depth".
 `,
 	ArgsName: "<file or url>",
 	ArgsLong: "<file or url> points to snapshot to checkout.",
 }
 
-func runUpdate(jirix *jiri.X, args []string) error {
+func runUpdate(jirix *jiri.X, args []string) (e error) {
+	if jirix.Metrics != nil {
+		defer func() {
+			if err := jirix.CheckWrite(jirix.MetricsDir(), "save metrics"); err != nil {
+				jirix.Logger.Debugf("%s\n\n", err)
+				return
+			}
+			run := jirix.Metrics.Run("update", jirix.Timer(), e != nil)
+			if err := metrics.Write(jirix.MetricsDir(), run); err != nil {
+				jirix.Logger.Warningf("Could not save metrics: %v\n\n", err)
+			}
+		}()
+	}
 	if len(args) > 1 {
 		return jirix.UsageErrorf("unexpected number of arguments")
 	}
@@ -79,8 +143,18 @@ func runUpdate(jirix *jiri.X, args []string) error {
 		return jirix.UsageErrorf("Number of attempts should be >= 1")
 	}
 	jirix.Attempts = attemptsFlag
+	jirix.Incremental = incrementalFlag
+	jirix.MaxBandwidth = maxBandwidthFlag << 10
+	jirix.MinFreeDisk = minFreeDiskFlag << 20
+	if err := project.ValidateConflictPolicy(onConflictFlag); err != nil {
+		return jirix.UsageErrorf("%s", err)
+	}
+	jirix.OnConflict = onConflictFlag
+	if err := jirix.CheckWrite(jirix.Root, "update"); err != nil {
+		return err
+	}
 
-	if autoupdateFlag {
+	if autoupdateFlag && !jirix.Offline {
 		// Try to update Jiri itself.
 		if err := retry.Function(jirix, func() error {
 			return jiri.UpdateAndExecute(forceAutoupdateFlag)
@@ -93,6 +167,10 @@ func runUpdate(jirix *jiri.X, args []string) error {
 		rebaseTrackedFlag = true
 	}
 
+	if err := project.WritePreUpdateSnapshot(jirix); err != nil {
+		jirix.Logger.Warningf("Could not snapshot the projects before updating, 'jiri rollback' will not be able to undo this update: %v\n\n", err)
+	}
+
 	if len(args) > 0 {
 		jirix.OverrideOptional = overrideOptionalFlag
 		if err := project.CheckoutSnapshot(jirix, args[0], gcFlag, runHooksFlag, fetchPkgsFlag, hookTimeoutFlag, fetchPkgsTimeoutFlag); err != nil {
@@ -0,0 +1,52 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri/metrics"
+)
+
+// listFiles returns the paths of the files under dir.
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// TestUpdateNoWrite checks that jiri update refuses to run in -no-write mode
+// without writing anything under the root, metrics included.
+func TestUpdateNoWrite(t *testing.T) {
+	_, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	before := listFiles(t, fake.X.Root)
+
+	fake.X.NoWrite = true
+	fake.X.Metrics = metrics.NewRecorder()
+	autoupdateFlag = false
+	defer func() { autoupdateFlag = true }()
+	if err := runUpdate(fake.X, nil); err == nil || !strings.Contains(err.Error(), "-no-write mode") {
+		t.Errorf("expected update to be refused in -no-write mode, got: %v", err)
+	}
+	if after := listFiles(t, fake.X.Root); !reflect.DeepEqual(after, before) {
+		t.Errorf("expected no file to be written under the root, got %q, want %q", after, before)
+	}
+}
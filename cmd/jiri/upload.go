@@ -29,6 +29,7 @@ var (
 	uploadBranchFlag       string
 	uploadRemoteBranchFlag string
 	uploadLabelsFlag       string
+	uploadHashtagsFlag     string
 	uploadGitOptions       string
 )
 
@@ -58,6 +59,7 @@ func init() {
 		fmt.Sprintf("The type of presubmit tests to run. Valid values: %s.", strings.Join(gerrit.PresubmitTestTypes(), ",")))
 	cmdUpload.Flags.StringVar(&uploadReviewersFlag, "r", "", `Comma-separated list of emails or LDAPs to request review.`)
 	cmdUpload.Flags.StringVar(&uploadLabelsFlag, "l", "", `Comma-separated list of review labels.`)
+	cmdUpload.Flags.StringVar(&uploadHashtagsFlag, "hashtags", "", `Comma-separated list of hashtags to add to the CLs.`)
 	cmdUpload.Flags.StringVar(&uploadTopicFlag, "topic", "", `CL topic. Default is <username>-<branchname>. If this flag is set, upload will ignore -set-topic and will set a topic.`)
 	cmdUpload.Flags.BoolVar(&uploadSetTopicFlag, "set-topic", false, `Set topic. This flag would be ignored if -topic passed.`)
 	cmdUpload.Flags.BoolVar(&uploadVerifyFlag, "verify", true, `Run pre-push git hooks.`)
@@ -146,7 +148,16 @@ func runUpload(jirix *jiri.X, args []string) error {
 		return err
 	}
 	if uploadMultipartFlag {
-		for _, project := range localProjects {
+		// Only upload from the projects the branch was created in by
+		// "jiri branch -create", if any.
+		branchProjects := make(project.Projects)
+		for key, p := range localProjects {
+			branchProjects[key] = p
+		}
+		if err := filterBranchProjects(jirix, currentBranch, branchProjects); err != nil {
+			return err
+		}
+		for _, project := range branchProjects {
 			scm := gitutil.New(jirix, gitutil.RootDirOpt(project.Path))
 			if scm.IsOnBranch() {
 				branch, err := scm.CurrentBranchName()
@@ -217,6 +228,7 @@ func runUpload(jirix *jiri.X, args []string) error {
 			Remote:       "origin",
 			Reviewers:    parseEmails(uploadReviewersFlag),
 			Labels:       parseLabels(uploadLabelsFlag),
+			Hashtags:     parseLabels(uploadHashtagsFlag),
 			Verify:       uploadVerifyFlag,
 			Topic:        topic,
 			RefToUpload:  refToUpload,
@@ -122,6 +122,7 @@ func resetFlags() {
 	uploadBranchFlag = ""
 	uploadRemoteBranchFlag = ""
 	uploadSetTopicFlag = false
+	uploadHashtagsFlag = ""
 }
 
 func TestUpload(t *testing.T) {
@@ -0,0 +1,94 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/project"
+)
+
+var viewFlags struct {
+	clear bool
+}
+
+var cmdView = &cmdline.Command{
+	Runner: jiri.RunnerFunc(runView),
+	Name:   "view",
+	Short:  "List or select workspace views",
+	Long: `
+Views are named subsets of projects declared in .jiri_manifest, see
+"jiri help manifest-files".  Without arguments, lists the declared views and
+marks the selected one with '*'.  With a view name, selects that view; the
+selection takes effect on the next "jiri update".
+`,
+	ArgsName: "[<view>]",
+	ArgsLong: "<view> is the name of the view to select.",
+}
+
+func init() {
+	cmdView.Flags.BoolVar(&viewFlags.clear, "clear", false, "Clear the selected view, so that all projects are synced.")
+}
+
+func runView(jirix *jiri.X, args []string) error {
+	if len(args) > 1 || (viewFlags.clear && len(args) != 0) {
+		return jirix.UsageErrorf("wrong number of arguments")
+	}
+	if !viewFlags.clear && len(args) == 0 {
+		views, err := project.LoadViews(jirix)
+		if err != nil {
+			return err
+		}
+		for _, view := range views {
+			marker := " "
+			if view.Name == jirix.View {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, view.Name)
+			for _, p := range view.Projects {
+				if p.Sparse != "" {
+					fmt.Printf("    %s (%s)\n", p.Name, p.Sparse)
+				} else {
+					fmt.Printf("    %s\n", p.Name)
+				}
+			}
+		}
+		return nil
+	}
+
+	name := ""
+	if !viewFlags.clear {
+		name = args[0]
+		if _, err := project.FindView(jirix, name); err != nil {
+			return err
+		}
+	}
+	if err := updateConfig(jirix, func(config *jiri.Config) { config.View = name }); err != nil {
+		return err
+	}
+	jirix.View = name
+	jirix.Logger.Infof("Run 'jiri update' to sync the workspace to the new view.\n")
+	return nil
+}
+
+// updateConfig applies update to the config of the jiri root and writes it
+// back, creating the config file if it does not exist yet.
+func updateConfig(jirix *jiri.X, update func(*jiri.Config)) error {
+	configPath := filepath.Join(jirix.RootMetaDir(), jiri.ConfigFile)
+	config := &jiri.Config{}
+	if _, err := os.Stat(configPath); err == nil {
+		if config, err = jiri.ConfigFromFile(configPath); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	update(config)
+	return config.Write(configPath)
+}
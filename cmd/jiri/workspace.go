@@ -0,0 +1,244 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+)
+
+var cmdWorkspace = &cmdline.Command{
+	Name:  "workspace",
+	Short: "Manage the jiri roots of the user",
+	Long: `
+Jiri keeps a registry of the jiri roots, or workspaces, of the user in
+jiri/workspaces under their configuration directory, e.g. ~/.config. "jiri
+init" registers the roots it creates.
+
+Jiri commands run in the jiri root given by -root or, if it is not set, by
+$JIRI_WORKSPACE, which holds the name of a workspace or the path of a jiri
+root. Otherwise they run in the jiri root containing the current directory,
+or, outside of any jiri root, in the workspace made active by "jiri workspace
+switch".
+`,
+	Children: []*cmdline.Command{cmdWorkspaceList, cmdWorkspaceAdd, cmdWorkspaceRemove, cmdWorkspaceSwitch, cmdWorkspaceRun},
+}
+
+var cmdWorkspaceList = &cmdline.Command{
+	Runner: cmdline.RunnerFunc(runWorkspaceList),
+	Name:   "list",
+	Short:  "List the workspaces",
+	Long: `
+Lists the registered workspaces with their jiri roots. The active workspace
+is marked with a "*", and the workspaces whose root is gone are marked as
+missing.
+`,
+}
+
+var cmdWorkspaceAdd = &cmdline.Command{
+	Runner: cmdline.RunnerFunc(runWorkspaceAdd),
+	Name:   "add",
+	Short:  "Register a jiri root as a workspace",
+	Long: `
+Registers a jiri root, by default the current one, as the workspace <name>.
+An existing workspace with the same name is replaced.
+`,
+	ArgsName: "<name> [<root>]",
+	ArgsLong: "<name> is the name of the workspace and <root> is its jiri root.",
+}
+
+var cmdWorkspaceRemove = &cmdline.Command{
+	Runner:   cmdline.RunnerFunc(runWorkspaceRemove),
+	Name:     "remove",
+	Short:    "Unregister a workspace",
+	Long:     "Unregisters a workspace, without touching its jiri root.",
+	ArgsName: "<name>",
+	ArgsLong: "<name> is the name of the workspace.",
+}
+
+var cmdWorkspaceSwitch = &cmdline.Command{
+	Runner: cmdline.RunnerFunc(runWorkspaceSwitch),
+	Name:   "switch",
+	Short:  "Make a workspace active",
+	Long: `
+Makes a workspace active: jiri commands run outside of any jiri root run in
+it. Its root is printed, so that "cd $(jiri workspace switch <name>)" also
+moves the shell to it. With -none, no workspace is active anymore.
+`,
+	ArgsName: "<name>",
+	ArgsLong: "<name> is the name of the workspace.",
+}
+
+var cmdWorkspaceRun = &cmdline.Command{
+	Runner: cmdline.RunnerFunc(runWorkspaceRun),
+	Name:   "run",
+	Short:  "Run a command in workspaces",
+	Long: `
+Runs a command from the root of a workspace, or of all the workspaces with
+-all, with $JIRI_WORKSPACE set to the workspace, e.g.
+"jiri workspace run -all jiri update".
+`,
+	ArgsName: "[<name>] <command>",
+	ArgsLong: "<name> is the name of the workspace, it is omitted with -all. <command> is the command to run and its arguments.",
+}
+
+var workspaceFlags struct {
+	none bool
+	all  bool
+}
+
+func init() {
+	cmdWorkspaceSwitch.Flags.BoolVar(&workspaceFlags.none, "none", false, "Make no workspace active.")
+	cmdWorkspaceRun.Flags.BoolVar(&workspaceFlags.all, "all", false, "Run the command in all the workspaces.")
+}
+
+func runWorkspaceList(env *cmdline.Env, args []string) error {
+	if len(args) != 0 {
+		return env.UsageErrorf("unexpected number of arguments")
+	}
+	ws, err := jiri.ReadWorkspaces()
+	if err != nil {
+		return err
+	}
+	width := 0
+	for _, w := range ws.Workspaces {
+		if len(w.Name) > width {
+			width = len(w.Name)
+		}
+	}
+	for _, w := range ws.Workspaces {
+		active := " "
+		if w.Name == ws.Active {
+			active = "*"
+		}
+		missing := ""
+		if _, err := os.Stat(filepath.Join(w.Root, jiri.RootMetaDir)); err != nil {
+			missing = " (missing)"
+		}
+		fmt.Fprintf(env.Stdout, "%s %-*s %s%s\n", active, width, w.Name, w.Root, missing)
+	}
+	return nil
+}
+
+func runWorkspaceAdd(env *cmdline.Env, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return env.UsageErrorf("unexpected number of arguments")
+	}
+	name := args[0]
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return env.UsageErrorf("invalid workspace name %q", name)
+	}
+	root := jiri.FindRoot()
+	if len(args) == 2 {
+		var err error
+		if root, err = filepath.Abs(args[1]); err != nil {
+			return err
+		}
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			return err
+		}
+	}
+	if root == "" {
+		return env.UsageErrorf("not in a jiri root, give the root of the workspace")
+	}
+	if _, err := os.Stat(filepath.Join(root, jiri.RootMetaDir)); err != nil {
+		return fmt.Errorf("%s is not a jiri root", root)
+	}
+	ws, err := jiri.ReadWorkspaces()
+	if err != nil {
+		return err
+	}
+	ws.Add(name, root)
+	return ws.Write()
+}
+
+func runWorkspaceRemove(env *cmdline.Env, args []string) error {
+	if len(args) != 1 {
+		return env.UsageErrorf("unexpected number of arguments")
+	}
+	ws, err := jiri.ReadWorkspaces()
+	if err != nil {
+		return err
+	}
+	if !ws.Remove(args[0]) {
+		return fmt.Errorf("unknown workspace %q", args[0])
+	}
+	return ws.Write()
+}
+
+func runWorkspaceSwitch(env *cmdline.Env, args []string) error {
+	ws, err := jiri.ReadWorkspaces()
+	if err != nil {
+		return err
+	}
+	if workspaceFlags.none {
+		if len(args) != 0 {
+			return env.UsageErrorf("unexpected number of arguments")
+		}
+		ws.Active = ""
+		return ws.Write()
+	}
+	if len(args) != 1 {
+		return env.UsageErrorf("unexpected number of arguments")
+	}
+	w, ok := ws.Lookup(args[0])
+	if !ok {
+		return fmt.Errorf("unknown workspace %q, see 'jiri workspace list'", args[0])
+	}
+	ws.Active = w.Name
+	if err := ws.Write(); err != nil {
+		return err
+	}
+	fmt.Fprintln(env.Stdout, w.Root)
+	return nil
+}
+
+func runWorkspaceRun(env *cmdline.Env, args []string) error {
+	ws, err := jiri.ReadWorkspaces()
+	if err != nil {
+		return err
+	}
+	workspaces := ws.Workspaces
+	if !workspaceFlags.all {
+		if len(args) == 0 {
+			return env.UsageErrorf("no workspace given")
+		}
+		w, ok := ws.Lookup(args[0])
+		if !ok {
+			return fmt.Errorf("unknown workspace %q, see 'jiri workspace list'", args[0])
+		}
+		workspaces, args = []jiri.Workspace{w}, args[1:]
+	}
+	if len(args) == 0 {
+		return env.UsageErrorf("no command given")
+	}
+	var failed []string
+	for _, w := range workspaces {
+		if workspaceFlags.all {
+			fmt.Fprintf(env.Stdout, "%s (%s):\n", w.Name, w.Root)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = w.Root
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = env.Stdin, env.Stdout, env.Stderr
+		cmd.Env = append(os.Environ(), jiri.WorkspaceEnv+"="+w.Root)
+		if err := cmd.Run(); err != nil {
+			if !workspaceFlags.all {
+				return err
+			}
+			fmt.Fprintf(env.Stderr, "%s: %v\n", w.Name, err)
+			failed = append(failed, w.Name)
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("command failed in workspace(s) %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
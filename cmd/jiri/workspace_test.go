@@ -0,0 +1,71 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/cmdline"
+	"github.com/btwiuse/jiri/jiritest"
+)
+
+func TestWorkspace(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+	configDir := filepath.Join(fake.X.Root, "config")
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", configDir)
+	root, err := filepath.EvalSymlinks(fake.X.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	env := &cmdline.Env{Stdout: &stdout, Stderr: &stderr}
+	if err := runWorkspaceAdd(env, []string{"a", root}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runWorkspaceAdd(env, []string{"b", filepath.Join(root, "missing")}); err == nil {
+		t.Errorf("expected an error adding a directory which is not a jiri root")
+	}
+	if err := runWorkspaceSwitch(env, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), root+"\n"; got != want {
+		t.Errorf("switch: got %q, want %q", got, want)
+	}
+	stdout.Reset()
+	if err := runWorkspaceList(env, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), fmt.Sprintf("* a %s\n", root); got != want {
+		t.Errorf("list: got %q, want %q", got, want)
+	}
+
+	stdout.Reset()
+	if err := runWorkspaceRun(env, []string{"a", "sh", "-c", "pwd; echo $" + jiri.WorkspaceEnv}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Fields(stdout.String()), []string{root, root}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("run: got %q, want %q", got, want)
+	}
+
+	if err := runWorkspaceRemove(env, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := jiri.ReadWorkspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ws.Workspaces) != 0 || ws.Active != "" {
+		t.Errorf("got workspaces %+v after removing the only one", ws)
+	}
+}
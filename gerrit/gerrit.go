@@ -63,6 +63,8 @@ type CLOpts struct {
 	Edit bool
 	// GitOptions pass through additional git options
 	GitOptions string
+	// Hashtags records a list of hashtags to add to the CL.
+	Hashtags []string
 	// Labels records a list of labels needs to pass through gerrit.
 	Labels []string
 	// Remote identifies the Gerrit remote that this CL will be pushed to
@@ -554,6 +556,7 @@ func Reference(opts CLOpts) string {
 	params = append(params, formatParams(opts.Labels, "l")...)
 	params = append(params, formatParams(opts.Reviewers, "r")...)
 	params = append(params, formatParams(opts.Ccs, "cc")...)
+	params = append(params, formatParams(opts.Hashtags, "t")...)
 	if opts.Topic != "" {
 		params = append(params, "topic="+opts.Topic)
 	}
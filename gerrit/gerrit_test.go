@@ -369,6 +369,14 @@ func TestReference(t *testing.T) {
 	if gold != ref {
 		t.Errorf("expecting %q, got %q", gold, ref)
 	}
+
+	testOpts.Hashtags = []string{"release", "cleanup"}
+	testOpts.Topic = "my-topic"
+	gold = "refs/for/master%l=Commit-Queue+1,r=a@example.com,r=b@example.com,t=release,t=cleanup,topic=my-topic"
+	ref = Reference(testOpts)
+	if gold != ref {
+		t.Errorf("expecting %q, got %q", gold, ref)
+	}
 }
 
 // TODO(jsimsa): Add a test for the hostCredentials function that
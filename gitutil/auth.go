@@ -0,0 +1,62 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gitutil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+)
+
+// credentialArgs returns the "-c" arguments configuring git to use the
+// credentials of the jiri config.
+func credentialArgs(creds []jiri.Credential) []string {
+	var args []string
+	for _, c := range creds {
+		prefix := "credential.https://" + c.Host
+		if c.Helper != "" {
+			args = append(args, "-c", prefix+".helper="+c.Helper)
+		}
+		if c.TokenEnv != "" {
+			username := c.Username
+			if username == "" {
+				username = "git"
+			}
+			// The helper is run by the shell, which expands the variable, so
+			// the token is only ever passed through the environment.
+			helper := fmt.Sprintf("!f() { test \"$1\" = get && test -n \"$%s\" && echo username=%s && echo \"password=$%s\"; }; f", c.TokenEnv, username, c.TokenEnv)
+			args = append(args, "-c", prefix+".helper="+helper)
+		} else if c.Username != "" {
+			args = append(args, "-c", prefix+".username="+c.Username)
+		}
+	}
+	return args
+}
+
+// AuthHint returns advice on how to fix the authentication failure that
+// caused err, or an empty string if err is not an authentication failure.
+func AuthHint(err error) string {
+	if err == nil {
+		return ""
+	}
+	out := err.Error()
+	switch {
+	case strings.Contains(out, "Permission denied (publickey"):
+		if os.Getenv("SSH_AUTH_SOCK") == "" {
+			return "No SSH agent is reachable (SSH_AUTH_SOCK is not set). Start one with 'eval $(ssh-agent)' and add your key with 'ssh-add'."
+		}
+		return "The SSH agent has no key accepted by the remote. Check the loaded keys with 'ssh-add -l'."
+	case strings.Contains(out, "Host key verification failed"):
+		return "The SSH host key of the remote is not known. Connect to it once with ssh to verify and record its key."
+	case strings.Contains(out, "could not read Username"),
+		strings.Contains(out, "could not read Password"),
+		strings.Contains(out, "terminal prompts disabled"),
+		strings.Contains(out, "Authentication failed"):
+		return "No valid credentials for the remote. Configure a credential helper or an access token for its host in .jiri_root/config, see 'jiri help init'."
+	}
+	return ""
+}
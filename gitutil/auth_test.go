@@ -0,0 +1,93 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gitutil
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri"
+)
+
+func TestCredentialArgs(t *testing.T) {
+	const prefix = "credential.https://example.com"
+	for _, test := range []struct {
+		name  string
+		creds []jiri.Credential
+		want  []string
+	}{
+		{"none", nil, nil},
+		{
+			"helper",
+			[]jiri.Credential{{Host: "example.com", Helper: "store"}},
+			[]string{"-c", prefix + ".helper=store"},
+		},
+		{
+			"username",
+			[]jiri.Credential{{Host: "example.com", Username: "jane"}},
+			[]string{"-c", prefix + ".username=jane"},
+		},
+		{
+			"token",
+			[]jiri.Credential{{Host: "example.com", TokenEnv: "TOKEN"}},
+			[]string{"-c", prefix + `.helper=!f() { test "$1" = get && test -n "$TOKEN" && echo username=git && echo "password=$TOKEN"; }; f`},
+		},
+		{
+			"token with username and helper",
+			[]jiri.Credential{{Host: "example.com", Helper: "store", Username: "jane", TokenEnv: "TOKEN"}},
+			[]string{
+				"-c", prefix + ".helper=store",
+				"-c", prefix + `.helper=!f() { test "$1" = get && test -n "$TOKEN" && echo username=jane && echo "password=$TOKEN"; }; f`,
+			},
+		},
+		{
+			"several hosts",
+			[]jiri.Credential{{Host: "example.com", Username: "jane"}, {Host: "other.org", Helper: "cache"}},
+			[]string{"-c", prefix + ".username=jane", "-c", "credential.https://other.org.helper=cache"},
+		},
+	} {
+		if got := credentialArgs(test.creds); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAuthHint(t *testing.T) {
+	sock, hadSock := os.LookupEnv("SSH_AUTH_SOCK")
+	defer func() {
+		if hadSock {
+			os.Setenv("SSH_AUTH_SOCK", sock)
+		} else {
+			os.Unsetenv("SSH_AUTH_SOCK")
+		}
+	}()
+	for _, test := range []struct {
+		err  error
+		sock string
+		// want is a substring of the hint, empty if there is no hint.
+		want string
+	}{
+		{nil, "", ""},
+		{errors.New("fatal: not a git repository"), "", ""},
+		{errors.New("git@example.com: Permission denied (publickey)."), "", "No SSH agent"},
+		{errors.New("git@example.com: Permission denied (publickey)."), "/tmp/agent.sock", "ssh-add -l"},
+		{errors.New("Host key verification failed."), "", "SSH host key"},
+		{errors.New("fatal: could not read Username for 'https://example.com': terminal prompts disabled"), "", "No valid credentials"},
+		{errors.New("fatal: Authentication failed for 'https://example.com/repo'"), "", "No valid credentials"},
+	} {
+		if test.sock == "" {
+			os.Unsetenv("SSH_AUTH_SOCK")
+		} else {
+			os.Setenv("SSH_AUTH_SOCK", test.sock)
+		}
+		got := AuthHint(test.err)
+		if test.want == "" && got != "" || !strings.Contains(got, test.want) {
+			t.Errorf("AuthHint(%v) with SSH_AUTH_SOCK=%q: got %q, want a hint containing %q", test.err, test.sock, got, test.want)
+		}
+	}
+}
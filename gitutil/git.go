@@ -6,6 +6,7 @@ package gitutil
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -13,8 +14,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/envvar"
@@ -57,6 +60,7 @@ type Git struct {
 	rootDir   string
 	userName  string
 	userEmail string
+	timeout   time.Duration
 }
 
 type gitOpt interface {
@@ -68,11 +72,20 @@ type RootDirOpt string
 type UserNameOpt string
 type UserEmailOpt string
 
-func (AuthorDateOpt) gitOpt()    {}
-func (CommitterDateOpt) gitOpt() {}
-func (RootDirOpt) gitOpt()       {}
-func (UserNameOpt) gitOpt()      {}
-func (UserEmailOpt) gitOpt()     {}
+// TerminalPromptOpt set to false makes git fail instead of prompting for
+// credentials on the terminal.
+type TerminalPromptOpt bool
+
+// TimeoutOpt kills git commands which run longer than the given duration.
+type TimeoutOpt time.Duration
+
+func (AuthorDateOpt) gitOpt()     {}
+func (CommitterDateOpt) gitOpt()  {}
+func (RootDirOpt) gitOpt()        {}
+func (UserNameOpt) gitOpt()       {}
+func (UserEmailOpt) gitOpt()      {}
+func (TerminalPromptOpt) gitOpt() {}
+func (TimeoutOpt) gitOpt()        {}
 
 type Reference struct {
 	Name     string
@@ -98,6 +111,7 @@ func New(jirix *jiri.X, opts ...gitOpt) *Git {
 	rootDir := ""
 	userName := ""
 	userEmail := ""
+	var timeout time.Duration
 	env := map[string]string{}
 	for _, opt := range opts {
 		switch typedOpt := opt.(type) {
@@ -111,6 +125,12 @@ func New(jirix *jiri.X, opts ...gitOpt) *Git {
 			userName = string(typedOpt)
 		case UserEmailOpt:
 			userEmail = string(typedOpt)
+		case TerminalPromptOpt:
+			if !typedOpt {
+				env["GIT_TERMINAL_PROMPT"] = "0"
+			}
+		case TimeoutOpt:
+			timeout = time.Duration(typedOpt)
 		}
 	}
 	return &Git{
@@ -119,6 +139,7 @@ func New(jirix *jiri.X, opts ...gitOpt) *Git {
 		rootDir:   rootDir,
 		userName:  userName,
 		userEmail: userEmail,
+		timeout:   timeout,
 	}
 }
 
@@ -279,6 +300,10 @@ func (g *Git) Clone(repo, path string, opts ...CloneOpt) error {
 			if typedOpt {
 				args = append(args, []string{"--shared", "--local"}...)
 			}
+		case DissociateOpt:
+			if typedOpt {
+				args = append(args, "--dissociate")
+			}
 		case NoCheckoutOpt:
 			if typedOpt {
 				args = append(args, "--no-checkout")
@@ -291,6 +316,10 @@ func (g *Git) Clone(repo, path string, opts ...CloneOpt) error {
 			if typedOpt {
 				args = append(args, "--filter=blob:none")
 			}
+		case FilterOpt:
+			if typedOpt != "" {
+				args = append(args, "--filter="+string(typedOpt))
+			}
 		}
 	}
 	args = append(args, repo)
@@ -392,6 +421,28 @@ func (g *Git) ExtraCommits(rev, base string) ([]string, error) {
 	return g.runOutput("rev-list", base+".."+rev)
 }
 
+// ObjectsSize returns the disk space, in bytes, used by the loose and packed
+// objects of the repository.
+func (g *Git) ObjectsSize() (int64, error) {
+	out, err := g.runOutput("count-objects", "-v")
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, line := range out {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || (parts[0] != "size" && parts[0] != "size-pack") {
+			continue
+		}
+		kib, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("ParseInt(%v) failed: %v", parts[1], err)
+		}
+		size += kib * 1024
+	}
+	return size, nil
+}
+
 // CountCommits returns the number of commits on <branch> that are not
 // on <base>.
 func (g *Git) CountCommits(branch, base string) (int, error) {
@@ -461,6 +512,29 @@ func (g *Git) LsRemote(args ...string) (string, error) {
 	return out[0], nil
 }
 
+// LsRemoteHeads returns the revisions of the given branches in a remote
+// repository, keyed by branch name, using a single "git ls-remote" call.
+// Branches that do not exist in the remote are omitted.
+func (g *Git) LsRemoteHeads(remote string, branches ...string) (map[string]string, error) {
+	args := []string{"ls-remote", "--heads", remote}
+	for _, b := range branches {
+		args = append(args, "refs/heads/"+b)
+	}
+	out, err := g.runOutput(args...)
+	if err != nil {
+		return nil, err
+	}
+	heads := make(map[string]string)
+	for _, line := range out {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "refs/heads/") {
+			return nil, fmt.Errorf("git ls-remote %s: unexpected output %q", remote, line)
+		}
+		heads[strings.TrimPrefix(fields[1], "refs/heads/")] = fields[0]
+	}
+	return heads, nil
+}
+
 // CreateBranchWithUpstream creates a new branch and sets the upstream
 // repository to the given upstream.
 func (g *Git) CreateBranchWithUpstream(branch, upstream string) error {
@@ -654,6 +728,7 @@ func (g *Git) FetchRefspec(remote, refspec string, opts ...FetchOpt) error {
 	all := false
 	prune := false
 	updateShallow := false
+	unshallow := false
 	depth := 0
 	fetchTag := ""
 	for _, opt := range opts {
@@ -668,6 +743,8 @@ func (g *Git) FetchRefspec(remote, refspec string, opts ...FetchOpt) error {
 			depth = int(typedOpt)
 		case UpdateShallowOpt:
 			updateShallow = bool(typedOpt)
+		case UnshallowOpt:
+			unshallow = bool(typedOpt)
 		case FetchTagOpt:
 			fetchTag = string(typedOpt)
 		}
@@ -686,6 +763,9 @@ func (g *Git) FetchRefspec(remote, refspec string, opts ...FetchOpt) error {
 	if updateShallow {
 		args = append(args, "--update-shallow")
 	}
+	if unshallow {
+		args = append(args, "--unshallow")
+	}
 	if all {
 		args = append(args, "--all")
 	}
@@ -859,6 +939,53 @@ func (g *Git) ShortStatus() (string, error) {
 	return strings.Join(out, "\n"), nil
 }
 
+// SubmoduleUpdate syncs submodule urls from .gitmodules, then initializes and
+// checks out the submodules at the commits recorded in the superproject.
+func (g *Git) SubmoduleUpdate(recursive bool) error {
+	syncArgs := []string{"submodule", "sync"}
+	updateArgs := []string{"submodule", "update", "--init"}
+	if recursive {
+		syncArgs = append(syncArgs, "--recursive")
+		updateArgs = append(updateArgs, "--recursive")
+	}
+	if err := g.run(syncArgs...); err != nil {
+		return err
+	}
+	return g.run(updateArgs...)
+}
+
+// SubmoduleStatus returns the lines of "git submodule status" for submodules
+// that are not initialized, not at the recorded commit or have merge
+// conflicts.
+func (g *Git) SubmoduleStatus(recursive bool) ([]string, error) {
+	args := []string{"submodule", "status"}
+	if recursive {
+		args = append(args, "--recursive")
+	}
+	out, err := g.runOutput(args...)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, line := range out {
+		if line != "" && strings.ContainsRune("+-U", rune(line[0])) {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+// SparseCheckoutSet restricts the working tree to the given directories.
+func (g *Git) SparseCheckoutSet(dirs []string) error {
+	args := append([]string{"sparse-checkout", "set", "--"}, dirs...)
+	return g.run(args...)
+}
+
+// SparseCheckoutDisable restores the full working tree.
+func (g *Git) SparseCheckoutDisable() error {
+	return g.run("sparse-checkout", "disable")
+}
+
 func (g *Git) CommitMsg(ref string) (string, error) {
 	out, err := g.runOutput("log", "-n", "1", "--format=format:%B", ref)
 	if err != nil {
@@ -898,6 +1025,31 @@ func (g *Git) Log(branch, base, format string) ([][]string, error) {
 	return result, nil
 }
 
+// ShortLog returns the abbreviated hash and subject of at most max
+// commits reachable from <to> but not from <from>, newest first.
+func (g *Git) ShortLog(from, to string, max uint) ([]string, error) {
+	return g.runOutput("log", "--format=%h %s", "-n", strconv.FormatUint(uint64(max), 10), from+".."+to)
+}
+
+// Authors returns the sorted, distinct names of the authors of the commits
+// in <from>..<to>.
+func (g *Git) Authors(from, to string) ([]string, error) {
+	out, err := g.runOutput("log", "--format=%an", from+".."+to)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var authors []string
+	for _, author := range out {
+		if !seen[author] {
+			seen[author] = true
+			authors = append(authors, author)
+		}
+	}
+	sort.Strings(authors)
+	return authors, nil
+}
+
 // Merge merges all commits from <branch> to the current branch. If
 // <squash> is set, then all merged commits are squashed into a single
 // commit.
@@ -1079,6 +1231,20 @@ func (g *Git) ConfigGetKey(key string) (string, error) {
 	return out[0], nil
 }
 
+// ConfigGetAll returns the values of the config variable key in the local
+// config of the repository, or nil if it is not set.
+func (g *Git) ConfigGetAll(key string) ([]string, error) {
+	out, err := g.runOutput("config", "--local", "--get-all", key)
+	if err != nil {
+		// git config exits with an error but no message when key is not set.
+		if ge, ok := err.(GitError); ok && ge.Output == "" && ge.ErrorOutput == "" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
 // RemoteUrl gets the url of the remote with the given name.
 func (g *Git) RemoteUrl(name string) (string, error) {
 	configKey := fmt.Sprintf("remote.%s.url", name)
@@ -1259,31 +1425,123 @@ func (g *Git) runInteractive(args ...string) error {
 	return nil
 }
 
+// readOnlyCommands are the git commands which do not modify the repository,
+// whatever their arguments.
+var readOnlyCommands = map[string]bool{
+	"blame":        true,
+	"cat-file":     true,
+	"check-ignore": true,
+	"describe":     true,
+	"diff":         true,
+	"for-each-ref": true,
+	"grep":         true,
+	"log":          true,
+	"ls-files":     true,
+	"ls-remote":    true,
+	"ls-tree":      true,
+	"merge-base":   true,
+	"name-rev":     true,
+	"rev-list":     true,
+	"rev-parse":    true,
+	"shortlog":     true,
+	"show":         true,
+	"show-ref":     true,
+	"status":       true,
+	"version":      true,
+}
+
+// readOnlyCommand returns true if the git command args does not modify the
+// repository, which is all that may run in -no-write mode.
+func readOnlyCommand(args []string) bool {
+	for len(args) != 0 && strings.HasPrefix(args[0], "-") {
+		// Skip the options of git itself, e.g. "--no-pager" or "-c k=v".
+		if args[0] == "-c" || args[0] == "-C" {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return true
+	}
+	var flags, operands []string
+	for _, arg := range args[1:] {
+		if strings.HasPrefix(arg, "-") {
+			flags = append(flags, arg)
+		} else {
+			operands = append(operands, arg)
+		}
+	}
+	hasFlag := func(names ...string) bool {
+		for _, f := range flags {
+			for _, name := range names {
+				if f == name || strings.HasPrefix(f, name+"=") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch args[0] {
+	case "branch":
+		if hasFlag("-d", "-D", "--delete", "-m", "-M", "--move", "-c", "-C", "--copy", "-u", "--set-upstream-to", "--unset-upstream", "--edit-description", "-f", "--force") {
+			return false
+		}
+		return len(operands) == 0 || hasFlag("-l", "--list", "-a", "--all", "-r", "--remotes", "--contains", "--no-contains", "--merged", "--no-merged", "--points-at", "--show-current")
+	case "config":
+		return hasFlag("--get", "--get-all", "--get-regexp", "-l", "--list") || (len(flags) == 0 && len(operands) == 1)
+	case "remote":
+		return len(operands) == 0 || operands[0] == "get-url" || operands[0] == "show"
+	case "stash", "submodule", "worktree":
+		return len(operands) != 0 && (operands[0] == "list" || operands[0] == "show" || operands[0] == "status")
+	case "symbolic-ref":
+		return len(operands) == 1 && !hasFlag("-d", "--delete")
+	}
+	return readOnlyCommands[args[0]]
+}
+
 func (g *Git) runGit(stdout, stderr io.Writer, args ...string) error {
+	dir := g.rootDir
+	if dir == "" {
+		if cwd, err := os.Getwd(); err == nil {
+			dir = cwd
+		} else {
+			// ignore error
+		}
+	}
+	if g.jirix.NoWrite && !readOnlyCommand(args) {
+		if err := g.jirix.CheckWrite(dir, "run 'git "+strings.Join(args, " ")+"'"); err != nil {
+			return err
+		}
+	}
 	if g.userName != "" {
 		args = append([]string{"-c", fmt.Sprintf("user.name=%s", g.userName)}, args...)
 	}
 	if g.userEmail != "" {
 		args = append([]string{"-c", fmt.Sprintf("user.email=%s", g.userEmail)}, args...)
 	}
+	if len(g.jirix.Credentials) != 0 {
+		args = append(credentialArgs(g.jirix.Credentials), args...)
+	}
 	var outbuf bytes.Buffer
 	var errbuf bytes.Buffer
-	command := exec.Command("git", args...)
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	command := exec.CommandContext(ctx, "git", args...)
 	command.Dir = g.rootDir
 	command.Stdin = os.Stdin
 	command.Stdout = io.MultiWriter(stdout, &outbuf)
 	command.Stderr = io.MultiWriter(stderr, &errbuf)
 	env := g.jirix.Env()
 	env = envvar.MergeMaps(g.opts, env)
-	command.Env = envvar.MapToSlice(env)
-	dir := g.rootDir
-	if dir == "" {
-		if cwd, err := os.Getwd(); err == nil {
-			dir = cwd
-		} else {
-			// ignore error
-		}
+	if g.jirix.NoWrite {
+		// Keep "git status" from refreshing the index.
+		env["GIT_OPTIONAL_LOCKS"] = "0"
 	}
+	command.Env = envvar.MapToSlice(env)
 	g.jirix.Logger.Tracef("Run: git %s (%s)", strings.Join(args, " "), dir)
 	err := command.Run()
 	exitCode := 0
@@ -1293,6 +1551,9 @@ func (g *Git) runGit(stdout, stderr io.Writer, args ...string) error {
 		}
 	}
 	g.jirix.Logger.Tracef("Finished: git %s (%s), \nstdout: %s\nstderr: %s\nexit code: %v\n", strings.Join(args, " "), dir, outbuf.String(), errbuf.String(), exitCode)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", g.timeout)
+	}
 	return err
 }
 
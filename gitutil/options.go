@@ -97,6 +97,10 @@ type UpdateShallowOpt bool
 
 func (UpdateShallowOpt) fetchOpt() {}
 
+type UnshallowOpt bool
+
+func (UnshallowOpt) fetchOpt() {}
+
 type VerifyOpt bool
 
 func (VerifyOpt) pushOpt() {}
@@ -109,6 +113,10 @@ type ReferenceOpt string
 
 func (ReferenceOpt) cloneOpt() {}
 
+type DissociateOpt bool
+
+func (DissociateOpt) cloneOpt() {}
+
 type NoCheckoutOpt bool
 
 func (NoCheckoutOpt) cloneOpt() {}
@@ -123,6 +131,11 @@ type OmitBlobsOpt bool
 
 func (OmitBlobsOpt) cloneOpt() {}
 
+// FilterOpt is a partial clone filter spec such as "blob:none" or "tree:0".
+type FilterOpt string
+
+func (FilterOpt) cloneOpt() {}
+
 type RebaseMerges bool
 
 func (RebaseMerges) rebaseOpt() {}
@@ -7,11 +7,13 @@ package log
 import (
 	"bytes"
 	"container/list"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	glog "log"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -58,6 +60,7 @@ type Logger struct {
 	timeLogThreshold     time.Duration
 	tasks                *list.List
 	logBuffer            *bytes.Buffer
+	format               LogFormat
 }
 
 type LogLevel int
@@ -71,6 +74,51 @@ const (
 	TraceLevel
 )
 
+func (l LogLevel) String() string {
+	switch l {
+	case ErrorLevel:
+		return "error"
+	case WarningLevel:
+		return "warning"
+	case InfoLevel:
+		return "info"
+	case DebugLevel:
+		return "debug"
+	case TraceLevel:
+		return "trace"
+	}
+	return "none"
+}
+
+// LogFormat is the format log entries are written in.
+type LogFormat int
+
+const (
+	// TextFormat writes timestamped, human readable lines.
+	TextFormat LogFormat = iota
+	// JSONFormat writes one JSON object per entry with "time", "level"
+	// and "msg" fields.
+	JSONFormat
+)
+
+// ParseLogFormat returns the LogFormat named by s, which should be
+// "text" or "json".
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch s {
+	case "text":
+		return TextFormat, nil
+	case "json":
+		return JSONFormat, nil
+	}
+	return TextFormat, fmt.Errorf("invalid log format %q, should be text or json", s)
+}
+
+type jsonEntry struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
 func NewLogger(loggerLevel LogLevel, color color.Color, enableProgress bool, progressWindowSize uint, timeLogThreshold time.Duration, outWriter, errWriter io.Writer) *Logger {
 	var logBuffer bytes.Buffer
 	if outWriter == nil {
@@ -116,6 +164,17 @@ func NewLogger(loggerLevel LogLevel, color color.Color, enableProgress bool, pro
 	return l
 }
 
+// SetFormat changes the format of subsequent log entries. Progress
+// messages are disabled for JSONFormat as they would corrupt the stream.
+func (l *Logger) SetFormat(format LogFormat) {
+	if format == JSONFormat {
+		l.DisableProgress()
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.format = format
+}
+
 func (l *Logger) IsProgressEnabled() bool {
 	return atomic.LoadUint32(&l.enableProgress) == 1
 }
@@ -207,19 +266,36 @@ func (l *Logger) clearProgress() {
 	l.progressLines = 0
 }
 
-func (l *Logger) log(prefix, format string, a ...interface{}) {
+// This is thread unsafe
+func (l *Logger) formatEntry(level LogLevel, prefix, format string, a ...interface{}) string {
+	now := time.Now()
+	msg := fmt.Sprintf(format, a...)
+	if l.format == JSONFormat {
+		b, err := json.Marshal(jsonEntry{
+			Time:  now.Format(time.RFC3339Nano),
+			Level: level.String(),
+			Msg:   strings.TrimRight(msg, "\n"),
+		})
+		if err != nil {
+			// Marshalling a struct of strings cannot fail.
+			panic(err)
+		}
+		return string(b)
+	}
+	return fmt.Sprintf("[%s] %s%s", now.Format("15:04:05.000"), prefix, msg)
+}
+
+func (l *Logger) log(level LogLevel, prefix, format string, a ...interface{}) {
 	l.lock.Lock()
-	stamp := time.Now().Format("15:04:05.000")
 	defer l.lock.Unlock()
 	l.clearProgress()
-	l.goLogger.Printf("[%s] %s%s", stamp, prefix, fmt.Sprintf(format, a...))
+	l.goLogger.Print(l.formatEntry(level, prefix, format, a...))
 }
 
-func (l *Logger) logToBufferOnly(prefix, format string, a ...interface{}) {
+func (l *Logger) logToBufferOnly(level LogLevel, prefix, format string, a ...interface{}) {
 	l.lock.Lock()
-	stamp := time.Now().Format("15:04:05.000")
 	defer l.lock.Unlock()
-	l.goBufferLogger.Printf("[%s] %s%s", stamp, prefix, fmt.Sprintf(format, a...))
+	l.goBufferLogger.Print(l.formatEntry(level, prefix, format, a...))
 }
 
 func (l *Logger) Logf(loglevel LogLevel, format string, a ...interface{}) {
@@ -241,33 +317,33 @@ func (l *Logger) Logf(loglevel LogLevel, format string, a ...interface{}) {
 
 func (l *Logger) Infof(format string, a ...interface{}) {
 	if l.LoggerLevel >= InfoLevel {
-		l.log("", format, a...)
+		l.log(InfoLevel, "", format, a...)
 	} else {
-		l.logToBufferOnly("", format, a...)
+		l.logToBufferOnly(InfoLevel, "", format, a...)
 	}
 }
 
 func (l *Logger) Debugf(format string, a ...interface{}) {
 	if l.LoggerLevel >= DebugLevel {
-		l.log(l.color.Cyan("DEBUG: "), format, a...)
+		l.log(DebugLevel, l.color.Cyan("DEBUG: "), format, a...)
 	} else {
-		l.logToBufferOnly(l.color.Cyan("DEBUG: "), format, a...)
+		l.logToBufferOnly(DebugLevel, l.color.Cyan("DEBUG: "), format, a...)
 	}
 }
 
 func (l *Logger) Tracef(format string, a ...interface{}) {
 	if l.LoggerLevel >= TraceLevel {
-		l.log(l.color.Blue("TRACE: "), format, a...)
+		l.log(TraceLevel, l.color.Blue("TRACE: "), format, a...)
 	} else {
-		l.logToBufferOnly(l.color.Blue("TRACE: "), format, a...)
+		l.logToBufferOnly(TraceLevel, l.color.Blue("TRACE: "), format, a...)
 	}
 }
 
 func (l *Logger) Warningf(format string, a ...interface{}) {
 	if l.LoggerLevel >= WarningLevel {
-		l.log(l.color.Yellow("WARN: "), format, a...)
+		l.log(WarningLevel, l.color.Yellow("WARN: "), format, a...)
 	} else {
-		l.logToBufferOnly(l.color.Yellow("WARN: "), format, a...)
+		l.logToBufferOnly(WarningLevel, l.color.Yellow("WARN: "), format, a...)
 	}
 }
 
@@ -276,9 +352,13 @@ func (l *Logger) Errorf(format string, a ...interface{}) {
 		l.lock.Lock()
 		defer l.lock.Unlock()
 		l.clearProgress()
-		l.goErrorLogger.Printf("%s%s", l.color.Red("ERROR: "), fmt.Sprintf(format, a...))
+		if l.format == JSONFormat {
+			l.goErrorLogger.Print(l.formatEntry(ErrorLevel, "", format, a...))
+		} else {
+			l.goErrorLogger.Printf("%s%s", l.color.Red("ERROR: "), fmt.Sprintf(format, a...))
+		}
 	} else {
-		l.logToBufferOnly(l.color.Red("ERROR: "), format, a...)
+		l.logToBufferOnly(ErrorLevel, l.color.Red("ERROR: "), format, a...)
 	}
 }
 
@@ -0,0 +1,61 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btwiuse/jiri/color"
+)
+
+// Tests that JSONFormat writes one parsable entry per log call.
+func TestJSONFormat(t *testing.T) {
+	t.Parallel()
+	out, errOut := bytes.NewBufferString(""), bytes.NewBufferString("")
+	logger := NewLogger(DebugLevel, color.NewColor(color.ColorNever), false, 0, 0, out, errOut)
+	logger.SetFormat(JSONFormat)
+	logger.Infof("info %d\n\n", 1)
+	logger.Debugf("debug %q", "quoted")
+	logger.Errorf("error\n")
+
+	var entries []jsonEntry
+	for _, line := range strings.Split(strings.TrimSpace(out.String()+errOut.String()), "\n") {
+		var e jsonEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("cannot parse %q: %s", line, err)
+		}
+		entries = append(entries, e)
+	}
+	want := []jsonEntry{
+		{Level: "info", Msg: "info 1"},
+		{Level: "debug", Msg: `debug "quoted"`},
+		{Level: "error", Msg: "error"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %v", len(entries), len(want), entries)
+	}
+	for i, e := range entries {
+		if e.Time == "" {
+			t.Errorf("entry %d has no time", i)
+		}
+		if e.Level != want[i].Level || e.Msg != want[i].Msg {
+			t.Errorf("entry %d: got %s/%q, want %s/%q", i, e.Level, e.Msg, want[i].Level, want[i].Msg)
+		}
+	}
+}
+
+// Tests that ParseLogFormat rejects unknown formats.
+func TestParseLogFormat(t *testing.T) {
+	t.Parallel()
+	if f, err := ParseLogFormat("json"); err != nil || f != JSONFormat {
+		t.Errorf("ParseLogFormat(json) = %v, %v", f, err)
+	}
+	if _, err := ParseLogFormat("xml"); err == nil {
+		t.Errorf("ParseLogFormat(xml) should fail")
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics records where the time of jiri commands goes, on the local
+// machine only, and reports it.
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/btwiuse/jiri/timing"
+)
+
+// MaxRuns is the number of runs kept by Write.
+const MaxRuns = 100
+
+// Phase is the time spent in one phase of a run, e.g. "fetch local projects",
+// or on one project in a phase, e.g. fetching one project.
+type Phase struct {
+	Name     string        `json:"name"`
+	Depth    int           `json:"depth,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Run is the record of one jiri command.
+type Run struct {
+	Command  string        `json:"command"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Failed   bool          `json:"failed,omitempty"`
+	// Phases are the intervals of the command timer, in depth-first order.
+	Phases []Phase `json:"phases"`
+	// Projects maps phases run once per project, e.g. "fetch", to the time
+	// spent on each project.
+	Projects map[string][]Phase `json:"projects,omitempty"`
+}
+
+// Recorder collects the time spent on each project by phases which run
+// projects concurrently, and so cannot use the command timer. A nil Recorder
+// records nothing.
+type Recorder struct {
+	mu       sync.Mutex
+	projects map[string][]Phase
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{projects: make(map[string][]Phase)}
+}
+
+// Add records that the given phase took d for project.
+func (r *Recorder) Add(phase, project string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.projects[phase] = append(r.projects[phase], Phase{Name: project, Duration: d})
+}
+
+// Run returns the record of command, with the phases of timer and the project
+// times recorded so far. Intervals of timer which are still open end now.
+func (r *Recorder) Run(command string, timer *timing.Timer, failed bool) Run {
+	run := Run{
+		Command: command,
+		Start:   time.Now(),
+		Failed:  failed,
+	}
+	if timer != nil {
+		run.Start = timer.Zero
+		now := timer.Now()
+		for _, i := range timer.Intervals[1:] {
+			end := i.End
+			if end == timing.InvalidDuration {
+				end = now
+			}
+			run.Phases = append(run.Phases, Phase{Name: i.Name, Depth: i.Depth - 1, Duration: end - i.Start})
+		}
+		run.Duration = now
+	}
+	if r != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		run.Projects = make(map[string][]Phase)
+		for phase, projects := range r.projects {
+			run.Projects[phase] = append([]Phase(nil), projects...)
+		}
+	}
+	return run
+}
+
+// Write saves run in dir, and removes the oldest runs if there are more than
+// MaxRuns.
+func Write(dir string, run Run) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json", run.Start.UTC().Format("20060102T150405.000000000"), run.Command)
+	if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+		return err
+	}
+	files, err := runFiles(dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > MaxRuns {
+		if err := os.Remove(filepath.Join(dir, files[0])); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// runFiles returns the names of the run files in dir, oldest first.
+func runFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
+			files = append(files, info.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Read returns the last n runs of command saved in dir, oldest first.
+func Read(dir, command string, n int) ([]Run, error) {
+	files, err := runFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var runs []Run
+	for i := len(files) - 1; i >= 0 && len(runs) < n; i-- {
+		data, err := ioutil.ReadFile(filepath.Join(dir, files[i]))
+		if err != nil {
+			return nil, err
+		}
+		var run Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			return nil, fmt.Errorf("invalid metrics file %s: %v", files[i], err)
+		}
+		if run.Command == command {
+			runs = append([]Run{run}, runs...)
+		}
+	}
+	return runs, nil
+}
+
+// Report writes a summary of runs to w: their durations, the average time
+// spent in each phase and the projects that took the longest in each phase
+// run per project, at most top of them.
+func Report(w io.Writer, runs []Run, top int) error {
+	if len(runs) == 0 {
+		_, err := fmt.Fprintln(w, "No runs recorded")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Last %d run(s) of %q:\n", len(runs), runs[0].Command)
+	for _, run := range runs {
+		status := ""
+		if run.Failed {
+			status = "failed"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", run.Start.Local().Format("2006-01-02 15:04:05"), round(run.Duration), status)
+	}
+
+	// Average phases over the runs, keeping the order of their first
+	// appearance. Repeated phases are summed up within a run.
+	type key struct {
+		name  string
+		depth int
+	}
+	var order []key
+	totals := make(map[key]time.Duration)
+	for _, run := range runs {
+		for _, p := range run.Phases {
+			k := key{p.Name, p.Depth}
+			if _, ok := totals[k]; !ok {
+				order = append(order, k)
+			}
+			totals[k] += p.Duration
+		}
+	}
+	fmt.Fprintf(tw, "\nAverage time per phase:\n")
+	for _, k := range order {
+		fmt.Fprintf(tw, "  %s%s\t%s\n", strings.Repeat("  ", k.depth), k.name, round(totals[k]/time.Duration(len(runs))))
+	}
+
+	projectTotals := make(map[string]map[string]time.Duration)
+	for _, run := range runs {
+		for phase, projects := range run.Projects {
+			if projectTotals[phase] == nil {
+				projectTotals[phase] = make(map[string]time.Duration)
+			}
+			for _, p := range projects {
+				projectTotals[phase][p.Name] += p.Duration
+			}
+		}
+	}
+	var phases []string
+	for phase := range projectTotals {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		var names []string
+		for name := range projectTotals[phase] {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			ti, tj := projectTotals[phase][names[i]], projectTotals[phase][names[j]]
+			if ti != tj {
+				return ti > tj
+			}
+			return names[i] < names[j]
+		})
+		if len(names) > top {
+			names = names[:top]
+		}
+		fmt.Fprintf(tw, "\nSlowest projects to %s, average per run:\n", phase)
+		for _, name := range names {
+			fmt.Fprintf(tw, "  %s\t%s\n", name, round(projectTotals[phase][name]/time.Duration(len(runs))))
+		}
+	}
+	return tw.Flush()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btwiuse/jiri/timing"
+)
+
+func TestWriteReadReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < MaxRuns+2; i++ {
+		timer := timing.NewTimer("jiri")
+		timer.Zero = start.Add(time.Duration(i) * time.Hour)
+		timer.Intervals = append(timer.Intervals,
+			timing.Interval{Name: "fetch local projects", Depth: 1, Start: 0, End: time.Second},
+			timing.Interval{Name: "update projects", Depth: 1, Start: time.Second, End: 3 * time.Second})
+		r := NewRecorder()
+		r.Add("fetch", "slow", 900*time.Millisecond)
+		r.Add("fetch", "fast", 100*time.Millisecond)
+		if err := Write(dir, r.Run("update", timer, false)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Write(dir, (*Recorder)(nil).Run("status", nil, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := runFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != MaxRuns {
+		t.Errorf("got %d runs, want %d", len(files), MaxRuns)
+	}
+
+	runs, err := Read(dir, "update", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("got %d runs, want 3", len(runs))
+	}
+	if got, want := runs[2].Start, start.Add((MaxRuns+1)*time.Hour); !got.Equal(want) {
+		t.Errorf("last run started at %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := Report(&buf, runs, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Last 3 run(s) of \"update\"",
+		"fetch local projects  1s",
+		"update projects       2s",
+		"Slowest projects to fetch, average per run:\n  slow  900ms\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "fast") {
+		t.Errorf("report lists more than 1 project:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jiri
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// NoWriteError is the error of an operation refused because it would modify
+// the jiri root in -no-write mode.
+type NoWriteError struct {
+	// Op describes the refused operation.
+	Op   string
+	Path string
+}
+
+func (e *NoWriteError) Error() string {
+	return fmt.Sprintf("cannot %s in %s: jiri is running in -no-write mode", e.Op, e.Path)
+}
+
+// CheckWrite returns a *NoWriteError if jirix is in -no-write mode and path is
+// in the jiri root or in the cache, which are the directories -no-write mode
+// protects. op describes the operation which would modify path, for the
+// error.
+func (jirix *X) CheckWrite(path, op string) error {
+	if !jirix.NoWrite {
+		return nil
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return &NoWriteError{Op: op, Path: path}
+	}
+	for _, dir := range []string{jirix.Root, jirix.Cache} {
+		if dir == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return &NoWriteError{Op: op, Path: path}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+// +build !darwin
+
+package osutil
+
+import "fmt"
+
+func FreeDiskSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("not supported on this platform")
+}
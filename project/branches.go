@@ -0,0 +1,99 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/btwiuse/jiri"
+)
+
+// readBranchProjects reads jirix.BranchesFile(), which maps each branch
+// created by "jiri branch -create" to the keys of the projects it was created
+// in.
+func readBranchProjects(jirix *jiri.X) (map[string]ProjectKeys, error) {
+	branches := make(map[string]ProjectKeys)
+	data, err := ioutil.ReadFile(jirix.BranchesFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return branches, nil
+		}
+		return nil, fmtError(err)
+	}
+	if err := json.Unmarshal(data, &branches); err != nil {
+		return nil, fmtError(err)
+	}
+	return branches, nil
+}
+
+func writeBranchProjects(jirix *jiri.X, branches map[string]ProjectKeys) error {
+	data, err := json.MarshalIndent(branches, "", "  ")
+	if err != nil {
+		return fmtError(err)
+	}
+	return safeWriteFile(jirix, jirix.BranchesFile(), data)
+}
+
+// BranchProjects returns the keys of the projects branch was created in by
+// "jiri branch -create", or nil if the branch is not tracked.
+func BranchProjects(jirix *jiri.X, branch string) (ProjectKeys, error) {
+	branches, err := readBranchProjects(jirix)
+	if err != nil {
+		return nil, err
+	}
+	return branches[branch], nil
+}
+
+// AddBranchProjects records that branch exists in the given projects, in
+// addition to the ones already recorded.
+func AddBranchProjects(jirix *jiri.X, branch string, keys ProjectKeys) error {
+	branches, err := readBranchProjects(jirix)
+	if err != nil {
+		return err
+	}
+	seen := make(map[ProjectKey]bool)
+	for _, key := range branches[branch] {
+		seen[key] = true
+	}
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			branches[branch] = append(branches[branch], key)
+		}
+	}
+	sort.Sort(branches[branch])
+	return writeBranchProjects(jirix, branches)
+}
+
+// RemoveBranchProjects stops tracking branch in the given projects. The
+// branch is forgotten once no project is left.
+func RemoveBranchProjects(jirix *jiri.X, branch string, keys ProjectKeys) error {
+	branches, err := readBranchProjects(jirix)
+	if err != nil {
+		return err
+	}
+	if _, ok := branches[branch]; !ok {
+		return nil
+	}
+	remove := make(map[ProjectKey]bool)
+	for _, key := range keys {
+		remove[key] = true
+	}
+	var left ProjectKeys
+	for _, key := range branches[branch] {
+		if !remove[key] {
+			left = append(left, key)
+		}
+	}
+	if len(left) == 0 {
+		delete(branches, branch)
+	} else {
+		branches[branch] = left
+	}
+	return writeBranchProjects(jirix, branches)
+}
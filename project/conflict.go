@@ -0,0 +1,191 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/gitutil"
+)
+
+// Policies for local work that is in the way of an update. The policy of a
+// project is taken from its local config, or from jiri.X.OnConflict, unless
+// jiri.X.ForceOnConflict is set.
+const (
+	// ConflictFail reports the project as failed. This is the default.
+	ConflictFail = "fail"
+	// ConflictSkip leaves the project as it is.
+	ConflictSkip = "skip"
+	// ConflictStash stashes uncommitted changes and reapplies them after the
+	// update.
+	ConflictStash = "stash"
+	// ConflictBackup saves local work on a backup branch before updating.
+	ConflictBackup = "backup"
+	// ConflictRebase rebases local commits onto the new revision, and
+	// stashes and reapplies uncommitted changes.
+	ConflictRebase = "rebase"
+	// ConflictPrompt asks which of the policies above to use.
+	ConflictPrompt = "prompt"
+)
+
+var conflictPolicies = []string{ConflictFail, ConflictSkip, ConflictStash, ConflictBackup, ConflictRebase, ConflictPrompt}
+
+// ValidateConflictPolicy returns an error if policy is not empty and not one
+// of the Conflict* policies.
+func ValidateConflictPolicy(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	for _, p := range conflictPolicies {
+		if p == policy {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid conflict policy %q, must be one of %s", policy, strings.Join(conflictPolicies, ", "))
+}
+
+// conflictPolicy returns the policy to use for project, which problem
+// prevents from being updated. choices are the policies that can handle the
+// problem, the others fall back to ConflictFail.
+func conflictPolicy(jirix *jiri.X, project Project, relativePath, problem string, choices []string) string {
+	policy := project.LocalConfig.OnConflict
+	if policy == "" || jirix.ForceOnConflict {
+		policy = jirix.OnConflict
+	}
+	if policy == ConflictPrompt {
+		return promptConflictPolicy(jirix, project, relativePath, problem, choices)
+	}
+	for _, c := range choices {
+		if c == policy {
+			return policy
+		}
+	}
+	return ConflictFail
+}
+
+// promptConflictPolicy asks on jirix.Stdin() which of choices to use for
+// project. It returns ConflictFail if nothing can be read.
+func promptConflictPolicy(jirix *jiri.X, project Project, relativePath, problem string, choices []string) string {
+	jirix.Logger.DisableProgress()
+	fmt.Fprintf(jirix.Stdout(), "Project %s(%s) %s.\n", project.Name, relativePath, problem)
+	for {
+		fmt.Fprintf(jirix.Stdout(), "How should it be updated? [%s]: ", strings.Join(choices, "/"))
+		answer, err := readLine(jirix.Stdin())
+		answer = strings.TrimSpace(answer)
+		for _, c := range choices {
+			if c == answer || (answer != "" && strings.HasPrefix(c, answer)) {
+				return c
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(jirix.Stdout())
+			return ConflictFail
+		}
+	}
+}
+
+// readLine reads r up to the next newline. It reads one byte at a time so that
+// nothing after the line is consumed.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
+
+// backupBranchName returns the name of a new branch to save the local work
+// of branch on, or of a detached head if branch is empty.
+func backupBranchName(branch string) string {
+	if branch == "" {
+		branch = "detached"
+	}
+	return fmt.Sprintf("jiri-backup/%s-%s", branch, time.Now().Format("20060102-150405"))
+}
+
+// backupUncommittedChanges commits the uncommitted changes of project on a
+// new backup branch and goes back to the current branch, or revision if on a
+// detached head. It returns the name of the backup branch.
+func backupUncommittedChanges(jirix *jiri.X, project Project, branch string) (string, error) {
+	scm := gitutil.New(jirix, gitutil.RootDirOpt(project.Path))
+	revision, err := scm.CurrentRevision()
+	if err != nil {
+		return "", err
+	}
+	backup := backupBranchName(branch)
+	if err := scm.CreateAndCheckoutBranch(backup); err != nil {
+		return "", err
+	}
+	if err := scm.AddUpdatedFiles(); err != nil {
+		return "", err
+	}
+	if err := scm.CommitWithMessage("Uncommitted changes saved by jiri update"); err != nil {
+		return "", err
+	}
+	if branch == "" {
+		return backup, scm.CheckoutBranch(revision, gitutil.DetachOpt(true))
+	}
+	return backup, scm.CheckoutBranch(branch)
+}
+
+// resolveDivergedBranch applies the conflict policy of project to the
+// checked out branch, which cannot be fast-forwarded or rebased onto
+// tracking. canRebase tells whether the branch was only fast-forwarded, in
+// which case rebasing is offered.
+func resolveDivergedBranch(jirix *jiri.X, project Project, relativePath, branch, tracking string, canRebase bool) error {
+	choices := []string{ConflictFail, ConflictSkip, ConflictBackup}
+	if canRebase {
+		choices = append(choices, ConflictRebase)
+	}
+	problem := fmt.Sprintf("has local commits on branch %q which cannot be fast-forwarded to %q", branch, tracking)
+	msg := fmt.Sprintf("For project %s(%s), not able to fast forward your local branch %q to %q", project.Name, relativePath, branch, tracking)
+	if !canRebase {
+		msg = fmt.Sprintf("For project %s(%s), not able to rebase your local branch %q onto %q", project.Name, relativePath, branch, tracking)
+	}
+	switch conflictPolicy(jirix, project, relativePath, problem, choices) {
+	case ConflictSkip:
+		jirix.Logger.Warningf("For project %s(%s), not updating your local branch %q which has diverged from %q\n\n", project.Name, relativePath, branch, tracking)
+		return nil
+	case ConflictRebase:
+		rebaseSuccess, err := tryRebase(jirix, project, tracking)
+		if err != nil {
+			return err
+		}
+		if rebaseSuccess {
+			jirix.Logger.Debugf("For project %q, rebased your local branch %q on %q", project.Name, branch, tracking)
+			return nil
+		}
+		msg = fmt.Sprintf("For project %s(%s), not able to rebase your local branch %q onto %q", project.Name, relativePath, branch, tracking)
+	case ConflictBackup:
+		scm := gitutil.New(jirix, gitutil.RootDirOpt(project.Path))
+		backup := backupBranchName(branch)
+		if err := scm.CreateBranch(backup); err != nil {
+			return err
+		}
+		if err := scm.Reset(tracking); err != nil {
+			return err
+		}
+		jirix.Logger.Warningf("For project %s(%s), saved your local branch %q as %q and reset it to %q\n\n", project.Name, relativePath, branch, backup, tracking)
+		return nil
+	}
+	msg += "\nPlease do it manually, or update with -on-conflict=backup to save it on a backup branch"
+	msg += "\nor -on-conflict=skip to leave it as it is\n\n"
+	jirix.Logger.Errorf(msg)
+	jirix.IncrementFailures()
+	return nil
+}
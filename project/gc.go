@@ -0,0 +1,101 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/btwiuse/jiri"
+)
+
+// OrphanedProjects returns the local projects that are not part of the
+// manifest any more, taking the optional attributes and the view selected
+// for the workspace into account, like "jiri update" does.
+func OrphanedProjects(jirix *jiri.X) (Projects, error) {
+	localProjects, err := LocalProjects(jirix, FullScan)
+	if err != nil {
+		return nil, err
+	}
+	remoteProjects, _, pkgs, err := LoadManifestFile(jirix, jirix.JiriManifestFile(), localProjects, false /*localManifest*/)
+	if err != nil {
+		return nil, err
+	}
+	if err := FilterOptionalProjectsPackages(jirix, jirix.FetchingAttrs, remoteProjects, pkgs); err != nil {
+		return nil, err
+	}
+	if _, err := filterViewProjects(jirix, remoteProjects); err != nil {
+		return nil, err
+	}
+	MatchLocalWithRemote(localProjects, remoteProjects)
+	orphans := make(Projects)
+	for key, p := range localProjects {
+		if _, ok := remoteProjects[key]; !ok {
+			orphans[key] = p
+		}
+	}
+	return orphans, nil
+}
+
+// DeleteOrphanedProjects deletes the projects returned by OrphanedProjects.
+// Like "jiri update -gc", it keeps projects that contain other projects,
+// projects ignored by their local config and, unless forceDirty is true,
+// projects with branches or local changes. It returns the projects that were
+// deleted.
+func DeleteOrphanedProjects(jirix *jiri.X, orphans Projects, forceDirty bool) (Projects, error) {
+	if err := jirix.CheckWrite(jirix.Root, "delete projects"); err != nil {
+		return nil, err
+	}
+	localProjects, err := LocalProjects(jirix, FastScan)
+	if err != nil {
+		return nil, err
+	}
+	kept := NewPathTrie()
+	for key, p := range localProjects {
+		if _, ok := orphans[key]; !ok {
+			kept.Insert(p.Path)
+		}
+	}
+	var ops []deleteOperation
+	for _, p := range orphans {
+		ops = append(ops, deleteOperation{commonOperation{
+			project: p,
+			source:  p.Path,
+		}})
+	}
+	// Delete nested projects first.
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].source+string(filepath.Separator) > ops[j].source+string(filepath.Separator)
+	})
+
+	deleted := make(Projects)
+	for _, op := range ops {
+		if kept.Contains(op.source) {
+			jirix.Logger.Warningf("Project %q won't be deleted because of its sub project(s)\n\n", op.project.Name)
+			kept.Insert(op.source)
+			continue
+		}
+		if forceDirty && !op.project.LocalConfig.Ignore {
+			jirix.Logger.Debugf("%s", op)
+			if err := os.RemoveAll(op.source); err != nil {
+				return deleted, fmtError(err)
+			}
+			if err := removeEmptyParents(jirix, filepath.Dir(op.source)); err != nil {
+				return deleted, err
+			}
+		} else if err := op.Run(jirix); err != nil {
+			return deleted, err
+		}
+		if _, err := os.Stat(op.source); err == nil {
+			kept.Insert(op.source)
+		} else if os.IsNotExist(err) {
+			deleted[op.project.Key()] = op.project
+		} else {
+			return deleted, fmtError(err)
+		}
+	}
+	return deleted, nil
+}
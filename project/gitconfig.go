@@ -0,0 +1,158 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/gitutil"
+)
+
+// GitConfig is a <gitconfig> element of a project: a variable of the local
+// git config of the project, e.g. user.email or push.default, which jiri sets
+// when the project is cloned and sets again on every update.
+type GitConfig struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// checkGitConfigs returns an error if a gitconfig element of p does not name
+// a git config variable, which is a section and a key separated by a dot.
+func (p Project) checkGitConfigs() error {
+	for _, c := range p.GitConfigs {
+		if i := strings.Index(c.Name, "."); i <= 0 || i == len(c.Name)-1 {
+			return fmt.Errorf("project %q has invalid gitconfig name %q, it should be a section and a key separated by a dot", p.Name, c.Name)
+		}
+	}
+	return nil
+}
+
+// gitConfigDrift returns how the value of the git config variable c differs
+// in the repository of scm from the value of c, or an empty string if it
+// does not.
+func gitConfigDrift(scm *gitutil.Git, c GitConfig) (string, error) {
+	values, err := scm.ConfigGetAll(c.Name)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(values) == 0:
+		return "not set", nil
+	case len(values) != 1 || values[0] != c.Value:
+		return fmt.Sprintf("set to %q instead of %q", strings.Join(values, ","), c.Value), nil
+	}
+	return "", nil
+}
+
+// applyGitConfigs sets the git config variables of the gitconfig elements of
+// projects which differ in their repositories. Variables of elements which
+// are removed from the manifest are left as they are.
+func applyGitConfigs(jirix *jiri.X, projects Projects) error {
+	jirix.TimerPush("apply gitconfigs")
+	defer jirix.TimerPop()
+	multiErr := make(MultiError, 0)
+	for _, p := range projects {
+		if len(p.GitConfigs) == 0 || p.LocalConfig.Ignore || p.LocalConfig.NoUpdate {
+			continue
+		}
+		if err := jirix.CheckWrite(p.Path, "set git config"); err != nil {
+			return err
+		}
+		scm := gitutil.New(jirix, gitutil.RootDirOpt(p.Path))
+		for _, c := range p.GitConfigs {
+			drift, err := gitConfigDrift(scm, c)
+			if err == nil && drift != "" {
+				jirix.Logger.Debugf("setting git config %s of project %q", c.Name, p.Name)
+				err = scm.Config("--local", "--replace-all", c.Name, c.Value)
+			}
+			if err != nil {
+				multiErr = append(multiErr, fmt.Errorf("setting git config %s of project %q failed: %v", c.Name, p.Name, err))
+			}
+		}
+	}
+	if len(multiErr) != 0 {
+		return multiErr
+	}
+	return nil
+}
+
+// gitHooksDrift returns the git hooks jiri installs in the repository of p
+// which are missing or were modified since, each with a description of how it
+// changed.
+func gitHooksDrift(jirix *jiri.X, p Project) ([]string, error) {
+	hooksDir := filepath.Join(p.Path, ".git", "hooks")
+	var drifts []string
+	if p.GerritHost != "" && !jirix.RewriteSsoToHttps {
+		// The content of the commit-msg hook is only known to gerrit.
+		if _, err := os.Stat(filepath.Join(hooksDir, "commit-msg")); os.IsNotExist(err) {
+			drifts = append(drifts, "hook commit-msg: missing")
+		} else if err != nil {
+			return nil, fmtError(err)
+		}
+	}
+	if p.GitHooks == "" {
+		return drifts, nil
+	}
+	err := filepath.Walk(p.GitHooks, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(p.GitHooks, path)
+		if err != nil {
+			return err
+		}
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		got, err := ioutil.ReadFile(filepath.Join(hooksDir, relPath))
+		if os.IsNotExist(err) {
+			drifts = append(drifts, fmt.Sprintf("hook %s: missing", relPath))
+		} else if err != nil {
+			return err
+		} else if !bytes.Equal(got, want) {
+			drifts = append(drifts, fmt.Sprintf("hook %s: modified", relPath))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmtError(err)
+	}
+	return drifts, nil
+}
+
+// GitConfigDrift returns the git config variables of the gitconfig elements
+// of p, and the git hooks jiri installs for p, which differ in the repository
+// of p from what "jiri update" sets, each with a description of how it
+// differs. Hooks are not checked if jiri does not update them.
+func GitConfigDrift(jirix *jiri.X, p Project) ([]string, error) {
+	var drifts []string
+	scm := gitutil.New(jirix, gitutil.RootDirOpt(p.Path))
+	for _, c := range p.GitConfigs {
+		drift, err := gitConfigDrift(scm, c)
+		if err != nil {
+			return nil, err
+		}
+		if drift != "" {
+			drifts = append(drifts, fmt.Sprintf("gitconfig %s: %s", c.Name, drift))
+		}
+	}
+	if !jirix.KeepGitHooks {
+		hookDrifts, err := gitHooksDrift(jirix, p)
+		if err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, hookDrifts...)
+	}
+	sort.Strings(drifts)
+	return drifts, nil
+}
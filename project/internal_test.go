@@ -6,3 +6,13 @@ package project
 
 // InternalWriteMetadata exports writeMetadata for tests.
 var InternalWriteMetadata = writeMetadata
+
+// InternalOrderFetches exports orderFetches for tests, with the sizes of the
+// projects as of their last fetch.
+func InternalOrderFetches(sizes map[ProjectKey]int64, keys []ProjectKey) {
+	state := &updateState{Projects: make(map[ProjectKey]fetchRecord)}
+	for key, size := range sizes {
+		state.Projects[key] = fetchRecord{Size: size}
+	}
+	orderFetches(state, keys)
+}
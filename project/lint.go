@@ -0,0 +1,416 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/gitutil"
+)
+
+// Severities of lint findings.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintFinding is a problem found in a manifest by LintManifestFile.
+type LintFinding struct {
+	// File is the manifest the problem was found in.
+	File string `json:"file"`
+	// Line is the line of the element at fault, 0 if unknown.
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	// Check is the name of the check which found the problem, e.g.
+	// "unknown-attribute" or "duplicate-path".
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	loc := f.File
+	if f.Line != 0 {
+		loc = fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", loc, f.Severity, f.Message, f.Check)
+}
+
+// LintOptions selects the checks of LintManifestFile which go beyond the
+// manifest file itself.
+type LintOptions struct {
+	// Resolve loads the imports of the manifest and checks the projects of
+	// the whole tree for import shadowing.
+	Resolve bool
+	// Network checks that the remotes of the imports, and of the projects with
+	// Resolve, are reachable.
+	Network bool
+}
+
+// lintElement is the schema of a manifest element: the attributes and child
+// elements it accepts.
+type lintElement struct {
+	attrs    map[string]bool
+	children map[string]*lintElement
+}
+
+var (
+	manifestSchemaOnce sync.Once
+	manifestSchema     *lintElement
+)
+
+// schemaFromType derives the schema of the element t is decoded from, from
+// its xml struct tags.
+func schemaFromType(t reflect.Type) *lintElement {
+	e := &lintElement{attrs: make(map[string]bool), children: make(map[string]*lintElement)}
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return e
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Name == "XMLName" {
+			continue
+		}
+		tag := f.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name, opts := parts[0], parts[1:]
+		if name == "" {
+			name = f.Name
+		}
+		isAttr := false
+		for _, o := range opts {
+			switch o {
+			case "attr":
+				isAttr = true
+			case "chardata", "innerxml", "comment", "any":
+				name = ""
+			}
+		}
+		if name == "" {
+			continue
+		}
+		if isAttr {
+			e.attrs[name] = true
+			continue
+		}
+		parent := e
+		path := strings.Split(name, ">")
+		for _, p := range path[:len(path)-1] {
+			if parent.children[p] == nil {
+				parent.children[p] = &lintElement{attrs: make(map[string]bool), children: make(map[string]*lintElement)}
+			}
+			parent = parent.children[p]
+		}
+		parent.children[path[len(path)-1]] = schemaFromType(f.Type)
+	}
+	return e
+}
+
+// lintSchema checks the elements and attributes of data against the manifest
+// schema, and returns the lines of the <project> elements of the manifest, in
+// order.
+func lintSchema(file string, data []byte) ([]LintFinding, []int) {
+	manifestSchemaOnce.Do(func() {
+		manifestSchema = &lintElement{children: map[string]*lintElement{
+			"manifest": schemaFromType(reflect.TypeOf(Manifest{})),
+		}}
+	})
+	var findings []LintFinding
+	var projectLines []int
+	d := xml.NewDecoder(bytes.NewReader(data))
+	stack := []*lintElement{manifestSchema}
+	var names []string
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// ManifestFromBytes reports it.
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			line := bytes.Count(data[:offset], []byte("\n")) + 1
+			parent := stack[len(stack)-1]
+			names = append(names, t.Name.Local)
+			e := (*lintElement)(nil)
+			if parent != nil {
+				e = parent.children[t.Name.Local]
+				if e == nil {
+					findings = append(findings, LintFinding{file, line, LintError, "unknown-element", fmt.Sprintf("unknown element <%s>, it is ignored", strings.Join(names, ">"))})
+				}
+			}
+			stack = append(stack, e)
+			if e == nil {
+				continue
+			}
+			if strings.Join(names, ">") == "manifest>projects>project" {
+				projectLines = append(projectLines, line)
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space == "" && !e.attrs[a.Name.Local] {
+					findings = append(findings, LintFinding{file, line, LintError, "unknown-attribute", fmt.Sprintf("unknown attribute %q of <%s>, it is ignored", a.Name.Local, t.Name.Local)})
+				}
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			names = names[:len(names)-1]
+		}
+	}
+	return findings, projectLines
+}
+
+// LintManifestBytes checks the manifest data read from file, without loading
+// its imports: the manifest must parse, only use known elements and
+// attributes, and its projects must have unique names and relative paths, and
+// not nest inside each other.
+func LintManifestBytes(file string, data []byte) []LintFinding {
+	findings, lines := lintSchema(file, data)
+	m, err := ManifestFromBytes(data)
+	if err != nil {
+		return append(findings, LintFinding{file, 0, LintError, "invalid", err.Error()})
+	}
+	line := func(i int) int {
+		if i < len(lines) {
+			return lines[i]
+		}
+		return 0
+	}
+	names := make(map[string]int)
+	keys := make(map[ProjectKey]int)
+	paths := make(map[string]int)
+	for i, p := range m.Projects {
+		if j, ok := keys[p.Key()]; ok {
+			findings = append(findings, LintFinding{file, line(i), LintError, "duplicate-project", fmt.Sprintf("project %q with remote %q is also defined on line %d", p.Name, p.Remote, line(j))})
+		} else if j, ok := names[p.Name]; ok {
+			findings = append(findings, LintFinding{file, line(i), LintWarning, "duplicate-name", fmt.Sprintf("project name %q is also used on line %d", p.Name, line(j))})
+		}
+		keys[p.Key()] = i
+		names[p.Name] = i
+		if p.Path == "" {
+			findings = append(findings, LintFinding{file, line(i), LintError, "missing-path", fmt.Sprintf("project %q has no path", p.Name)})
+			continue
+		}
+		if filepath.IsAbs(p.Path) || filepath.IsAbs(p.GitHooks) {
+			findings = append(findings, LintFinding{file, line(i), LintError, "absolute-path", fmt.Sprintf("project %q has an absolute path, paths should be relative to the jiri root", p.Name)})
+		}
+		path := filepath.Clean(p.Path)
+		if j, ok := paths[path]; ok {
+			findings = append(findings, LintFinding{file, line(i), LintError, "duplicate-path", fmt.Sprintf("project %q uses path %q, like project %q", p.Name, p.Path, m.Projects[j].Name)})
+			continue
+		}
+		paths[path] = i
+	}
+	for _, pair := range nestedProjects(m.Projects) {
+		parent, p := pair[0], pair[1]
+		for i := range m.Projects {
+			if m.Projects[i].Key() == p.Key() {
+				findings = append(findings, LintFinding{file, line(i), LintWarning, "nested-path", fmt.Sprintf("project %q at %q is nested inside project %q at %q", p.Name, p.Path, parent.Name, parent.Path)})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// nestedProjects returns the pairs of projects whose second project has its
+// path inside the path of the first one.
+func nestedProjects(projects []Project) [][2]Project {
+	sorted := append([]Project(nil), projects...)
+	sort.Sort(ProjectsByPath(sorted))
+	var pairs [][2]Project
+	var parents []Project
+	for _, p := range sorted {
+		if p.Path == "" {
+			continue
+		}
+		for len(parents) > 0 && !strings.HasPrefix(p.Path, parents[len(parents)-1].Path+string(filepath.Separator)) {
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) > 0 {
+			pairs = append(pairs, [2]Project{parents[len(parents)-1], p})
+		}
+		parents = append(parents, p)
+	}
+	return pairs
+}
+
+// LintManifestFile checks the manifest file with LintManifestBytes, and the
+// checks selected by opts. Problems are returned as findings, sorted by file
+// and line, the error is only set if the checks could not run.
+func LintManifestFile(jirix *jiri.X, file string, opts LintOptions) ([]LintFinding, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmtError(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmtError(err)
+	}
+	name := shortFileName(jirix.Root, "", file, "")
+	findings := LintManifestBytes(name, data)
+	m, err := ManifestFromBytes(data)
+	if err != nil {
+		return findings, nil
+	}
+	// remotes maps the remotes to check to the branch they must have, if
+	// they are not pinned to a revision.
+	remotes := make(map[string]string)
+	for _, i := range m.Imports {
+		remotes[i.Remote] = trackedBranch(i.RemoteBranch, i.Revision)
+	}
+	if opts.Resolve {
+		resolved, projects, err := lintImports(jirix, file, m)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, resolved...)
+		for _, p := range projects {
+			if remotes[p.Remote] == "" {
+				remotes[p.Remote] = trackedBranch(p.RemoteBranch, p.Revision)
+			}
+		}
+	}
+	if opts.Network {
+		findings = append(findings, lintRemotes(jirix, name, remotes)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// lintImports loads the whole manifest tree rooted at file and reports
+// projects which shadow each other: distinct projects sharing a path, and
+// overrides which match no project. It returns the projects of the tree.
+func lintImports(jirix *jiri.X, file string, m *Manifest) ([]LintFinding, []Project, error) {
+	name := shortFileName(jirix.Root, "", file, "")
+	localProjects, err := LocalProjects(jirix, FastScan)
+	if err != nil {
+		return nil, nil, err
+	}
+	traces, err := TraceManifestFile(jirix, file, localProjects, false /*localManifest*/)
+	if err != nil {
+		return []LintFinding{{name, 0, LintError, "imports", err.Error()}}, nil, nil
+	}
+	var keys ProjectKeys
+	for key := range traces {
+		keys = append(keys, key)
+	}
+	sort.Sort(keys)
+	var findings []LintFinding
+	var projects []Project
+	paths := make(map[string]ProjectKey)
+	chain := func(key ProjectKey) string {
+		return strings.Join(traces[key].Chain, " -> ")
+	}
+	for _, key := range keys {
+		p := traces[key].Project
+		projects = append(projects, p)
+		if other, ok := paths[p.Path]; ok {
+			findings = append(findings, LintFinding{name, 0, LintError, "import-shadowing", fmt.Sprintf("project %q (imported through %s) and project %q (imported through %s) share path %q", traces[other].Project.Name, chain(other), p.Name, chain(key), p.Path)})
+			continue
+		}
+		paths[p.Path] = key
+	}
+	for _, pair := range nestedProjects(projects) {
+		parent, p := pair[0], pair[1]
+		if parent.ManifestPath == file && p.ManifestPath == file {
+			// Reported by LintManifestBytes.
+			continue
+		}
+		findings = append(findings, LintFinding{shortFileName(jirix.Root, "", p.ManifestPath, ""), 0, LintWarning, "nested-path", fmt.Sprintf("project %q at %q is nested inside project %q at %q (imported through %s)", p.Name, p.Path, parent.Name, parent.Path, chain(parent.Key()))})
+	}
+	names := make(map[string]bool)
+	for _, p := range projects {
+		names[p.Name] = true
+	}
+	for _, p := range projects {
+		if p.Replacement != "" && !names[p.Replacement] {
+			findings = append(findings, LintFinding{shortFileName(jirix.Root, "", p.ManifestPath, ""), 0, LintWarning, "unknown-replacement", fmt.Sprintf("project %q is replaced by project %q, which is not in the manifest", p.Name, p.Replacement)})
+		}
+	}
+	for _, o := range m.ProjectOverrides {
+		if _, ok := traces[o.Key()]; !ok {
+			findings = append(findings, LintFinding{name, 0, LintWarning, "unused-override", fmt.Sprintf("override of project %q with remote %q matches no project", o.Name, o.Remote)})
+		}
+	}
+	return findings, projects, nil
+}
+
+// trackedBranch returns the branch followed by a project or import, or "" if
+// it is pinned to a revision.
+func trackedBranch(branch, revision string) string {
+	if revision != "" && revision != "HEAD" {
+		return ""
+	}
+	if branch == "" {
+		return "master"
+	}
+	return branch
+}
+
+// lintRemotes reports the remotes which cannot be reached, or lack the
+// branch they are mapped to, if any.
+func lintRemotes(jirix *jiri.X, file string, remotes map[string]string) []LintFinding {
+	var sorted []string
+	for remote := range remotes {
+		sorted = append(sorted, remote)
+	}
+	sort.Strings(sorted)
+	errs := make([]error, len(sorted))
+	jobs := jirix.Jobs
+	if jobs == 0 {
+		jobs = 1
+	}
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, remote := range sorted {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, remote, branch string) {
+			defer func() { <-sem; wg.Done() }()
+			var branches []string
+			if branch != "" {
+				branches = append(branches, branch)
+			}
+			heads, err := gitutil.New(jirix).LsRemoteHeads(remote, branches...)
+			if err == nil && branch != "" {
+				if _, ok := heads[branch]; !ok {
+					err = fmt.Errorf("no branch %q", branch)
+				}
+			}
+			errs[i] = err
+		}(i, remote, remotes[remote])
+	}
+	wg.Wait()
+	var findings []LintFinding
+	for i, err := range errs {
+		if err != nil {
+			findings = append(findings, LintFinding{file, 0, LintError, "unreachable-remote", fmt.Sprintf("remote %q: %v", sorted[i], err)})
+		}
+	}
+	return findings
+}
@@ -41,9 +41,20 @@ type loader struct {
 	importTree       importTree
 	update           bool
 	cycleStack       []cycleInfo
+	projectChains    map[ProjectKey][]string
 	manifests        map[string]bool
 	lockfiles        map[string]bool
 	parentFile       string
+	// parentData is the content of parentFile if it is not read from the
+	// file.
+	parentData []byte
+	// inputs are the files the loaded manifest depends on, which are
+	// stamped in the manifest cache, unless the manifest is uncacheable.
+	inputs      map[string]bool
+	uncacheable bool
+	// atHead is set to read remote imports at the revision "jiri update"
+	// would check out, without fetching, rather than at JIRI_HEAD.
+	atHead bool
 }
 
 type importTreeNode struct {
@@ -205,6 +216,20 @@ type cycleInfo struct {
 	file, key string
 }
 
+// includeChain returns the manifests currently being loaded, from the root
+// manifest down to the innermost import, as "file" or "file (remote key)".
+func includeChain(root string, stack []cycleInfo) []string {
+	var chain []string
+	for _, c := range stack {
+		s := shortFileName(root, "", c.file, "")
+		if c.key != "" {
+			s = fmt.Sprintf("%s (%s)", s, c.key)
+		}
+		chain = append(chain, s)
+	}
+	return chain
+}
+
 // newManifestLoader returns a new manifest loader.  The localProjects are used
 // to resolve remote imports; if nil, encountering any remote import will result
 // in an error.  If update is true, remote manifest import projects that don't
@@ -226,6 +251,7 @@ func newManifestLoader(localProjects Projects, update bool, file string) *loader
 		importProjects:   make(Projects),
 		update:           update,
 		importCacheMap:   make(map[string]importCache),
+		projectChains:    make(map[ProjectKey][]string),
 		manifests:        make(map[string]bool),
 		lockfiles:        make(map[string]bool),
 		importTree:       newImportTree(),
@@ -271,9 +297,9 @@ func (ld *loader) loadNoCycles(jirix *jiri.X, root, repoPath, file, ref, cycleKe
 	for _, c := range ld.cycleStack {
 		switch {
 		case f == c.file:
-			return fmt.Errorf("import cycle detected in local manifest files: %q", append(ld.cycleStack, info))
+			return fmt.Errorf("import cycle detected in local manifest files: %s", strings.Join(includeChain(jirix.Root, append(ld.cycleStack, info)), " -> "))
 		case cycleKey == c.key && cycleKey != "":
-			return fmt.Errorf("import cycle detected in remote manifest imports: %q", append(ld.cycleStack, info))
+			return fmt.Errorf("import cycle detected in remote manifest imports: %s", strings.Join(includeChain(jirix.Root, append(ld.cycleStack, info)), " -> "))
 		}
 	}
 	ld.cycleStack = append(ld.cycleStack, info)
@@ -303,6 +329,9 @@ func (ld *loader) Load(jirix *jiri.X, root, repoPath, file, ref, cycleKey, paren
 }
 
 func (ld *loader) cloneManifestRepo(jirix *jiri.X, remote *Import, cacheDirPath string, localManifest bool) error {
+	if jirix.Offline {
+		return fmt.Errorf("import %q is not available locally and cannot be cloned in offline mode", remote.Name)
+	}
 	if !ld.update || localManifest {
 		jirix.Logger.Warningf("import %q not found locally, getting from server. Please check your manifest file (default: .jiri_manifest).\nMake sure that the 'name' attributes on the 'import' and 'project' tags match and that there is a corresponding 'project' tag for every 'import' tag.\n\n", remote.Name)
 	}
@@ -341,7 +370,7 @@ func (ld *loader) cloneManifestRepo(jirix *jiri.X, remote *Import, cacheDirPath
 	if jirix.Partial {
 		opts = append(opts, gitutil.OmitBlobsOpt(true))
 	}
-	if err := clone(jirix, r, path, opts...); err != nil {
+	if err := clone(jirix, p, r, path, opts...); err != nil {
 		return err
 	}
 	scm := gitutil.New(jirix, gitutil.RootDirOpt(path))
@@ -388,6 +417,7 @@ func (ld *loader) loadLockFile(jirix *jiri.X, repoPath, dir, lockFileName, ref s
 		}
 		data = []byte(s)
 	} else {
+		ld.recordFile(lockfile)
 		if _, err := os.Stat(lockfile); err != nil {
 			if os.IsNotExist(err) {
 				jirix.Logger.Debugf("could not find %q file at %q", lockFileName, lockfile)
@@ -456,9 +486,20 @@ func (ld *loader) load(jirix *jiri.X, root, repoPath, file, ref, parentImport st
 	}
 	ld.manifests[f] = true
 
+	if repoPath == "" {
+		ld.recordFile(file)
+	} else {
+		ld.recordRef(repoPath, ref)
+	}
 	loadManifestAndLocks := func(jirix *jiri.X, file string) (*Manifest, error) {
 		if repoPath == "" {
-			m, err := ManifestFromFile(jirix, file)
+			var m *Manifest
+			var err error
+			if ld.parentData != nil && file == ld.parentFile {
+				m, err = ManifestFromBytes(ld.parentData)
+			} else {
+				m, err = ManifestFromFile(jirix, file)
+			}
 			if err != nil {
 				return nil, fmt.Errorf("Error reading from manifest file %s %s:%s:error(%s)", repoPath, ref, file, err)
 			}
@@ -598,6 +639,27 @@ func (ld *loader) load(jirix *jiri.X, root, repoPath, file, ref, parentImport st
 		if err != nil {
 			return err
 		}
+		if err := project.checkRelativePaths(); err != nil {
+			return fmt.Errorf("%v in %q", err, shortFileName(jirix.Root, repoPath, file, ref))
+		}
+		if err := project.checkFiles(); err != nil {
+			return fmt.Errorf("%v in %q", err, shortFileName(jirix.Root, repoPath, file, ref))
+		}
+		if err := project.checkGitConfigs(); err != nil {
+			return fmt.Errorf("%v in %q", err, shortFileName(jirix.Root, repoPath, file, ref))
+		}
+		if root != "" {
+			// Like the project path, the destinations of its files are
+			// relative to the root of the import.
+			copyfiles, linkfiles := project.Copyfiles, project.Linkfiles
+			project.Copyfiles, project.Linkfiles = nil, nil
+			for _, f := range copyfiles {
+				project.Copyfiles = append(project.Copyfiles, ProjectFile{Src: f.Src, Dest: filepath.Join(root, f.Dest)})
+			}
+			for _, f := range linkfiles {
+				project.Linkfiles = append(project.Linkfiles, ProjectFile{Src: f.Src, Dest: filepath.Join(root, f.Dest)})
+			}
+		}
 		// normalize project attributes
 		project.ComputedAttributes = newAttributes(project.Attributes)
 		project.Attributes = project.ComputedAttributes.String()
@@ -626,8 +688,7 @@ func (ld *loader) load(jirix *jiri.X, root, repoPath, file, ref, parentImport st
 		}
 
 		if dup, ok := ld.Projects[key]; ok && !reflect.DeepEqual(dup, project) {
-			// TODO(toddw): Tell the user the other conflicting file.
-			return fmt.Errorf("duplicate project %q found in %q", key, shortFileName(jirix.Root, repoPath, file, ref))
+			return fmt.Errorf("duplicate project %q found in %q, it is also defined in %q (imported through %s)", key, shortFileName(jirix.Root, repoPath, file, ref), shortFileName(jirix.Root, "", dup.ManifestPath, ""), strings.Join(ld.projectChains[key], " -> "))
 		}
 
 		// Record manifest location.
@@ -635,6 +696,7 @@ func (ld *loader) load(jirix *jiri.X, root, repoPath, file, ref, parentImport st
 
 		// Associate project with importTreeNode for git attributes propagation.
 		ld.importTree.projectKeyMap[key] = self
+		ld.projectChains[key] = includeChain(jirix.Root, ld.cycleStack)
 
 		ld.Projects[key] = project
 	}
@@ -690,7 +752,9 @@ func (ld *loader) loadImport(jirix *jiri.X, root, file, cycleKey, cacheDirPath,
 						fetch = false
 					}
 				}
-				if fetch {
+				if fetch && jirix.Offline {
+					jirix.Logger.Debugf("Not fetching manifest project %q in offline mode", project.Name)
+				} else if fetch {
 					if cacheDirPath != "" {
 						remoteUrl := rewriteRemote(jirix, project.Remote)
 						if err := updateOrCreateCache(jirix, cacheDirPath, remoteUrl, project.RemoteBranch, project.Revision, 0); err != nil {
@@ -701,7 +765,7 @@ func (ld *loader) loadImport(jirix *jiri.X, root, file, cycleKey, cacheDirPath,
 						return fmt.Errorf("Fetch failed for project(%s), %s", project.Path, err)
 					}
 				}
-			} else {
+			} else if !ld.atHead {
 				// If not updating then try to get file from JIRI_HEAD
 				if _, err := gitutil.New(jirix, gitutil.RootDirOpt(project.Path)).Show("JIRI_HEAD", ""); err == nil {
 					// JIRI_HEAD available, set ref
@@ -30,6 +30,7 @@ import (
 	"github.com/btwiuse/jiri/envvar"
 	"github.com/btwiuse/jiri/gerrit"
 	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/osutil"
 	"github.com/btwiuse/jiri/retry"
 	"golang.org/x/net/publicsuffix"
 )
@@ -45,6 +46,7 @@ type Manifest struct {
 	ImportOverrides  []Import      `xml:"overrides>import"`
 	Hooks            []Hook        `xml:"hooks>hook"`
 	Packages         []Package     `xml:"packages>package"`
+	Views            []View        `xml:"views>view"`
 	XMLName          struct{}      `xml:"manifest"`
 }
 
@@ -78,11 +80,56 @@ func ManifestFromFile(jirix *jiri.X, filename string) (*Manifest, error) {
 	}
 	m, err := ManifestFromBytes(data)
 	if err != nil {
+		if backup := ManifestBackupFile(filename); isValidManifestFile(backup) {
+			return nil, fmt.Errorf("invalid manifest %s: %v (a valid backup exists at %s, use project.RecoverManifest or copy it over to restore it)", filename, err, backup)
+		}
 		return nil, fmt.Errorf("invalid manifest %s: %v", filename, err)
 	}
 	return m, nil
 }
 
+// ManifestBackupFile returns the path of the backup that Manifest.ToFile keeps
+// of the previous contents of filename.
+func ManifestBackupFile(filename string) string {
+	return filename + manifestBackupSuffix
+}
+
+// isValidManifestFile returns true if filename exists and contains a manifest
+// that can be parsed.
+func isValidManifestFile(filename string) bool {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	_, err = ManifestFromBytes(data)
+	return err == nil
+}
+
+// RecoverManifest returns the manifest parsed from filename.  If filename
+// cannot be parsed, the backup written by the last Manifest.ToFile is parsed
+// instead and, when valid, restored over filename.  The error from filename is
+// returned if there is no usable backup.
+func RecoverManifest(jirix *jiri.X, filename string) (*Manifest, error) {
+	m, err := ManifestFromFile(jirix, filename)
+	if err == nil {
+		return m, nil
+	}
+	backup := ManifestBackupFile(filename)
+	data, err2 := ioutil.ReadFile(backup)
+	if err2 != nil {
+		return nil, err
+	}
+	m, err2 = ManifestFromBytes(data)
+	if err2 != nil {
+		return nil, err
+	}
+	if err := safeWriteFile(jirix, filename, data); err != nil {
+		return nil, err
+	}
+	jirix.Logger.Warningf("Manifest %s could not be read (%v), restored it from backup %s\n\n", filename, err, backup)
+	return m, nil
+}
+
 var (
 	newlineBytes        = []byte("\n")
 	emptyImportsBytes   = []byte("\n  <imports></imports>\n")
@@ -90,6 +137,7 @@ var (
 	emptyOverridesBytes = []byte("\n  <overrides></overrides>\n")
 	emptyHooksBytes     = []byte("\n  <hooks></hooks>\n")
 	emptyPackagesBytes  = []byte("\n  <packages></packages>\n")
+	emptyViewsBytes     = []byte("\n  <views></views>\n")
 
 	endElemBytes        = []byte("/>\n")
 	endImportBytes      = []byte("></import>\n")
@@ -107,6 +155,14 @@ var (
 
 const (
 	fuchsiaGerritHost = "https://fuchsia-review.googlesource.com"
+
+	// manifestBackupSuffix is appended to a manifest file name to get the
+	// name of its backup.
+	manifestBackupSuffix = ".bak"
+
+	// manifestLockSuffix is appended to a manifest file name to get the name
+	// of the file used by LockManifestFile.
+	manifestLockSuffix = ".lock"
 )
 
 // deepCopy returns a deep copy of Manifest.
@@ -119,6 +175,7 @@ func (m *Manifest) deepCopy() *Manifest {
 	x.ImportOverrides = append([]Import(nil), m.ImportOverrides...)
 	x.Hooks = append([]Hook(nil), m.Hooks...)
 	x.Packages = append([]Package(nil), m.Packages...)
+	x.Views = append([]View(nil), m.Views...)
 	x.Version = m.Version
 	x.Attributes = m.Attributes
 	return x
@@ -141,6 +198,7 @@ func (m *Manifest) ToBytes() ([]byte, error) {
 	data = bytes.Replace(data, emptyOverridesBytes, newlineBytes, -1)
 	data = bytes.Replace(data, emptyHooksBytes, newlineBytes, -1)
 	data = bytes.Replace(data, emptyPackagesBytes, newlineBytes, -1)
+	data = bytes.Replace(data, emptyViewsBytes, newlineBytes, -1)
 	data = bytes.Replace(data, endImportBytes, endElemBytes, -1)
 	data = bytes.Replace(data, endLocalImportBytes, endElemBytes, -1)
 	data = bytes.Replace(data, endProjectBytes, endElemBytes, -1)
@@ -175,9 +233,82 @@ func (m *Manifest) ToFile(jirix *jiri.X, filename string) error {
 	if err != nil {
 		return err
 	}
+	if err := backupManifestFile(jirix, filename); err != nil {
+		return err
+	}
 	return safeWriteFile(jirix, filename, data)
 }
 
+// backupManifestFile copies the current contents of filename to its backup
+// file, so that there is always a valid manifest on disk while filename is
+// being replaced.  Missing or unparsable manifests are not backed up, to
+// avoid clobbering a good backup with a bad one.
+func backupManifestFile(jirix *jiri.X, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmtError(err)
+	}
+	if _, err := ManifestFromBytes(data); err != nil {
+		jirix.Logger.Debugf("not backing up invalid manifest %s: %v", filename, err)
+		return nil
+	}
+	return safeWriteFile(jirix, ManifestBackupFile(filename), data)
+}
+
+// WriteManifestBytes atomically replaces the manifest in filename with data,
+// e.g. to restore its content as read before.
+func WriteManifestBytes(jirix *jiri.X, filename string, data []byte) error {
+	return safeWriteFile(jirix, filename, data)
+}
+
+// LockManifestFile takes an exclusive advisory lock guarding read-modify-write
+// cycles of the manifest in filename, so that concurrent jiri invocations do
+// not lose each other's changes.  It retries with backoff until timeout has
+// elapsed.  The returned function releases the lock.
+func LockManifestFile(jirix *jiri.X, filename string, timeout time.Duration) (func(), error) {
+	lockFile := filename + manifestLockSuffix
+	if err := jirix.CheckWrite(lockFile, "lock manifest"); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(lockFile), 0755); err != nil {
+		return nil, fmtError(err)
+	}
+	f, err := os.OpenFile(lockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmtError(err)
+	}
+	deadline := time.Now().Add(timeout)
+	interval := 50 * time.Millisecond
+	for {
+		locked, err := osutil.TryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %v", lockFile, err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for lock on %s, another jiri process may be modifying the manifest. Use %s flag to wait longer.", timeout, filename, jirix.Color.Yellow("-lock-timeout"))
+		}
+		jirix.Logger.Debugf("waiting for lock on %s", lockFile)
+		time.Sleep(interval)
+		if interval < time.Second {
+			interval *= 2
+		}
+	}
+	return func() {
+		if err := osutil.UnlockFile(f); err != nil {
+			jirix.Logger.Debugf("failed to unlock %s: %v", lockFile, err)
+		}
+		f.Close()
+	}, nil
+}
+
 func (m *Manifest) fillDefaults() error {
 	for index := range m.Imports {
 		if err := m.Imports[index].fillDefaults(); err != nil {
@@ -362,10 +493,11 @@ func (i *LocalImport) validate() error {
 }
 
 type LocalConfig struct {
-	Ignore   bool     `xml:"ignore"`
-	NoUpdate bool     `xml:"no-update"`
-	NoRebase bool     `xml:"no-rebase"`
-	XMLName  struct{} `xml:"config"`
+	Ignore     bool     `xml:"ignore"`
+	NoUpdate   bool     `xml:"no-update"`
+	NoRebase   bool     `xml:"no-rebase"`
+	OnConflict string   `xml:"on-conflict,omitempty"`
+	XMLName    struct{} `xml:"config"`
 }
 
 // Reads localConfig from given reader. Returns incorrect bytes
@@ -393,6 +525,9 @@ func (lc *LocalConfig) WriteTo(writer io.Writer) (int64, error) {
 }
 
 func (lc *LocalConfig) ToFile(jirix *jiri.X, filename string) error {
+	if err := jirix.CheckWrite(filename, "write local config"); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
 		return fmtError(err)
 	}
@@ -412,11 +547,17 @@ func WriteLocalConfig(jirix *jiri.X, project Project, lc LocalConfig) error {
 
 // Hook represents a hook to run
 type Hook struct {
-	Name        string   `xml:"name,attr"`
-	Action      string   `xml:"action,attr"`
-	ProjectName string   `xml:"project,attr"`
-	XMLName     struct{} `xml:"hook"`
-	ActionPath  string   `xml:"-"`
+	Name        string `xml:"name,attr"`
+	Action      string `xml:"action,attr"`
+	ProjectName string `xml:"project,attr"`
+	// After is a comma-separated list of names of hooks that must succeed
+	// before this hook runs.
+	After string `xml:"after,attr,omitempty"`
+	// Timeout is the timeout of the hook in minutes. It overrides the
+	// timeout given to RunHooks when set.
+	Timeout    uint     `xml:"timeout,attr,omitempty"`
+	XMLName    struct{} `xml:"hook"`
+	ActionPath string   `xml:"-"`
 }
 
 // HookKey is a unique string for a project.
@@ -735,6 +876,18 @@ func (ld *loader) enforceLocks(jirix *jiri.X) error {
 // errors about ".git/index.lock exists", you are likely calling
 // LoadManifestFile in parallel.
 func LoadManifestFile(jirix *jiri.X, file string, localProjects Projects, localManifest bool) (Projects, Hooks, Packages, error) {
+	key := manifestCacheKey(jirix, file, localProjects, localManifest)
+	if c := readManifestCache(jirix, key); c != nil {
+		jirix.Logger.Debugf("loaded manifest %s from cache", file)
+		ld := &loader{ProjectOverrides: c.ProjectOverrides, ImportOverrides: c.ImportOverrides}
+		if len(ld.ImportOverrides) != 0 {
+			jirix.UsingImportOverride = true
+		}
+		if !jirix.OverrideWarned {
+			ld.warnOverrides(jirix)
+		}
+		return c.Projects, c.Hooks, c.Packages, nil
+	}
 	ld := newManifestLoader(localProjects, false, file)
 	if err := ld.Load(jirix, "", "", file, "", "", "", localManifest); err != nil {
 		return nil, nil, nil, err
@@ -749,6 +902,39 @@ func LoadManifestFile(jirix *jiri.X, file string, localProjects Projects, localM
 		ld.warnOverrides(jirix)
 	}
 	ld.GenerateGitAttributesForProjects(jirix)
+	writeManifestCache(jirix, key, ld)
+	return ld.Projects, ld.Hooks, ld.Packages, nil
+}
+
+// LoadManifestFileAtHead loads the manifest starting with the given file
+// like LoadManifestFile, but reads the remote imports at the revision "jiri
+// update" would check out, i.e. their pinned revision or the head of their
+// remote branch as last fetched, instead of at JIRI_HEAD. Nothing is fetched
+// or checked out.
+func LoadManifestFileAtHead(jirix *jiri.X, file string, localProjects Projects) (Projects, Hooks, Packages, error) {
+	return LoadManifestBytesAtHead(jirix, file, nil, localProjects)
+}
+
+// LoadManifestBytesAtHead is like LoadManifestFileAtHead, but reads the
+// manifest in file from data, if not nil, e.g. to load an edited manifest
+// without writing it. Its local imports are still relative to file.
+func LoadManifestBytesAtHead(jirix *jiri.X, file string, data []byte, localProjects Projects) (Projects, Hooks, Packages, error) {
+	ld := newManifestLoader(localProjects, false, file)
+	ld.atHead = true
+	ld.parentData = data
+	if err := ld.Load(jirix, "", "", file, "", "", "", false); err != nil {
+		return nil, nil, nil, err
+	}
+	jirix.AddCleanupFunc(ld.cleanup)
+	if jirix.LockfileEnabled {
+		if err := ld.enforceLocks(jirix); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if !jirix.OverrideWarned {
+		ld.warnOverrides(jirix)
+	}
+	ld.GenerateGitAttributesForProjects(jirix)
 	return ld.Projects, ld.Hooks, ld.Packages, nil
 }
 
@@ -774,6 +960,38 @@ func LoadUpdatedManifest(jirix *jiri.X, localProjects Projects, localManifest bo
 	return ld.Projects, ld.Hooks, ld.Packages, nil
 }
 
+// ProjectTrace describes how a project was resolved when loading a manifest.
+type ProjectTrace struct {
+	Project Project
+	// Chain lists the manifests, from the root manifest down to the one
+	// declaring the project. Remote imports are followed by their
+	// "remote/manifest" key.
+	Chain []string
+	// Overridden is true if an <overrides> entry of the root manifest was
+	// applied to the project.
+	Overridden bool
+}
+
+// TraceManifestFile loads the manifest starting with the given file, like
+// LoadManifestFile, and returns how each of its projects was resolved.
+func TraceManifestFile(jirix *jiri.X, file string, localProjects Projects, localManifest bool) (map[ProjectKey]ProjectTrace, error) {
+	ld := newManifestLoader(localProjects, false, file)
+	if err := ld.Load(jirix, "", "", file, "", "", "", localManifest); err != nil {
+		return nil, err
+	}
+	jirix.AddCleanupFunc(ld.cleanup)
+	traces := make(map[ProjectKey]ProjectTrace)
+	for key, p := range ld.Projects {
+		_, overridden := ld.ProjectOverrides[string(key)]
+		traces[key] = ProjectTrace{
+			Project:    p,
+			Chain:      ld.projectChains[key],
+			Overridden: overridden,
+		}
+	}
+	return traces, nil
+}
+
 // ResolveImplicitPackageVersions resolves the version field of packages if it
 // pins to a project's revision hash
 func ResolveImplicitPackageVersions(jirix *jiri.X, projects Projects, pkgs Packages) (Packages, error) {
@@ -868,6 +1086,9 @@ func resolveProjectLocks(jirix *jiri.X, projects Projects) (ProjectLocks, error)
 func FetchPackages(jirix *jiri.X, projects Projects, pkgs Packages, fetchTimeout uint) error {
 	jirix.TimerPush("fetch cipd packages")
 	defer jirix.TimerPop()
+	if err := jirix.CheckWrite(jirix.Root, "fetch packages"); err != nil {
+		return err
+	}
 
 	pkgsWAccess, hasInternalPkgs, err := pkgs.FilterACL(jirix)
 	if err != nil {
@@ -1126,10 +1347,64 @@ func generateVersionFile(jirix *jiri.X, ensureFile string, pkgs Packages) (strin
 	return versionFileName, ioutil.WriteFile(versionFileName, versionFileBuf.Bytes(), 0655)
 }
 
-// RunHooks runs all given hooks.
+// hookDependencies returns, for each hook, the keys of the hooks named in its
+// "after" attribute.
+func hookDependencies(hooks Hooks) (map[HookKey][]HookKey, error) {
+	byName := make(map[string][]HookKey)
+	for key, hook := range hooks {
+		byName[hook.Name] = append(byName[hook.Name], key)
+	}
+	deps := make(map[HookKey][]HookKey)
+	for key, hook := range hooks {
+		for _, name := range strings.Split(hook.After, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if len(byName[name]) == 0 {
+				return nil, fmt.Errorf("hook(%s) for project %q runs after unknown hook %q", hook.Name, hook.ProjectName, name)
+			}
+			deps[key] = append(deps[key], byName[name]...)
+		}
+	}
+	// Check for cycles, which would make RunHooks wait forever.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[HookKey]int)
+	var visit func(key HookKey) error
+	visit = func(key HookKey) error {
+		switch marks[key] {
+		case visiting:
+			return fmt.Errorf("hook(%s) for project %q depends on itself through its \"after\" attribute", hooks[key].Name, hooks[key].ProjectName)
+		case visited:
+			return nil
+		}
+		marks[key] = visiting
+		for _, dep := range deps[key] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		marks[key] = visited
+		return nil
+	}
+	for key := range hooks {
+		if err := visit(key); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
+
+// RunHooks runs all given hooks. Hooks run in parallel, except that a hook
+// starts only once the hooks named in its "after" attribute have succeeded.
 func RunHooks(jirix *jiri.X, hooks Hooks, runHookTimeout uint) error {
 	jirix.TimerPush("run hooks")
 	defer jirix.TimerPop()
+	if err := jirix.CheckWrite(jirix.Root, "run hooks"); err != nil {
+		return err
+	}
 	jirix.Logger.Debugf("Running Jiri hooks")
 	defer jirix.Logger.Debugf("Running Jiri ")
 	type result struct {
@@ -1143,52 +1418,80 @@ func RunHooks(jirix *jiri.X, hooks Hooks, runHookTimeout uint) error {
 		return fmt.Errorf("not able to create tmp dir: %v", err)
 	}
 	defer os.RemoveAll(tmpDir)
-	for _, hook := range hooks {
-		go func(hook Hook) {
-			logStr := fmt.Sprintf("running hook(%s) for project %q", hook.Name, hook.ProjectName)
-			jirix.Logger.Debugf(logStr)
-			task := jirix.Logger.AddTaskMsg(logStr)
-			defer task.Done()
-			outFile, err := ioutil.TempFile(tmpDir, hook.Name+"-out")
-			if err != nil {
-				ch <- result{nil, nil, fmtError(err)}
-				return
+	deps, err := hookDependencies(hooks)
+	if err != nil {
+		return err
+	}
+	type hookState struct {
+		done chan struct{}
+		err  error
+	}
+	states := make(map[HookKey]*hookState)
+	for key := range hooks {
+		states[key] = &hookState{done: make(chan struct{})}
+	}
+	runHook := func(hook Hook) result {
+		logStr := fmt.Sprintf("running hook(%s) for project %q", hook.Name, hook.ProjectName)
+		jirix.Logger.Debugf(logStr)
+		task := jirix.Logger.AddTaskMsg(logStr)
+		defer task.Done()
+		outFile, err := ioutil.TempFile(tmpDir, hook.Name+"-out")
+		if err != nil {
+			return result{nil, nil, fmtError(err)}
+		}
+		errFile, err := ioutil.TempFile(tmpDir, hook.Name+"-err")
+		if err != nil {
+			return result{nil, nil, fmtError(err)}
+		}
+
+		fmt.Fprintf(outFile, "output for hook(%v) for project %q\n", hook.Name, hook.ProjectName)
+		fmt.Fprintf(errFile, "Error for hook(%v) for project %q\n", hook.Name, hook.ProjectName)
+		cmdLine := filepath.Join(hook.ActionPath, hook.Action)
+		timeout := runHookTimeout
+		if hook.Timeout > 0 {
+			timeout = hook.Timeout
+		}
+		err = retry.Function(jirix, func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Minute)
+			defer cancel()
+			command := exec.CommandContext(ctx, cmdLine)
+			command.Dir = hook.ActionPath
+			command.Stdin = os.Stdin
+			command.Stdout = outFile
+			command.Stderr = errFile
+			env := jirix.Env()
+			command.Env = envvar.MapToSlice(env)
+			jirix.Logger.Tracef("Run: %q", cmdLine)
+			err = command.Run()
+			if ctx.Err() == context.DeadlineExceeded {
+				err = ctx.Err()
 			}
-			errFile, err := ioutil.TempFile(tmpDir, hook.Name+"-err")
-			if err != nil {
-				ch <- result{nil, nil, fmtError(err)}
-				return
+			scm := gitutil.New(jirix, gitutil.RootDirOpt(filepath.Dir(filepath.Dir(cmdLine))))
+			revision, err2 := scm.CurrentRevisionOfBranch("HEAD")
+			if err2 == nil {
+				jirix.Logger.Debugf("  Invoked hook(%v) for project %q on revision %q", hook.Name, hook.ProjectName, revision)
 			}
-
-			fmt.Fprintf(outFile, "output for hook(%v) for project %q\n", hook.Name, hook.ProjectName)
-			fmt.Fprintf(errFile, "Error for hook(%v) for project %q\n", hook.Name, hook.ProjectName)
-			cmdLine := filepath.Join(hook.ActionPath, hook.Action)
-			err = retry.Function(jirix, func() error {
-				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(runHookTimeout)*time.Minute)
-				defer cancel()
-				command := exec.CommandContext(ctx, cmdLine)
-				command.Dir = hook.ActionPath
-				command.Stdin = os.Stdin
-				command.Stdout = outFile
-				command.Stderr = errFile
-				env := jirix.Env()
-				command.Env = envvar.MapToSlice(env)
-				jirix.Logger.Tracef("Run: %q", cmdLine)
-				err = command.Run()
-				if ctx.Err() == context.DeadlineExceeded {
-					err = ctx.Err()
-				}
-				scm := gitutil.New(jirix, gitutil.RootDirOpt(filepath.Dir(filepath.Dir(cmdLine))))
-				revision, err2 := scm.CurrentRevisionOfBranch("HEAD")
-				if err2 == nil {
-					jirix.Logger.Debugf("  Invoked hook(%v) for project %q on revision %q", hook.Name, hook.ProjectName, revision)
+			return err
+		}, fmt.Sprintf("running hook(%s) for project %s", hook.Name, hook.ProjectName),
+			retry.AttemptsOpt(jirix.Attempts))
+		return result{outFile, errFile, err}
+	}
+	for key, hook := range hooks {
+		go func(key HookKey, hook Hook) {
+			state := states[key]
+			defer close(state.done)
+			for _, dep := range deps[key] {
+				<-states[dep].done
+				if states[dep].err != nil {
+					state.err = fmt.Errorf("hook(%s) for project %q was not run as hook(%s) for project %q failed", hook.Name, hook.ProjectName, hooks[dep].Name, hooks[dep].ProjectName)
+					ch <- result{nil, nil, state.err}
+					return
 				}
-				return err
-			}, fmt.Sprintf("running hook(%s) for project %s", hook.Name, hook.ProjectName),
-				retry.AttemptsOpt(jirix.Attempts))
-			ch <- result{outFile, errFile, err}
-		}(hook)
-
+			}
+			res := runHook(hook)
+			state.err = res.err
+			ch <- res
+		}(key, hook)
 	}
 
 	err = nil
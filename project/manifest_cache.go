@@ -0,0 +1,164 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/btwiuse/jiri"
+)
+
+// manifestCacheVersion is bumped whenever the types stored in the manifest
+// cache change, so that jiri ignores caches written by other versions.
+const manifestCacheVersion = 3
+
+var shaRE = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// fileStamp identifies the version of a file read to load a manifest. A file
+// which does not exist has a zero stamp, so that creating it invalidates the
+// cache as well.
+type fileStamp struct {
+	Path    string
+	ModTime int64
+	Size    int64
+}
+
+// manifestCache is the content of jirix.ManifestCacheFile(): the result of
+// the last LoadManifestFile, valid as long as the files it was loaded from
+// keep their stamps.
+type manifestCache struct {
+	Key              []byte
+	Stamps           []fileStamp
+	Projects         Projects
+	Hooks            Hooks
+	Packages         Packages
+	ProjectOverrides map[string]Project
+	ImportOverrides  map[string]Import
+}
+
+func stampFile(path string) fileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{Path: path}
+	}
+	return fileStamp{Path: path, ModTime: fi.ModTime().UnixNano(), Size: fi.Size()}
+}
+
+// recordFile records that the manifest being loaded depends on file.
+func (ld *loader) recordFile(file string) {
+	if ld.inputs == nil {
+		ld.inputs = make(map[string]bool)
+	}
+	ld.inputs[file] = true
+}
+
+// recordRef records that the manifest being loaded depends on the revision
+// ref of the repository at repoPath, by recording the files git resolves it
+// from.
+func (ld *loader) recordRef(repoPath, ref string) {
+	if shaRE.MatchString(ref) {
+		return
+	}
+	gitDir := filepath.Join(repoPath, ".git")
+	if fi, err := os.Stat(gitDir); err != nil || !fi.IsDir() {
+		// The refs of worktrees and submodules live elsewhere.
+		ld.uncacheable = true
+		return
+	}
+	ld.recordFile(filepath.Join(gitDir, "packed-refs"))
+	for _, dir := range []string{"", "refs", "refs/tags", "refs/heads", "refs/remotes"} {
+		ld.recordFile(filepath.Join(gitDir, dir, ref))
+	}
+	ld.recordFile(filepath.Join(gitDir, "refs", "remotes", ref, "HEAD"))
+}
+
+// manifestCacheKey returns the key of the cached result of LoadManifestFile
+// for its arguments, or nil if the result cannot be cached.
+func manifestCacheKey(jirix *jiri.X, file string, localProjects Projects, localManifest bool) []byte {
+	if jirix.UsingSnapshot || jirix.IgnoreLockConflicts || jirix.UsingImportOverride {
+		// Loading a snapshot changes jirix.FetchingAttrs, and lock conflicts
+		// are not reported when ignored or with import overrides, so results
+		// loaded then must not be served to other commands.
+		return nil
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n%v\n%v\n%s\n", manifestCacheVersion, jirix.Root, file, localManifest, jirix.LockfileEnabled, jirix.LockfileName)
+	var keys ProjectKeys
+	for key := range localProjects {
+		keys = append(keys, key)
+	}
+	sort.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s\n%s\n", key, localProjects[key].Path)
+	}
+	return h.Sum(nil)
+}
+
+// readManifestCache returns the cached result of LoadManifestFile for key, or
+// nil if there is none or it is stale.
+func readManifestCache(jirix *jiri.X, key []byte) *manifestCache {
+	if key == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(jirix.ManifestCacheFile())
+	if err != nil {
+		return nil
+	}
+	c := &manifestCache{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(c); err != nil {
+		jirix.Logger.Debugf("ignoring invalid manifest cache: %v", err)
+		return nil
+	}
+	if !bytes.Equal(c.Key, key) {
+		return nil
+	}
+	for _, s := range c.Stamps {
+		if stampFile(s.Path) != s {
+			jirix.Logger.Debugf("manifest cache is stale: %s changed", s.Path)
+			return nil
+		}
+	}
+	return c
+}
+
+// writeManifestCache caches the result of ld for key, unless it depends on
+// files which cannot be stamped. Failures are only logged, as the cache is
+// an optimization.
+func writeManifestCache(jirix *jiri.X, key []byte, ld *loader) {
+	if key == nil || ld.uncacheable || ld.TmpDir != "" {
+		return
+	}
+	c := manifestCache{
+		Key:              key,
+		Projects:         ld.Projects,
+		Hooks:            ld.Hooks,
+		Packages:         ld.Packages,
+		ProjectOverrides: ld.ProjectOverrides,
+		ImportOverrides:  ld.ImportOverrides,
+	}
+	for file := range ld.inputs {
+		c.Stamps = append(c.Stamps, stampFile(file))
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(c); err != nil {
+		jirix.Logger.Debugf("cannot encode manifest cache: %v", err)
+		return
+	}
+	if err := safeWriteFile(jirix, jirix.ManifestCacheFile(), buf.Bytes()); err != nil {
+		jirix.Logger.Debugf("cannot write manifest cache: %v", err)
+	}
+}
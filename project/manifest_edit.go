@@ -0,0 +1,261 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/btwiuse/jiri"
+)
+
+// The functions below edit manifest files in place: elements are inserted
+// into or cut out of the file text, so that comments, ordering and formatting
+// of the rest of the file are kept, unlike with Manifest.ToFile.
+
+// AddManifestProject adds project p to the <projects> element of the manifest
+// file, or to its <overrides> element if override is true.
+func AddManifestProject(jirix *jiri.X, filename string, p Project, override bool) error {
+	if err := p.relativizePaths(jirix.Root); err != nil {
+		return err
+	}
+	if err := p.unfillDefaults(); err != nil {
+		return err
+	}
+	return editManifestFile(jirix, filename, func(m *Manifest, data []byte) ([]byte, error) {
+		section, existing := "projects", m.Projects
+		if override {
+			section, existing = "overrides", m.ProjectOverrides
+		}
+		for _, e := range existing {
+			if e.Name == p.Name && e.Remote == p.Remote {
+				return nil, fmt.Errorf("project %q with remote %q already exists in %s", p.Name, p.Remote, filename)
+			}
+		}
+		return insertManifestElement(data, section, "project", p)
+	})
+}
+
+// RemoveManifestProject removes the projects named name from the <projects>
+// element of the manifest file, or from its <overrides> element if override
+// is true. If remote is not empty, only projects with that remote are
+// removed. It returns the number of projects removed.
+func RemoveManifestProject(jirix *jiri.X, filename, name, remote string, override bool) (int, error) {
+	section := "projects"
+	if override {
+		section = "overrides"
+	}
+	n := 0
+	err := editManifestFile(jirix, filename, func(_ *Manifest, data []byte) ([]byte, error) {
+		var err error
+		data, n, err = removeManifestElements(data, section, "project", map[string]string{"name": name, "remote": remote})
+		return data, err
+	})
+	return n, err
+}
+
+// AddManifestImport adds import i to the <imports> element of the manifest
+// file, or to its <overrides> element if override is true.
+func AddManifestImport(jirix *jiri.X, filename string, i Import, override bool) error {
+	if err := i.unfillDefaults(); err != nil {
+		return err
+	}
+	return editManifestFile(jirix, filename, func(m *Manifest, data []byte) ([]byte, error) {
+		section, existing := "imports", m.Imports
+		if override {
+			section, existing = "overrides", m.ImportOverrides
+		}
+		for _, e := range existing {
+			if e.Name == i.Name && e.Remote == i.Remote && e.Manifest == i.Manifest {
+				return nil, fmt.Errorf("import %q of %q from %q already exists in %s", i.Name, i.Manifest, i.Remote, filename)
+			}
+		}
+		return insertManifestElement(data, section, "import", i)
+	})
+}
+
+// RemoveManifestImport removes the imports named name from the <imports>
+// element of the manifest file, or from its <overrides> element if override
+// is true. If manifest or remote are not empty, only imports with that
+// manifest or remote are removed. It returns the number of imports removed.
+func RemoveManifestImport(jirix *jiri.X, filename, manifest, name, remote string, override bool) (int, error) {
+	section := "imports"
+	if override {
+		section = "overrides"
+	}
+	n := 0
+	err := editManifestFile(jirix, filename, func(_ *Manifest, data []byte) ([]byte, error) {
+		var err error
+		data, n, err = removeManifestElements(data, section, "import", map[string]string{"manifest": manifest, "name": name, "remote": remote})
+		return data, err
+	})
+	return n, err
+}
+
+// editManifestFile applies edit to the content of the manifest file, checks
+// that the result is still a valid manifest and writes it back. A missing
+// file is treated as an empty manifest.
+func editManifestFile(jirix *jiri.X, filename string, edit func(*Manifest, []byte) ([]byte, error)) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return fmtError(err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("<manifest>\n</manifest>\n")
+	}
+	m, err := ManifestFromBytes(data)
+	if err != nil {
+		return fmt.Errorf("invalid manifest %s: %v", filename, err)
+	}
+	if data, err = edit(m, data); err != nil {
+		return err
+	}
+	if _, err := ManifestFromBytes(data); err != nil {
+		return fmt.Errorf("editing %s would produce an invalid manifest: %v", filename, err)
+	}
+	if err := backupManifestFile(jirix, filename); err != nil {
+		return err
+	}
+	return safeWriteFile(jirix, filename, data)
+}
+
+// insertManifestElement inserts elem, marshaled as a <tag> XML element, as
+// the last child of the <section> element of the manifest in data. The
+// section is created at the end of the manifest if it does not exist.
+func insertManifestElement(data []byte, section, tag string, elem interface{}) ([]byte, error) {
+	out, err := xml.Marshal(elem)
+	if err != nil {
+		return nil, err
+	}
+	// Use short empty elements, like Manifest.ToBytes.
+	if end := []byte("></" + tag + ">"); bytes.HasSuffix(out, end) && bytes.Count(out, []byte("<")) == 2 {
+		out = append(out[:len(out)-len(end)], []byte("/>")...)
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []string
+	manifestEnd := -1
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if len(stack) == 2 && stack[0] == "manifest" && t.Name.Local == section && int(d.InputOffset()) > offset &&
+				bytes.HasSuffix(data[:d.InputOffset()], []byte("/>")) {
+				// Expand a self-closing <section/>.
+				indent := lineIndent(data, offset)
+				repl := fmt.Sprintf("<%s>\n%s  %s\n%s</%s>", section, indent, out, indent, section)
+				return splice(data, offset, int(d.InputOffset()), []byte(repl)), nil
+			}
+		case xml.EndElement:
+			if len(stack) == 2 && stack[0] == "manifest" && t.Name.Local == section {
+				indent := lineIndent(data, offset)
+				if start := lineStart(data, offset); indent == string(data[start:offset]) {
+					// The closing tag is on its own line; insert a line before it.
+					return splice(data, start, start, []byte(fmt.Sprintf("%s  %s\n", indent, out))), nil
+				}
+				return splice(data, offset, offset, []byte(fmt.Sprintf("\n%s  %s\n%s", indent, out, indent))), nil
+			}
+			if len(stack) == 1 && t.Name.Local == "manifest" {
+				manifestEnd = offset
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if manifestEnd == -1 {
+		return nil, fmt.Errorf("no <manifest> element found")
+	}
+	start := lineStart(data, manifestEnd)
+	if lineIndent(data, manifestEnd) != string(data[start:manifestEnd]) {
+		// </manifest> is not on its own line.
+		start = manifestEnd
+		data = splice(data, start, start, []byte("\n"))
+		start++
+	}
+	return splice(data, start, start, []byte(fmt.Sprintf("  <%s>\n    %s\n  </%s>\n", section, out, section))), nil
+}
+
+// removeManifestElements removes the <tag> children of the <section> element
+// of the manifest in data whose attributes have the non-empty values of
+// attrs. Lines left empty are removed too.
+func removeManifestElements(data []byte, section, tag string, attrs map[string]string) ([]byte, int, error) {
+	type span struct{ start, end int }
+	var spans []span
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []string
+	start := -1
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			if len(stack) == 3 && stack[0] == "manifest" && stack[1] == section && t.Name.Local == tag {
+				values := make(map[string]string)
+				for _, a := range t.Attr {
+					values[a.Name.Local] = a.Value
+				}
+				start = offset
+				for k, v := range attrs {
+					if v != "" && values[k] != v {
+						start = -1
+						break
+					}
+				}
+			}
+		case xml.EndElement:
+			if len(stack) == 3 && start != -1 {
+				spans = append(spans, span{start, int(d.InputOffset())})
+				start = -1
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	for i := len(spans) - 1; i >= 0; i-- {
+		s, e := spans[i].start, spans[i].end
+		if ls := lineStart(data, s); lineIndent(data, s) == string(data[ls:s]) {
+			rest := bytes.IndexByte(data[e:], '\n')
+			if rest != -1 && len(bytes.TrimSpace(data[e:e+rest])) == 0 {
+				s, e = ls, e+rest+1
+			}
+		}
+		data = splice(data, s, e, nil)
+	}
+	return data, len(spans), nil
+}
+
+// lineStart returns the offset of the beginning of the line containing
+// offset.
+func lineStart(data []byte, offset int) int {
+	return bytes.LastIndexByte(data[:offset], '\n') + 1
+}
+
+// lineIndent returns the leading whitespace of the line containing offset.
+func lineIndent(data []byte, offset int) string {
+	line := data[lineStart(data, offset):offset]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+func splice(data []byte, start, end int, repl []byte) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(repl))
+	out = append(out, data[:start]...)
+	out = append(out, repl...)
+	return append(out, data[end:]...)
+}
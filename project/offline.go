@@ -0,0 +1,48 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/gitutil"
+)
+
+// checkOfflineOperations returns an error listing the operations that cannot
+// run without network access: creating projects, changing their remotes and
+// checking out revisions that have not been fetched yet.
+func checkOfflineOperations(jirix *jiri.X, ops operations) error {
+	var missing []string
+	checkRevision := func(p Project, source string) {
+		if p.Revision == "" || p.Revision == "HEAD" {
+			return
+		}
+		if _, err := gitutil.New(jirix, gitutil.RootDirOpt(source)).Show(p.Revision, ""); err != nil {
+			missing = append(missing, fmt.Sprintf("%s(%s): revision %s is not fetched", p.Name, source, p.Revision))
+		}
+	}
+	for _, op := range ops {
+		switch o := op.(type) {
+		case createOperation:
+			missing = append(missing, fmt.Sprintf("%s(%s): project is not cloned", o.project.Name, o.destination))
+		case changeRemoteOperation:
+			missing = append(missing, fmt.Sprintf("%s(%s): remote changed to %s", o.project.Name, o.source, o.project.Remote))
+		case updateOperation:
+			checkRevision(o.project, o.source)
+		case moveOperation:
+			checkRevision(o.project, o.source)
+		case nullOperation:
+			checkRevision(o.project, o.source)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("cannot update in offline mode, the following %d project(s) need network access:\n%s", len(missing), strings.Join(missing, "\n"))
+}
@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/gitutil"
@@ -118,13 +119,18 @@ func (op createOperation) checkoutProject(jirix *jiri.X, cache string) error {
 			opts = append(opts, gitutil.DepthOpt(op.project.HistoryDepth))
 		} else {
 			// Shallow clones can not be used as as local git reference
-			opts = append(opts, gitutil.ReferenceOpt(cache))
+			opts = append(opts, gitutil.ReferenceOpt(cache), gitutil.DissociateOpt(jirix.Dissociate))
 		}
-		if jirix.Partial {
+		// The clone filter of the project replaces the one of -partial.
+		if op.project.CloneFilter != "" {
+			opts = append(opts, gitutil.FilterOpt(op.project.CloneFilter))
+		} else if jirix.Partial {
 			opts = append(opts, gitutil.OmitBlobsOpt(true))
 		}
-		if cache != "" {
-			if err = clone(jirix, cache, op.destination, opts...); err != nil {
+		// git ignores --filter for local clones, so filtered projects are
+		// cloned from the remote even when a cache is available.
+		if cache != "" && op.project.CloneFilter == "" {
+			if err = clone(jirix, op.project, cache, op.destination, opts...); err != nil {
 				return err
 			}
 			scm := gitutil.New(jirix, gitutil.RootDirOpt(op.project.Path))
@@ -132,7 +138,9 @@ func (op createOperation) checkoutProject(jirix *jiri.X, cache string) error {
 				return err
 			}
 		} else {
-			if err = clone(jirix, remote, op.destination, opts...); err != nil {
+			if err = withMirrors(jirix, op.project, remote, func(r string) error {
+				return clone(jirix, op.project, r, op.destination, opts...)
+			}); err != nil {
 				return err
 			}
 		}
@@ -411,7 +419,7 @@ func (op changeRemoteOperation) Run(jirix *jiri.X) error {
 	}
 	defer git.DeleteRemote(tempRemote)
 
-	if err := fetch(jirix, op.project.Path, tempRemote); err != nil {
+	if err := fetch(jirix, op.project, tempRemote); err != nil {
 		return err
 	}
 
@@ -442,7 +450,7 @@ func (op changeRemoteOperation) Run(jirix *jiri.X) error {
 		return err
 	}
 
-	if err := fetch(jirix, op.project.Path, "", gitutil.AllOpt(true), gitutil.PruneOpt(true)); err != nil {
+	if err := fetch(jirix, op.project, "", gitutil.AllOpt(true), gitutil.PruneOpt(true)); err != nil {
 		return err
 	}
 
@@ -687,7 +695,7 @@ func computeOp(local, remote *Project, state *ProjectState, gc, rebaseTracked, r
 }
 
 // This function creates worktree and runs create operation in parallel
-func runCreateOperations(jirix *jiri.X, ops []createOperation) MultiError {
+func runCreateOperations(jirix *jiri.X, scheduler *fetchScheduler, ops []createOperation) MultiError {
 	count := len(ops)
 	if count == 0 {
 		return nil
@@ -738,9 +746,15 @@ func runCreateOperations(jirix *jiri.X, ops []createOperation) MultiError {
 		defer wg.Done()
 		for _, op := range tree.ops {
 			logMsg := fmt.Sprintf("Creating project %q", op.Project().Name)
+			if err := scheduler.wait(); err != nil {
+				errs <- fmt.Errorf("%s: %s", logMsg, err)
+				return
+			}
 			task := jirix.Logger.AddTaskMsg(logMsg)
 			jirix.Logger.Debugf("%v", op)
-			if err := op.Run(jirix); err != nil {
+			if err := scheduler.measure(op.Project().Path, func() error {
+				return op.Run(jirix)
+			}); err != nil {
 				task.Done()
 				errs <- fmt.Errorf("%s: %s", logMsg, err)
 				return
@@ -893,10 +907,12 @@ func runCommonOperations(jirix *jiri.X, ops operations, loglevel log.LogLevel) e
 		logMsg := fmt.Sprintf("Updating project %q", op.Project().Name)
 		task := jirix.Logger.AddTaskMsg(logMsg)
 		jirix.Logger.Logf(loglevel, "%s", op)
+		start := time.Now()
 		if err := op.Run(jirix); err != nil {
 			task.Done()
 			return fmt.Errorf("%s: %s", logMsg, err)
 		}
+		jirix.Metrics.Add("update", op.Project().Name, time.Since(start))
 		task.Done()
 	}
 	return nil
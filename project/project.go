@@ -22,6 +22,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"github.com/btwiuse/jiri"
@@ -37,6 +38,8 @@ var (
 	ssoRe                 = regexp.MustCompile("^sso://(.*?)/")
 	DefaultHookTimeout    = uint(5)  // DefaultHookTimeout is the time in minutes to wait for a hook to timeout.
 	DefaultPackageTimeout = uint(20) // DefaultPackageTimeout is the time in minutes to wait for cipd fetching packages.
+	// DefaultManifestLockTimeout is the time to wait for the lock taken by LockManifestFile.
+	DefaultManifestLockTimeout = 30 * time.Second
 )
 
 const (
@@ -58,6 +61,9 @@ type Project struct {
 	Path string `xml:"path,attr,omitempty"`
 	// Remote is the project remote.
 	Remote string `xml:"remote,attr,omitempty"`
+	// NewRemote is only used in project overrides. It replaces the remote of
+	// the overridden project, e.g. to fetch the project from a fork.
+	NewRemote string `xml:"newremote,attr,omitempty"`
 	// RemoteBranch is the name of the remote branch to track.
 	RemoteBranch string `xml:"remotebranch,attr,omitempty"`
 	// Revision is the revision the project should be advanced to during "jiri
@@ -68,6 +74,24 @@ type Project struct {
 	// commands. It is used to limit downloading large histories for large
 	// projects.
 	HistoryDepth int `xml:"historydepth,attr,omitempty"`
+	// CloneFilter is a git partial clone filter, e.g. "blob:none" or
+	// "tree:0", used when the project is first cloned. Missing objects are
+	// fetched lazily by git when they are needed.
+	CloneFilter string `xml:"clonefilter,attr,omitempty"`
+	// FetchTimeout is the time in minutes after which a git clone or fetch
+	// of the project is aborted. There is no timeout if it is zero.
+	FetchTimeout uint `xml:"fetchtimeout,attr,omitempty"`
+	// FetchAttempts is the number of times a git clone or fetch of the
+	// project is attempted, with an exponential backoff between attempts.
+	// It overrides the -attempts flag of "jiri update" when set.
+	FetchAttempts uint `xml:"fetchattempts,attr,omitempty"`
+	// Mirrors is a comma-separated list of urls of mirrors of the remote,
+	// which are fetched from in order when fetching from the remote fails.
+	Mirrors string `xml:"mirrors,attr,omitempty"`
+	// Submodules controls whether git submodules of the project are
+	// initialized and updated by "jiri update". It can be "true" for top
+	// level submodules only or "recursive" for nested submodules as well.
+	Submodules string `xml:"submodules,attr,omitempty"`
 	// GerritHost is the gerrit host where project CLs will be sent.
 	GerritHost string `xml:"gerrithost,attr,omitempty"`
 	// GitHooks is a directory containing git hooks that will be installed for
@@ -87,6 +111,21 @@ type Project struct {
 	// this project is successfully fetched.
 	Flag string `xml:"flag,attr,omitempty"`
 
+	// Deprecated is a message explaining that the project should not be
+	// used anymore, which "jiri update" shows as a warning. Replacement
+	// optionally names the project to use instead.
+	Deprecated  string `xml:"deprecated,attr,omitempty"`
+	Replacement string `xml:"replacement,attr,omitempty"`
+
+	// Copyfiles and Linkfiles are files of the project which are copied, or
+	// symlinked, to other locations of the jiri root after it is checked out.
+	Copyfiles []ProjectFile `xml:"copyfile"`
+	Linkfiles []ProjectFile `xml:"linkfile"`
+
+	// GitConfigs are variables of the local git config of the project, which
+	// are set when it is cloned and on every update.
+	GitConfigs []GitConfig `xml:"gitconfig"`
+
 	XMLName struct{} `xml:"project"`
 
 	// This is used to store computed key. This is useful when remote and
@@ -172,7 +211,9 @@ func (p Project) ToFile(jirix *jiri.X, filename string) error {
 		return fmt.Errorf("project xml.Marshal failed: %v", err)
 	}
 	// Same logic as Manifest.ToBytes, to make the output more compact.
-	data = bytes.Replace(data, endProjectSoloBytes, endElemSoloBytes, -1)
+	if len(p.Copyfiles) == 0 && len(p.Linkfiles) == 0 && len(p.GitConfigs) == 0 {
+		data = bytes.Replace(data, endProjectSoloBytes, endElemSoloBytes, -1)
+	}
 	if !bytes.HasSuffix(data, newlineBytes) {
 		data = append(data, '\n')
 	}
@@ -189,6 +230,18 @@ func (p *Project) absolutizePaths(basepath string) {
 	}
 }
 
+// checkRelativePaths returns an error if the paths of p, read from a
+// manifest, are absolute. Manifests only hold paths relative to the jiri root,
+// so that the root can be moved.
+func (p Project) checkRelativePaths() error {
+	for _, path := range []string{p.Path, p.GitHooks} {
+		if filepath.IsAbs(path) {
+			return fmt.Errorf("project %q has absolute path %q, paths should be relative to the jiri root. Legacy manifests can be fixed with 'jiri relocate'", p.Name, path)
+		}
+	}
+	return nil
+}
+
 // relativizePaths makes all absolute paths relative to basepath.
 func (p *Project) relativizePaths(basepath string) error {
 	if filepath.IsAbs(p.Path) {
@@ -240,10 +293,21 @@ func (p *Project) validate() error {
 	if strings.Contains(p.Name, KeySeparator) {
 		return fmt.Errorf("bad project: name cannot contain %q: %+v", KeySeparator, *p)
 	}
+	if p.CloneFilter != "" && !strings.HasPrefix(p.CloneFilter, "blob:") && !strings.HasPrefix(p.CloneFilter, "tree:") {
+		return fmt.Errorf("bad project: clonefilter should be a blob: or tree: filter, got %q: %+v", p.CloneFilter, *p)
+	}
+	switch p.Submodules {
+	case "", "true", "false", "recursive":
+	default:
+		return fmt.Errorf("bad project: submodules should be true, false or recursive, got %q: %+v", p.Submodules, *p)
+	}
 	return nil
 }
 
 func (p *Project) update(other *Project) {
+	if other.NewRemote != "" {
+		p.Remote = other.NewRemote
+	}
 	if other.Path != "" {
 		p.Path = other.Path
 	}
@@ -256,6 +320,21 @@ func (p *Project) update(other *Project) {
 	if other.HistoryDepth != 0 {
 		p.HistoryDepth = other.HistoryDepth
 	}
+	if other.CloneFilter != "" {
+		p.CloneFilter = other.CloneFilter
+	}
+	if other.FetchTimeout != 0 {
+		p.FetchTimeout = other.FetchTimeout
+	}
+	if other.FetchAttempts != 0 {
+		p.FetchAttempts = other.FetchAttempts
+	}
+	if other.Mirrors != "" {
+		p.Mirrors = other.Mirrors
+	}
+	if other.Submodules != "" {
+		p.Submodules = other.Submodules
+	}
 	if other.GerritHost != "" {
 		p.GerritHost = other.GerritHost
 	}
@@ -267,6 +346,24 @@ func (p *Project) update(other *Project) {
 	}
 }
 
+// DeprecationWarning returns the warning about p being deprecated, or an
+// empty string if it is not.
+func (p Project) DeprecationWarning() string {
+	if p.Deprecated == "" {
+		return ""
+	}
+	warning := fmt.Sprintf("Project %q is deprecated: %s", p.Name, p.Deprecated)
+	if p.Replacement != "" {
+		warning += fmt.Sprintf("\nUse project %q instead.", p.Replacement)
+	}
+	return warning
+}
+
+// HasSubmodules returns true if submodules of the project are managed by jiri.
+func (p Project) HasSubmodules() bool {
+	return p.Submodules == "true" || p.Submodules == "recursive"
+}
+
 // WriteProjectFlags write flag files into project directory using in "flag"
 // attribute from projs.
 func WriteProjectFlags(jirix *jiri.X, projs Projects) error {
@@ -765,6 +862,8 @@ func CreateSnapshot(jirix *jiri.X, file string, hooks Hooks, pkgs Packages, loca
 
 // CheckoutSnapshot updates project state to the state specified in the given
 // snapshot file.  Note that the snapshot file must not contain remote imports.
+// If the jiri root has a snapshot signers file, the snapshot must have a
+// detached signature made by one of the keys listed in it.
 func CheckoutSnapshot(jirix *jiri.X, snapshot string, gc, runHooks, fetchPkgs bool, runHookTimeout, fetchTimeout uint) error {
 	jirix.UsingSnapshot = true
 	// Find all local projects.
@@ -776,11 +875,16 @@ func CheckoutSnapshot(jirix *jiri.X, snapshot string, gc, runHooks, fetchPkgs bo
 	if err != nil {
 		return err
 	}
-	remoteProjects, hooks, pkgs, err := LoadSnapshotFile(jirix, snapshot)
+	snapshotFile, cleanup, err := verifiedSnapshot(jirix, snapshot)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	remoteProjects, hooks, pkgs, err := LoadSnapshotFile(jirix, snapshotFile)
 	if err != nil {
 		return err
 	}
-	if err := updateProjects(jirix, localProjects, remoteProjects, hooks, pkgs, gc, runHookTimeout, fetchTimeout, false /*rebaseTracked*/, false /*rebaseUntracked*/, false /*rebaseAll*/, true /*snapshot*/, runHooks, fetchPkgs); err != nil {
+	if err := updateProjects(jirix, localProjects, remoteProjects, hooks, pkgs, gc, runHookTimeout, fetchTimeout, false /*rebaseTracked*/, false /*rebaseUntracked*/, false /*rebaseAll*/, true /*snapshot*/, runHooks, fetchPkgs, nil); err != nil {
 		return err
 	}
 	return WriteUpdateHistorySnapshot(jirix, snapshot, hooks, pkgs, false)
@@ -1051,6 +1155,9 @@ func loadManifestFiles(jirix *jiri.X, manifestFiles []string, localManifest bool
 }
 
 func writeLockFile(jirix *jiri.X, lockfilePath string, projectLocks ProjectLocks, pkgLocks PackageLocks) error {
+	if err := jirix.CheckWrite(lockfilePath, "write lockfile"); err != nil {
+		return err
+	}
 	data, err := MarshalLockEntries(projectLocks, pkgLocks)
 	if err != nil {
 		return err
@@ -1241,6 +1348,7 @@ func GenerateJiriLockFile(jirix *jiri.X, manifestFiles []string, resolveConfig R
 func UpdateUniverse(jirix *jiri.X, gc, localManifest, rebaseTracked, rebaseUntracked, rebaseAll, runHooks, fetchPkgs bool, runHookTimeout, fetchTimeout uint) (e error) {
 	jirix.Logger.Infof("Updating all projects")
 
+	var summary updateSummary
 	updateFn := func(scanMode ScanMode) error {
 		jirix.TimerPush(fmt.Sprintf("update universe: %s", scanMode))
 		defer jirix.TimerPop()
@@ -1260,12 +1368,16 @@ func UpdateUniverse(jirix *jiri.X, gc, localManifest, rebaseTracked, rebaseUntra
 		}
 
 		// Actually update the projects.
-		return updateProjects(jirix, localProjects, remoteProjects, hooks, pkgs, gc, runHookTimeout, fetchTimeout, rebaseTracked, rebaseUntracked, rebaseAll, false /*snapshot*/, runHooks, fetchPkgs)
+		return updateProjects(jirix, localProjects, remoteProjects, hooks, pkgs, gc, runHookTimeout, fetchTimeout, rebaseTracked, rebaseUntracked, rebaseAll, false /*snapshot*/, runHooks, fetchPkgs, &summary)
 	}
 
 	// Specifying gc should always force a full filesystem scan.
 	if gc {
-		return updateFn(FullScan)
+		if err := updateFn(FullScan); err != nil {
+			return err
+		}
+		summary.log(jirix)
+		return nil
 	}
 
 	// Attempt a fast update, which uses the latest snapshot to avoid doing
@@ -1280,13 +1392,26 @@ func UpdateUniverse(jirix *jiri.X, gc, localManifest, rebaseTracked, rebaseUntra
 			return fmt.Errorf("%v, %v", err, err2)
 		}
 	}
+	summary.log(jirix)
 
 	return nil
 }
 
+// updateSummary counts the projects changed by an update.
+type updateSummary struct {
+	upToDate, updated int
+}
+
+func (s updateSummary) log(jirix *jiri.X) {
+	jirix.Logger.Infof("%d project(s) up-to-date, %d updated", s.upToDate, s.updated)
+}
+
 // WriteUpdateHistoryLog creates a log file of the current update process.
 func WriteUpdateHistoryLog(jirix *jiri.X) error {
 	logFile := filepath.Join(jirix.UpdateHistoryLogDir(), time.Now().Format((time.RFC3339)))
+	if err := jirix.CheckWrite(logFile, "write update history"); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
 		return fmtError(err)
 	}
@@ -1363,7 +1488,10 @@ func WriteUpdateHistorySnapshot(jirix *jiri.X, snapshotPath string, hooks Hooks,
 	if err := os.RemoveAll(latestLink); err != nil {
 		return fmtError(err)
 	}
-	return fmtError(os.Symlink(snapshotFile, latestLink))
+	if err := os.Symlink(snapshotFile, latestLink); err != nil {
+		return fmtError(err)
+	}
+	return PruneUpdateHistory(jirix)
 }
 
 // CleanupProjects restores the given jiri projects back to their detached
@@ -1371,6 +1499,9 @@ func WriteUpdateHistorySnapshot(jirix *jiri.X, snapshotPath string, hooks Hooks,
 // all the local changes. If "cleanupBranches" is true, it will also delete all
 // the non-master branches.
 func CleanupProjects(jirix *jiri.X, localProjects Projects, cleanupBranches bool) (e error) {
+	if err := jirix.CheckWrite(jirix.Root, "clean up projects"); err != nil {
+		return err
+	}
 	remoteProjects, _, _, err := LoadManifest(jirix)
 	if err != nil {
 		return err
@@ -1453,6 +1584,11 @@ func resetLocalProject(jirix *jiri.X, local, remote Project, cleanupBranches boo
 
 // IsLocalProject returns true if there is a project at the given path.
 func IsLocalProject(jirix *jiri.X, path string) (bool, error) {
+	// Submodules have a .git file instead of a directory, they are managed
+	// by the project containing them.
+	if fi, err := os.Stat(filepath.Join(path, ".git")); err == nil && !fi.IsDir() {
+		return false, nil
+	}
 	// Existence of a metadata directory is how we know we've found a
 	// Jiri-maintained project.
 	metadataDir := filepath.Join(path, jiri.ProjectMetaDir)
@@ -1590,33 +1726,29 @@ func fetchAll(jirix *jiri.X, project Project) error {
 	}
 	scm := gitutil.New(jirix, gitutil.RootDirOpt(project.Path))
 	remote := rewriteRemote(jirix, project.Remote)
-	r := remote
 	cachePath, err := project.CacheDirPath(jirix)
 	if err != nil {
 		return err
 	}
-	if cachePath != "" {
-		r = cachePath
-	}
 	defer func() {
 		if err := scm.SetRemoteUrl("origin", remote); err != nil {
 			jirix.Logger.Errorf("failed to set remote back to %v for project %+v", remote, project)
 		}
 	}()
-	if err := scm.SetRemoteUrl("origin", r); err != nil {
-		return err
-	}
-	if project.HistoryDepth > 0 {
-		if err := fetch(jirix, project.Path, "origin", gitutil.PruneOpt(true),
-			gitutil.DepthOpt(project.HistoryDepth), gitutil.UpdateShallowOpt(true)); err != nil {
+	fetchOrigin := func(r string) error {
+		if err := scm.SetRemoteUrl("origin", r); err != nil {
 			return err
 		}
-	} else {
-		if err := fetch(jirix, project.Path, "origin", gitutil.PruneOpt(true)); err != nil {
-			return err
+		if project.HistoryDepth > 0 {
+			return fetch(jirix, project, "origin", gitutil.PruneOpt(true),
+				gitutil.DepthOpt(project.HistoryDepth), gitutil.UpdateShallowOpt(true))
 		}
+		return fetch(jirix, project, "origin", gitutil.PruneOpt(true))
 	}
-	return nil
+	if cachePath != "" {
+		return fetchOrigin(cachePath)
+	}
+	return withMirrors(jirix, project, remote, fetchOrigin)
 }
 
 func GetHeadRevision(jirix *jiri.X, project Project) (string, error) {
@@ -1641,9 +1773,17 @@ func checkoutHeadRevision(jirix *jiri.X, project Project, forceCheckout bool) er
 		return nil
 	}
 	jirix.Logger.Debugf("Checkout %s to head revision %s failed, fallback to fetch: %v", project.Name, revision, err)
+	if project.HistoryDepth > 0 {
+		// The revision might be older than the shallow history, deepen it.
+		if err2 := fetch(jirix, project, "origin", gitutil.UnshallowOpt(true)); err2 != nil {
+			jirix.Logger.Debugf("Unshallow %s failed: %v", project.Name, err2)
+		} else if err = git.CheckoutBranch(revision, gitutil.DetachOpt(true), gitutil.ForceOpt(forceCheckout)); err == nil {
+			return nil
+		}
+	}
 	if project.Revision != "" && project.Revision != "HEAD" {
 		//might be a tag
-		if err2 := fetch(jirix, project.Path, "origin", gitutil.FetchTagOpt(project.Revision)); err2 != nil {
+		if err2 := fetch(jirix, project, "origin", gitutil.FetchTagOpt(project.Revision)); err2 != nil {
 			// error while fetching tag, return original err and debug log this err
 			return fmt.Errorf("error while fetching tag after failed to checkout revision %s for project %s (%s): %s\ncheckout error: %v", revision, project.Name, project.Path, err2, err)
 		}
@@ -1683,16 +1823,45 @@ func syncProjectMaster(jirix *jiri.X, project Project, state ProjectState, rebas
 	if diff, err := scm.FilesWithUncommittedChanges(); err != nil {
 		return fmt.Errorf("Cannot get uncommited changes for project %q: %s", project.Name, err)
 	} else if len(diff) != 0 {
-		msg := fmt.Sprintf("Project %s(%s) contains uncommited changes:", project.Name, relativePath)
-		if jirix.Logger.LoggerLevel >= log.DebugLevel {
-			for _, item := range diff {
-				msg += "\n" + item
+		choices := []string{ConflictFail, ConflictSkip, ConflictStash, ConflictBackup, ConflictRebase}
+		switch conflictPolicy(jirix, project, relativePath, "contains uncommited changes", choices) {
+		case ConflictSkip:
+			jirix.Logger.Warningf("Project %s(%s) contains uncommited changes, not updating it\n\n", project.Name, relativePath)
+			return nil
+		case ConflictStash, ConflictRebase:
+			if _, err := scm.Stash(); err != nil {
+				return fmt.Errorf("Cannot stash uncommited changes for project %q: %s", project.Name, err)
+			}
+			// This should run last so that the changes are reapplied to
+			// the branch or detached head the project was on.
+			defer func() {
+				if err := scm.StashPop(); err != nil {
+					gitCommand := jirix.Color.Yellow("git -C %q stash pop", relativePath)
+					msg := fmt.Sprintf("For project %s(%s), not able to reapply your uncommited changes, they are kept in the stash: %s", project.Name, relativePath, err)
+					msg += fmt.Sprintf("\nResolve the conflicts and run '%s'\n\n", gitCommand)
+					jirix.Logger.Errorf(msg)
+					jirix.IncrementFailures()
+				}
+			}()
+		case ConflictBackup:
+			backup, err := backupUncommittedChanges(jirix, project, state.CurrentBranch.Name)
+			if err != nil {
+				return fmt.Errorf("Cannot save uncommited changes for project %q: %s", project.Name, err)
+			}
+			jirix.Logger.Warningf("For project %s(%s), saved your uncommited changes on branch %q\n\n", project.Name, relativePath, backup)
+		default:
+			msg := fmt.Sprintf("Project %s(%s) contains uncommited changes:", project.Name, relativePath)
+			if jirix.Logger.LoggerLevel >= log.DebugLevel {
+				for _, item := range diff {
+					msg += "\n" + item
+				}
 			}
+			msg += fmt.Sprintf("\nCommit or discard the changes and try again, or update with -on-conflict=stash")
+			msg += fmt.Sprintf("\nto reapply them after updating or -on-conflict=backup to save them on a branch.\n\n")
+			jirix.Logger.Errorf(msg)
+			jirix.IncrementFailures()
+			return nil
 		}
-		msg += fmt.Sprintf("\nCommit or discard the changes and try again.\n\n")
-		jirix.Logger.Errorf(msg)
-		jirix.IncrementFailures()
-		return nil
 	}
 
 	if state.CurrentBranch.Name == "" || snapshot { // detached head
@@ -1738,9 +1907,7 @@ func syncProjectMaster(jirix *jiri.X, project Project, state ProjectState, rebas
 			return nil
 		}
 		if err := scm.Merge(tracking.Name, gitutil.FfOnlyOpt(true)); err != nil {
-			msg := fmt.Sprintf("For project %s(%s), not able to fast forward your local branch %q to %q\n\n", project.Name, relativePath, state.CurrentBranch.Name, tracking.Name)
-			jirix.Logger.Errorf(msg)
-			jirix.IncrementFailures()
+			return resolveDivergedBranch(jirix, project, relativePath, state.CurrentBranch.Name, tracking.Name, true /*canRebase*/)
 		}
 		return nil
 	}
@@ -1812,12 +1979,8 @@ func syncProjectMaster(jirix *jiri.X, project Project, state ProjectState, rebas
 			}
 			if rebaseSuccess {
 				jirix.Logger.Debugf("For project %q, rebased your local branch %q on %q", project.Name, branch.Name, tracking.Name)
-			} else {
-				msg := fmt.Sprintf("For project %s(%s), not able to rebase your local branch %q onto %q", project.Name, relativePath, branch.Name, tracking.Name)
-				msg += "\nPlease do it manually\n\n"
-				jirix.Logger.Errorf(msg)
-				jirix.IncrementFailures()
-				continue
+			} else if err := resolveDivergedBranch(jirix, project, relativePath, branch.Name, tracking.Name, false /*canRebase*/); err != nil {
+				return err
 			}
 		} else {
 			if branchesContainingHead[branch.Name] {
@@ -2041,8 +2204,8 @@ func updateOrCreateCache(jirix *jiri.X, dir, remote, branch, revision string, de
 		} else {
 			opts = append(opts, gitutil.BareOpt(true))
 		}
-		if err := gitutil.New(jirix).Clone(remote, dir, opts...); err != nil {
-			return err
+		if err := gitutil.New(jirix, gitutil.TerminalPromptOpt(false)).Clone(remote, dir, opts...); err != nil {
+			return withAuthHint(err)
 		}
 
 		git := gitutil.New(jirix, gitutil.RootDirOpt(dir))
@@ -2076,13 +2239,17 @@ func updateOrCreateCache(jirix *jiri.X, dir, remote, branch, revision string, de
 	return createCache()
 }
 
-// updateCache creates the cache or updates it if already present.
-func updateCache(jirix *jiri.X, remoteProjects Projects) error {
+// UpdateCache creates the cache of the given projects or updates it if
+// already present. It does nothing if no cache is configured.
+func UpdateCache(jirix *jiri.X, remoteProjects Projects) error {
 	jirix.TimerPush("update cache")
 	defer jirix.TimerPop()
 	if jirix.Cache == "" {
 		return nil
 	}
+	if err := jirix.CheckWrite(jirix.Cache, "update cache"); err != nil {
+		return err
+	}
 
 	errs := make(chan error, len(remoteProjects))
 	var wg sync.WaitGroup
@@ -2099,17 +2266,19 @@ func updateCache(jirix *jiri.X, remoteProjects Projects) error {
 			}
 			wg.Add(1)
 			fetchLimit <- struct{}{}
-			go func(dir, remote string, depth int, branch, revision string, cacheMutex *sync.Mutex) {
+			go func(dir string, project Project, cacheMutex *sync.Mutex) {
 				cacheMutex.Lock()
 				defer func() { <-fetchLimit }()
 				defer wg.Done()
 				defer cacheMutex.Unlock()
-				remote = rewriteRemote(jirix, remote)
-				if err := updateOrCreateCache(jirix, dir, remote, branch, revision, depth); err != nil {
+				remote := rewriteRemote(jirix, project.Remote)
+				if err := withMirrors(jirix, project, remote, func(r string) error {
+					return updateOrCreateCache(jirix, dir, r, project.RemoteBranch, project.Revision, project.HistoryDepth)
+				}); err != nil {
 					errs <- err
 					return
 				}
-			}(cacheDirPath, project.Remote, project.HistoryDepth, project.RemoteBranch, project.Revision, processingPath[cacheDirPath])
+			}(cacheDirPath, project, processingPath[cacheDirPath])
 		} else {
 			errs <- err
 		}
@@ -2128,12 +2297,84 @@ func updateCache(jirix *jiri.X, remoteProjects Projects) error {
 	return nil
 }
 
-func fetchLocalProjects(jirix *jiri.X, localProjects, remoteProjects Projects) error {
-	jirix.TimerPush("fetch local projects")
+// updateSubmodules initializes and updates the submodules of projects whose
+// manifest entry sets the submodules attribute.
+func updateSubmodules(jirix *jiri.X, projects Projects) error {
+	jirix.TimerPush("update submodules")
 	defer jirix.TimerPop()
-	fetchLimit := make(chan struct{}, jirix.Jobs)
-	errs := make(chan error, len(localProjects))
+	limit := make(chan struct{}, jirix.Jobs)
+	errs := make(chan error, len(projects))
 	var wg sync.WaitGroup
+	for _, project := range projects {
+		if !project.HasSubmodules() || project.LocalConfig.Ignore || project.LocalConfig.NoUpdate {
+			continue
+		}
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(project Project) {
+			defer func() { <-limit }()
+			defer wg.Done()
+			task := jirix.Logger.AddTaskMsg("Updating submodules for project %q", project.Name)
+			defer task.Done()
+			if err := retry.Function(jirix, func() error {
+				return gitutil.New(jirix, gitutil.RootDirOpt(project.Path)).SubmoduleUpdate(project.Submodules == "recursive")
+			}, fmt.Sprintf("Updating submodules for %s", project.Path), retry.AttemptsOpt(jirix.Attempts)); err != nil {
+				errs <- fmt.Errorf("submodule update failed for %v: %v", project.Name, err)
+			}
+		}(project)
+	}
+	wg.Wait()
+	close(errs)
+
+	multiErr := make(MultiError, 0)
+	for err := range errs {
+		multiErr = append(multiErr, err)
+	}
+	if len(multiErr) != 0 {
+		return multiErr
+	}
+	return nil
+}
+
+type fetchFailure struct {
+	project Project
+	err     error
+}
+
+// fetchFailuresError returns an error holding a table of all projects that
+// could not be fetched, as a MultiError would only show the first of them.
+func fetchFailuresError(failures []fetchFailure, total int) error {
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].project.Path < failures[j].project.Path
+	})
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "PROJECT\tPATH\tERROR\n")
+	for _, f := range failures {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.project.Name, f.project.Path, strings.Replace(strings.TrimSpace(f.err.Error()), "\n", " ", -1))
+	}
+	w.Flush()
+	return fmt.Errorf("Fetch failed for %d of %d project(s):\n%s", len(failures), total, buf.String())
+}
+
+func fetchLocalProjects(jirix *jiri.X, scheduler *fetchScheduler, localProjects, remoteProjects Projects) error {
+	jirix.TimerPush("fetch local projects")
+	defer jirix.TimerPop()
+	// The state is only needed to skip unchanged projects and to fetch small
+	// projects first when disk space may run out.
+	useState := jirix.Incremental || jirix.MinFreeDisk != 0
+	state := &updateState{Projects: make(map[ProjectKey]fetchRecord)}
+	if useState {
+		var err error
+		if state, err = loadUpdateState(jirix); err != nil {
+			return err
+		}
+	}
+	unchanged := make(map[ProjectKey]bool)
+	if jirix.Incremental {
+		unchanged = state.unchangedProjects(jirix, localProjects, remoteProjects)
+	}
+	var keys []ProjectKey
 	for key, project := range localProjects {
 		if r, ok := remoteProjects[key]; ok {
 			if project.LocalConfig.Ignore || project.LocalConfig.NoUpdate {
@@ -2144,32 +2385,71 @@ func fetchLocalProjects(jirix *jiri.X, localProjects, remoteProjects Projects) e
 			if r.Remote != project.Remote {
 				continue
 			}
-			wg.Add(1)
-			fetchLimit <- struct{}{}
-			project.HistoryDepth = r.HistoryDepth
-			go func(project Project) {
-				defer func() { <-fetchLimit }()
-				defer wg.Done()
-				task := jirix.Logger.AddTaskMsg("Fetching remotes for project %q", project.Name)
-				defer task.Done()
-				if err := fetchAll(jirix, project); err != nil {
-					errs <- fmt.Errorf("fetch failed for %v: %v", project.Name, err)
-					return
-				}
-			}(project)
+			if unchanged[key] {
+				jirix.Logger.Debugf("Not fetching project %q as its remote branch is unchanged", project.Name)
+				continue
+			}
+			keys = append(keys, key)
 		}
 	}
+	orderFetches(state, keys)
+	fetchLimit := make(chan struct{}, jirix.Jobs)
+	errs := make(chan fetchFailure, len(localProjects))
+	var wg sync.WaitGroup
+	var stopErr error
+	total := 0
+	for i, key := range keys {
+		project, r := localProjects[key], remoteProjects[key]
+		fetchLimit <- struct{}{}
+		if err := scheduler.wait(); err != nil {
+			<-fetchLimit
+			jirix.Logger.Warningf("Stopped fetching before %d of %d project(s): %v\n\n", len(keys)-i, len(keys), err)
+			stopErr = err
+			break
+		}
+		total++
+		wg.Add(1)
+		project.HistoryDepth = r.HistoryDepth
+		go func(project Project, branch string) {
+			defer func() { <-fetchLimit }()
+			defer wg.Done()
+			task := jirix.Logger.AddTaskMsg("Fetching remotes for project %q", project.Name)
+			defer task.Done()
+			start := time.Now()
+			if err := scheduler.measure(project.Path, func() error {
+				return fetchAll(jirix, project)
+			}); err != nil {
+				errs <- fetchFailure{project, err}
+				return
+			}
+			jirix.Metrics.Add("fetch", project.Name, time.Since(start))
+			if !useState {
+				return
+			}
+			if err := state.record(jirix, project, branch); err != nil {
+				jirix.Logger.Debugf("could not record fetch state of project %q: %v", project.Name, err)
+			}
+		}(project, r.RemoteBranch)
+	}
 	wg.Wait()
 	close(errs)
+	if len(unchanged) != 0 {
+		jirix.Logger.Infof("Skipped fetching %d project(s) with unchanged remotes", len(unchanged))
+	}
+	if useState {
+		if err := state.write(jirix); err != nil {
+			jirix.Logger.Warningf("Could not save update state: %v\n\n", err)
+		}
+	}
 
-	multiErr := make(MultiError, 0)
-	for err := range errs {
-		multiErr = append(multiErr, err)
+	var failures []fetchFailure
+	for f := range errs {
+		failures = append(failures, f)
 	}
-	if len(multiErr) != 0 {
-		return multiErr
+	if len(failures) != 0 {
+		return fetchFailuresError(failures, total)
 	}
-	return nil
+	return stopErr
 }
 
 // FilterOptionalProjectsPackages removes projects and packages in place if the Optional field is true and
@@ -2204,12 +2484,31 @@ func FilterOptionalProjectsPackages(jirix *jiri.X, attrs string, projects Projec
 	return nil
 }
 
-func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks Hooks, pkgs Packages, gc bool, runHookTimeout, fetchTimeout uint, rebaseTracked, rebaseUntracked, rebaseAll, snapshot, shouldRunHooks, shouldFetchPkgs bool) error {
+// warnDeprecatedProjects warns about the deprecated projects in projects.
+func warnDeprecatedProjects(jirix *jiri.X, projects Projects) {
+	var keys ProjectKeys
+	for key, p := range projects {
+		if p.Deprecated != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(keys)
+	for _, key := range keys {
+		jirix.Logger.Warningf("%s\n\n", projects[key].DeprecationWarning())
+	}
+}
+
+func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks Hooks, pkgs Packages, gc bool, runHookTimeout, fetchTimeout uint, rebaseTracked, rebaseUntracked, rebaseAll, snapshot, shouldRunHooks, shouldFetchPkgs bool, summary *updateSummary) error {
 	jirix.TimerPush("update projects")
 	defer jirix.TimerPop()
+	if err := jirix.CheckWrite(jirix.Root, "update projects"); err != nil {
+		return err
+	}
 
 	packageFetched := false
 	hookRun := false
+	jirix.Mirrors = &jiri.MirrorLog{}
+	defer func() { jirix.Mirrors = nil }()
 	defer func() {
 		if shouldFetchPkgs && !packageFetched {
 			jirix.Logger.Infof("Jiri packages are not fetched due to fatal errors when updating projects.")
@@ -2223,12 +2522,22 @@ func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks
 	if err := FilterOptionalProjectsPackages(jirix, jirix.FetchingAttrs, remoteProjects, pkgs); err != nil {
 		return err
 	}
-
-	if err := updateCache(jirix, remoteProjects); err != nil {
+	sparse, err := filterViewProjects(jirix, remoteProjects)
+	if err != nil {
 		return err
 	}
-	if err := fetchLocalProjects(jirix, localProjects, remoteProjects); err != nil {
-		return err
+	warnDeprecatedProjects(jirix, remoteProjects)
+
+	scheduler := newFetchScheduler(jirix)
+	if jirix.Offline {
+		jirix.Logger.Infof("Not fetching projects in offline mode")
+	} else {
+		if err := UpdateCache(jirix, remoteProjects); err != nil {
+			return err
+		}
+		if err := fetchLocalProjects(jirix, scheduler, localProjects, remoteProjects); err != nil {
+			return err
+		}
 	}
 	states, err := GetProjectStates(jirix, localProjects, false)
 	if err != nil {
@@ -2239,6 +2548,11 @@ func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks
 	}
 
 	ops := computeOperations(localProjects, remoteProjects, states, gc, rebaseTracked, rebaseUntracked, rebaseAll, snapshot)
+	if jirix.Offline {
+		if err := checkOfflineOperations(jirix, ops); err != nil {
+			return err
+		}
+	}
 	moveOperations := []moveOperation{}
 	changeRemoteOperations := operations{}
 	deleteOperations := []deleteOperation{}
@@ -2265,6 +2579,10 @@ func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks
 			nullOperations = append(nullOperations, o)
 		}
 	}
+	// Check out nothing rather than fill the disk midway.
+	if err := checkFreeDisk(jirix); err != nil {
+		return err
+	}
 	if err := runDeleteOperations(jirix, deleteOperations, gc); err != nil {
 		return err
 	}
@@ -2277,12 +2595,17 @@ func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks
 	if err := runCommonOperations(jirix, updateOperations, log.DebugLevel); err != nil {
 		return err
 	}
-	if err := runCreateOperations(jirix, createOperations); err != nil {
+	if err := runCreateOperations(jirix, scheduler, createOperations); err != nil {
 		return err
 	}
 	if err := runCommonOperations(jirix, nullOperations, log.TraceLevel); err != nil {
 		return err
 	}
+	if summary != nil {
+		summary.upToDate = len(nullOperations)
+		summary.updated = len(ops) - len(nullOperations) - len(deleteOperations)
+	}
+	logMirrorsUsed(jirix)
 	jirix.TimerPush("jiri revision files")
 	for _, project := range remoteProjects {
 		if !(project.LocalConfig.Ignore || project.LocalConfig.NoUpdate) {
@@ -2300,6 +2623,19 @@ func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks
 	}
 	jirix.TimerPop()
 
+	if err := applySparseCheckouts(jirix, remoteProjects, sparse); err != nil {
+		return err
+	}
+	if err := updateSubmodules(jirix, remoteProjects); err != nil {
+		return err
+	}
+	if err := updateProjectFiles(jirix, remoteProjects); err != nil {
+		return err
+	}
+	if err := applyGitConfigs(jirix, remoteProjects); err != nil {
+		return err
+	}
+
 	if projectStatuses, err := getProjectStatus(jirix, remoteProjects); err != nil {
 		return fmt.Errorf("Error getting project status: %s", err)
 	} else if len(projectStatuses) != 0 {
@@ -2329,7 +2665,12 @@ func updateProjects(jirix *jiri.X, localProjects, remoteProjects Projects, hooks
 		jirix.Logger.Warningf("%s\n\n", msg)
 	}
 
-	if shouldFetchPkgs {
+	if shouldFetchPkgs && jirix.Offline {
+		packageFetched = true
+		if len(pkgs) > 0 {
+			jirix.Logger.Warningf("Not fetching %d package(s) in offline mode\n\n", len(pkgs))
+		}
+	} else if shouldFetchPkgs {
 		packageFetched = true
 		if len(pkgs) > 0 {
 			if err := FetchPackages(jirix, remoteProjects, pkgs, fetchTimeout); err != nil {
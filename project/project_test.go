@@ -6,24 +6,30 @@ package project_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/cipd"
+	"github.com/btwiuse/jiri/envvar"
 	"github.com/btwiuse/jiri/gitutil"
 	"github.com/btwiuse/jiri/jiritest"
 	"github.com/btwiuse/jiri/jiritest/xtest"
+	"github.com/btwiuse/jiri/log"
 	"github.com/btwiuse/jiri/project"
+	"github.com/btwiuse/jiri/tool"
 )
 
 func dirExists(dirname string) error {
@@ -308,6 +314,294 @@ func TestUpdateUniverseSimple(t *testing.T) {
 	}
 }
 
+// TestUpdateUniverseIncremental tests that an incremental update only fetches
+// the projects whose remote branch moved since the last recorded fetch, and
+// that the update state is only written with -incremental.
+func TestUpdateUniverseIncremental(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fake.X.UpdateStateFile()); !os.IsNotExist(err) {
+		t.Errorf("expected no update state without -incremental, got: %v", err)
+	}
+	fake.X.Incremental = true
+
+	writeReadme(t, fake.X, fake.Projects[localProjects[1].Name], "new readme")
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[0], "initial readme")
+	checkReadme(t, fake.X, localProjects[1], "new readme")
+
+	// Pretend project 0 was already fetched at its new head, so that it is
+	// skipped.
+	writeReadme(t, fake.X, fake.Projects[localProjects[0].Name], "new readme")
+	rev, err := gitutil.New(fake.X, gitutil.RootDirOpt(fake.Projects[localProjects[0].Name])).CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(fake.X.UpdateStateFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state struct {
+		Projects map[string]map[string]interface{} `json:"projects"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	rec, ok := state.Projects[string(localProjects[0].Key())]
+	if !ok {
+		t.Fatalf("no update state recorded for project %q", localProjects[0].Name)
+	}
+	rec["revision"] = rev
+	if data, err = json.Marshal(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fake.X.UpdateStateFile(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[0], "initial readme")
+
+	fake.X.Incremental = false
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[0], "new readme")
+}
+
+// TestUpdateUniverseOffline tests that an offline update does not fetch, and
+// fails listing the projects it would need to clone.
+func TestUpdateUniverseOffline(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	fake.X.Offline = true
+
+	writeReadme(t, fake.X, fake.Projects[localProjects[1].Name], "new readme")
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[1], "initial readme")
+
+	// The manifest is not fetched either, so remove a project to make update
+	// clone it.
+	p := localProjects[1]
+	if err := os.RemoveAll(p.Path); err != nil {
+		t.Fatal(err)
+	}
+	err := fake.UpdateUniverse(false)
+	if err == nil || !strings.Contains(err.Error(), p.Name+"("+p.Path+"): project is not cloned") {
+		t.Fatalf("expected error about %q not being cloned, got: %v", p.Name, err)
+	}
+	if err := dirExists(p.Path); err == nil {
+		t.Fatalf("project %q should not have been created", p.Name)
+	}
+
+	fake.X.Offline = false
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[1], "new readme")
+}
+
+// TestUpdateUniverseNoWrite tests that nothing in the jiri root is modified in
+// -no-write mode, while reading it still works.
+func TestUpdateUniverseNoWrite(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	fake.X.NoWrite = true
+
+	writeReadme(t, fake.X, fake.Projects[localProjects[1].Name], "new readme")
+	if err := fake.UpdateUniverse(false); err == nil || !strings.Contains(err.Error(), "-no-write mode") {
+		t.Fatalf("expected update to be refused in -no-write mode, got: %v", err)
+	}
+	checkReadme(t, fake.X, localProjects[1], "initial readme")
+	if _, _, _, err := project.LoadManifest(fake.X); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := project.GetProjectStates(fake.X, project.Projects{localProjects[1].Key(): localProjects[1]}, true); err != nil {
+		t.Fatal(err)
+	}
+	scm := gitutil.New(fake.X, gitutil.RootDirOpt(localProjects[1].Path))
+	if err := scm.CreateBranch("no-write"); err == nil || !strings.Contains(err.Error(), "-no-write mode") {
+		t.Errorf("expected creating a branch to be refused in -no-write mode, got: %v", err)
+	}
+	// Commands running in parallel use clones of the context.
+	cloned := gitutil.New(fake.X.Clone(tool.ContextOpts{}), gitutil.RootDirOpt(localProjects[1].Path))
+	if err := cloned.CreateBranch("no-write"); err == nil || !strings.Contains(err.Error(), "-no-write mode") {
+		t.Errorf("expected creating a branch from a cloned context to be refused in -no-write mode, got: %v", err)
+	}
+	m, err := project.ManifestFromFile(fake.X, fake.X.JiriManifestFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ToFile(fake.X, fake.X.JiriManifestFile()); err == nil {
+		t.Errorf("expected writing %s to be refused in -no-write mode", fake.X.JiriManifestFile())
+	}
+
+	fake.X.NoWrite = false
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[1], "new readme")
+}
+
+// TestUpdateUniverseMinFreeDisk checks that UpdateUniverse stops without
+// checking out anything when the disk has less free space than
+// jirix.MinFreeDisk, and records the sizes of the projects it fetches. It also
+// checks that fetches and clones still complete with jirix.MaxBandwidth set.
+func TestUpdateUniverseMinFreeDisk(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	writeReadme(t, fake.X, fake.Projects[localProjects[1].Name], "new readme")
+	fake.X.MinFreeDisk = 1 << 62
+	if err := fake.UpdateUniverse(false); err == nil || !strings.Contains(err.Error(), "-min-free-disk") {
+		t.Fatalf("expected update to stop for lack of disk space, got: %v", err)
+	}
+	checkReadme(t, fake.X, localProjects[1], "initial readme")
+
+	// Any free space is enough, but the update state is still recorded.
+	fake.X.MinFreeDisk = 1
+	fake.X.MaxBandwidth = 1 << 30
+	if err := fake.CreateRemoteProject("paced"); err != nil {
+		t.Fatal(err)
+	}
+	paced := project.Project{
+		Name:   "paced",
+		Path:   filepath.Join(fake.X.Root, "paced"),
+		Remote: fake.Projects["paced"],
+	}
+	if err := fake.AddProject(paced); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[1], "new readme")
+	if _, err := os.Stat(filepath.Join(paced.Path, ".git")); err != nil {
+		t.Errorf("expected project %q to be cloned with -max-bandwidth: %v", paced.Name, err)
+	}
+	data, err := ioutil.ReadFile(fake.X.UpdateStateFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state struct {
+		Projects map[project.ProjectKey]struct {
+			Size int64 `json:"size"`
+		} `json:"projects"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if size := state.Projects[localProjects[1].Key()].Size; size <= 0 {
+		t.Errorf("expected the size of project %q to be recorded, got %d", localProjects[1].Name, size)
+	}
+}
+
+// TestUpdateUniverseFetchFailure checks that UpdateUniverse returns an error
+// listing each project which could not be fetched.
+func TestUpdateUniverseFetchFailure(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	remote := fake.Projects[localProjects[1].Name]
+	if err := os.Rename(remote, remote+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	err := fake.UpdateUniverse(false)
+	if err == nil {
+		t.Fatalf("expected update to fail")
+	}
+	if got, want := err.Error(), fmt.Sprintf("Fetch failed for 1 of %d project(s):", len(localProjects)+1); !strings.HasPrefix(got, want) {
+		t.Errorf("got error %q, want prefix %q", got, want)
+	}
+	if !strings.Contains(err.Error(), localProjects[1].Path) {
+		t.Errorf("expected error to list project %q, got %q", localProjects[1].Name, err)
+	}
+}
+
+// TestOrderFetches checks that fetches are ordered by the size of the
+// projects, smallest first, the projects of unknown size last.
+func TestOrderFetches(t *testing.T) {
+	keys := []project.ProjectKey{"d", "c", "b", "a"}
+	project.InternalOrderFetches(map[project.ProjectKey]int64{"a": 30, "b": 10, "c": 20}, keys)
+	if want := []project.ProjectKey{"b", "c", "a", "d"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %v, want %v", keys, want)
+	}
+}
+
+// TestUpdateUniverseWithView tests that UpdateUniverse only syncs the projects
+// of the selected view, and applies their sparse checkouts.
+func TestUpdateUniverseWithView(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+
+	remote := fake.Projects[localProjects[1].Name]
+	if err := os.MkdirAll(filepath.Join(remote, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(remote, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fake.X, remote, filepath.Join("src", "a"), "a")
+	writeFile(t, fake.X, remote, filepath.Join("docs", "b"), "b")
+
+	m, err := fake.ReadJiriManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Views = []project.View{{
+		Name:     "v",
+		Projects: []project.ViewProject{{Name: localProjects[1].Name, Sparse: "src"}},
+	}}
+	if err := fake.WriteJiriManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	fake.X.View = "v"
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := dirExists(localProjects[0].Path); err == nil {
+		t.Fatalf("project %q is not in the view and should not have been synced", localProjects[0].Name)
+	}
+	if err := dirExists(filepath.Join(fake.X.Root, jiritest.ManifestProjectPath)); err != nil {
+		t.Fatalf("manifest project should always be synced: %v", err)
+	}
+	if err := fileExists(filepath.Join(localProjects[1].Path, "src", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileExists(filepath.Join(localProjects[1].Path, "docs", "b")); err == nil {
+		t.Fatalf("docs should not be checked out in a sparse checkout of src")
+	}
+
+	fake.X.View = ""
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := dirExists(localProjects[0].Path); err != nil {
+		t.Fatalf("expected project %q to be synced without a view: %v", localProjects[0].Name, err)
+	}
+	if err := fileExists(filepath.Join(localProjects[1].Path, "docs", "b")); err != nil {
+		t.Fatalf("sparse checkout should have been disabled: %v", err)
+	}
+}
+
 func TestUpdateUniverseWhenLocalTracksLocal(t *testing.T) {
 	localProjects, fake, cleanup := setupUniverse(t)
 	defer cleanup()
@@ -497,6 +791,31 @@ func TestUpdateUniverseWithCache(t *testing.T) {
 	}
 }
 
+// TestUpdateUniverseWithDissociatedCache checks that projects cloned from a
+// cache do not depend on it when Dissociate is set.
+func TestUpdateUniverseWithDissociatedCache(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+
+	cacheDir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	fake.X.Cache = cacheDir
+	fake.X.Dissociate = true
+
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range localProjects {
+		if err := fileExists(p.Path + "/.git/objects/info/alternates"); err == nil {
+			t.Errorf("expected %v to not exist, but found", p.Path+"/.git/objects/info/alternates")
+		}
+		checkReadme(t, fake.X, p, "initial readme")
+	}
+}
+
 func TestProjectUpdateWhenNoUpdate(t *testing.T) {
 	localProjects, fake, cleanup := setupUniverse(t)
 	defer cleanup()
@@ -1200,99 +1519,280 @@ func TestUpdateUniverseWithUncommitted(t *testing.T) {
 	}
 }
 
-// TestUpdateUniverseMovedProject checks that UpdateUniverse can move a
-// project.
-func TestUpdateUniverseMovedProject(t *testing.T) {
+// TestUpdateUniverseOnConflictStash checks that uncommitted changes block the
+// update of a project by default, and are reapplied after updating with the
+// stash policy, given on the command line or chosen at the prompt.
+func TestUpdateUniverseOnConflictStash(t *testing.T) {
+	for _, policy := range []string{"", project.ConflictStash, project.ConflictPrompt} {
+		localProjects, fake, cleanup := setupUniverse(t)
+		defer cleanup()
+		if err := fake.UpdateUniverse(false); err != nil {
+			t.Fatal(err)
+		}
+
+		writeFile(t, fake.X, fake.Projects[localProjects[1].Name], "extra", "remote commit")
+		writeUncommitedFile(t, fake.X, localProjects[1].Path, "README", "uncommitted readme")
+		fake.X.OnConflict = policy
+		if policy == project.ConflictPrompt {
+			fake.X.Context = fake.X.Context.Clone(tool.ContextOpts{
+				Stdin:  strings.NewReader("unknown\nst\n"),
+				Stdout: ioutil.Discard,
+			})
+		}
+		if err := fake.UpdateUniverse(false); err != nil {
+			t.Fatal(err)
+		}
+
+		checkReadme(t, fake.X, localProjects[1], "uncommitted readme")
+		_, err := os.Stat(filepath.Join(localProjects[1].Path, "extra"))
+		if policy == "" && err == nil {
+			t.Fatalf("policy %q: expected project %q not to be updated", policy, localProjects[1].Name)
+		} else if policy != "" && err != nil {
+			t.Fatalf("policy %q: expected project %q to be updated: %s", policy, localProjects[1].Name, err)
+		}
+	}
+}
+
+// TestRollback checks that Rollback restores the revisions recorded before
+// an update.
+func TestRollback(t *testing.T) {
 	localProjects, fake, cleanup := setupUniverse(t)
 	defer cleanup()
 	if err := fake.UpdateUniverse(false); err != nil {
 		t.Fatal(err)
 	}
-
-	// Update the local path at which project 1 is located.
-	m, err := fake.ReadRemoteManifest()
-	if err != nil {
+	if err := project.WriteUpdateHistorySnapshot(fake.X, "", nil, nil, false); err != nil {
 		t.Fatal(err)
 	}
-	oldProjectPath := localProjects[1].Path
-	localProjects[1].Path = filepath.Join(fake.X.Root, "new-project-path")
-	projects := []project.Project{}
-	for _, p := range m.Projects {
-		if p.Name == localProjects[1].Name {
-			p.Path = localProjects[1].Path
-		}
-		projects = append(projects, p)
+	gitLocal := gitutil.New(fake.X, gitutil.RootDirOpt(localProjects[1].Path))
+	before, err := gitLocal.CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
 	}
-	m.Projects = projects
-	if err := fake.WriteRemoteManifest(m); err != nil {
+
+	if err := project.WritePreUpdateSnapshot(fake.X); err != nil {
 		t.Fatal(err)
 	}
-	// Check that UpdateUniverse() moves the local copy of the project 1.
+	writeFile(t, fake.X, fake.Projects[localProjects[1].Name], "extra", "remote commit")
 	if err := fake.UpdateUniverse(false); err != nil {
 		t.Fatal(err)
 	}
-	if err := dirExists(oldProjectPath); err == nil {
-		t.Fatalf("expected project %q at path %q not to exist but it did", localProjects[1].Name, oldProjectPath)
+	if err := project.WriteUpdateHistorySnapshot(fake.X, "", nil, nil, false); err != nil {
+		t.Fatal(err)
 	}
-	if err := dirExists(localProjects[2].Path); err != nil {
-		t.Fatalf("expected project %q at path %q to exist but it did not", localProjects[1].Name, localProjects[1].Path)
+	if _, err := os.Stat(filepath.Join(localProjects[1].Path, "extra")); err != nil {
+		t.Fatalf("expected project %q to be updated: %s", localProjects[1].Name, err)
 	}
-	checkReadme(t, fake.X, localProjects[1], "initial readme")
-}
 
-// TestUpdateUniverseChangeRemote checks that UpdateUniverse can change remote
-// of a project.
-func TestUpdateUniverseChangeRemote(t *testing.T) {
-	localProjects, fake, cleanup := setupUniverse(t)
-	defer cleanup()
-	if err := fake.UpdateUniverse(false); err != nil {
+	s, err := project.RollbackTarget(fake.X, "")
+	if err != nil {
 		t.Fatal(err)
 	}
-
-	changedRemoteDir := fake.Projects[localProjects[1].Name] + "-remote-changed"
-	if err := os.Rename(fake.Projects[localProjects[1].Name], changedRemoteDir); err != nil {
+	if !s.PreUpdate {
+		t.Errorf("got rollback target %q, want a pre-update snapshot", s.ID)
+	}
+	if err := project.Rollback(fake.X, s, false, false, false, project.DefaultHookTimeout, project.DefaultPackageTimeout); err != nil {
 		t.Fatal(err)
 	}
+	after, err := gitLocal.CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("got revision %s after rollback, want %s", after, before)
+	}
+	if _, err := project.RollbackTarget(fake.X, "missing"); err == nil {
+		t.Errorf("expected an error for a missing snapshot")
+	}
+}
 
-	writeReadme(t, fake.X, changedRemoteDir, "new commit")
+// TestPruneUpdateHistory checks that the update history keeps the configured
+// number of snapshots of each kind, and the snapshots the latest links point
+// to.
+func TestPruneUpdateHistory(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+	jirix.UpdateHistoryDepth = 2
 
-	// Update the local path at which project 1 is located.
-	m, err := fake.ReadRemoteManifest()
-	if err != nil {
+	dir := jirix.UpdateHistoryDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		t.Fatal(err)
 	}
-	projects := []project.Project{}
-	for _, p := range m.Projects {
-		if p.Name == localProjects[1].Name {
-			p.Remote = changedRemoteDir
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ids []string
+	for i := 0; i < 4; i++ {
+		id := start.Add(time.Duration(i) * time.Hour).Format(time.RFC3339)
+		ids = append(ids, id+".pre", id)
+	}
+	for _, id := range ids {
+		if err := ioutil.WriteFile(filepath.Join(dir, id), []byte("<manifest/>"), 0644); err != nil {
+			t.Fatal(err)
 		}
-		projects = append(projects, p)
 	}
-	m.Projects = projects
-	if err := fake.WriteRemoteManifest(m); err != nil {
+	if err := os.Symlink(ids[1], jirix.UpdateHistorySecondLatestLink()); err != nil {
 		t.Fatal(err)
 	}
-	// Check that UpdateUniverse() moves the local copy of the project 1.
-	if err := fake.UpdateUniverse(false); err != nil {
+	if err := project.PruneUpdateHistory(jirix); err != nil {
 		t.Fatal(err)
 	}
-	checkReadme(t, fake.X, localProjects[1], "new commit")
+	snapshots, err := project.UpdateHistory(jirix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range snapshots {
+		got = append(got, s.ID)
+	}
+	if want := []string{ids[1], ids[4], ids[5], ids[6], ids[7]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got update history %v, want %v", got, want)
+	}
 }
 
-func TestIgnoredProjectsNotMoved(t *testing.T) {
+// TestUpdateUniverseOnConflictBackup checks that a branch which cannot be
+// fast-forwarded is saved on a backup branch and reset with the backup
+// policy.
+func TestUpdateUniverseOnConflictBackup(t *testing.T) {
 	localProjects, fake, cleanup := setupUniverse(t)
 	defer cleanup()
 	if err := fake.UpdateUniverse(false); err != nil {
 		t.Fatal(err)
 	}
 
-	// Update the local path at which project 1 is located.
-	m, err := fake.ReadRemoteManifest()
-	if err != nil {
+	gitLocal := gitutil.New(fake.X, gitutil.RootDirOpt(localProjects[1].Path))
+	if err := gitLocal.CreateBranchWithUpstream("local", "origin/master"); err != nil {
 		t.Fatal(err)
 	}
-	lc := project.LocalConfig{Ignore: true}
-	project.WriteLocalConfig(fake.X, localProjects[1], lc)
+	if err := gitLocal.CheckoutBranch("local"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fake.X, localProjects[1].Path, "local", "local commit")
+	writeFile(t, fake.X, fake.Projects[localProjects[1].Name], "extra", "remote commit")
+	localRev, err := gitLocal.CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.X.OnConflict = project.ConflictBackup
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(localProjects[1].Path, "extra")); err != nil {
+		t.Fatalf("expected branch %q to be reset to origin/master: %s", "local", err)
+	}
+	branches, _, err := gitLocal.GetBranches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := ""
+	for _, b := range branches {
+		if strings.HasPrefix(b, "jiri-backup/local-") {
+			backup = b
+		}
+	}
+	if backup == "" {
+		t.Fatalf("expected a backup branch, got %v", branches)
+	}
+	if rev, err := gitLocal.CurrentRevisionForRef(backup); err != nil {
+		t.Fatal(err)
+	} else if rev != localRev {
+		t.Fatalf("backup branch %q: got revision %s, want %s", backup, rev, localRev)
+	}
+}
+
+// TestUpdateUniverseMovedProject checks that UpdateUniverse can move a
+// project.
+func TestUpdateUniverseMovedProject(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Update the local path at which project 1 is located.
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldProjectPath := localProjects[1].Path
+	localProjects[1].Path = filepath.Join(fake.X.Root, "new-project-path")
+	projects := []project.Project{}
+	for _, p := range m.Projects {
+		if p.Name == localProjects[1].Name {
+			p.Path = localProjects[1].Path
+		}
+		projects = append(projects, p)
+	}
+	m.Projects = projects
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	// Check that UpdateUniverse() moves the local copy of the project 1.
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := dirExists(oldProjectPath); err == nil {
+		t.Fatalf("expected project %q at path %q not to exist but it did", localProjects[1].Name, oldProjectPath)
+	}
+	if err := dirExists(localProjects[2].Path); err != nil {
+		t.Fatalf("expected project %q at path %q to exist but it did not", localProjects[1].Name, localProjects[1].Path)
+	}
+	checkReadme(t, fake.X, localProjects[1], "initial readme")
+}
+
+// TestUpdateUniverseChangeRemote checks that UpdateUniverse can change remote
+// of a project.
+func TestUpdateUniverseChangeRemote(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	changedRemoteDir := fake.Projects[localProjects[1].Name] + "-remote-changed"
+	if err := os.Rename(fake.Projects[localProjects[1].Name], changedRemoteDir); err != nil {
+		t.Fatal(err)
+	}
+
+	writeReadme(t, fake.X, changedRemoteDir, "new commit")
+
+	// Update the local path at which project 1 is located.
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects := []project.Project{}
+	for _, p := range m.Projects {
+		if p.Name == localProjects[1].Name {
+			p.Remote = changedRemoteDir
+		}
+		projects = append(projects, p)
+	}
+	m.Projects = projects
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	// Check that UpdateUniverse() moves the local copy of the project 1.
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, localProjects[1], "new commit")
+}
+
+func TestIgnoredProjectsNotMoved(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Update the local path at which project 1 is located.
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc := project.LocalConfig{Ignore: true}
+	project.WriteLocalConfig(fake.X, localProjects[1], lc)
 	oldProjectPath := localProjects[1].Path
 	localProjects[1].Path = filepath.Join(fake.X.Root, "new-project-path")
 	projects := []project.Project{}
@@ -1471,6 +1971,71 @@ func TestIgnoredProjectsNotDeleted(t *testing.T) {
 	}
 }
 
+// TestOrphanedProjects checks that a project removed from the manifest by an
+// update without gc is reported, and deleted once it has no changes.
+func TestOrphanedProjects(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete project 1.
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects := []project.Project{}
+	for _, p := range m.Projects {
+		if p.Name == localProjects[1].Name {
+			continue
+		}
+		projects = append(projects, p)
+	}
+	m.Projects = projects
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := project.OrphanedProjects(fake.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := orphans[localProjects[1].Key()]; !ok || len(orphans) != 1 {
+		t.Fatalf("expected only project %q to be orphaned, got %v", localProjects[1].Name, orphans)
+	}
+
+	// Projects with uncommitted changes are kept.
+	if err := ioutil.WriteFile(filepath.Join(localProjects[1].Path, "extra"), []byte("extra"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := project.DeleteOrphanedProjects(fake.X, orphans, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("expected no project to be deleted, got %v", deleted)
+	}
+	if err := dirExists(localProjects[1].Path); err != nil {
+		t.Fatalf("expected project %q at path %q to exist but it did not: %s", localProjects[1].Name, localProjects[1].Path, err)
+	}
+
+	// Unless forceDirty is set.
+	deleted, err = project.DeleteOrphanedProjects(fake.X, orphans, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := deleted[localProjects[1].Key()]; !ok || len(deleted) != 1 {
+		t.Fatalf("expected only project %q to be deleted, got %v", localProjects[1].Name, deleted)
+	}
+	if err := dirExists(localProjects[1].Path); err == nil {
+		t.Fatalf("expected project %q at path %q to be deleted", localProjects[1].Name, localProjects[1].Path)
+	}
+}
+
 // TestUpdateUniverseNewProjectSamePath checks that UpdateUniverse can handle a
 // new project with the same path as a deleted project, but a different path.
 func TestUpdateUniverseNewProjectSamePath(t *testing.T) {
@@ -1545,6 +2110,83 @@ func TestUpdateUniverseRemoteBranch(t *testing.T) {
 	checkReadme(t, fake.X, localProjects[1], "non-master commit")
 }
 
+// TestUpdateUniverseSubmodules checks that UpdateUniverse checks out the
+// submodules of a project which sets the submodules attribute at the commits
+// recorded in the project, and that SubmoduleStatus reports the submodules
+// which are not.
+func TestUpdateUniverseSubmodules(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	// git only clones submodules from local paths when allowed to.
+	env := envvar.CopyMap(fake.X.Env())
+	env["GIT_CONFIG_COUNT"] = "1"
+	env["GIT_CONFIG_KEY_0"] = "protocol.file.allow"
+	env["GIT_CONFIG_VALUE_0"] = "always"
+	fake.X.Context = tool.NewContext(tool.ContextOpts{Env: env})
+	runGit := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = envvar.MapToSlice(env)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	// Add a submodule to project 1.
+	if err := fake.CreateRemoteProject("sub"); err != nil {
+		t.Fatal(err)
+	}
+	subRemote := fake.Projects["sub"]
+	writeReadme(t, fake.X, subRemote, "initial sub readme")
+	superRemote := fake.Projects[localProjects[1].Name]
+	runGit(superRemote, "submodule", "add", subRemote, "sub")
+	runGit(superRemote, "commit", "-m", "add submodule")
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range m.Projects {
+		if p.Name == localProjects[1].Name {
+			m.Projects[i].Submodules = "true"
+		}
+	}
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	sub := project.Project{Name: "sub", Path: filepath.Join(localProjects[1].Path, "sub")}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, sub, "initial sub readme")
+
+	// Move the submodule in project 1.
+	writeReadme(t, fake.X, subRemote, "new sub readme")
+	runGit(filepath.Join(superRemote, "sub"), "pull", "origin", "HEAD")
+	runGit(superRemote, "commit", "-a", "-m", "update submodule")
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, sub, "new sub readme")
+
+	scm := gitutil.New(fake.X, gitutil.RootDirOpt(localProjects[1].Path))
+	if status, err := scm.SubmoduleStatus(false); err != nil {
+		t.Fatal(err)
+	} else if len(status) != 0 {
+		t.Errorf("expected no submodule to be reported, got %q", status)
+	}
+	// Check out another commit of the submodule.
+	runGit(sub.Path, "checkout", "-q", "HEAD~1")
+	if status, err := scm.SubmoduleStatus(false); err != nil {
+		t.Fatal(err)
+	} else if len(status) != 1 || !strings.HasPrefix(status[0], "+") || !strings.Contains(status[0], " sub") {
+		t.Errorf("expected submodule sub to be reported as moved, got %q", status)
+	}
+	if err := scm.SubmoduleUpdate(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, sub, "new sub readme")
+}
+
 // TestUpdateWhenRemoteChangesRebased checks that UpdateUniverse can pull from a
 // non-master remote branch if the local changes were rebased somewhere else(gerrit)
 // before being pushed to remote
@@ -1939,78 +2581,276 @@ func TestFileImportCycle(t *testing.T) {
 	if got, want := fmt.Sprint(err), "import cycle detected in local manifest files"; !strings.Contains(got, want) {
 		t.Errorf("got error %v, want substr %v", got, want)
 	}
+	if got, want := fmt.Sprint(err), ".jiri_manifest -> A -> B -> A"; !strings.Contains(got, want) {
+		t.Errorf("got error %v, want substr %v", got, want)
+	}
 }
 
-func TestRemoteImportCycle(t *testing.T) {
-	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+func TestTraceManifestFile(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
 	defer cleanup()
 
-	// Set up two remote manifest projects, remote1 and remote1.
-	if err := fake.CreateRemoteProject("remote1"); err != nil {
-		t.Fatal(err)
-	}
-	if err := fake.CreateRemoteProject("remote2"); err != nil {
-		t.Fatal(err)
+	// Set up .jiri_manifest -> A -> B, with B declaring a project that is
+	// overridden by .jiri_manifest.
+	p := project.Project{
+		Name:   "p",
+		Path:   "p",
+		Remote: "https://example.com/p",
 	}
-	remote1 := fake.Projects["remote1"]
-	remote2 := fake.Projects["remote2"]
-
-	fileA, fileB := filepath.Join(remote1, "A"), filepath.Join(remote2, "B")
-
-	// Set up the cycle .jiri_manifest -> remote1+A -> remote2+B -> remote1+A
+	o := p
+	o.Revision = "override-revision"
 	jiriManifest := project.Manifest{
-		Imports: []project.Import{
-			{Manifest: "A", Name: "n1", Remote: remote1},
+		LocalImports: []project.LocalImport{
+			{File: "A"},
 		},
+		ProjectOverrides: []project.Project{o},
 	}
 	manifestA := project.Manifest{
-		Imports: []project.Import{
-			{Manifest: "B", Name: "n2", Remote: remote2},
+		LocalImports: []project.LocalImport{
+			{File: "B"},
 		},
 	}
 	manifestB := project.Manifest{
-		Imports: []project.Import{
-			{Manifest: "A", Name: "n3", Remote: remote1},
-		},
+		Projects: []project.Project{p},
 	}
-	if err := jiriManifest.ToFile(fake.X, fake.X.JiriManifestFile()); err != nil {
+	if err := jiriManifest.ToFile(jirix, jirix.JiriManifestFile()); err != nil {
 		t.Fatal(err)
 	}
-	if err := manifestA.ToFile(fake.X, fileA); err != nil {
+	if err := manifestA.ToFile(jirix, filepath.Join(jirix.Root, "A")); err != nil {
 		t.Fatal(err)
 	}
-	if err := manifestB.ToFile(fake.X, fileB); err != nil {
+	if err := manifestB.ToFile(jirix, filepath.Join(jirix.Root, "B")); err != nil {
 		t.Fatal(err)
 	}
-	commitFile(t, fake.X, remote1, fileA, "commit A")
-	commitFile(t, fake.X, remote2, fileB, "commit B")
-
-	// The update should complain about the cycle.
-	err := project.UpdateUniverse(fake.X, false, false, false, false, false, true /*run-hooks*/, true /*run-packages*/, project.DefaultHookTimeout, project.DefaultPackageTimeout)
-	if got, want := fmt.Sprint(err), "import cycle detected in remote manifest imports"; !strings.Contains(got, want) {
-		t.Errorf("got error %v, want substr %v", got, want)
-	}
-}
-
-func TestFileAndRemoteImportCycle(t *testing.T) {
-	fake, cleanup := jiritest.NewFakeJiriRoot(t)
-	defer cleanup()
 
-	// Set up two remote manifest projects, remote1 and remote2.
-	// Set up two remote manifest projects, remote1 and remote1.
-	if err := fake.CreateRemoteProject("remote1"); err != nil {
+	traces, err := project.TraceManifestFile(jirix, jirix.JiriManifestFile(), nil, false)
+	if err != nil {
 		t.Fatal(err)
 	}
-	if err := fake.CreateRemoteProject("remote2"); err != nil {
-		t.Fatal(err)
+	trace, ok := traces[p.Key()]
+	if !ok {
+		t.Fatalf("project %q not found in traces %v", p.Name, traces)
 	}
-	remote1 := fake.Projects["remote1"]
-	remote2 := fake.Projects["remote2"]
-	fileA, fileD := filepath.Join(remote1, "A"), filepath.Join(remote1, "D")
-	fileB, fileC := filepath.Join(remote2, "B"), filepath.Join(remote2, "C")
-
-	// Set up the cycle .jiri_manifest -> remote1+A -> remote2+B -> C -> remote1+D -> A
-	jiriManifest := project.Manifest{
+	if got, want := strings.Join(trace.Chain, " -> "), ".jiri_manifest -> A -> B"; got != want {
+		t.Errorf("got chain %q, want %q", got, want)
+	}
+	if !trace.Overridden {
+		t.Errorf("expected project %q to be overridden", p.Name)
+	}
+	if got, want := trace.Project.Revision, o.Revision; got != want {
+		t.Errorf("got revision %q, want %q", got, want)
+	}
+}
+
+func TestLintManifestBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want []string
+	}{
+		{
+			"clean",
+			`<manifest>
+  <projects>
+    <project name="a" path="a" remote="https://example.com/a"/>
+    <project name="b" path="b" remote="https://example.com/b"/>
+  </projects>
+</manifest>
+`,
+			nil,
+		},
+		{
+			"unknown",
+			`<manifest>
+  <projects>
+    <project name="a" path="a" remot="https://example.com/a"/>
+  </projects>
+  <project name="b"/>
+</manifest>
+`,
+			[]string{"m:3:unknown-attribute", "m:5:unknown-element"},
+		},
+		{
+			"duplicates",
+			`<manifest>
+  <projects>
+    <project name="a" path="a" remote="https://example.com/a"/>
+    <project name="a" path="a2" remote="https://example.com/a2"/>
+    <project name="b" path="a" remote="https://example.com/b"/>
+    <project name="c" remote="https://example.com/c"/>
+  </projects>
+</manifest>
+`,
+			[]string{"m:4:duplicate-name", "m:5:duplicate-path", "m:6:missing-path"},
+		},
+		{
+			"nested",
+			`<manifest>
+  <projects>
+    <project name="a" path="a" remote="https://example.com/a"/>
+    <project name="b" path="a/b" remote="https://example.com/b"/>
+    <project name="c" path="ab" remote="https://example.com/c"/>
+  </projects>
+</manifest>
+`,
+			[]string{"m:4:nested-path"},
+		},
+		{
+			"absolute",
+			`<manifest>
+  <projects>
+    <project name="a" path="/root/a" remote="https://example.com/a"/>
+    <project name="b" path="b" remote="https://example.com/b" githooks="/root/hooks"/>
+  </projects>
+</manifest>
+`,
+			[]string{"m:3:absolute-path", "m:4:absolute-path"},
+		},
+		{
+			"invalid",
+			`<manifest><projects></manifest>`,
+			[]string{"m:0:invalid"},
+		},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, f := range project.LintManifestBytes("m", []byte(test.xml)) {
+			got = append(got, fmt.Sprintf("%s:%d:%s", f.File, f.Line, f.Check))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got findings %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLintManifestFileResolve(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+
+	// .jiri_manifest imports A and B, which declare different projects at the
+	// same path, and overrides a project which does not exist.
+	jiriManifest := project.Manifest{
+		LocalImports: []project.LocalImport{
+			{File: "A"},
+			{File: "B"},
+		},
+		ProjectOverrides: []project.Project{
+			{Name: "missing", Remote: "https://example.com/missing"},
+		},
+	}
+	manifestA := project.Manifest{
+		Projects: []project.Project{
+			{Name: "a", Path: "p", Remote: "https://example.com/a"},
+		},
+	}
+	manifestB := project.Manifest{
+		Projects: []project.Project{
+			{Name: "b", Path: "p", Remote: "https://example.com/b"},
+		},
+	}
+	if err := jiriManifest.ToFile(jirix, jirix.JiriManifestFile()); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifestA.ToFile(jirix, filepath.Join(jirix.Root, "A")); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifestB.ToFile(jirix, filepath.Join(jirix.Root, "B")); err != nil {
+		t.Fatal(err)
+	}
+
+	findings, err := project.LintManifestFile(jirix, jirix.JiriManifestFile(), project.LintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("got findings %v without -resolve, want none", findings)
+	}
+	findings, err = project.LintManifestFile(jirix, jirix.JiriManifestFile(), project.LintOptions{Resolve: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Severity+":"+f.Check)
+	}
+	if want := []string{"error:import-shadowing", "warning:unused-override"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got findings %v, want %v", findings, want)
+	}
+	if msg := findings[0].Message; !strings.Contains(msg, ".jiri_manifest -> A") || !strings.Contains(msg, ".jiri_manifest -> B") {
+		t.Errorf("import-shadowing finding %q does not name both import chains", msg)
+	}
+}
+
+func TestRemoteImportCycle(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	// Set up two remote manifest projects, remote1 and remote1.
+	if err := fake.CreateRemoteProject("remote1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.CreateRemoteProject("remote2"); err != nil {
+		t.Fatal(err)
+	}
+	remote1 := fake.Projects["remote1"]
+	remote2 := fake.Projects["remote2"]
+
+	fileA, fileB := filepath.Join(remote1, "A"), filepath.Join(remote2, "B")
+
+	// Set up the cycle .jiri_manifest -> remote1+A -> remote2+B -> remote1+A
+	jiriManifest := project.Manifest{
+		Imports: []project.Import{
+			{Manifest: "A", Name: "n1", Remote: remote1},
+		},
+	}
+	manifestA := project.Manifest{
+		Imports: []project.Import{
+			{Manifest: "B", Name: "n2", Remote: remote2},
+		},
+	}
+	manifestB := project.Manifest{
+		Imports: []project.Import{
+			{Manifest: "A", Name: "n3", Remote: remote1},
+		},
+	}
+	if err := jiriManifest.ToFile(fake.X, fake.X.JiriManifestFile()); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifestA.ToFile(fake.X, fileA); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifestB.ToFile(fake.X, fileB); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, fake.X, remote1, fileA, "commit A")
+	commitFile(t, fake.X, remote2, fileB, "commit B")
+
+	// The update should complain about the cycle.
+	err := project.UpdateUniverse(fake.X, false, false, false, false, false, true /*run-hooks*/, true /*run-packages*/, project.DefaultHookTimeout, project.DefaultPackageTimeout)
+	if got, want := fmt.Sprint(err), "import cycle detected in remote manifest imports"; !strings.Contains(got, want) {
+		t.Errorf("got error %v, want substr %v", got, want)
+	}
+}
+
+func TestFileAndRemoteImportCycle(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	// Set up two remote manifest projects, remote1 and remote2.
+	// Set up two remote manifest projects, remote1 and remote1.
+	if err := fake.CreateRemoteProject("remote1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.CreateRemoteProject("remote2"); err != nil {
+		t.Fatal(err)
+	}
+	remote1 := fake.Projects["remote1"]
+	remote2 := fake.Projects["remote2"]
+	fileA, fileD := filepath.Join(remote1, "A"), filepath.Join(remote1, "D")
+	fileB, fileC := filepath.Join(remote2, "B"), filepath.Join(remote2, "C")
+
+	// Set up the cycle .jiri_manifest -> remote1+A -> remote2+B -> C -> remote1+D -> A
+	jiriManifest := project.Manifest{
 		Imports: []project.Import{
 			{Manifest: "A", Root: "r1", Name: "n1", Remote: remote1},
 		},
@@ -2163,58 +3003,388 @@ func TestManifestToFromBytes(t *testing.T) {
 	}
 }
 
-func TestProjectToFromFile(t *testing.T) {
-	jirix, cleanup := xtest.NewX(t)
+func TestProjectToFromFile(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+
+	tests := []struct {
+		Project project.Project
+		XML     string
+	}{
+		{
+			// Default fields are dropped when marshaled, and added when unmarshaled.
+			project.Project{
+				Name:         "project1",
+				Path:         filepath.Join(jirix.Root, "path1"),
+				Remote:       "remote1",
+				RemoteBranch: "master",
+				Revision:     "HEAD",
+			},
+			`<project name="project1" path="path1" remote="remote1"/>
+`,
+		},
+		{
+			project.Project{
+				Name:         "project2",
+				Path:         filepath.Join(jirix.Root, "path2"),
+				GitHooks:     filepath.Join(jirix.Root, "git-hooks"),
+				Remote:       "remote2",
+				RemoteBranch: "branch2",
+				Revision:     "rev2",
+			},
+			`<project name="project2" path="path2" remote="remote2" remotebranch="branch2" revision="rev2" githooks="git-hooks"/>
+`,
+		},
+	}
+	for index, test := range tests {
+		filename := filepath.Join(jirix.Root, fmt.Sprintf("test-%d", index))
+		if err := test.Project.ToFile(jirix, filename); err != nil {
+			t.Errorf("%+v ToFile failed: %v", test.Project, err)
+		}
+		gotBytes, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Errorf("%+v ReadFile failed: %v", test.Project, err)
+		}
+		if got, want := string(gotBytes), test.XML; got != want {
+			t.Errorf("%+v ToFile GOT\n%v\nWANT\n%v", test.Project, got, want)
+		}
+		project, err := project.ProjectFromFile(jirix, filename)
+		if err != nil {
+			t.Errorf("%+v FromFile failed: %v", test.Project, err)
+		}
+		if got, want := project, &test.Project; !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v FromFile got %#v, want %#v", test.Project, got, want)
+		}
+	}
+}
+
+func TestEditManifestFile(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
+	defer cleanup()
+
+	file := filepath.Join(fake.X.Root, "edited_manifest")
+	original := `<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <!-- Remote manifests. -->
+  <imports>
+    <import manifest="manifest" name="foo" remote="https://foo.com/manifest"/>
+  </imports>
+  <projects>
+    <!-- Keep this comment. -->
+    <project name="b" path="b" remote="https://b.com/b"/>
+    <project name="a" path="a" remote="https://a.com/a"/>
+  </projects>
+</manifest>
+`
+	if err := ioutil.WriteFile(file, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := project.AddManifestProject(fake.X, file, project.Project{
+		Name:   "c",
+		Path:   filepath.Join(fake.X.Root, "c"),
+		Remote: "https://c.com/c",
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := project.AddManifestProject(fake.X, file, project.Project{Name: "c", Remote: "https://c.com/c"}, false); err == nil {
+		t.Errorf("adding a duplicate project should fail")
+	}
+	if err := project.AddManifestImport(fake.X, file, project.Import{
+		Name:     "bar",
+		Manifest: "manifest",
+		Remote:   "https://bar.com/manifest",
+		Revision: "HEAD",
+	}, true); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := project.RemoveManifestProject(fake.X, file, "b", "", false); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Errorf("got %d removed projects, want 1", n)
+	}
+	if n, err := project.RemoveManifestImport(fake.X, file, "", "foo", "https://other.com/manifest", false); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("got %d removed imports, want 0", n)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <!-- Remote manifests. -->
+  <imports>
+    <import manifest="manifest" name="foo" remote="https://foo.com/manifest"/>
+  </imports>
+  <projects>
+    <!-- Keep this comment. -->
+    <project name="a" path="a" remote="https://a.com/a"/>
+    <project name="c" path="c" remote="https://c.com/c"/>
+  </projects>
+  <overrides>
+    <import manifest="manifest" name="bar" remote="https://bar.com/manifest"/>
+  </overrides>
+</manifest>
+`
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != want {
+		t.Errorf("GOT\n%s\nWANT\n%s", got, want)
+	}
+}
+
+func TestManifestToFileKeepsBackup(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+
+	filename := filepath.Join(jirix.Root, "manifest.xml")
+	backup := project.ManifestBackupFile(filename)
+	first := project.Manifest{Projects: []project.Project{{Name: "first", Path: "first", Remote: "remote1"}}}
+	if err := first.ToFile(jirix, filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileExists(backup); err == nil {
+		t.Fatalf("backup %s should not be created for a new manifest", backup)
+	}
+	firstData, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := project.Manifest{Projects: []project.Project{{Name: "second", Path: "second", Remote: "remote2"}}}
+	if err := second.ToFile(jirix, filename); err != nil {
+		t.Fatal(err)
+	}
+	backupData, err := ioutil.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(backupData), string(firstData); got != want {
+		t.Fatalf("backup got\n%s\nwant\n%s", got, want)
+	}
+	if err := fileExists(filename + ".tmp"); err == nil {
+		t.Fatalf("temporary file was not renamed")
+	}
+
+	// A truncated manifest must not overwrite a valid backup.
+	if err := ioutil.WriteFile(filename, []byte("<manifest><projects>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := project.ManifestFromFile(jirix, filename); err == nil || !strings.Contains(err.Error(), backup) {
+		t.Fatalf("expected error mentioning backup %s, got %v", backup, err)
+	}
+	m, err := project.RecoverManifest(jirix, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Projects) != 1 || m.Projects[0].Name != "first" {
+		t.Fatalf("recovered wrong manifest: %+v", m)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), string(firstData); got != want {
+		t.Fatalf("restored manifest got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRecoverManifestWithoutBackup(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+
+	filename := filepath.Join(jirix.Root, "manifest.xml")
+	if err := ioutil.WriteFile(filename, []byte("<manifest><projects>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := project.RecoverManifest(jirix, filename); err == nil {
+		t.Fatalf("expected RecoverManifest to fail without a backup")
+	}
+}
+
+func TestLockManifestFile(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+
+	unlock, err := project.LockManifestFile(jirix, jirix.JiriManifestFile(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := project.LockManifestFile(jirix, jirix.JiriManifestFile(), 100*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected lock timeout, got %v", err)
+	}
+	unlock()
+	unlock, err = project.LockManifestFile(jirix, jirix.JiriManifestFile(), time.Second)
+	if err != nil {
+		t.Fatalf("lock should be available after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestManifestCloneFilter(t *testing.T) {
+	m, err := project.ManifestFromBytes([]byte(`<manifest><projects><project name="a" path="a" remote="r" clonefilter="tree:0"/></projects></manifest>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Projects[0].CloneFilter, "tree:0"; got != want {
+		t.Errorf("clonefilter got %q, want %q", got, want)
+	}
+	if _, err := project.ManifestFromBytes([]byte(`<manifest><projects><project name="a" path="a" remote="r" clonefilter="bogus"/></projects></manifest>`)); err == nil {
+		t.Errorf("expected invalid clonefilter to be rejected")
+	}
+}
+
+// TestUpdateUniverseCloneFilter checks that the clone filter of a project
+// replaces the one of jirix.Partial rather than being combined with it.
+func TestUpdateUniverseCloneFilter(t *testing.T) {
+	_, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.CreateRemoteProject("filtered"); err != nil {
+		t.Fatal(err)
+	}
+	writeReadme(t, fake.X, fake.Projects["filtered"], "initial readme")
+	// git ignores filters when cloning from a local path.
+	p := project.Project{
+		Name:        "filtered",
+		Path:        filepath.Join(fake.X.Root, "filtered"),
+		Remote:      "file://" + fake.Projects["filtered"],
+		CloneFilter: "tree:0",
+	}
+	if err := fake.AddProject(p); err != nil {
+		t.Fatal(err)
+	}
+	fake.X.Partial = true
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, p, "initial readme")
+	filters, err := gitutil.New(fake.X, gitutil.RootDirOpt(p.Path)).ConfigGetAll("remote.origin.partialclonefilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"tree:0"}; !reflect.DeepEqual(filters, want) {
+		t.Errorf("got partial clone filter %q, want %q", filters, want)
+	}
+}
+
+// TestMirrorFallback checks that a project is cloned and fetched from its
+// mirrors when its remote fails, and that origin still points to the remote.
+func TestMirrorFallback(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+
+	p := localProjects[1]
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	brokenRemote := filepath.Join(fake.X.Root, "broken-remote")
+	for i := range m.Projects {
+		if m.Projects[i].Name == p.Name {
+			m.Projects[i].Remote = brokenRemote
+			m.Projects[i].Mirrors = "https://localhost:1/missing," + fake.Projects[p.Name]
+			m.Projects[i].FetchTimeout = 1
+		}
+	}
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, p, "initial readme")
+
+	writeReadme(t, fake.X, fake.Projects[p.Name], "mirror readme")
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, p, "mirror readme")
+	if url, err := gitutil.New(fake.X, gitutil.RootDirOpt(p.Path)).RemoteUrl("origin"); err != nil || url != brokenRemote {
+		t.Errorf("got origin %q, %v, want %q", url, err, brokenRemote)
+	}
+}
+
+func TestManifestFetchAttributes(t *testing.T) {
+	m, err := project.ManifestFromBytes([]byte(`<manifest><projects><project name="a" path="a" remote="r" fetchtimeout="2" fetchattempts="5" mirrors="m1,m2"/></projects></manifest>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := m.Projects[0]
+	if p.FetchTimeout != 2 || p.FetchAttempts != 5 || p.Mirrors != "m1,m2" {
+		t.Errorf("got fetchtimeout %d, fetchattempts %d, mirrors %q, want 2, 5, \"m1,m2\"", p.FetchTimeout, p.FetchAttempts, p.Mirrors)
+	}
+}
+
+// TestRelocate checks that Relocate rewrites the absolute paths left by older
+// versions of jiri once the root is moved.
+func TestRelocate(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	oldRoot := fake.X.Root
+	p := localProjects[1]
+	metadataFile := filepath.Join(p.Path, jiri.ProjectMetaDir, jiri.ProjectMetaFile)
+	data, err := ioutil.ReadFile(metadataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte(`path="path-1"`), []byte(`path="`+p.Path+`"`), 1)
+	if err := ioutil.WriteFile(metadataFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(fake.X.UpdateHistoryDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	snapshotFile := filepath.Join(fake.X.UpdateHistoryDir(), "legacy")
+	snapshot := `<manifest><projects><project name="a" path="%s/a" remote="r"/></projects></manifest>`
+	if err := ioutil.WriteFile(snapshotFile, []byte(fmt.Sprintf(snapshot, oldRoot)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(snapshotFile, fake.X.UpdateHistoryLatestLink()); err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot := oldRoot + "-moved"
+	defer os.RemoveAll(newRoot)
+	if err := os.Rename(oldRoot, newRoot); err != nil {
+		t.Fatal(err)
+	}
+	fake.X.Root = newRoot
+	rewritten, err := project.Relocate(fake.X, oldRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewritten) != 3 {
+		t.Errorf("got rewritten files %v, want the metadata, snapshot and link", rewritten)
+	}
+	projects, err := project.LocalProjects(fake.X, project.FullScan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := projects[p.Key()].Path, filepath.Join(newRoot, "path-1"); got != want {
+		t.Errorf("got path %q for project %q, want %q", got, p.Name, want)
+	}
+	if data, err := ioutil.ReadFile(fake.X.UpdateHistoryLatestLink()); err != nil || !strings.Contains(string(data), `path="a"`) {
+		t.Errorf("got latest snapshot %q, %v, want a relative project path", data, err)
+	}
+	if target, err := os.Readlink(fake.X.UpdateHistoryLatestLink()); err != nil || filepath.IsAbs(target) {
+		t.Errorf("got latest link to %q, %v, want a relative link", target, err)
+	}
+}
+
+// TestLoadManifestAbsolutePath checks that manifests with absolute project
+// paths are rejected.
+func TestLoadManifestAbsolutePath(t *testing.T) {
+	fake, cleanup := jiritest.NewFakeJiriRoot(t)
 	defer cleanup()
-
-	tests := []struct {
-		Project project.Project
-		XML     string
-	}{
-		{
-			// Default fields are dropped when marshaled, and added when unmarshaled.
-			project.Project{
-				Name:         "project1",
-				Path:         filepath.Join(jirix.Root, "path1"),
-				Remote:       "remote1",
-				RemoteBranch: "master",
-				Revision:     "HEAD",
-			},
-			`<project name="project1" path="path1" remote="remote1"/>
-`,
-		},
-		{
-			project.Project{
-				Name:         "project2",
-				Path:         filepath.Join(jirix.Root, "path2"),
-				GitHooks:     filepath.Join(jirix.Root, "git-hooks"),
-				Remote:       "remote2",
-				RemoteBranch: "branch2",
-				Revision:     "rev2",
-			},
-			`<project name="project2" path="path2" remote="remote2" remotebranch="branch2" revision="rev2" githooks="git-hooks"/>
-`,
-		},
+	file := filepath.Join(fake.X.Root, "absolute-manifest")
+	manifest := `<manifest><projects><project name="a" path="%s" remote="r"/></projects></manifest>`
+	if err := ioutil.WriteFile(file, []byte(fmt.Sprintf(manifest, filepath.Join(fake.X.Root, "a"))), 0644); err != nil {
+		t.Fatal(err)
 	}
-	for index, test := range tests {
-		filename := filepath.Join(jirix.Root, fmt.Sprintf("test-%d", index))
-		if err := test.Project.ToFile(jirix, filename); err != nil {
-			t.Errorf("%+v ToFile failed: %v", test.Project, err)
-		}
-		gotBytes, err := ioutil.ReadFile(filename)
-		if err != nil {
-			t.Errorf("%+v ReadFile failed: %v", test.Project, err)
-		}
-		if got, want := string(gotBytes), test.XML; got != want {
-			t.Errorf("%+v ToFile GOT\n%v\nWANT\n%v", test.Project, got, want)
-		}
-		project, err := project.ProjectFromFile(jirix, filename)
-		if err != nil {
-			t.Errorf("%+v FromFile failed: %v", test.Project, err)
-		}
-		if got, want := project, &test.Project; !reflect.DeepEqual(got, want) {
-			t.Errorf("%+v FromFile got %#v, want %#v", test.Project, got, want)
-		}
+	if _, _, _, err := project.LoadManifestFile(fake.X, file, project.Projects{}, false); err == nil || !strings.Contains(err.Error(), "absolute path") {
+		t.Errorf("got error %v, want an absolute path error", err)
 	}
 }
 
@@ -2638,6 +3808,45 @@ func TestOverrideProject(t *testing.T) {
 	}
 }
 
+func TestOverrideProjectRemote(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+
+	p := localProjects[1]
+	fork := fake.Projects[p.Name] + "-fork"
+	if err := gitutil.New(fake.X).Clone(fake.Projects[p.Name], fork); err != nil {
+		t.Fatal(err)
+	}
+	writeReadme(t, fake.X, fork, "fork commit")
+
+	m, err := fake.ReadJiriManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ProjectOverrides = append(m.ProjectOverrides, project.Project{
+		Name:      p.Name,
+		Remote:    p.Remote,
+		NewRemote: fork,
+	})
+	if err := fake.WriteJiriManifest(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	checkReadme(t, fake.X, p, "fork commit")
+	local, err := project.ProjectAtPath(fake.X, p.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.Remote != fork {
+		t.Errorf("got remote %q, want %q", local.Remote, fork)
+	}
+}
+
 func TestHostnameAllowed(t *testing.T) {
 	tests := map[string]bool{
 		"*.google.com,fuchsia.google.com":       true,
@@ -2725,3 +3934,349 @@ func TestCheckProjectsHostnames(t *testing.T) {
 		t.Errorf("expecting error from CheckProjectsHostnames, but got nil")
 	}
 }
+
+func TestCheckoutSignedSnapshot(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+
+	gnupgHome, err := ioutil.TempDir("", "gnupg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gnupgHome)
+	oldHome := os.Getenv("GNUPGHOME")
+	os.Setenv("GNUPGHOME", gnupgHome)
+	defer os.Setenv("GNUPGHOME", oldHome)
+	if out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "Jiri Test <test@example.com>", "ed25519", "sign", "never").CombinedOutput(); err != nil {
+		t.Fatalf("generating key failed: %v: %s", err, out)
+	}
+	out, err := exec.Command("gpg", "--batch", "--with-colons", "--list-keys").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := ""
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Split(line, ":"); fields[0] == "fpr" && len(fields) > 9 {
+			fingerprint = fields[9]
+			break
+		}
+	}
+	if fingerprint == "" {
+		t.Fatalf("no fingerprint found in %s", out)
+	}
+
+	if err := (&project.Manifest{}).ToFile(jirix, jirix.JiriManifestFile()); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(jirix.Root, "snapshot")
+	if err := project.CreateSnapshot(jirix, snapshot, nil, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	checkout := func() error {
+		return project.CheckoutSnapshot(jirix, snapshot, false, false, false, project.DefaultHookTimeout, project.DefaultPackageTimeout)
+	}
+
+	// Unsigned snapshots are accepted as long as no signers are configured.
+	if err := checkout(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(jirix.SnapshotSignersFile(), []byte("# release keys\n"+fingerprint+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkout(); err == nil || !strings.Contains(err.Error(), "has no signature") {
+		t.Errorf("got error %v, want missing signature error", err)
+	}
+	if err := project.SignSnapshot(jirix, snapshot, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkout(); err != nil {
+		t.Errorf("checkout of signed snapshot failed: %v", err)
+	}
+
+	// A signature from a key that is not trusted is rejected.
+	if err := ioutil.WriteFile(jirix.SnapshotSignersFile(), []byte(strings.Repeat("0", 40)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkout(); err == nil || !strings.Contains(err.Error(), "not listed in") {
+		t.Errorf("got error %v, want untrusted signer error", err)
+	}
+
+	// Tampering with the snapshot invalidates the signature.
+	if err := ioutil.WriteFile(jirix.SnapshotSignersFile(), []byte(fingerprint+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(snapshot, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("<!-- tampered -->\n")
+	f.Close()
+	if err := checkout(); err == nil || !strings.Contains(err.Error(), "verification of snapshot failed") {
+		t.Errorf("got error %v, want verification error", err)
+	}
+}
+
+func TestRunHooksAfter(t *testing.T) {
+	jirix, cleanup := xtest.NewX(t)
+	defer cleanup()
+
+	dir := filepath.Join(jirix.Root, "hooks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	scripts := map[string]string{
+		"first.sh":  "#!/bin/sh\nsleep 0.2\ntouch first.done\n",
+		"second.sh": "#!/bin/sh\ntest -f first.done && touch second.done\n",
+		"fail.sh":   "#!/bin/sh\nexit 1\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newHooks := func(hooks ...project.Hook) project.Hooks {
+		ret := make(project.Hooks)
+		for _, h := range hooks {
+			h.ProjectName = "p"
+			h.ActionPath = dir
+			ret[h.Key()] = h
+		}
+		return ret
+	}
+
+	hooks := newHooks(
+		project.Hook{Name: "second", Action: "second.sh", After: "first"},
+		project.Hook{Name: "first", Action: "first.sh"},
+	)
+	if err := project.RunHooks(jirix, hooks, project.DefaultHookTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileExists(filepath.Join(dir, "second.done")); err != nil {
+		t.Errorf("hook second did not run after hook first: %v", err)
+	}
+	os.Remove(filepath.Join(dir, "second.done"))
+
+	hooks = newHooks(
+		project.Hook{Name: "second", Action: "second.sh", After: "fail"},
+		project.Hook{Name: "fail", Action: "fail.sh"},
+	)
+	if err := project.RunHooks(jirix, hooks, project.DefaultHookTimeout); err == nil {
+		t.Errorf("expected hooks to fail")
+	}
+	if err := fileExists(filepath.Join(dir, "second.done")); err == nil {
+		t.Errorf("hook second should not run after hook fail failed")
+	}
+
+	hooks = newHooks(
+		project.Hook{Name: "first", Action: "first.sh", After: "second"},
+		project.Hook{Name: "second", Action: "second.sh", After: "first"},
+	)
+	if err := project.RunHooks(jirix, hooks, project.DefaultHookTimeout); err == nil || !strings.Contains(err.Error(), "depends on itself") {
+		t.Errorf("got error %v, want dependency cycle error", err)
+	}
+	hooks = newHooks(project.Hook{Name: "second", Action: "second.sh", After: "missing"})
+	if err := project.RunHooks(jirix, hooks, project.DefaultHookTimeout); err == nil || !strings.Contains(err.Error(), "unknown hook") {
+		t.Errorf("got error %v, want unknown hook error", err)
+	}
+}
+
+// TestProjectFiles checks that the files of copyfile and linkfile elements
+// are installed by jiri update, that their drift is reported, and that they
+// are removed along with their element.
+func TestProjectFiles(t *testing.T) {
+	_, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+
+	manifest, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Projects[0].Copyfiles = []project.ProjectFile{{Src: "README", Dest: "README.top"}}
+	manifest.Projects[1].Linkfiles = []project.ProjectFile{{Src: "README", Dest: "links/readme"}}
+	if err := fake.WriteRemoteManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(fake.X.Root, "README.top")
+	data, err := ioutil.ReadFile(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "initial readme"; got != want {
+		t.Errorf("got copied file %q, want %q", got, want)
+	}
+	target, err := os.Readlink(filepath.Join(fake.X.Root, "links", "readme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("..", manifest.Projects[1].Path, "README"); target != want {
+		t.Errorf("got link to %q, want %q", target, want)
+	}
+
+	if err := ioutil.WriteFile(copied, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := manifest.Projects[0]
+	p.Path = filepath.Join(fake.X.Root, p.Path)
+	drift, err := project.ProjectFilesDrift(fake.X, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"README.top: modified"}; !reflect.DeepEqual(drift, want) {
+		t.Errorf("got drift %q, want %q", drift, want)
+	}
+
+	manifest.Projects[0].Copyfiles = nil
+	if err := fake.WriteRemoteManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(copied); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed along with its copyfile element: %v", copied, err)
+	}
+	if _, err := os.Lstat(filepath.Join(fake.X.Root, "links", "readme")); err != nil {
+		t.Errorf("expected the link to be kept: %v", err)
+	}
+
+	manifest.Projects[1].Linkfiles = []project.ProjectFile{{Src: "README", Dest: "../outside"}}
+	if err := fake.WriteRemoteManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.UpdateUniverse(false); err == nil {
+		t.Errorf("expected an error linking a file outside of the jiri root")
+	}
+}
+
+// TestManifestCache checks that LoadManifestFile caches the resolved
+// manifest, that the cache is invalidated by changes to the manifests, and
+// that it is not used when lock conflicts are ignored.
+func TestManifestCache(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	load := func() project.Projects {
+		t.Helper()
+		local, err := project.LocalProjects(fake.X, project.FastScan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		projects, _, _, err := project.LoadManifestFile(fake.X, fake.X.JiriManifestFile(), local, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return projects
+	}
+
+	want := load()
+	if _, err := os.Stat(fake.X.ManifestCacheFile()); err != nil {
+		t.Fatalf("expected the manifest to be cached: %v", err)
+	}
+	if got := load(); !reflect.DeepEqual(keysAndPaths(got), keysAndPaths(want)) {
+		t.Errorf("got cached projects %v, want %v", keysAndPaths(got), keysAndPaths(want))
+	}
+
+	// Remote manifests are read at JIRI_HEAD, which jiri update moves.
+	if err := fake.CreateRemoteProject("new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.AddProject(project.Project{Name: "new", Path: "new", Remote: fake.Projects["new"]}); err != nil {
+		t.Fatal(err)
+	}
+	writeReadme(t, fake.X, fake.Projects["new"], "initial readme")
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	if got := load(); len(got) != len(want)+1 {
+		t.Errorf("got %d projects after adding one to the remote manifest, want %d", len(got), len(want)+1)
+	}
+
+	p := localProjects[0]
+	if err := fake.AddProjectOverride(p.Name, p.Remote, "rev"); err != nil {
+		t.Fatal(err)
+	}
+	if got := load()[p.Key()].Revision; got != "rev" {
+		t.Errorf("got revision %q after overriding it in .jiri_manifest, want %q", got, "rev")
+	}
+
+	// Results loaded with lock conflicts ignored are not cached.
+	if err := os.Remove(fake.X.ManifestCacheFile()); err != nil {
+		t.Fatal(err)
+	}
+	fake.X.IgnoreLockConflicts = true
+	load()
+	if _, err := os.Stat(fake.X.ManifestCacheFile()); !os.IsNotExist(err) {
+		t.Errorf("expected no manifest cache with lock conflicts ignored, got: %v", err)
+	}
+}
+
+func keysAndPaths(projects project.Projects) map[project.ProjectKey]string {
+	m := make(map[project.ProjectKey]string)
+	for key, p := range projects {
+		m[key] = p.Path
+	}
+	return m
+}
+
+// TestDeprecatedProjects tests that jiri update warns about deprecated
+// projects, and that lint reports replacements which are not projects.
+func TestDeprecatedProjects(t *testing.T) {
+	localProjects, fake, cleanup := setupUniverse(t)
+	defer cleanup()
+	m, err := fake.ReadRemoteManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range m.Projects {
+		if p.Name == localProjects[1].Name {
+			m.Projects[i].Deprecated = "it moved"
+			m.Projects[i].Replacement = "successor"
+		}
+	}
+	if err := fake.WriteRemoteManifest(m); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	fake.X.Logger = log.NewLogger(fake.X.Logger.LoggerLevel, fake.X.Color, false, 0, 100, buf, buf)
+	if err := fake.UpdateUniverse(false); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("Project %q is deprecated: it moved\nUse project \"successor\" instead.", localProjects[1].Name)
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("expected warning %q, got %q", want, buf.String())
+	}
+	if strings.Contains(buf.String(), fmt.Sprintf("Project %q is deprecated", localProjects[0].Name)) {
+		t.Errorf("unexpected warning about project %q: %q", localProjects[0].Name, buf.String())
+	}
+
+	projects, err := project.LocalProjects(fake.X, project.FullScan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := projects[localProjects[1].Key()]; p.Deprecated != "it moved" || p.Replacement != "successor" {
+		t.Errorf("got deprecated %q, replacement %q in the metadata of project %q", p.Deprecated, p.Replacement, p.Name)
+	}
+
+	findings, err := project.LintManifestFile(fake.X, fake.X.JiriManifestFile(), project.LintOptions{Resolve: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range findings {
+		if f.Check == "unknown-replacement" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an unknown-replacement finding, got %+v", findings)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+)
+
+// ProjectFile is a <copyfile> or <linkfile> element of a project. After the
+// project is checked out, its file Src is copied, or symlinked, to Dest,
+// e.g. to put a Makefile or a license file at the top of the jiri root. Src
+// is relative to the project and Dest to the jiri root.
+type ProjectFile struct {
+	Src  string `xml:"src,attr"`
+	Dest string `xml:"dest,attr"`
+}
+
+// installedFile is a file copied or linked by jiri, as recorded in
+// jirix.ProjectFilesFile(), keyed by its path relative to the jiri root.
+type installedFile struct {
+	Project ProjectKey `json:"project"`
+	// Src is the path of the file of the project, relative to the jiri
+	// root like the key.
+	Src  string `json:"src"`
+	Link bool   `json:"link,omitempty"`
+}
+
+// checkFiles returns an error if the copyfile or linkfile elements of p
+// refer to files outside of the project or of the jiri root.
+func (p Project) checkFiles() error {
+	for _, f := range append(append([]ProjectFile(nil), p.Copyfiles...), p.Linkfiles...) {
+		for _, path := range []string{f.Src, f.Dest} {
+			if path == "" || filepath.IsAbs(path) || path == ".." || strings.HasPrefix(filepath.Clean(path), ".."+string(filepath.Separator)) {
+				return fmt.Errorf("project %q copies or links invalid file %q, files should be relative paths inside the project and the jiri root", p.Name, path)
+			}
+		}
+	}
+	return nil
+}
+
+func readInstalledFiles(jirix *jiri.X) (map[string]installedFile, error) {
+	files := make(map[string]installedFile)
+	data, err := ioutil.ReadFile(jirix.ProjectFilesFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return nil, fmtError(err)
+	}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, fmtError(err)
+	}
+	return files, nil
+}
+
+// projectFiles returns the files copied or linked by projects, keyed by
+// their destination.
+func projectFiles(jirix *jiri.X, projects Projects) (map[string]installedFile, error) {
+	files := make(map[string]installedFile)
+	add := func(p Project, f ProjectFile, link bool) error {
+		dest := filepath.Clean(f.Dest)
+		if other, ok := files[dest]; ok {
+			return fmt.Errorf("file %q is copied or linked by both projects %q and %q", dest, other.Project, p.Key())
+		}
+		src, err := filepath.Rel(jirix.Root, filepath.Join(p.Path, f.Src))
+		if err != nil {
+			return fmtError(err)
+		}
+		files[dest] = installedFile{Project: p.Key(), Src: src, Link: link}
+		return nil
+	}
+	for _, p := range projects {
+		if p.LocalConfig.Ignore || p.LocalConfig.NoUpdate {
+			continue
+		}
+		for _, f := range p.Copyfiles {
+			if err := add(p, f, false); err != nil {
+				return nil, err
+			}
+		}
+		for _, f := range p.Linkfiles {
+			if err := add(p, f, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// linkTarget returns the target of the link dest to src: like repo, links
+// are relative so that the jiri root can be moved.
+func linkTarget(dest, src string) (string, error) {
+	return filepath.Rel(filepath.Dir(dest), src)
+}
+
+// fileDrift returns how the file dest differs from what f would install, or
+// an empty string if it does not.
+func fileDrift(jirix *jiri.X, dest string, f installedFile) (string, error) {
+	path, src := filepath.Join(jirix.Root, dest), filepath.Join(jirix.Root, f.Src)
+	if f.Link {
+		want, err := linkTarget(dest, f.Src)
+		if err != nil {
+			return "", err
+		}
+		got, err := os.Readlink(path)
+		if os.IsNotExist(err) {
+			return "missing", nil
+		} else if err != nil {
+			return "not a link", nil
+		} else if got != want {
+			return fmt.Sprintf("links to %s instead of %s", got, want), nil
+		}
+		return "", nil
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return "is a link", nil
+	}
+	want, err := ioutil.ReadFile(src)
+	if err != nil {
+		return "", fmtError(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "missing", nil
+	} else if err != nil {
+		return "", fmtError(err)
+	} else if !bytes.Equal(got, want) {
+		return "modified", nil
+	}
+	return "", nil
+}
+
+// installFile copies or links f to dest, unless it is already there.
+func installFile(jirix *jiri.X, dest string, f installedFile) error {
+	drift, err := fileDrift(jirix, dest, f)
+	if err != nil || drift == "" {
+		return err
+	}
+	path := filepath.Join(jirix.Root, dest)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmtError(err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmtError(err)
+	}
+	if f.Link {
+		target, err := linkTarget(dest, f.Src)
+		if err != nil {
+			return err
+		}
+		return fmtError(os.Symlink(target, path))
+	}
+	src := filepath.Join(jirix.Root, f.Src)
+	fi, err := os.Stat(src)
+	if err != nil {
+		return fmtError(err)
+	}
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmtError(err)
+	}
+	return fmtError(ioutil.WriteFile(path, data, fi.Mode().Perm()))
+}
+
+// updateProjectFiles copies and links the files of the copyfile and linkfile
+// elements of projects, and removes the files jiri copied or linked before
+// for projects or elements which are gone.
+func updateProjectFiles(jirix *jiri.X, projects Projects) error {
+	jirix.TimerPush("project files")
+	defer jirix.TimerPop()
+	files, err := projectFiles(jirix, projects)
+	if err != nil {
+		return err
+	}
+	installed, err := readInstalledFiles(jirix)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && len(installed) == 0 {
+		return nil
+	}
+	multiErr := make(MultiError, 0)
+	for dest, f := range installed {
+		if _, ok := files[dest]; ok {
+			continue
+		}
+		if p, ok := projects[f.Project]; ok && (p.LocalConfig.Ignore || p.LocalConfig.NoUpdate) {
+			// Leave the files of projects jiri does not update alone.
+			files[dest] = f
+			continue
+		}
+		jirix.Logger.Debugf("removing file %q of project %q", dest, f.Project)
+		if err := os.Remove(filepath.Join(jirix.Root, dest)); err != nil && !os.IsNotExist(err) {
+			multiErr = append(multiErr, fmtError(err))
+		}
+	}
+	for dest, f := range files {
+		if err := installFile(jirix, dest, f); err != nil {
+			multiErr = append(multiErr, fmt.Errorf("copying or linking file %q of project %q failed: %v", dest, f.Project, err))
+		}
+	}
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return fmtError(err)
+	}
+	if err := safeWriteFile(jirix, jirix.ProjectFilesFile(), data); err != nil {
+		multiErr = append(multiErr, err)
+	}
+	if len(multiErr) != 0 {
+		return multiErr
+	}
+	return nil
+}
+
+// ProjectFilesDrift returns the files copied or linked by the copyfile and
+// linkfile elements of p which are missing or were modified since, each with
+// a description of how it changed.
+func ProjectFilesDrift(jirix *jiri.X, p Project) ([]string, error) {
+	files, err := projectFiles(jirix, Projects{p.Key(): p})
+	if err != nil {
+		return nil, err
+	}
+	var drifts []string
+	for dest, f := range files {
+		drift, err := fileDrift(jirix, dest, f)
+		if err != nil {
+			return nil, err
+		}
+		if drift != "" {
+			drifts = append(drifts, fmt.Sprintf("%s: %s", dest, drift))
+		}
+	}
+	sort.Strings(drifts)
+	return drifts, nil
+}
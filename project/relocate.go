@@ -0,0 +1,152 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+)
+
+// Relocate rewrites the absolute references to oldRoot left in the jiri root
+// by older versions of jiri, once the root was moved from oldRoot to
+// jirix.Root. The project paths of the project metadata, .jiri_manifest and
+// the update history snapshots are made relative to the root, while the jiri
+// config, the update history links and the git alternates and gitdir files of
+// the projects are pointed to jirix.Root. oldRoot can be jirix.Root, to only
+// make the paths relative. Relocate returns the files it rewrote.
+func Relocate(jirix *jiri.X, oldRoot string) ([]string, error) {
+	if err := jirix.CheckWrite(jirix.Root, "relocate"); err != nil {
+		return nil, err
+	}
+	oldRoot = filepath.Clean(oldRoot)
+	relative := strings.NewReplacer(`"`+oldRoot+`/`, `"`, `"`+oldRoot+`"`, `"."`)
+	var rewritten []string
+	rewrite := func(file string, fn func(string) string) error {
+		changed, err := rewriteFile(file, fn)
+		if changed {
+			rewritten = append(rewritten, file)
+		}
+		return err
+	}
+
+	if err := rewrite(jirix.JiriManifestFile(), relative.Replace); err != nil {
+		return rewritten, err
+	}
+	config := strings.NewReplacer(">"+oldRoot+"/", ">"+jirix.Root+"/", ">"+oldRoot+"<", ">"+jirix.Root+"<")
+	if err := rewrite(filepath.Join(jirix.RootMetaDir(), jiri.ConfigFile), config.Replace); err != nil {
+		return rewritten, err
+	}
+	for _, dir := range []string{jirix.UpdateHistoryDir(), jirix.UpdateHistoryLogDir()} {
+		fileInfos, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return rewritten, fmtError(err)
+		}
+		for _, fi := range fileInfos {
+			file := filepath.Join(dir, fi.Name())
+			if fi.Mode()&os.ModeSymlink != 0 {
+				changed, err := relocateLink(jirix, oldRoot, file)
+				if changed {
+					rewritten = append(rewritten, file)
+				}
+				if err != nil {
+					return rewritten, err
+				}
+			} else if fi.Mode().IsRegular() && dir == jirix.UpdateHistoryDir() {
+				if err := rewrite(file, relative.Replace); err != nil {
+					return rewritten, err
+				}
+			}
+		}
+	}
+
+	// Walk the projects, which can be nested.
+	gitdir := strings.NewReplacer("gitdir: "+oldRoot+"/", "gitdir: "+jirix.Root+"/")
+	alternates := func(data string) string {
+		lines := strings.Split(data, "\n")
+		for i, line := range lines {
+			if strings.HasPrefix(line, oldRoot+"/") {
+				lines[i] = jirix.Root + strings.TrimPrefix(line, oldRoot)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		gitPath := filepath.Join(dir, ".git")
+		if fi, err := os.Lstat(gitPath); err == nil {
+			if fi.IsDir() {
+				if err := rewrite(filepath.Join(dir, jiri.ProjectMetaDir, jiri.ProjectMetaFile), relative.Replace); err != nil {
+					return err
+				}
+				if err := rewrite(filepath.Join(gitPath, "objects", "info", "alternates"), alternates); err != nil {
+					return err
+				}
+			} else if err := rewrite(gitPath, gitdir.Replace); err != nil {
+				return err
+			}
+		}
+		fileInfos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsPermission(err) {
+				return nil
+			}
+			return fmtError(err)
+		}
+		for _, fi := range fileInfos {
+			if fi.IsDir() && !strings.HasPrefix(fi.Name(), ".") {
+				if err := walk(filepath.Join(dir, fi.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return rewritten, walk(jirix.Root)
+}
+
+// rewriteFile replaces the content of file by fn of it, if it exists and
+// fn changes it, and returns whether it did.
+func rewriteFile(file string, fn func(string) string) (bool, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmtError(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, fmtError(err)
+	}
+	newData := fn(string(data))
+	if newData == string(data) {
+		return false, nil
+	}
+	return true, fmtError(ioutil.WriteFile(file, []byte(newData), fi.Mode().Perm()))
+}
+
+// relocateLink points link to the new location of its target, relatively,
+// if its target is an absolute path under oldRoot.
+func relocateLink(jirix *jiri.X, oldRoot, link string) (bool, error) {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return false, fmtError(err)
+	}
+	if !strings.HasPrefix(target, oldRoot+string(filepath.Separator)) {
+		return false, nil
+	}
+	newTarget := filepath.Join(jirix.Root, strings.TrimPrefix(target, oldRoot))
+	if rel, err := filepath.Rel(filepath.Dir(link), newTarget); err == nil {
+		newTarget = rel
+	}
+	if err := os.Remove(link); err != nil {
+		return false, fmtError(err)
+	}
+	return true, fmtError(os.Symlink(newTarget, link))
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/gitutil"
+	"github.com/btwiuse/jiri/osutil"
+)
+
+// fetchScheduler holds back the fetches and clones of "jiri update" to keep
+// the data they download around jirix.MaxBandwidth bytes per second on average,
+// and stops them when less than jirix.MinFreeDisk bytes are free. It paces the
+// start of fetches and does not slow down a fetch in progress.
+type fetchScheduler struct {
+	jirix *jiri.X
+	start time.Time
+
+	mu sync.Mutex
+	// fetched is the number of bytes downloaded so far, estimated by the
+	// growth of the object stores of the fetched projects.
+	fetched int64
+}
+
+func newFetchScheduler(jirix *jiri.X) *fetchScheduler {
+	return &fetchScheduler{jirix: jirix, start: time.Now()}
+}
+
+// orderFetches sorts keys by the size of their projects as of their last
+// fetch recorded in state, smallest first, so that most projects are fetched
+// before a limit is hit. Projects which were never fetched come last.
+func orderFetches(state *updateState, keys []ProjectKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := state.Projects[keys[i]].Size, state.Projects[keys[j]].Size
+		switch {
+		case si == sj:
+			return keys[i] < keys[j]
+		case si == 0 || sj == 0:
+			return sj == 0
+		}
+		return si < sj
+	})
+}
+
+// wait returns when the next fetch or clone can start, pausing as long as
+// needed to keep to jirix.MaxBandwidth, or returns an error if the disk is full.
+func (s *fetchScheduler) wait() error {
+	if err := checkFreeDisk(s.jirix); err != nil {
+		return err
+	}
+	if s.jirix.MaxBandwidth == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	fetched := s.fetched
+	s.mu.Unlock()
+	due := time.Duration(float64(fetched) / float64(s.jirix.MaxBandwidth) * float64(time.Second))
+	if d := due - time.Since(s.start); d > 0 {
+		s.jirix.Logger.Infof("Pausing fetches for %s to keep to %d KiB/s", d.Round(time.Second), s.jirix.MaxBandwidth/1024)
+		time.Sleep(d)
+	}
+	return nil
+}
+
+// measure runs fetch, which fetches or clones the project at dir, and
+// accounts for the data it downloads.
+func (s *fetchScheduler) measure(dir string, fetch func() error) error {
+	if s.jirix.MaxBandwidth == 0 {
+		return fetch()
+	}
+	scm := gitutil.New(s.jirix, gitutil.RootDirOpt(dir))
+	// before is 0 for a clone, as dir does not exist yet.
+	before, _ := scm.ObjectsSize()
+	err := fetch()
+	if after, sizeErr := scm.ObjectsSize(); sizeErr == nil && after > before {
+		s.mu.Lock()
+		s.fetched += after - before
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// checkFreeDisk returns an error if less than jirix.MinFreeDisk bytes are
+// free on the file system of the jiri root.
+func checkFreeDisk(jirix *jiri.X) error {
+	if jirix.MinFreeDisk == 0 {
+		return nil
+	}
+	free, err := osutil.FreeDiskSpace(jirix.Root)
+	if err != nil {
+		jirix.Logger.Debugf("cannot get free disk space: %v", err)
+		return nil
+	}
+	if free < jirix.MinFreeDisk {
+		return fmt.Errorf("only %d MiB free on the disk of %s, less than the %d MiB of -min-free-disk. Free some disk space and run 'jiri update' again", free>>20, jirix.Root, jirix.MinFreeDisk>>20)
+	}
+	return nil
+}
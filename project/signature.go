@@ -0,0 +1,171 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+)
+
+// SignatureSuffix is appended to the name of a snapshot file to get the name
+// of its detached signature.
+const SignatureSuffix = ".asc"
+
+// SignSnapshot writes an armored detached GPG signature of the snapshot file
+// to file+SignatureSuffix. If key is not empty, it selects the signing key,
+// otherwise the default key of gpg is used.
+func SignSnapshot(jirix *jiri.X, file, key string) error {
+	args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", file + SignatureSuffix}
+	if key != "" {
+		args = append(args, "--local-user", key)
+	}
+	args = append(args, file)
+	if _, err := runGPG(jirix, args...); err != nil {
+		return fmt.Errorf("signing snapshot %q failed: %v", file, err)
+	}
+	return nil
+}
+
+// readTrustedSigners returns the fingerprints listed in the snapshot signers
+// file, or nil if it does not exist. Blank lines and lines starting with '#'
+// are ignored.
+func readTrustedSigners(jirix *jiri.X) ([]string, error) {
+	f, err := os.Open(jirix.SnapshotSignersFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmtError(err)
+	}
+	defer f.Close()
+	var signers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		signers = append(signers, strings.ToUpper(strings.Replace(line, " ", "", -1)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmtError(err)
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("%s does not list any signer", jirix.SnapshotSignersFile())
+	}
+	return signers, nil
+}
+
+// verifySnapshot checks that the detached signature sigFile of the snapshot
+// file was made by one of the trusted signers, and returns the fingerprint of
+// the signing key.
+func verifySnapshot(jirix *jiri.X, file, sigFile string, signers []string) (string, error) {
+	// With --status-fd, gpg reports a good signature as
+	// "[GNUPG:] VALIDSIG <fingerprint> ... <primary key fingerprint>".
+	out, err := runGPG(jirix, "--batch", "--status-fd", "1", "--verify", sigFile, file)
+	if err != nil {
+		return "", fmt.Errorf("signature verification of snapshot failed: %v", err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "[GNUPG:]" || fields[1] != "VALIDSIG" {
+			continue
+		}
+		for _, fingerprint := range []string{fields[2], fields[len(fields)-1]} {
+			for _, signer := range signers {
+				if strings.ToUpper(fingerprint) == signer {
+					return fingerprint, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("snapshot is signed by %s, which is not listed in %s", fields[2], jirix.SnapshotSignersFile())
+	}
+	return "", fmt.Errorf("no valid signature found for snapshot")
+}
+
+// verifiedSnapshot verifies the signature of the snapshot if the jiri root
+// has a snapshot signers file, and returns the path of the snapshot file to
+// load. Snapshots given as URLs are downloaded along with their signature, and
+// the returned cleanup function removes the downloaded files.
+func verifiedSnapshot(jirix *jiri.X, snapshot string) (string, func(), error) {
+	signers, err := readTrustedSigners(jirix)
+	if err != nil || signers == nil {
+		return snapshot, func() {}, err
+	}
+	file, sigFile := snapshot, snapshot+SignatureSuffix
+	cleanup := func() {}
+	if _, err := os.Stat(snapshot); err != nil {
+		if !os.IsNotExist(err) {
+			return "", nil, fmtError(err)
+		}
+		u, err := url.ParseRequestURI(snapshot)
+		if err != nil {
+			return "", nil, fmt.Errorf("%q is neither a URL nor a valid file path", snapshot)
+		}
+		if file, err = downloadToTempFile(u.String()); err != nil {
+			return "", nil, err
+		}
+		if sigFile, err = downloadToTempFile(u.String() + SignatureSuffix); err != nil {
+			os.Remove(file)
+			return "", nil, err
+		}
+		cleanup = func() {
+			os.Remove(file)
+			os.Remove(sigFile)
+		}
+	} else if _, err := os.Stat(sigFile); err != nil {
+		return "", nil, fmt.Errorf("snapshot %q has no signature %q, which is required by %s", snapshot, sigFile, jirix.SnapshotSignersFile())
+	}
+	fingerprint, err := verifySnapshot(jirix, file, sigFile, signers)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	jirix.Logger.Infof("Snapshot %q is signed by %s\n", snapshot, fingerprint)
+	return file, cleanup, nil
+}
+
+func downloadToTempFile(u string) (string, error) {
+	resp, err := http.Get(u)
+	if err != nil {
+		return "", fmt.Errorf("Error getting %q: %v", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error getting %q: %s", u, resp.Status)
+	}
+	tmpFile, err := ioutil.TempFile("", "snapshot")
+	if err != nil {
+		return "", fmt.Errorf("Error creating tmp file: %v", err)
+	}
+	defer tmpFile.Close()
+	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("Error writing to tmp file: %v", err)
+	}
+	return tmpFile.Name(), nil
+}
+
+func runGPG(jirix *jiri.X, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	jirix.Logger.Tracef("Run: gpg %s", strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -187,6 +187,9 @@ func NewSourceManifest(jirix *jiri.X, projects Projects) (*SourceManifest, Multi
 }
 
 func (sm *SourceManifest) ToFile(jirix *jiri.X, filename string) error {
+	if err := jirix.CheckWrite(filename, "write source manifest"); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
 		return fmtError(err)
 	}
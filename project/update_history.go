@@ -0,0 +1,178 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btwiuse/jiri"
+)
+
+// preUpdateSuffix ends the names of the snapshots taken before updates.
+const preUpdateSuffix = ".pre"
+
+// HistorySnapshot is a snapshot of the update history.
+type HistorySnapshot struct {
+	// ID is the name of the snapshot file in the update history directory.
+	ID   string
+	Time time.Time
+	// PreUpdate is true for the snapshots taken before an update, false for
+	// the ones taken after.
+	PreUpdate bool
+}
+
+// Path returns the path of the snapshot file.
+func (s HistorySnapshot) Path(jirix *jiri.X) string {
+	return filepath.Join(jirix.UpdateHistoryDir(), s.ID)
+}
+
+// UpdateHistory returns the snapshots of the update history, oldest first.
+func UpdateHistory(jirix *jiri.X) ([]HistorySnapshot, error) {
+	infos, err := ioutil.ReadDir(jirix.UpdateHistoryDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmtError(err)
+	}
+	var snapshots []HistorySnapshot
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		s := HistorySnapshot{ID: info.Name()}
+		name := info.Name()
+		if strings.HasSuffix(name, preUpdateSuffix) {
+			s.PreUpdate = true
+			name = strings.TrimSuffix(name, preUpdateSuffix)
+		}
+		if s.Time, err = time.Parse(time.RFC3339, name); err != nil {
+			continue
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if !snapshots[i].Time.Equal(snapshots[j].Time) {
+			return snapshots[i].Time.Before(snapshots[j].Time)
+		}
+		// An update taking less than a second starts before it ends.
+		return snapshots[i].PreUpdate && !snapshots[j].PreUpdate
+	})
+	return snapshots, nil
+}
+
+// WritePreUpdateSnapshot records the revisions of the local projects in the
+// update history before an update, so that "jiri rollback" can undo it. Unlike
+// WriteUpdateHistorySnapshot, it only lists projects, and does not move the
+// latest links. Nothing is written if there are no local projects yet.
+func WritePreUpdateSnapshot(jirix *jiri.X) error {
+	jirix.TimerPush("pre-update snapshot")
+	defer jirix.TimerPop()
+
+	localProjects, err := LocalProjects(jirix, FastScan)
+	if err != nil {
+		return err
+	}
+	if len(localProjects) == 0 {
+		return nil
+	}
+	manifest := Manifest{
+		Version:    ManifestVersion,
+		Attributes: jirix.FetchingAttrs,
+	}
+	for _, p := range localProjects {
+		manifest.Projects = append(manifest.Projects, p)
+	}
+	sort.Sort(ProjectsByPath(manifest.Projects))
+	if err := os.MkdirAll(jirix.UpdateHistoryDir(), 0755); err != nil {
+		return fmtError(err)
+	}
+	file := filepath.Join(jirix.UpdateHistoryDir(), time.Now().Format(time.RFC3339)+preUpdateSuffix)
+	if err := manifest.ToFile(jirix, file); err != nil {
+		return err
+	}
+	return PruneUpdateHistory(jirix)
+}
+
+// PruneUpdateHistory removes the oldest snapshots of the update history, so
+// that jirix.UpdateHistoryDepth snapshots of each kind, pre-update and
+// post-update, are left. The snapshots the latest links point to are kept.
+func PruneUpdateHistory(jirix *jiri.X) error {
+	depth := jirix.UpdateHistoryDepth
+	if depth <= 0 {
+		depth = jiri.DefaultUpdateHistoryDepth
+	}
+	snapshots, err := UpdateHistory(jirix)
+	if err != nil {
+		return err
+	}
+	linked := make(map[string]bool)
+	for _, link := range []string{jirix.UpdateHistoryLatestLink(), jirix.UpdateHistorySecondLatestLink()} {
+		if target, err := os.Readlink(link); err == nil {
+			linked[filepath.Base(target)] = true
+		}
+	}
+	kept := map[bool]int{}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		if kept[s.PreUpdate] < depth || linked[s.ID] {
+			kept[s.PreUpdate]++
+			continue
+		}
+		if err := os.Remove(s.Path(jirix)); err != nil {
+			return fmtError(err)
+		}
+	}
+	return nil
+}
+
+// RollbackTarget returns the snapshot of the update history with the given
+// id or, if id is empty, the one taken before the last update.
+func RollbackTarget(jirix *jiri.X, id string) (HistorySnapshot, error) {
+	snapshots, err := UpdateHistory(jirix)
+	if err != nil {
+		return HistorySnapshot{}, err
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		s := snapshots[i]
+		if (id == "" && s.PreUpdate) || s.ID == id {
+			return s, nil
+		}
+	}
+	if id == "" {
+		return HistorySnapshot{}, fmt.Errorf("no pre-update snapshot found in %s", jirix.UpdateHistoryDir())
+	}
+	return HistorySnapshot{}, fmt.Errorf("no snapshot %q found in %s", id, jirix.UpdateHistoryDir())
+}
+
+// Rollback checks out the projects at the revisions recorded in the given
+// snapshot of the update history. Unlike CheckoutSnapshot, it does not
+// require the snapshot to be signed, as jiri wrote it. With gc, the projects
+// which are not in the snapshot are deleted.
+func Rollback(jirix *jiri.X, s HistorySnapshot, gc, runHooks, fetchPkgs bool, runHookTimeout, fetchTimeout uint) error {
+	jirix.UsingSnapshot = true
+	scanMode := FastScan
+	if gc {
+		scanMode = FullScan
+	}
+	localProjects, err := LocalProjects(jirix, scanMode)
+	if err != nil {
+		return err
+	}
+	remoteProjects, hooks, pkgs, err := LoadSnapshotFile(jirix, s.Path(jirix))
+	if err != nil {
+		return err
+	}
+	if err := updateProjects(jirix, localProjects, remoteProjects, hooks, pkgs, gc, runHookTimeout, fetchTimeout, false /*rebaseTracked*/, false /*rebaseUntracked*/, false /*rebaseAll*/, true /*snapshot*/, runHooks, fetchPkgs, nil); err != nil {
+		return err
+	}
+	return WriteUpdateHistorySnapshot(jirix, "", hooks, pkgs, false)
+}
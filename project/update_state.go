@@ -0,0 +1,166 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/gitutil"
+)
+
+// fetchRecord is the state of a project as of its last successful fetch.
+type fetchRecord struct {
+	Remote    string    `json:"remote"`
+	Branch    string    `json:"branch"`
+	Revision  string    `json:"revision"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// Size is the size in bytes of the objects of the project after the
+	// fetch, which estimates the size of its next fetches.
+	Size int64 `json:"size,omitempty"`
+}
+
+// updateState is the content of jirix.UpdateStateFile(), keyed by project
+// key.
+type updateState struct {
+	Projects map[ProjectKey]fetchRecord `json:"projects"`
+	mu       sync.Mutex
+}
+
+func loadUpdateState(jirix *jiri.X) (*updateState, error) {
+	state := &updateState{Projects: make(map[ProjectKey]fetchRecord)}
+	data, err := ioutil.ReadFile(jirix.UpdateStateFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmtError(err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		// The state is only an optimization, start over if it is corrupt.
+		jirix.Logger.Warningf("Ignoring invalid update state %s: %v\n\n", jirix.UpdateStateFile(), err)
+		return &updateState{Projects: make(map[ProjectKey]fetchRecord)}, nil
+	}
+	if state.Projects == nil {
+		state.Projects = make(map[ProjectKey]fetchRecord)
+	}
+	return state, nil
+}
+
+func (s *updateState) write(jirix *jiri.X) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmtError(err)
+	}
+	return safeWriteFile(jirix, jirix.UpdateStateFile(), data)
+}
+
+// record saves the revision of the remote branch of project after a fetch.
+func (s *updateState) record(jirix *jiri.X, project Project, branch string) error {
+	scm := gitutil.New(jirix, gitutil.RootDirOpt(project.Path))
+	rev, err := scm.CurrentRevisionForRef("remotes/origin/" + branch)
+	if err != nil {
+		return err
+	}
+	size, err := scm.ObjectsSize()
+	if err != nil {
+		jirix.Logger.Debugf("could not get the size of project %q: %v", project.Name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Projects[project.Key()] = fetchRecord{
+		Remote:    project.Remote,
+		Branch:    branch,
+		Revision:  rev,
+		FetchedAt: time.Now(),
+		Size:      size,
+	}
+	return nil
+}
+
+// unchangedProjects returns the keys of the local projects at HEAD whose
+// remote branch still points at the revision recorded in the state. Remote
+// heads are listed with one "git ls-remote" per remote repository. Projects
+// whose remote cannot be listed are treated as changed.
+func (s *updateState) unchangedProjects(jirix *jiri.X, localProjects, remoteProjects Projects) map[ProjectKey]bool {
+	jirix.TimerPush("list remote heads")
+	defer jirix.TimerPop()
+
+	branches := make(map[string]map[string]bool)
+	for key, local := range localProjects {
+		remote, ok := remoteProjects[key]
+		if !ok || remote.Revision != "HEAD" || remote.Remote != local.Remote {
+			continue
+		}
+		if _, ok := s.Projects[key]; !ok {
+			continue
+		}
+		r := rewriteRemote(jirix, remote.Remote)
+		if branches[r] == nil {
+			branches[r] = make(map[string]bool)
+		}
+		branches[r][remote.RemoteBranch] = true
+	}
+
+	type result struct {
+		remote string
+		heads  map[string]string
+	}
+	remotes := make(chan string, len(branches))
+	results := make(chan result, len(branches))
+	var wg sync.WaitGroup
+	for i := uint(0); i < jirix.Jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range remotes {
+				var bs []string
+				for b := range branches[r] {
+					bs = append(bs, b)
+				}
+				heads, err := gitutil.New(jirix, gitutil.TerminalPromptOpt(false)).LsRemoteHeads(r, bs...)
+				if err != nil {
+					jirix.Logger.Debugf("listing heads of %s failed: %v", r, err)
+					continue
+				}
+				results <- result{r, heads}
+			}
+		}()
+	}
+	for r := range branches {
+		remotes <- r
+	}
+	close(remotes)
+	wg.Wait()
+	close(results)
+
+	heads := make(map[string]map[string]string)
+	for res := range results {
+		heads[res.remote] = res.heads
+	}
+	unchanged := make(map[ProjectKey]bool)
+	for key, local := range localProjects {
+		remote, ok := remoteProjects[key]
+		if !ok || remote.Revision != "HEAD" || remote.Remote != local.Remote {
+			continue
+		}
+		rec, ok := s.Projects[key]
+		if !ok {
+			continue
+		}
+		b := remote.RemoteBranch
+		rev, ok := heads[rewriteRemote(jirix, remote.Remote)][b]
+		if ok && rec.Remote == remote.Remote && rec.Branch == b && rec.Revision == rev {
+			unchanged[key] = true
+		}
+	}
+	return unchanged
+}
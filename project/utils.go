@@ -7,11 +7,12 @@ package project
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/btwiuse/jiri"
 	"github.com/btwiuse/jiri/gitutil"
@@ -38,12 +39,30 @@ func fmtError(err error) error {
 	return fmt.Errorf("%s:%d: %s", filepath.Base(file), line, err)
 }
 
+// safeWriteFile writes data to a temporary file next to filename, syncs it
+// to disk and renames it over filename, so that readers never observe a
+// partially written file.
 func safeWriteFile(jirix *jiri.X, filename string, data []byte) error {
+	if err := jirix.CheckWrite(filename, "write file"); err != nil {
+		return err
+	}
 	tmp := filename + ".tmp"
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
 		return fmtError(err)
 	}
-	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmtError(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmtError(err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmtError(err)
+	}
+	if err := f.Close(); err != nil {
 		return fmtError(err)
 	}
 	return fmtError(osutil.Rename(tmp, filename))
@@ -81,24 +100,99 @@ func fmtRevision(r string) string {
 	return r[:l]
 }
 
-// clone is a wrapper that reattempts a git clone operation on failure.
-func clone(jirix *jiri.X, repo, path string, opts ...gitutil.CloneOpt) error {
+// fetchRetryOpts returns the options used to retry git clone and fetch
+// operations of project p.
+func fetchRetryOpts(jirix *jiri.X, p Project) []retry.RetryOpt {
+	attempts := jirix.Attempts
+	if p.FetchAttempts != 0 {
+		attempts = p.FetchAttempts
+	}
+	return []retry.RetryOpt{retry.AttemptsOpt(attempts), retry.BackoffOpt(2)}
+}
+
+// fetchGit returns the git used to clone or fetch project p from dir.
+func fetchGit(jirix *jiri.X, p Project, dir string) *gitutil.Git {
+	return gitutil.New(jirix, gitutil.RootDirOpt(dir), gitutil.TerminalPromptOpt(false),
+		gitutil.TimeoutOpt(time.Duration(p.FetchTimeout)*time.Minute))
+}
+
+// clone is a wrapper that reattempts a git clone operation of project p on
+// failure.
+func clone(jirix *jiri.X, p Project, repo, path string, opts ...gitutil.CloneOpt) error {
 	msg := fmt.Sprintf("Cloning %s", repo)
 	t := jirix.Logger.TrackTime(msg)
 	defer t.Done()
-	return retry.Function(jirix, func() error {
-		return gitutil.New(jirix).Clone(repo, path, opts...)
-	}, msg, retry.AttemptsOpt(jirix.Attempts))
+	return withAuthHint(retry.Function(jirix, func() error {
+		err := fetchGit(jirix, p, "").Clone(repo, path, opts...)
+		if err != nil {
+			// A clone killed after the fetch timeout leaves a partial
+			// repository at path, which the next attempt, or the next
+			// mirror, would refuse to clone into.
+			if err2 := os.RemoveAll(path); err2 != nil {
+				jirix.Logger.Debugf("Removing partial clone %s failed: %v", path, err2)
+			}
+		}
+		return err
+	}, msg, fetchRetryOpts(jirix, p)...))
 }
 
-// fetch is a wrapper that reattempts a git fetch operation on failure.
-func fetch(jirix *jiri.X, path, remote string, opts ...gitutil.FetchOpt) error {
-	msg := fmt.Sprintf("Fetching for %s", path)
+// fetch is a wrapper that reattempts a git fetch operation of project p on
+// failure.
+func fetch(jirix *jiri.X, p Project, remote string, opts ...gitutil.FetchOpt) error {
+	msg := fmt.Sprintf("Fetching for %s", p.Path)
 	t := jirix.Logger.TrackTime(msg)
 	defer t.Done()
-	return retry.Function(jirix, func() error {
-		return gitutil.New(jirix, gitutil.RootDirOpt(path)).Fetch(remote, opts...)
-	}, msg, retry.AttemptsOpt(jirix.Attempts))
+	return withAuthHint(retry.Function(jirix, func() error {
+		return fetchGit(jirix, p, p.Path).Fetch(remote, opts...)
+	}, msg, fetchRetryOpts(jirix, p)...))
+}
+
+// withMirrors calls fn with the remote of project p and, if it fails, with
+// each of the mirrors of p in order until it succeeds.
+func withMirrors(jirix *jiri.X, p Project, remote string, fn func(remote string) error) error {
+	err := fn(remote)
+	if err == nil || p.Mirrors == "" {
+		return err
+	}
+	for _, mirror := range strings.Split(p.Mirrors, ",") {
+		if mirror = strings.TrimSpace(mirror); mirror == "" {
+			continue
+		}
+		jirix.Logger.Warningf("Fetching project %s(%s) from %s failed, trying mirror %s\n\n", p.Name, p.Path, remote, mirror)
+		if err2 := fn(rewriteRemote(jirix, mirror)); err2 != nil {
+			jirix.Logger.Debugf("Fetching project %s(%s) from mirror %s failed: %v", p.Name, p.Path, mirror, err2)
+			continue
+		}
+		jirix.Mirrors.Record(p.Path, mirror)
+		return nil
+	}
+	return err
+}
+
+// logMirrorsUsed reports the projects fetched from a mirror.
+func logMirrorsUsed(jirix *jiri.X) {
+	used := jirix.Mirrors.Used()
+	if len(used) == 0 {
+		return
+	}
+	var paths []string
+	for path := range used {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	msg := fmt.Sprintf("%d project(s) fetched from a mirror as their remote failed:", len(paths))
+	for _, path := range paths {
+		msg = fmt.Sprintf("%s\n%s: %s", msg, path, used[path])
+	}
+	jirix.Logger.Warningf("%s\n\n", msg)
+}
+
+// withAuthHint appends advice on fixing authentication failures to err.
+func withAuthHint(err error) error {
+	if hint := gitutil.AuthHint(err); hint != "" {
+		return fmt.Errorf("%v\n%s", err, hint)
+	}
+	return err
 }
 
 type MultiError []error
@@ -0,0 +1,146 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/btwiuse/jiri"
+	"github.com/btwiuse/jiri/gitutil"
+)
+
+// View is a named subset of the projects of a workspace, declared in the
+// .jiri_manifest file. Once a view is selected with "jiri init -view" or
+// "jiri view", "jiri update" only syncs the projects listed in it.
+type View struct {
+	Name     string        `xml:"name,attr"`
+	Projects []ViewProject `xml:"project"`
+	XMLName  struct{}      `xml:"view"`
+}
+
+// ViewProject is a project of a View. Sparse is an optional comma-separated
+// list of directories; when set, only these directories of the project are
+// checked out, using git sparse-checkout.
+type ViewProject struct {
+	Name    string   `xml:"name,attr"`
+	Sparse  string   `xml:"sparse,attr,omitempty"`
+	XMLName struct{} `xml:"project"`
+}
+
+// SparseDirs returns the directories listed in the Sparse attribute.
+func (p ViewProject) SparseDirs() []string {
+	var dirs []string
+	for _, dir := range strings.Split(p.Sparse, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// LoadViews returns the views declared in the .jiri_manifest file.
+func LoadViews(jirix *jiri.X) ([]View, error) {
+	m, err := ManifestFromFile(jirix, jirix.JiriManifestFile())
+	if err != nil {
+		return nil, err
+	}
+	return m.Views, nil
+}
+
+// FindView returns the view with the given name.
+func FindView(jirix *jiri.X, name string) (*View, error) {
+	views, err := LoadViews(jirix)
+	if err != nil {
+		return nil, err
+	}
+	for i := range views {
+		if views[i].Name == name {
+			return &views[i], nil
+		}
+	}
+	return nil, fmt.Errorf("view %q is not defined in %s", name, jirix.JiriManifestFile())
+}
+
+// filterViewProjects removes projects that are not part of the selected view
+// from projects, and returns the sparse checkout directories of the remaining
+// ones. Projects containing manifests are always kept, as they are needed to
+// load the manifest itself.
+func filterViewProjects(jirix *jiri.X, projects Projects) (map[ProjectKey][]string, error) {
+	if jirix.View == "" {
+		return nil, nil
+	}
+	view, err := FindView(jirix, jirix.View)
+	if err != nil {
+		return nil, err
+	}
+	inView := make(map[string]ViewProject)
+	for _, p := range view.Projects {
+		inView[p.Name] = p
+	}
+	var manifestDirs []string
+	for _, p := range projects {
+		if p.ManifestPath != "" {
+			manifestDirs = append(manifestDirs, filepath.Dir(p.ManifestPath))
+		}
+	}
+	sparse := make(map[ProjectKey][]string)
+	for key, p := range projects {
+		if vp, ok := inView[p.Name]; ok {
+			if dirs := vp.SparseDirs(); len(dirs) != 0 {
+				sparse[key] = dirs
+			}
+			continue
+		}
+		hostsManifest := false
+		for _, dir := range manifestDirs {
+			if dir == p.Path || strings.HasPrefix(dir, p.Path+string(filepath.Separator)) {
+				hostsManifest = true
+				break
+			}
+		}
+		if !hostsManifest {
+			jirix.Logger.Debugf("project %q is not in view %q", p.Name, jirix.View)
+			delete(projects, key)
+		}
+	}
+	return sparse, nil
+}
+
+// applySparseCheckouts restricts the working tree of projects listed in
+// sparse, and restores the full working tree of other projects that were
+// previously sparse.
+func applySparseCheckouts(jirix *jiri.X, projects Projects, sparse map[ProjectKey][]string) error {
+	jirix.TimerPush("sparse checkouts")
+	defer jirix.TimerPop()
+	multiErr := make(MultiError, 0)
+	for key, p := range projects {
+		if p.LocalConfig.Ignore || p.LocalConfig.NoUpdate {
+			continue
+		}
+		scm := gitutil.New(jirix, gitutil.RootDirOpt(p.Path))
+		if dirs, ok := sparse[key]; ok {
+			if err := scm.SparseCheckoutSet(dirs); err != nil {
+				multiErr = append(multiErr, fmt.Errorf("sparse checkout failed for %v: %v", p.Name, err))
+			}
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(p.Path, ".git", "info", "sparse-checkout")); err != nil {
+			continue
+		}
+		if val, err := scm.ConfigGetKey("core.sparseCheckout"); err != nil || val != "true" {
+			continue
+		}
+		if err := scm.SparseCheckoutDisable(); err != nil {
+			multiErr = append(multiErr, fmt.Errorf("disabling sparse checkout failed for %v: %v", p.Name, err))
+		}
+	}
+	if len(multiErr) != 0 {
+		return multiErr
+	}
+	return nil
+}
@@ -25,6 +25,12 @@ type IntervalOpt time.Duration
 
 func (i IntervalOpt) retryOpt() {}
 
+// BackoffOpt multiplies the interval by the given factor after each failed
+// attempt, for an exponential backoff.
+type BackoffOpt float64
+
+func (b BackoffOpt) retryOpt() {}
+
 const (
 	defaultAttempts = 3
 	defaultInterval = 5 * time.Second
@@ -34,12 +40,15 @@ const (
 // attempts at the given interval.
 func Function(jirix *jiri.X, fn func() error, task string, opts ...RetryOpt) error {
 	attempts, interval := defaultAttempts, defaultInterval
+	backoff := 1.0
 	for _, opt := range opts {
 		switch typedOpt := opt.(type) {
 		case AttemptsOpt:
 			attempts = int(typedOpt)
 		case IntervalOpt:
 			interval = time.Duration(typedOpt)
+		case BackoffOpt:
+			backoff = float64(typedOpt)
 		}
 	}
 
@@ -55,6 +64,7 @@ func Function(jirix *jiri.X, fn func() error, task string, opts ...RetryOpt) err
 			jirix.Logger.Errorf("%s\n\n", err)
 			jirix.Logger.Infof("Wait for %s before next attempt...: %s\n\n", interval, task)
 			time.Sleep(interval)
+			interval = time.Duration(float64(interval) * backoff)
 		}
 	}
 	if attempts > 1 {
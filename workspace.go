@@ -0,0 +1,198 @@
+// Copyright 2019 The Fuchsia Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jiri
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WorkspaceEnv is the environment variable selecting the jiri root of the
+// commands run without -root. It is the name of a registered workspace, or
+// the path of a jiri root.
+const WorkspaceEnv = "JIRI_WORKSPACE"
+
+// Workspace is a jiri root registered in the workspaces file of the user.
+type Workspace struct {
+	Name string `xml:"name,attr"`
+	Root string `xml:"root,attr"`
+}
+
+// Workspaces is the content of the workspaces file of the user, which lists
+// the jiri roots the user works in.
+type Workspaces struct {
+	// Active is the name of the workspace of the commands run outside of any
+	// jiri root.
+	Active     string      `xml:"active,attr,omitempty"`
+	Workspaces []Workspace `xml:"workspace"`
+	XMLName    struct{}    `xml:"workspaces"`
+}
+
+// WorkspacesFile returns the path to the workspaces file of the user, in
+// their configuration directory.
+func WorkspacesFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jiri", "workspaces"), nil
+}
+
+// ReadWorkspaces reads the workspaces file of the user. There are no
+// workspaces if it does not exist.
+func ReadWorkspaces() (*Workspaces, error) {
+	file, err := WorkspacesFile()
+	if err != nil {
+		return nil, err
+	}
+	ws := &Workspaces{}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ws, nil
+		}
+		return nil, err
+	}
+	if err := xml.Unmarshal(data, ws); err != nil {
+		return nil, fmt.Errorf("invalid workspaces file %s: %v", file, err)
+	}
+	return ws, nil
+}
+
+// Write writes ws to the workspaces file of the user.
+func (ws *Workspaces) Write() error {
+	file, err := WorkspacesFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	data, err := xml.MarshalIndent(ws, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// Lookup returns the workspace named name.
+func (ws *Workspaces) Lookup(name string) (Workspace, bool) {
+	for _, w := range ws.Workspaces {
+		if w.Name == name {
+			return w, true
+		}
+	}
+	return Workspace{}, false
+}
+
+// Add registers root as the workspace named name, replacing the workspace
+// with the same name, if any.
+func (ws *Workspaces) Add(name, root string) {
+	for i, w := range ws.Workspaces {
+		if w.Name == name {
+			ws.Workspaces[i].Root = root
+			return
+		}
+	}
+	ws.Workspaces = append(ws.Workspaces, Workspace{Name: name, Root: root})
+}
+
+// Remove unregisters the workspace named name, and returns whether it was
+// registered.
+func (ws *Workspaces) Remove(name string) bool {
+	for i, w := range ws.Workspaces {
+		if w.Name == name {
+			ws.Workspaces = append(ws.Workspaces[:i], ws.Workspaces[i+1:]...)
+			if ws.Active == name {
+				ws.Active = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterWorkspace registers root in the workspaces file of the user, named
+// after its base name, unless it is already registered.
+func RegisterWorkspace(root string) error {
+	ws, err := ReadWorkspaces()
+	if err != nil {
+		return err
+	}
+	for _, w := range ws.Workspaces {
+		if w.Root == root {
+			return nil
+		}
+	}
+	name := filepath.Base(root)
+	for i := 2; ; i++ {
+		if _, ok := ws.Lookup(name); !ok {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", filepath.Base(root), i)
+	}
+	ws.Add(name, root)
+	return ws.Write()
+}
+
+// isJiriRoot returns whether dir contains the jiri root metadata directory.
+func isJiriRoot(dir string) bool {
+	fi, err := os.Stat(filepath.Join(dir, RootMetaDir))
+	return err == nil && fi.IsDir()
+}
+
+// workspaceRoot returns the jiri root selected by $JIRI_WORKSPACE, or an
+// empty string if it is not set.
+func workspaceRoot() (string, error) {
+	ws := os.Getenv(WorkspaceEnv)
+	if ws == "" {
+		return "", nil
+	}
+	root := ws
+	if !strings.ContainsRune(ws, filepath.Separator) {
+		workspaces, err := ReadWorkspaces()
+		if err != nil {
+			return "", err
+		}
+		w, ok := workspaces.Lookup(ws)
+		if !ok {
+			return "", fmt.Errorf("unknown workspace %q in $%s, see 'jiri workspace list'", ws, WorkspaceEnv)
+		}
+		root = w.Root
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if root, err = cleanPath(root); err != nil {
+		return "", err
+	}
+	if !isJiriRoot(root) {
+		return "", fmt.Errorf("$%s selects %s, which is not a jiri root", WorkspaceEnv, root)
+	}
+	return root, nil
+}
+
+// activeWorkspaceRoot returns the root of the active workspace, or an empty
+// string if there is none.
+func activeWorkspaceRoot() (string, error) {
+	if _, err := WorkspacesFile(); err != nil {
+		// There is no configuration directory, hence no workspaces file.
+		return "", nil
+	}
+	workspaces, err := ReadWorkspaces()
+	if err != nil || workspaces.Active == "" {
+		return "", err
+	}
+	w, ok := workspaces.Lookup(workspaces.Active)
+	if !ok || !isJiriRoot(w.Root) {
+		return "", fmt.Errorf("active workspace %q is not a jiri root anymore, select another one with 'jiri workspace switch'", workspaces.Active)
+	}
+	return w.Root, nil
+}
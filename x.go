@@ -15,8 +15,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -25,6 +29,7 @@ import (
 	"github.com/btwiuse/jiri/color"
 	"github.com/btwiuse/jiri/envvar"
 	"github.com/btwiuse/jiri/log"
+	"github.com/btwiuse/jiri/metrics"
 	"github.com/btwiuse/jiri/timing"
 	"github.com/btwiuse/jiri/tool"
 )
@@ -51,6 +56,7 @@ type Config struct {
 	CipdParanoidMode  string `xml:"cipd_paranoid_mode,omitempty"`
 	CipdMaxThreads    int    `xml:"cipd_max_threads,omitempty"`
 	Shared            bool   `xml:"cache>shared,omitempty"`
+	Dissociate        bool   `xml:"cache>dissociate,omitempty"`
 	RewriteSsoToHttps bool   `xml:"rewriteSsoToHttps,omitempty"`
 	SsoCookiePath     string `xml:"SsoCookiePath,omitempty"`
 	LockfileEnabled   string `xml:"lockfile>enabled,omitempty"`
@@ -60,13 +66,56 @@ type Config struct {
 	AnalyticsOptIn    string `xml:"analytics>optin,omitempty"`
 	AnalyticsUserId   string `xml:"analytics>userId,omitempty"`
 	Partial           bool   `xml:"partial,omitempty"`
+	View              string `xml:"view,omitempty"`
 	// version user has opted-in to
 	AnalyticsVersion string `xml:"analytics>version,omitempty"`
 	KeepGitHooks     bool   `xml:"keepGitHooks,omitempty"`
+	Metrics          bool   `xml:"metrics,omitempty"`
+	// UpdateHistoryDepth is the number of snapshots of each kind, taken
+	// before and after updates, kept in the update history.
+	UpdateHistoryDepth int `xml:"updateHistoryDepth,omitempty"`
+	// Credentials configure how git authenticates to remote hosts.
+	Credentials []Credential `xml:"credentials>credential,omitempty"`
 
 	XMLName struct{} `xml:"config"`
 }
 
+// Credential configures the authentication of git to the HTTPS remotes of a
+// host. Helper is a git credential helper, see gitcredentials(7). TokenEnv is
+// the name of an environment variable holding an access token; the token,
+// along with Username, is handed to git through a credential helper, so that
+// it never appears on a command line.
+type Credential struct {
+	Host     string `xml:"host,attr"`
+	Helper   string `xml:"helper,attr,omitempty"`
+	Username string `xml:"username,attr,omitempty"`
+	TokenEnv string `xml:"tokenEnv,attr,omitempty"`
+}
+
+var (
+	envNameRE    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	credentialRE = regexp.MustCompile(`^[A-Za-z0-9.@_:-]+$`)
+)
+
+func (c Credential) validate() error {
+	if c.Host == "" || !credentialRE.MatchString(c.Host) {
+		return fmt.Errorf("'config>credentials>credential' has invalid host %q", c.Host)
+	}
+	if c.Helper != "" && strings.TrimSpace(c.Helper) == "" {
+		return fmt.Errorf("'config>credentials>credential' for %q has blank helper", c.Host)
+	}
+	if c.Helper == "" && c.TokenEnv == "" {
+		return fmt.Errorf("'config>credentials>credential' for %q needs a helper or a tokenEnv", c.Host)
+	}
+	if c.TokenEnv != "" && !envNameRE.MatchString(c.TokenEnv) {
+		return fmt.Errorf("'config>credentials>credential' for %q has invalid tokenEnv %q", c.Host, c.TokenEnv)
+	}
+	if c.Username != "" && !credentialRE.MatchString(c.Username) {
+		return fmt.Errorf("'config>credentials>credential' for %q has invalid username %q", c.Host, c.Username)
+	}
+	return nil
+}
+
 func (c *Config) Write(filename string) error {
 	if c.CachePath != "" {
 		var err error
@@ -108,6 +157,7 @@ type X struct {
 	CipdParanoidMode    bool
 	CipdMaxThreads      int
 	Shared              bool
+	Dissociate          bool
 	Jobs                uint
 	KeepGitHooks        bool
 	RewriteSsoToHttps   bool
@@ -117,10 +167,20 @@ type X struct {
 	Partial             bool
 	PrebuiltJSON        string
 	FetchingAttrs       string
+	View                string
+	Credentials         []Credential
 	UsingSnapshot       bool
 	UsingImportOverride bool
 	OverrideOptional    bool
 	IgnoreLockConflicts bool
+	Incremental         bool
+	MaxBandwidth        uint64
+	MinFreeDisk         uint64
+	Offline             bool
+	NoWrite             bool
+	OnConflict          string
+	ForceOnConflict     bool
+	UpdateHistoryDepth  int
 	Color               color.Color
 	Logger              *log.Logger
 	failures            uint32
@@ -128,6 +188,46 @@ type X struct {
 	cleanupFuncs        []func()
 	AnalyticsSession    *analytics_util.AnalyticsSession
 	OverrideWarned      bool
+	// Metrics collects per project timings when local metrics are enabled,
+	// it is nil otherwise.
+	Metrics *metrics.Recorder
+	// Mirrors records the mirrors projects were fetched from during a
+	// "jiri update", it is nil otherwise.
+	Mirrors *MirrorLog
+}
+
+// MirrorLog records the mirrors projects were fetched from, by project path.
+// Its methods are safe for concurrent use, and do nothing on a nil log.
+type MirrorLog struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+// Record records that the project at path was fetched from mirror.
+func (l *MirrorLog) Record(path, mirror string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.m == nil {
+		l.m = make(map[string]string)
+	}
+	l.m[path] = mirror
+}
+
+// Used returns the mirrors recorded so far, by project path.
+func (l *MirrorLog) Used() map[string]string {
+	used := make(map[string]string)
+	if l == nil {
+		return used
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for path, mirror := range l.m {
+		used[path] = mirror
+	}
+	return used
 }
 
 func (jirix *X) IncrementFailures() {
@@ -161,6 +261,9 @@ var (
 	showProgressFlag      bool
 	progessWindowSizeFlag uint
 	timeLogThresholdFlag  time.Duration
+	logFormatFlag         string
+	offlineFlag           bool
+	noWriteFlag           bool
 )
 
 // showRootFlag implements a flag that dumps the root dir and exits the
@@ -180,6 +283,10 @@ func (showRootFlag) Set(string) error {
 	return nil
 }
 
+// DefaultUpdateHistoryDepth is the number of snapshots of each kind kept in
+// the update history when the config does not set it.
+const DefaultUpdateHistoryDepth = 10
+
 var DefaultJobs = uint(runtime.NumCPU() * 2)
 
 func init() {
@@ -198,6 +305,9 @@ func init() {
 	flag.BoolVar(&quietVerboseFlag, "q", false, "Same as -quiet")
 	flag.BoolVar(&debugVerboseFlag, "v", false, "Print debug level output.")
 	flag.BoolVar(&traceVerboseFlag, "vv", false, "Print trace level output.")
+	flag.BoolVar(&offlineFlag, "offline", false, "Make jiri update, and the loading of manifests, work without network access, failing with a list of what is missing locally. Other commands, e.g. upload, still access the network.")
+	flag.BoolVar(&noWriteFlag, "no-write", false, "Do not modify the jiri root, its projects, manifests and cache. Commands that would modify them fail.")
+	flag.StringVar(&logFormatFlag, "log-format", "text", "Format of log output. Values can be text and json. json disables color and progress.")
 }
 
 // NewX returns a new execution environment, given a cmdline env.
@@ -207,6 +317,13 @@ func NewX(env *cmdline.Env) (*X, error) {
 	if cf != color.ColorAuto && cf != color.ColorAlways && cf != color.ColorNever {
 		return nil, env.UsageErrorf("invalid value of -color flag")
 	}
+	logFormat, err := log.ParseLogFormat(logFormatFlag)
+	if err != nil {
+		return nil, env.UsageErrorf("invalid value of -log-format flag: %s", err)
+	}
+	if logFormat == log.JSONFormat {
+		cf = color.ColorNever
+	}
 	color := color.NewColor(cf)
 
 	loggerLevel := log.InfoLevel
@@ -223,6 +340,7 @@ func NewX(env *cmdline.Env) (*X, error) {
 		progessWindowSizeFlag = 10
 	}
 	logger := log.NewLogger(loggerLevel, color, showProgressFlag, progessWindowSizeFlag, timeLogThresholdFlag, nil, nil)
+	logger.SetFormat(logFormat)
 
 	ctx := tool.NewContextFromEnv(env)
 	root, err := findJiriRoot(ctx.Timer())
@@ -242,6 +360,8 @@ func NewX(env *cmdline.Env) (*X, error) {
 		Color:    color,
 		Logger:   logger,
 		Attempts: 1,
+		Offline:  offlineFlag,
+		NoWrite:  noWriteFlag,
 	}
 	configPath := filepath.Join(x.RootMetaDir(), ConfigFile)
 	if _, err := os.Stat(configPath); err == nil {
@@ -256,6 +376,9 @@ func NewX(env *cmdline.Env) (*X, error) {
 	}
 	if x.config != nil {
 		x.KeepGitHooks = x.config.KeepGitHooks
+		if x.config.Metrics {
+			x.Metrics = metrics.NewRecorder()
+		}
 		x.RewriteSsoToHttps = x.config.RewriteSsoToHttps
 		x.SsoCookiePath = x.config.SsoCookiePath
 		if x.config.LockfileEnabled == "" {
@@ -277,9 +400,20 @@ func NewX(env *cmdline.Env) (*X, error) {
 			}
 		}
 		x.CipdMaxThreads = x.config.CipdMaxThreads
+		x.UpdateHistoryDepth = x.config.UpdateHistoryDepth
+		if x.UpdateHistoryDepth <= 0 {
+			x.UpdateHistoryDepth = DefaultUpdateHistoryDepth
+		}
 		x.LockfileName = x.config.LockfileName
 		x.PrebuiltJSON = x.config.PrebuiltJSON
 		x.FetchingAttrs = x.config.FetchingAttrs
+		x.View = x.config.View
+		for _, c := range x.config.Credentials {
+			if err := c.validate(); err != nil {
+				return nil, err
+			}
+		}
+		x.Credentials = x.config.Credentials
 		if x.LockfileName == "" {
 			x.LockfileName = "jiri.lock"
 		}
@@ -290,6 +424,7 @@ func NewX(env *cmdline.Env) (*X, error) {
 	x.Cache, err = findCache(root, x.config)
 	if x.config != nil {
 		x.Shared = x.config.Shared
+		x.Dissociate = x.config.Dissociate
 		x.Partial = x.config.Partial
 	}
 
@@ -360,6 +495,9 @@ func findJiriRoot(timer *timing.Timer) (string, error) {
 	if rootFlag != "" {
 		return cleanPath(rootFlag)
 	}
+	if root, err := workspaceRoot(); root != "" || err != nil {
+		return root, err
+	}
 
 	wd, err := os.Getwd()
 	if err != nil {
@@ -383,13 +521,15 @@ func findJiriRoot(timer *timing.Timer) (string, error) {
 	}
 
 	for _, path := range paths {
-		fi, err := os.Stat(filepath.Join(path, RootMetaDir))
-		if err == nil && fi.IsDir() {
+		if isJiriRoot(path) {
 			return path, nil
 		}
 	}
+	if root, err := activeWorkspaceRoot(); root != "" || err != nil {
+		return root, err
+	}
 
-	return "", fmt.Errorf("cannot find %v", RootMetaDir)
+	return "", fmt.Errorf("cannot find %v: run jiri inside a jiri root, select one with -root or $%s, or make a workspace active with 'jiri workspace switch'", RootMetaDir, WorkspaceEnv)
 }
 
 // FindRoot returns the root directory of the jiri environment.  All state
@@ -419,11 +559,21 @@ func (x *X) Clone(opts tool.ContextOpts) *X {
 		Cache:             x.Cache,
 		Color:             x.Color,
 		RewriteSsoToHttps: x.RewriteSsoToHttps,
+		Credentials:       x.Credentials,
 		Logger:            x.Logger,
 		failures:          x.failures,
 		Attempts:          x.Attempts,
+		Incremental:       x.Incremental,
+		MaxBandwidth:      x.MaxBandwidth,
+		MinFreeDisk:       x.MinFreeDisk,
+		Offline:           x.Offline,
+		NoWrite:           x.NoWrite,
+		OnConflict:        x.OnConflict,
+		ForceOnConflict:   x.ForceOnConflict,
 		cleanupFuncs:      x.cleanupFuncs,
 		AnalyticsSession:  x.AnalyticsSession,
+		Metrics:           x.Metrics,
+		Mirrors:           x.Mirrors,
 	}
 }
 
@@ -479,6 +629,49 @@ func (x *X) UpdateHistorySecondLatestLink() string {
 	return filepath.Join(x.UpdateHistoryDir(), "second-latest")
 }
 
+// LogsDir returns the path to the directory containing logs of failed
+// commands.
+func (x *X) LogsDir() string {
+	return filepath.Join(x.RootMetaDir(), "logs")
+}
+
+// SnapshotSignersFile returns the path to the file listing the fingerprints
+// of the keys trusted to sign snapshots.
+func (x *X) SnapshotSignersFile() string {
+	return filepath.Join(x.RootMetaDir(), "snapshot_signers")
+}
+
+// BranchesFile returns the path to the file recording the projects that
+// each branch created by "jiri branch -create" belongs to.
+func (x *X) BranchesFile() string {
+	return filepath.Join(x.RootMetaDir(), "branches.json")
+}
+
+// ProjectFilesFile returns the path to the file recording the files copied
+// or linked by the copyfile and linkfile elements of projects.
+func (x *X) ProjectFilesFile() string {
+	return filepath.Join(x.RootMetaDir(), "project_files.json")
+}
+
+// ManifestCacheFile returns the path to the file caching the manifest
+// resolved by the last command, along with the stamps of the files it was
+// loaded from.
+func (x *X) ManifestCacheFile() string {
+	return filepath.Join(x.RootMetaDir(), "manifest_cache")
+}
+
+// MetricsDir returns the path to the directory holding the local metrics
+// of jiri commands.
+func (x *X) MetricsDir() string {
+	return filepath.Join(x.RootMetaDir(), "metrics")
+}
+
+// UpdateStateFile returns the path to the file recording the remote
+// revision each project was last fetched at.
+func (x *X) UpdateStateFile() string {
+	return filepath.Join(x.RootMetaDir(), "update_state.json")
+}
+
 // UpdateHistoryLogDir returns the path to the update history directory.
 func (x *X) UpdateHistoryLogDir() string {
 	return filepath.Join(x.RootMetaDir(), "update_history_log")
@@ -496,6 +689,60 @@ func (x *X) UpdateHistoryLogSecondLatestLink() string {
 	return filepath.Join(x.UpdateHistoryLogDir(), "second-latest")
 }
 
+// maxFailureLogs is the number of logs of failed commands kept in LogsDir.
+const maxFailureLogs = 20
+
+// writeFailureLog saves the log buffer of a failed command under LogsDir,
+// so that it can be inspected after the fact, and removes the oldest logs
+// beyond maxFailureLogs.
+func (x *X) writeFailureLog(command string) {
+	command = strings.Replace(command, "->", "-", -1)
+	logFile := filepath.Join(x.LogsDir(), fmt.Sprintf("%s-%s.log", command, time.Now().Format("20060102T150405")))
+	if err := x.CheckWrite(logFile, "write log file"); err != nil {
+		x.Logger.Debugf("%s\n\n", err)
+		return
+	}
+	if err := os.MkdirAll(x.LogsDir(), 0755); err != nil {
+		x.Logger.Debugf("cannot create logs dir: %s\n\n", err)
+		return
+	}
+	if err := x.Logger.WriteLogToFile(logFile); err != nil {
+		x.Logger.Debugf("cannot write log file: %s\n\n", err)
+		return
+	}
+	x.Logger.Infof("Log of this run written to %s\n\n", logFile)
+	if err := x.pruneFailureLogs(maxFailureLogs); err != nil {
+		x.Logger.Debugf("cannot prune logs dir: %s\n\n", err)
+	}
+}
+
+// pruneFailureLogs removes the oldest logs of failed commands in LogsDir
+// beyond the latest keep ones.
+func (x *X) pruneFailureLogs(keep int) error {
+	infos, err := ioutil.ReadDir(x.LogsDir())
+	if err != nil {
+		return err
+	}
+	var logs []os.FileInfo
+	for _, info := range infos {
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), ".log") {
+			logs = append(logs, info)
+		}
+	}
+	if len(logs) <= keep {
+		return nil
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].ModTime().After(logs[j].ModTime())
+	})
+	for _, info := range logs[keep:] {
+		if err := os.Remove(filepath.Join(x.LogsDir(), info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // RunnerFunc is an adapter that turns regular functions into cmdline.Runner.
 // This is similar to cmdline.RunnerFunc, but the first function argument is
 // jiri.X, rather than cmdline.Env.
@@ -537,6 +784,9 @@ func (r runner) Run(env *cmdline.Env, args []string) error {
 
 	err = r(x, args)
 	x.Logger.DisableProgress()
+	if err != nil {
+		x.writeFailureLog(env.CommandName)
+	}
 
 	as.Done(id)
 	as.SendAllAndWaitToFinish()
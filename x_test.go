@@ -8,7 +8,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // TestFindRootEnvSymlink checks that FindRoot interprets the value of the
@@ -45,3 +47,155 @@ func TestFindRootEnvSymlink(t *testing.T) {
 		t.Fatalf("unexpected output: got %v, want %v", got, want)
 	}
 }
+
+func TestCredentialValidate(t *testing.T) {
+	valid := []Credential{
+		{Host: "github.com", TokenEnv: "GITHUB_TOKEN", Username: "x-access-token"},
+		{Host: "git.example.com:8443", Helper: "store"},
+	}
+	for _, c := range valid {
+		if err := c.validate(); err != nil {
+			t.Errorf("validate(%+v) failed: %v", c, err)
+		}
+	}
+	invalid := []Credential{
+		{Host: "", Helper: "store"},
+		{Host: "github.com"},
+		{Host: "github.com", Helper: " \t"},
+		{Host: "github.com", Helper: " ", TokenEnv: "TOKEN"},
+		{Host: "github.com", TokenEnv: "$(rm -rf ~)"},
+		{Host: "github.com", TokenEnv: "TOKEN", Username: "a'b"},
+		{Host: "github.com/path", Helper: "store"},
+	}
+	for _, c := range invalid {
+		if err := c.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded, want error", c)
+		}
+	}
+}
+
+func TestFindRootWorkspace(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	if err != nil {
+		t.Fatalf("EvalSymlinks(%v) failed: %v", tmpDir, err)
+	}
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, "config"))
+	defer os.Unsetenv(WorkspaceEnv)
+	rootFlag = ""
+
+	root := filepath.Join(tmpDir, "root")
+	if err := os.MkdirAll(filepath.Join(root, RootMetaDir), 0700); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := RegisterWorkspace(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterWorkspace(root); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := ReadWorkspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Workspace{{Name: "root", Root: root}}; !reflect.DeepEqual(ws.Workspaces, want) {
+		t.Fatalf("got workspaces %+v, want %+v", ws.Workspaces, want)
+	}
+
+	// Run from outside of any jiri root.
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findJiriRoot(nil); err == nil {
+		t.Errorf("expected an error outside of any jiri root")
+	}
+	for _, env := range []string{"root", root} {
+		os.Setenv(WorkspaceEnv, env)
+		if got, err := findJiriRoot(nil); err != nil || got != root {
+			t.Errorf("with $%s=%s: got %q, %v, want %q", WorkspaceEnv, env, got, err, root)
+		}
+	}
+	os.Setenv(WorkspaceEnv, "unknown")
+	if _, err := findJiriRoot(nil); err == nil {
+		t.Errorf("expected an error for an unknown workspace")
+	}
+	os.Unsetenv(WorkspaceEnv)
+
+	ws.Active = "root"
+	if err := ws.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := findJiriRoot(nil); err != nil || got != root {
+		t.Errorf("with an active workspace: got %q, %v, want %q", got, err, root)
+	}
+}
+
+func TestCheckWrite(t *testing.T) {
+	x := &X{Root: "/jiri", Cache: "/cache"}
+	if err := x.CheckWrite("/jiri/project", "write"); err != nil {
+		t.Errorf("expected no error without -no-write, got %v", err)
+	}
+	x.NoWrite = true
+	for _, path := range []string{"/jiri", "/jiri/project/file", "/cache/repo"} {
+		if err := x.CheckWrite(path, "write"); err == nil {
+			t.Errorf("expected writing %s to be refused", path)
+		} else if _, ok := err.(*NoWriteError); !ok {
+			t.Errorf("writing %s: got %T, want *NoWriteError", path, err)
+		}
+	}
+	for _, path := range []string{"/tmp/file", "/jiri-other/file", "/"} {
+		if err := x.CheckWrite(path, "write"); err != nil {
+			t.Errorf("expected writing %s to be allowed, got %v", path, err)
+		}
+	}
+}
+
+// TestPruneFailureLogs checks that pruneFailureLogs keeps the latest logs and
+// leaves other files alone.
+func TestPruneFailureLogs(t *testing.T) {
+	root, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	x := &X{Root: root}
+	if err := os.MkdirAll(x.LogsDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	names := []string{"update-1.log", "update-2.log", "upload-3.log", "notes.txt"}
+	for i, name := range names {
+		file := filepath.Join(x.LogsDir(), name)
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := x.pruneFailureLogs(2); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(x.LogsDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.Name())
+	}
+	if want := []string{"notes.txt", "update-2.log", "upload-3.log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}